@@ -40,7 +40,9 @@ type HMSActiveRoomQueryParam struct {
 	Role   string `form:"role,omitempty"`
 }
 
-var activeRoomBaseUrl = helpers.GetEndpointUrl("active-rooms")
+func activeRoomBaseUrl() string {
+	return helpers.GetEndpointUrl("active-rooms")
+}
 
 // Get active room details
 func GetActiveRoom(ctx *gin.Context) {
@@ -49,7 +51,7 @@ func GetActiveRoom(ctx *gin.Context) {
 		ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": hmserrors.ErrMissingRoomId})
 	}
 
-	helpers.MakeApiRequest(ctx, activeRoomBaseUrl+"/"+roomId, "GET", nil)
+	helpers.MakeApiRequest(ctx, activeRoomBaseUrl()+"/"+roomId, "GET", nil)
 }
 
 // Fetch a single peer's details
@@ -59,7 +61,7 @@ func GetPeer(ctx *gin.Context) {
 	if !ok || !ok1 {
 		ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": hmserrors.ErrMissingRoomIdAndPeerId})
 	}
-	helpers.MakeApiRequest(ctx, activeRoomBaseUrl+"/"+roomId+"/peers/"+peerId, "GET", nil)
+	helpers.MakeApiRequest(ctx, activeRoomBaseUrl()+"/"+roomId+"/peers/"+peerId, "GET", nil)
 }
 
 // List all peers details
@@ -77,7 +79,7 @@ func ListPeers(ctx *gin.Context) {
 		qs.Add("role", param.Role)
 	}
 
-	helpers.MakeApiRequest(ctx, activeRoomBaseUrl+"/"+roomId+"/peers"+"?"+qs.Encode(), "GET", nil)
+	helpers.MakeApiRequest(ctx, activeRoomBaseUrl()+"/"+roomId+"/peers"+"?"+qs.Encode(), "GET", nil)
 }
 
 // Update a single peer's details
@@ -101,7 +103,7 @@ func UpdatePeer(ctx *gin.Context) {
 	})
 
 	payload := bytes.NewBuffer(postBody)
-	helpers.MakeApiRequest(ctx, activeRoomBaseUrl+"/"+roomId+"/peers/"+peerId, "POST", payload)
+	helpers.MakeApiRequest(ctx, activeRoomBaseUrl()+"/"+roomId+"/peers/"+peerId, "POST", payload)
 }
 
 // Send a message
@@ -124,7 +126,7 @@ func SendMessage(ctx *gin.Context) {
 	})
 
 	payload := bytes.NewBuffer(postBody)
-	helpers.MakeApiRequest(ctx, activeRoomBaseUrl+"/"+roomId+"/send-message", "POST", payload)
+	helpers.MakeApiRequest(ctx, activeRoomBaseUrl()+"/"+roomId+"/send-message", "POST", payload)
 }
 
 // Remove a peer
@@ -145,7 +147,7 @@ func RemovePeer(ctx *gin.Context) {
 		Reason: rb.Reason,
 	})
 	payload := bytes.NewBuffer(postBody)
-	helpers.MakeApiRequest(ctx, activeRoomBaseUrl+"/"+roomId+"/remove-peers", "POST", payload)
+	helpers.MakeApiRequest(ctx, activeRoomBaseUrl()+"/"+roomId+"/remove-peers", "POST", payload)
 }
 
 // Remove a peer
@@ -166,5 +168,5 @@ func EndRoom(ctx *gin.Context) {
 	})
 	payload := bytes.NewBuffer(postBody)
 
-	helpers.MakeApiRequest(ctx, activeRoomBaseUrl+"/"+roomId+"/end-room", "POST", payload)
+	helpers.MakeApiRequest(ctx, activeRoomBaseUrl()+"/"+roomId+"/end-room", "POST", payload)
 }
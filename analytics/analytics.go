@@ -8,7 +8,9 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-var streamKeysBaseUrl = helpers.GetEndpointUrl("analytics")
+func streamKeysBaseUrl() string {
+	return helpers.GetEndpointUrl("analytics")
+}
 
 type HMSAnalyticsQueryParam struct {
 	Type      string `form:"type"`
@@ -33,5 +35,25 @@ func GetAnalyticsEvents(ctx *gin.Context) {
 		qs.Add("start", param.Start)
 		qs.Add("limit", strconv.Itoa(int(param.Limit)))
 	}
-	helpers.MakeApiRequest(ctx, streamKeysBaseUrl+"/events"+"?"+qs.Encode(), "GET", nil)
+	helpers.MakeApiRequest(ctx, streamKeysBaseUrl()+"/events"+"?"+qs.Encode(), "GET", nil)
+}
+
+// Export all analytics events as NDJSON or CSV
+// Applicable filters: type string, room_id string, session_id string, peer_id string, user_id string, after string, before string, format string, columns string
+func ExportAnalyticsEvents(ctx *gin.Context) {
+	var param HMSAnalyticsQueryParam
+	qs := url.Values{}
+	if ctx.BindQuery(&param) == nil {
+		qs.Add("type", param.Type)
+		qs.Add("room_id", param.RoomId)
+		qs.Add("session_id", param.SessionId)
+		qs.Add("peer_id", param.PeerId)
+		qs.Add("user_id", param.UserId)
+	}
+	helpers.ExportApiPages(ctx, streamKeysBaseUrl()+"/events", qs, helpers.ExportOptions{
+		ItemsKey:  "events",
+		CursorKey: "next",
+		TimeField: "timestamp",
+		Columns:   []string{"id", "type", "timestamp", "data.room_id", "data.session_id", "data.peer_id", "data.user_id", "data.user_name", "data.role", "data.duration"},
+	})
 }
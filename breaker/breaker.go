@@ -0,0 +1,159 @@
+package breaker
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"api/hmserrors"
+)
+
+type State int
+
+const (
+	Closed State = iota
+	Open
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+func (s State) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// Returned instead of calling 100ms while a breaker is open
+type OpenError struct {
+	Family     string
+	RetryAfter time.Duration
+}
+
+func (e *OpenError) Error() string {
+	return fmt.Sprintf("%s: %s", hmserrors.ErrCircuitOpen.Error(), e.Family)
+}
+
+func (e *OpenError) Unwrap() error {
+	return hmserrors.ErrCircuitOpen
+}
+
+// Point-in-time view of a breaker, used by the health and metrics endpoints
+type Snapshot struct {
+	Family     string `json:"family"`
+	State      State  `json:"state"`
+	Failures   int    `json:"failures"`
+	Opened     uint64 `json:"opened_total"`
+	RetryAfter int    `json:"retry_after,omitempty"`
+}
+
+// Opens after threshold consecutive failures, rejects calls for the cooldown,
+// then lets a single probe through to decide whether to close again
+type Breaker struct {
+	mu        sync.Mutex
+	family    string
+	threshold int
+	cooldown  time.Duration
+	state     State
+	failures  int
+	openedAt  time.Time
+	opened    uint64
+	probing   bool
+}
+
+func New(family string, threshold int, cooldown time.Duration) *Breaker {
+	if threshold < 1 {
+		threshold = 1
+	}
+	return &Breaker{
+		family:    family,
+		threshold: threshold,
+		cooldown:  cooldown,
+	}
+}
+
+func (b *Breaker) retryAfter(now time.Time) time.Duration {
+	wait := b.openedAt.Add(b.cooldown).Sub(now)
+	if wait < time.Second {
+		return time.Second
+	}
+	return wait
+}
+
+// Check whether a call may go ahead. Every allowed call must be followed by
+// Success, Failure or Cancel.
+func (b *Breaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	if b.state == Open && !now.Before(b.openedAt.Add(b.cooldown)) {
+		b.state = HalfOpen
+	}
+
+	switch b.state {
+	case Open:
+		return &OpenError{Family: b.family, RetryAfter: b.retryAfter(now)}
+	case HalfOpen:
+		if b.probing {
+			return &OpenError{Family: b.family, RetryAfter: time.Second}
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+func (b *Breaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.state = Closed
+	b.failures = 0
+	b.probing = false
+}
+
+func (b *Breaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	b.probing = false
+	if b.state == HalfOpen || b.failures >= b.threshold {
+		if b.state != Open {
+			b.opened++
+		}
+		b.state = Open
+		b.openedAt = time.Now()
+	}
+}
+
+// The call was abandoned by the caller and says nothing about 100ms
+func (b *Breaker) Cancel() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+}
+
+func (b *Breaker) Snapshot() Snapshot {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	snapshot := Snapshot{
+		Family:   b.family,
+		State:    b.state,
+		Failures: b.failures,
+		Opened:   b.opened,
+	}
+	if b.state == Open {
+		snapshot.RetryAfter = int(b.retryAfter(time.Now()).Seconds())
+	}
+	return snapshot
+}
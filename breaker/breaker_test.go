@@ -0,0 +1,102 @@
+package breaker
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"api/hmserrors"
+)
+
+// Outcomes of calls through a breaker: "s" success, "f" failure, "c" cancelled
+func run(b *Breaker, outcomes string) {
+	for _, outcome := range outcomes {
+		if b.Allow() != nil {
+			continue
+		}
+		switch outcome {
+		case 's':
+			b.Success()
+		case 'f':
+			b.Failure()
+		case 'c':
+			b.Cancel()
+		}
+	}
+}
+
+func TestBreakerStates(t *testing.T) {
+	tests := []struct {
+		name       string
+		threshold  int
+		outcomes   string
+		wantState  State
+		wantOpened uint64
+	}{
+		{"failures below the threshold", 3, "ff", Closed, 0},
+		{"consecutive failures open", 3, "fff", Open, 1},
+		{"a success resets the count", 3, "ffsff", Closed, 0},
+		{"cancelled calls do not count", 3, "ffccc", Closed, 0},
+		{"calls are rejected while open", 1, "fsss", Open, 1},
+		{"threshold below one opens on the first failure", 0, "f", Open, 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b := New("rooms", test.threshold, time.Minute)
+			run(b, test.outcomes)
+			snapshot := b.Snapshot()
+			if snapshot.State != test.wantState || snapshot.Opened != test.wantOpened {
+				t.Errorf("%s opened %d times, want %s opened %d times", snapshot.State, snapshot.Opened, test.wantState, test.wantOpened)
+			}
+		})
+	}
+}
+
+func TestBreakerOpenError(t *testing.T) {
+	b := New("rooms", 1, time.Minute)
+	run(b, "f")
+	err := b.Allow()
+	var open *OpenError
+	if !errors.As(err, &open) || !errors.Is(err, hmserrors.ErrCircuitOpen) {
+		t.Fatalf("allow on an open breaker: %v", err)
+	}
+	if open.Family != "rooms" || open.RetryAfter <= 30*time.Second {
+		t.Errorf("open error %+v", open)
+	}
+	if retryAfter := b.Snapshot().RetryAfter; retryAfter < 59 {
+		t.Errorf("snapshot retry after %d", retryAfter)
+	}
+}
+
+func TestBreakerHalfOpen(t *testing.T) {
+	tests := []struct {
+		name       string
+		probe      string
+		wantState  State
+		wantOpened uint64
+	}{
+		{"successful probe closes", "s", Closed, 1},
+		{"failed probe opens again", "f", Open, 2},
+		{"cancelled probe lets another through", "cs", Closed, 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b := New("rooms", 1, time.Minute)
+			run(b, "f")
+			// Let the cooldown pass
+			b.openedAt = b.openedAt.Add(-time.Minute)
+
+			if err := b.Allow(); err != nil {
+				t.Fatalf("probe refused: %v", err)
+			}
+			if err := b.Allow(); err == nil {
+				t.Fatal("second call let through while probing")
+			}
+			b.Cancel()
+			run(b, test.probe)
+			if snapshot := b.Snapshot(); snapshot.State != test.wantState || snapshot.Opened != test.wantOpened {
+				t.Errorf("%s opened %d times, want %s opened %d times", snapshot.State, snapshot.Opened, test.wantState, test.wantOpened)
+			}
+		})
+	}
+}
@@ -0,0 +1,267 @@
+package cache
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type entry struct {
+	key         string
+	status      int
+	contentType string
+	body        []byte
+	etag        string
+	expires     time.Time
+	// Headers of a failed response, such as Retry-After, passed on to waiting requests
+	header http.Header
+}
+
+// A pending upstream request that identical misses wait on
+type call struct {
+	done       chan struct{}
+	entry      *entry
+	generation uint64
+}
+
+// An in-memory response cache, evicting the least recently used entry
+// once more than maxEntries responses are held. Zero means unbounded.
+type Cache struct {
+	mu         sync.Mutex
+	maxEntries int
+	entries    map[string]*list.Element
+	lru        *list.List
+	inflight   map[string]*call
+	// Bumped on every purge so responses fetched before it are not stored
+	generation uint64
+}
+
+func New(maxEntries int) *Cache {
+	return &Cache{
+		maxEntries: maxEntries,
+		entries:    map[string]*list.Element{},
+		lru:        list.New(),
+		inflight:   map[string]*call{},
+	}
+}
+
+func (c *Cache) get(key string) *entry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	e := element.Value.(*entry)
+	if time.Now().After(e.expires) {
+		c.lru.Remove(element)
+		delete(c.entries, key)
+		return nil
+	}
+	c.lru.MoveToFront(element)
+	return e
+}
+
+func (c *Cache) set(e *entry, generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+
+	if element, ok := c.entries[e.key]; ok {
+		element.Value = e
+		c.lru.MoveToFront(element)
+		return
+	}
+	c.entries[e.key] = c.lru.PushFront(e)
+
+	if c.maxEntries > 0 && c.lru.Len() > c.maxEntries {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*entry).key)
+	}
+}
+
+// Drop every entry for the path and anything below it,
+// e.g. "/templates/1" also drops "/templates/1/roles/host"
+func (c *Cache) Purge(path string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	for key, element := range c.entries {
+		if key == path || strings.HasPrefix(key, path+"/") || strings.HasPrefix(key, path+"?") {
+			c.lru.Remove(element)
+			delete(c.entries, key)
+		}
+	}
+}
+
+// Either join a pending request for the key or become the one making it
+func (c *Cache) join(key string) (*call, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if pending, ok := c.inflight[key]; ok {
+		return pending, false
+	}
+	pending := &call{done: make(chan struct{}), generation: c.generation}
+	c.inflight[key] = pending
+	return pending, true
+}
+
+func (c *Cache) finish(key string, pending *call, e *entry) {
+	c.mu.Lock()
+	delete(c.inflight, key)
+	c.mu.Unlock()
+
+	pending.entry = e
+	close(pending.done)
+}
+
+func etagOf(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+func serve(ctx *gin.Context, e *entry, state string) {
+	// Failed responses are shared with waiting requests but carry no ETag
+	if e.etag == "" {
+		for name, values := range e.header {
+			ctx.Writer.Header()[name] = values
+		}
+		ctx.Header("X-Cache", state)
+		ctx.Data(e.status, e.contentType, e.body)
+		ctx.Abort()
+		return
+	}
+	ctx.Header("ETag", e.etag)
+	ctx.Header("X-Cache", state)
+	if ctx.GetHeader("If-None-Match") == e.etag {
+		ctx.AbortWithStatus(http.StatusNotModified)
+		return
+	}
+	ctx.Data(e.status, e.contentType, e.body)
+	ctx.Abort()
+}
+
+// Buffers the handler's response so it can be cached before it is sent
+type bufferWriter struct {
+	gin.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *bufferWriter) WriteHeader(code int) {
+	w.status = code
+}
+
+func (w *bufferWriter) WriteHeaderNow() {}
+
+func (w *bufferWriter) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
+
+func (w *bufferWriter) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+func (w *bufferWriter) Status() int {
+	return w.status
+}
+
+func (w *bufferWriter) Size() int {
+	return w.body.Len()
+}
+
+func (w *bufferWriter) Written() bool {
+	return w.body.Len() > 0
+}
+
+// Cache successful GET responses for the ttl, keyed by the request url.
+// Concurrent misses for the same url share a single upstream request, and
+// its response, even when it failed.
+func (c *Cache) Handler(ttl time.Duration) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if ttl <= 0 || ctx.Request.Method != http.MethodGet {
+			ctx.Next()
+			return
+		}
+
+		key := ctx.Request.URL.RequestURI()
+		if e := c.get(key); e != nil {
+			serve(ctx, e, "HIT")
+			return
+		}
+
+		pending, leader := c.join(key)
+		if !leader {
+			<-pending.done
+			if pending.entry != nil {
+				serve(ctx, pending.entry, "HIT")
+				return
+			}
+			// The shared request panicked, try on our own
+			ctx.Next()
+			return
+		}
+
+		var e *entry
+		defer func() {
+			c.finish(key, pending, e)
+		}()
+
+		original := ctx.Writer
+		writer := &bufferWriter{ResponseWriter: original, status: http.StatusOK}
+		ctx.Writer = writer
+		ctx.Next()
+		ctx.Writer = original
+
+		e = &entry{
+			key:         key,
+			status:      writer.status,
+			contentType: original.Header().Get("Content-Type"),
+			body:        writer.body.Bytes(),
+		}
+		if writer.status != http.StatusOK {
+			e.header = original.Header().Clone()
+			serve(ctx, e, "MISS")
+			return
+		}
+		e.etag = etagOf(e.body)
+		e.expires = time.Now().Add(ttl)
+		c.set(e, pending.generation)
+		serve(ctx, e, "MISS")
+	}
+}
+
+// Purge the given paths once the handler succeeds. Path parameters such as
+// ":roomId" are filled in from the request.
+func (c *Cache) Invalidate(paths ...string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Next()
+
+		if ctx.Writer.Status() >= http.StatusMultipleChoices {
+			return
+		}
+		for _, path := range paths {
+			segments := strings.Split(path, "/")
+			for i, segment := range segments {
+				if strings.HasPrefix(segment, ":") {
+					segments[i] = ctx.Param(segment[1:])
+				}
+			}
+			c.Purge(strings.Join(segments, "/"))
+		}
+	}
+}
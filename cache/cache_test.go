@@ -0,0 +1,203 @@
+package cache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func get(router http.Handler, path string, header ...string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", path, nil)
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// A router caching GET /items/:id, answering with the status of the handler and counting its calls
+func cachedRouter(c *Cache, ttl time.Duration, status func() int, calls *int32) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/items/:id", c.Handler(ttl), func(ctx *gin.Context) {
+		atomic.AddInt32(calls, 1)
+		ctx.JSON(status(), gin.H{"id": ctx.Param("id")})
+	})
+	router.POST("/items/:id", c.Invalidate("/items/:id"), func(ctx *gin.Context) {
+		ctx.Status(status())
+	})
+	return router
+}
+
+func ok() int { return http.StatusOK }
+
+func TestHandler(t *testing.T) {
+	tests := []struct {
+		name      string
+		ttl       time.Duration
+		status    int
+		wantCache string
+		wantCalls int32
+	}{
+		{"second request is a hit", time.Minute, http.StatusOK, "HIT", 1},
+		{"zero ttl disables caching", 0, http.StatusOK, "", 2},
+		{"failed responses are not cached", time.Minute, http.StatusBadGateway, "MISS", 2},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var calls int32
+			router := cachedRouter(New(0), test.ttl, func() int { return test.status }, &calls)
+			get(router, "/items/1")
+			w := get(router, "/items/1")
+			if w.Code != test.status {
+				t.Errorf("status %d, want %d", w.Code, test.status)
+			}
+			if got := w.Header().Get("X-Cache"); got != test.wantCache {
+				t.Errorf("X-Cache %q, want %q", got, test.wantCache)
+			}
+			if calls != test.wantCalls {
+				t.Errorf("%d upstream calls, want %d", calls, test.wantCalls)
+			}
+		})
+	}
+}
+
+func TestHandlerETag(t *testing.T) {
+	var calls int32
+	router := cachedRouter(New(0), time.Minute, ok, &calls)
+	etag := get(router, "/items/1").Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("no ETag")
+	}
+	if w := get(router, "/items/1", "If-None-Match", etag); w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("matching If-None-Match: %d with %d bytes", w.Code, w.Body.Len())
+	}
+	if w := get(router, "/items/1", "If-None-Match", `"other"`); w.Code != http.StatusOK {
+		t.Errorf("stale If-None-Match: %d", w.Code)
+	}
+}
+
+func TestHandlerExpiry(t *testing.T) {
+	var calls int32
+	c := New(0)
+	router := cachedRouter(c, time.Minute, ok, &calls)
+	get(router, "/items/1")
+	c.entries["/items/1"].Value.(*entry).expires = time.Now().Add(-time.Second)
+	if w := get(router, "/items/1"); w.Header().Get("X-Cache") != "MISS" || calls != 2 {
+		t.Errorf("expired entry served: X-Cache %q after %d calls", w.Header().Get("X-Cache"), calls)
+	}
+}
+
+func TestLRUEviction(t *testing.T) {
+	var calls int32
+	router := cachedRouter(New(2), time.Minute, ok, &calls)
+	get(router, "/items/1")
+	get(router, "/items/2")
+	// Touch 1 so that 2 is the least recently used
+	get(router, "/items/1")
+	get(router, "/items/3")
+
+	// Fetching 2 again evicts 1, so it is checked last
+	for _, check := range []struct{ path, want string }{{"/items/3", "HIT"}, {"/items/1", "HIT"}, {"/items/2", "MISS"}} {
+		if got := get(router, check.path).Header().Get("X-Cache"); got != check.want {
+			t.Errorf("%s: X-Cache %q, want %q", check.path, got, check.want)
+		}
+	}
+}
+
+func TestInvalidate(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		wantCache string
+	}{
+		{"successful update purges", http.StatusOK, "MISS"},
+		{"failed update keeps the entry", http.StatusBadRequest, "HIT"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var calls int32
+			status := http.StatusOK
+			router := cachedRouter(New(0), time.Minute, func() int { return status }, &calls)
+			get(router, "/items/1")
+			status = test.status
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("POST", "/items/1", nil))
+			status = http.StatusOK
+			if got := get(router, "/items/1").Header().Get("X-Cache"); got != test.wantCache {
+				t.Errorf("X-Cache %q, want %q", got, test.wantCache)
+			}
+		})
+	}
+}
+
+func TestPurgeBelowPath(t *testing.T) {
+	c := New(0)
+	for _, key := range []string{"/templates/1", "/templates/1/roles/host", "/templates/1?x=y", "/templates/10"} {
+		c.set(&entry{key: key, expires: time.Now().Add(time.Minute)}, 0)
+	}
+	c.Purge("/templates/1")
+	if len(c.entries) != 1 || c.entries["/templates/10"] == nil {
+		t.Errorf("left after purge: %v", c.entries)
+	}
+}
+
+func TestCoalescing(t *testing.T) {
+	for _, status := range []int{http.StatusOK, http.StatusServiceUnavailable} {
+		t.Run(http.StatusText(status), func(t *testing.T) {
+			var calls int32
+			release := make(chan struct{})
+			c := New(0)
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.GET("/slow", c.Handler(time.Minute), func(ctx *gin.Context) {
+				atomic.AddInt32(&calls, 1)
+				<-release
+				ctx.Header("Retry-After", "5")
+				ctx.JSON(status, gin.H{})
+			})
+
+			const requests = 5
+			var wg sync.WaitGroup
+			codes := make([]*httptest.ResponseRecorder, requests)
+			for i := range codes {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					codes[i] = get(router, "/slow")
+				}(i)
+			}
+			// Let every request join the first one before it answers
+			for {
+				c.mu.Lock()
+				pending := c.inflight["/slow"]
+				c.mu.Unlock()
+				if pending != nil {
+					break
+				}
+				time.Sleep(time.Millisecond)
+			}
+			time.Sleep(20 * time.Millisecond)
+			close(release)
+			wg.Wait()
+
+			if calls != 1 {
+				t.Errorf("%d upstream calls, want 1", calls)
+			}
+			for i, w := range codes {
+				if w.Code != status {
+					t.Errorf("request %d: status %d, want %d", i, w.Code, status)
+				}
+				if status != http.StatusOK && w.Header().Get("Retry-After") != "5" {
+					t.Errorf("request %d: Retry-After of the shared failure missing", i)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,689 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"api/activeroom"
+	"api/helpers"
+	"api/livestreams"
+	"api/policy"
+	"api/polls"
+	"api/recording"
+	"api/room"
+	"api/roomcodes"
+	"api/token"
+)
+
+func commands() commandTable {
+	table := commandTable{
+		"rooms": {
+			"list":        {usage: "[--name NAME] [--enabled true|false]", summary: "List rooms", columns: []string{"id", "name", "enabled", "template_id", "created_at"}, run: listRooms},
+			"create":      {usage: "-f FILE | --name NAME [--template-id ID]", summary: "Create a room", run: createRoom},
+			"disable":     {usage: "<roomId>", summary: "Disable a room", run: disableRoom},
+			"bulk-create": {usage: "-f FILE [--concurrency N] [-o MANIFEST]", summary: "Create the rooms of a CSV, JSON or YAML file that do not exist yet, with their room codes", columns: []string{"name", "room_id", "status", "room_codes", "error"}, run: createRooms},
+		},
+		"templates": {
+			"get":    {usage: "<templateId>", summary: "Get a template", run: getTemplate},
+			"apply":  {usage: "-f FILE [--id TEMPLATE_ID] [--prune] [--yes]", summary: "Create a template from a file, or update it after confirming the plan", run: applyTemplate},
+			"lint":   {usage: "-f FILE | <templateId>", summary: "Lint a template file, or a template in the workspace", columns: []string{"severity", "rule", "path", "message"}, run: lintTemplate},
+			"plan":   {usage: "-f FILE --id TEMPLATE_ID [--prune]", summary: "Show the changes applying a template file would make", run: planTemplate},
+			"export": {usage: "<templateId> [-o FILE]", summary: "Export a template as a YAML file", run: exportTemplate},
+			"clone":  {usage: "<templateId> --from PROFILE --to PROFILE [--target-id ID] [--map SOURCE=TARGET] [--prune] [--dry-run]", summary: "Create or update a copy of a template in another workspace", run: cloneTemplate},
+		},
+		"room-codes": {
+			"create": {usage: "<roomId> [--role ROLE]", summary: "Create room codes for every role, or a single one", columns: []string{"code", "role", "enabled"}, run: createRoomCodes},
+			"rotate": {usage: "<roomId> --role ROLE [--webhook URL]", summary: "Replace the room code of a role with a fresh one, disabling the previous codes", run: rotateRoomCode},
+		},
+		"peers": {
+			"list":   {usage: "<roomId> [--role ROLE] [--user-id ID]", summary: "List the peers of an active room", columns: []string{"id", "name", "user_id", "role", "joined_at"}, run: listPeers},
+			"remove": {usage: "<roomId> --peer-id ID | --role ROLE [--reason REASON]", summary: "Remove peers from an active room", run: removePeers},
+		},
+		"recordings": {
+			"start": {usage: "<roomId> [--meeting-url URL] [--audio-only]", summary: "Start recording a room", run: startRecording},
+			"stop":  {usage: "<roomId> | --recording-id ID", summary: "Stop the recordings of a room, or a single one", run: stopRecording},
+		},
+		"live-streams": {
+			"start":    {usage: "<roomId> [--meeting-url URL]", summary: "Start live streaming a room", run: startLiveStream},
+			"stop":     {usage: "<roomId> | --stream-id ID", summary: "Stop the live streams of a room, or a single one", run: stopLiveStream},
+			"metadata": {usage: "<streamId> --payload PAYLOAD [--duration SECONDS]", summary: "Send timed metadata to a live stream", run: sendTimedMetadata},
+		},
+		"polls": {
+			"create": {usage: "-f FILE", summary: "Create a poll", run: createPoll},
+		},
+		"analytics": {
+			"events": {usage: "--type TYPE [--room-id ID] [--session-id ID] [--peer-id ID] [--user-id ID] [--limit N] [--start CURSOR]", summary: "List analytics events", columns: []string{"type", "timestamp", "data.room_id", "data.peer_id", "data.user_id"}, run: listAnalyticsEvents},
+		},
+		"token": {
+			"issue": {usage: "--room-id ID --user-id ID --role ROLE [--expires-in SECONDS]", summary: "Issue an auth token for a client SDK", run: issueToken},
+		},
+		"profile": {
+			"list": {usage: "", summary: "List workspace profiles", columns: []string{"name", "current", "base_url", "app_access_key"}, run: listProfiles},
+			"use":  {usage: "<name>", summary: "Make a profile the current one", run: useProfileCommand},
+			"set":  {usage: "<name> --access-key KEY --secret SECRET [--base-url URL]", summary: "Create or update a profile", run: setProfile},
+		},
+	}
+	table["completion"] = map[string]*command{
+		"bash": {usage: "", summary: "Print the bash completion script", run: func([]string) (interface{}, error) { return bashCompletion(table), nil }},
+		"zsh":  {usage: "", summary: "Print the zsh completion script", run: func([]string) (interface{}, error) { return zshCompletion(table), nil }},
+	}
+	return table
+}
+
+// Send a request to the 100ms API and decode its JSON response
+func call(method, path string, body interface{}) (interface{}, error) {
+	var result interface{}
+	if err := helpers.CallApi(context.Background(), method, helpers.GetEndpointUrl(path), body, &result); err != nil {
+		return nil, err
+	}
+	if result == nil {
+		return map[string]interface{}{}, nil
+	}
+	return result, nil
+}
+
+// Read a JSON or YAML file ("-" for stdin) as JSON
+func readJSON(file string) ([]byte, error) {
+	var data []byte
+	var err error
+	if file == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(file)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ext := strings.ToLower(filepath.Ext(file))
+	if ext == ".yaml" || ext == ".yml" || (file == "-" && !json.Valid(data)) {
+		if data, err = helpers.YAMLToJSON(data); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+	}
+	return data, nil
+}
+
+// Read a request body from a JSON or YAML file ("-" for stdin) and validate it
+// against the same rules as the API service
+func readBody(file string, v interface{}) error {
+	data, err := readJSON(file)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+	return validate(v)
+}
+
+func validate(v interface{}) error {
+	err := helpers.Validate(v)
+	if err == nil {
+		return nil
+	}
+	var message strings.Builder
+	message.WriteString("invalid request body")
+	for _, fieldError := range helpers.ValidationErrors(err) {
+		fmt.Fprintf(&message, "\n  %s: %s", fieldError.Field, fieldError.Message)
+	}
+	return errors.New(message.String())
+}
+
+func usageError(group, name string) error {
+	cmd := commands()[group][name]
+	return fmt.Errorf("usage: hmsctl %s %s %s", group, name, cmd.usage)
+}
+
+func listRooms(args []string) (interface{}, error) {
+	flags := flag.NewFlagSet("rooms list", flag.ContinueOnError)
+	name := flags.String("name", "", "filter by room name")
+	enabled := flags.String("enabled", "", "filter by enabled state")
+	if _, err := parseFlags(flags, args); err != nil {
+		return nil, err
+	}
+
+	qs := url.Values{}
+	if *name != "" {
+		qs.Add("name", *name)
+	}
+	if *enabled != "" {
+		qs.Add("enabled", *enabled)
+	}
+	return call("GET", "rooms?"+qs.Encode(), nil)
+}
+
+// Tags are kept by the API service, which hmsctl does not go through
+var errTagsNeedService = errors.New("room tags are kept by the API service, create tagged rooms through it instead")
+
+func createRoom(args []string) (interface{}, error) {
+	flags := flag.NewFlagSet("rooms create", flag.ContinueOnError)
+	file := flags.String("f", "", "JSON or YAML room definition")
+	name := flags.String("name", "", "room name")
+	templateId := flags.String("template-id", "", "template of the room")
+	if _, err := parseFlags(flags, args); err != nil {
+		return nil, err
+	}
+
+	rb := room.HMSRoom{Name: *name, TemplateId: *templateId}
+	if *file != "" {
+		if err := readBody(*file, &rb); err != nil {
+			return nil, err
+		}
+	} else if err := validate(&rb); err != nil {
+		return nil, err
+	}
+	if rb.Tags != nil {
+		return nil, errTagsNeedService
+	}
+	return call("POST", "rooms", rb)
+}
+
+func createRooms(args []string) (interface{}, error) {
+	flags := flag.NewFlagSet("rooms bulk-create", flag.ContinueOnError)
+	file := flags.String("f", "", "CSV, JSON or YAML list of rooms")
+	concurrency := flags.Int("concurrency", 5, "rooms created at the same time, up to 20")
+	manifestFile := flags.String("o", "", "also write the manifest to this file, as CSV when it ends in .csv")
+	if _, err := parseFlags(flags, args); err != nil {
+		return nil, err
+	}
+	if *file == "" {
+		return nil, usageError("rooms", "bulk-create")
+	}
+
+	var rooms []room.BulkRoom
+	if strings.ToLower(filepath.Ext(*file)) == ".csv" {
+		f, err := os.Open(*file)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		if rooms, err = room.ParseBulkRoomsCSV(f); err != nil {
+			return nil, fmt.Errorf("%s: %w", *file, err)
+		}
+	} else {
+		var rb room.BulkRoomsBody
+		if err := readBody(*file, &rb); err != nil {
+			return nil, err
+		}
+		rooms = rb.Rooms
+	}
+	for _, rb := range rooms {
+		if rb.Tags != nil {
+			return nil, errTagsNeedService
+		}
+	}
+	if fieldErrors := room.CheckBulkRooms(rooms); len(fieldErrors) > 0 {
+		var message strings.Builder
+		message.WriteString("invalid request body")
+		for _, fieldError := range fieldErrors {
+			fmt.Fprintf(&message, "\n  %s: %s", fieldError.Field, fieldError.Message)
+		}
+		return nil, errors.New(message.String())
+	}
+
+	manifest := room.ProvisionRooms(context.Background(), rooms, *concurrency)
+	if *manifestFile != "" {
+		f, err := os.Create(*manifestFile)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		if strings.ToLower(filepath.Ext(*manifestFile)) == ".csv" {
+			err = manifest.WriteCSV(f)
+		} else {
+			encoder := json.NewEncoder(f)
+			encoder.SetIndent("", "  ")
+			err = encoder.Encode(manifest)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return manifest, nil
+}
+
+func disableRoom(args []string) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, usageError("rooms", "disable")
+	}
+	return call("POST", "rooms/"+args[0], map[string]bool{"enabled": false})
+}
+
+func getTemplate(args []string) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, usageError("templates", "get")
+	}
+	return call("GET", "templates/"+args[0], nil)
+}
+
+type templateFileOptions struct {
+	id    string
+	prune bool
+	yes   bool
+}
+
+// Parse the flags shared by templates plan and apply, and read the template file.
+// It is validated as a template but kept as a document, so that its false values are applied.
+func readTemplateFile(group, name string, args []string) (*templateFileOptions, policy.TemplateDocument, error) {
+	var options templateFileOptions
+	flags := flag.NewFlagSet(group+" "+name, flag.ContinueOnError)
+	file := flags.String("f", "", "JSON or YAML template file")
+	flags.StringVar(&options.id, "id", "", "template to update")
+	flags.BoolVar(&options.prune, "prune", false, "delete roles missing from the file")
+	flags.BoolVar(&options.yes, "yes", false, "apply without asking for confirmation")
+	if _, err := parseFlags(flags, args); err != nil {
+		return nil, nil, err
+	}
+	if *file == "" {
+		return nil, nil, usageError(group, name)
+	}
+
+	data, err := readJSON(*file)
+	if err != nil {
+		return nil, nil, err
+	}
+	rb, err := policy.NewTemplateDocument(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", *file, err)
+	}
+	template, err := rb.Template()
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", *file, err)
+	}
+	if err := validate(template); err != nil {
+		return nil, nil, err
+	}
+	return &options, rb, nil
+}
+
+func planTemplate(args []string) (interface{}, error) {
+	options, rb, err := readTemplateFile("templates", "plan", args)
+	if err != nil {
+		return nil, err
+	}
+	if options.id == "" {
+		return nil, usageError("templates", "plan")
+	}
+
+	plan, err := policy.PlanTemplate(context.Background(), options.id, rb, options.prune)
+	if err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// Ask on the terminal whether to go ahead
+func confirm(question string) (bool, error) {
+	if info, err := os.Stdin.Stat(); err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return false, errors.New("not a terminal, pass --yes to apply without confirmation")
+	}
+	fmt.Fprint(os.Stderr, question+" [y/N] ")
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
+}
+
+func applyTemplate(args []string) (interface{}, error) {
+	options, rb, err := readTemplateFile("templates", "apply", args)
+	if err != nil {
+		return nil, err
+	}
+
+	if options.id != "" && !options.yes {
+		plan, err := policy.PlanTemplate(context.Background(), options.id, rb, options.prune)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprint(os.Stderr, plan)
+		if len(plan.Changes) == 0 {
+			return nil, nil
+		}
+		ok, err := confirm("Apply these changes?")
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, errors.New("apply cancelled")
+		}
+	}
+
+	result, err := policy.ApplyTemplate(context.Background(), options.id, rb, options.prune)
+	if err != nil && len(result.Applied) > 0 {
+		return nil, fmt.Errorf("%w (applied before the error: %s)", err, strings.Join(result.Applied, ", "))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func lintTemplate(args []string) (interface{}, error) {
+	flags := flag.NewFlagSet("templates lint", flag.ContinueOnError)
+	file := flags.String("f", "", "JSON or YAML template file")
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return nil, err
+	}
+
+	template := &policy.HMSTemplate{}
+	switch {
+	case *file != "" && len(positional) == 0:
+		err = readBody(*file, template)
+	case *file == "" && len(positional) == 1:
+		template, err = policy.FetchTemplate(context.Background(), positional[0])
+	default:
+		return nil, usageError("templates", "lint")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return policy.LintResult{Issues: policy.LintTemplate(template)}, nil
+}
+
+func exportTemplate(args []string) (interface{}, error) {
+	flags := flag.NewFlagSet("templates export", flag.ContinueOnError)
+	file := flags.String("o", "", "write the YAML to this file instead of stdout")
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return nil, err
+	}
+	if len(positional) != 1 {
+		return nil, usageError("templates", "export")
+	}
+
+	template, err := policy.FetchTemplateDocument(context.Background(), positional[0])
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range template.StripSecrets() {
+		fmt.Fprintln(os.Stderr, "hmsctl: left out", path)
+	}
+	data, err := policy.MarshalTemplateYAML(template)
+	if err != nil {
+		return nil, err
+	}
+	if *file != "" {
+		return nil, os.WriteFile(*file, data, 0o644)
+	}
+	return string(data), nil
+}
+
+func cloneTemplate(args []string) (interface{}, error) {
+	var options policy.CloneTemplateBody
+	flags := flag.NewFlagSet("templates clone", flag.ContinueOnError)
+	flags.StringVar(&options.From, "from", "", "profile of the workspace to copy from")
+	flags.StringVar(&options.To, "to", "", "profile of the workspace to copy to")
+	flags.StringVar(&options.TargetTemplateId, "target-id", "", "template to update, instead of the one with the same name")
+	flags.Func("map", "template name in the target workspace, as SOURCE=TARGET", func(value string) error {
+		source, target, ok := strings.Cut(value, "=")
+		if !ok {
+			return errors.New("expected SOURCE=TARGET")
+		}
+		if options.NameMapping == nil {
+			options.NameMapping = map[string]string{}
+		}
+		options.NameMapping[source] = target
+		return nil
+	})
+	flags.BoolVar(&options.Prune, "prune", false, "delete roles the source template does not have")
+	flags.BoolVar(&options.DryRun, "dry-run", false, "report the changes without making them")
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return nil, err
+	}
+	if len(positional) != 1 || options.From == "" || options.To == "" {
+		return nil, usageError("templates", "clone")
+	}
+
+	from, err := profileWorkspace(options.From)
+	if err != nil {
+		return nil, err
+	}
+	to, err := profileWorkspace(options.To)
+	if err != nil {
+		return nil, err
+	}
+	report, err := policy.CloneTemplate(context.Background(), positional[0], options, from, to)
+	if err != nil && len(report.Applied) > 0 {
+		return nil, fmt.Errorf("%w (applied before the error: %s)", err, strings.Join(report.Applied, ", "))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+func createRoomCodes(args []string) (interface{}, error) {
+	flags := flag.NewFlagSet("room-codes create", flag.ContinueOnError)
+	role := flags.String("role", "", "create the code of this role only")
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return nil, err
+	}
+	if len(positional) != 1 {
+		return nil, usageError("room-codes", "create")
+	}
+
+	if *role != "" {
+		return call("POST", "room-codes/room/"+positional[0]+"/role/"+*role, nil)
+	}
+	return call("POST", "room-codes/room/"+positional[0], nil)
+}
+
+func rotateRoomCode(args []string) (interface{}, error) {
+	flags := flag.NewFlagSet("room-codes rotate", flag.ContinueOnError)
+	role := flags.String("role", "", "role whose code is rotated")
+	webhook := flags.String("webhook", "", "notify this webhook of the new code instead of ROOM_CODE_WEBHOOK_URL")
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return nil, err
+	}
+	if len(positional) != 1 || *role == "" {
+		return nil, usageError("room-codes", "rotate")
+	}
+
+	rotated, err := roomcodes.Rotate(context.Background(), positional[0], *role, roomcodes.RotationManual, *webhook)
+	if err != nil {
+		return nil, err
+	}
+	if rotated.Error != "" {
+		return rotated, fmt.Errorf("new code %s created, but: %s", rotated.Code, rotated.Error)
+	}
+	return rotated, nil
+}
+
+func listPeers(args []string) (interface{}, error) {
+	flags := flag.NewFlagSet("peers list", flag.ContinueOnError)
+	role := flags.String("role", "", "filter by role")
+	userId := flags.String("user-id", "", "filter by user id")
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return nil, err
+	}
+	if len(positional) != 1 {
+		return nil, usageError("peers", "list")
+	}
+
+	qs := url.Values{}
+	qs.Add("role", *role)
+	qs.Add("user_id", *userId)
+	return call("GET", "active-rooms/"+positional[0]+"/peers?"+qs.Encode(), nil)
+}
+
+func removePeers(args []string) (interface{}, error) {
+	flags := flag.NewFlagSet("peers remove", flag.ContinueOnError)
+	var rb activeroom.HMSRemovePeerBody
+	flags.StringVar(&rb.PeerId, "peer-id", "", "peer to remove")
+	flags.StringVar(&rb.Role, "role", "", "remove every peer with this role")
+	flags.StringVar(&rb.Reason, "reason", "", "reason shown to the removed peers")
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return nil, err
+	}
+	if len(positional) != 1 || (rb.PeerId == "") == (rb.Role == "") {
+		return nil, usageError("peers", "remove")
+	}
+	return call("POST", "active-rooms/"+positional[0]+"/remove-peers", rb)
+}
+
+func startRecording(args []string) (interface{}, error) {
+	flags := flag.NewFlagSet("recordings start", flag.ContinueOnError)
+	var rb recording.HMSStartRecordingBody
+	flags.StringVar(&rb.MeetingUrl, "meeting-url", "", "url the recorder joins")
+	flags.BoolVar(&rb.AudioOnly, "audio-only", false, "record audio only")
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return nil, err
+	}
+	if len(positional) != 1 {
+		return nil, usageError("recordings", "start")
+	}
+	return call("POST", "recordings/room/"+positional[0]+"/start", rb)
+}
+
+func stopRecording(args []string) (interface{}, error) {
+	flags := flag.NewFlagSet("recordings stop", flag.ContinueOnError)
+	recordingId := flags.String("recording-id", "", "stop this recording only")
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case *recordingId != "" && len(positional) == 0:
+		return call("POST", "recordings/"+*recordingId+"/stop", nil)
+	case *recordingId == "" && len(positional) == 1:
+		return call("POST", "recordings/room/"+positional[0]+"/stop", nil)
+	default:
+		return nil, usageError("recordings", "stop")
+	}
+}
+
+func startLiveStream(args []string) (interface{}, error) {
+	flags := flag.NewFlagSet("live-streams start", flag.ContinueOnError)
+	var rb livestreams.HMSLivestream
+	flags.StringVar(&rb.MeetingUrl, "meeting-url", "", "url the streamer joins")
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return nil, err
+	}
+	if len(positional) != 1 {
+		return nil, usageError("live-streams", "start")
+	}
+	return call("POST", "live-streams/room/"+positional[0]+"/start", rb)
+}
+
+func stopLiveStream(args []string) (interface{}, error) {
+	flags := flag.NewFlagSet("live-streams stop", flag.ContinueOnError)
+	streamId := flags.String("stream-id", "", "stop this live stream only")
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case *streamId != "" && len(positional) == 0:
+		return call("POST", "live-streams/"+*streamId+"/stop", nil)
+	case *streamId == "" && len(positional) == 1:
+		return call("POST", "live-streams/room/"+positional[0]+"/stop", nil)
+	default:
+		return nil, usageError("live-streams", "stop")
+	}
+}
+
+func sendTimedMetadata(args []string) (interface{}, error) {
+	flags := flag.NewFlagSet("live-streams metadata", flag.ContinueOnError)
+	var rb livestreams.TimedMetaDataBody
+	flags.StringVar(&rb.Payload, "payload", "", "metadata payload")
+	duration := flags.Int("duration", 1, "seconds the metadata is shown for")
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return nil, err
+	}
+	if len(positional) != 1 {
+		return nil, usageError("live-streams", "metadata")
+	}
+	rb.Duration = int32(*duration)
+	if err := validate(&rb); err != nil {
+		return nil, err
+	}
+	return call("POST", "live-streams/"+positional[0]+"/timed-metadata", rb)
+}
+
+func createPoll(args []string) (interface{}, error) {
+	flags := flag.NewFlagSet("polls create", flag.ContinueOnError)
+	file := flags.String("f", "", "JSON or YAML poll definition")
+	if _, err := parseFlags(flags, args); err != nil {
+		return nil, err
+	}
+	if *file == "" {
+		return nil, usageError("polls", "create")
+	}
+
+	var rb polls.HMSPoll
+	if err := readBody(*file, &rb); err != nil {
+		return nil, err
+	}
+	return call("POST", "polls", rb)
+}
+
+func listAnalyticsEvents(args []string) (interface{}, error) {
+	flags := flag.NewFlagSet("analytics events", flag.ContinueOnError)
+	qs := url.Values{}
+	filters := map[string]*string{}
+	for _, filter := range []string{"type", "room_id", "session_id", "peer_id", "user_id", "start"} {
+		filters[filter] = flags.String(strings.ReplaceAll(filter, "_", "-"), "", "filter by "+filter)
+	}
+	limit := flags.Int("limit", 0, "maximum number of events")
+	if _, err := parseFlags(flags, args); err != nil {
+		return nil, err
+	}
+	if *filters["type"] == "" {
+		return nil, usageError("analytics", "events")
+	}
+
+	for filter, value := range filters {
+		if *value != "" {
+			qs.Add(filter, *value)
+		}
+	}
+	if *limit > 0 {
+		qs.Add("limit", strconv.Itoa(*limit))
+	}
+	return call("GET", "analytics/events?"+qs.Encode(), nil)
+}
+
+func issueToken(args []string) (interface{}, error) {
+	flags := flag.NewFlagSet("token issue", flag.ContinueOnError)
+	var rb token.RequestBody
+	flags.StringVar(&rb.RoomId, "room-id", "", "room to join")
+	flags.StringVar(&rb.UserId, "user-id", "", "user joining the room")
+	flags.StringVar(&rb.Role, "role", "", "role to join with")
+	flags.IntVar(&rb.ExpiresIn, "expires-in", 0, "seconds the token is valid for (default 24 hours)")
+	if _, err := parseFlags(flags, args); err != nil {
+		return nil, err
+	}
+	if rb.RoomId == "" || rb.UserId == "" || rb.Role == "" {
+		return nil, usageError("token", "issue")
+	}
+
+	signedToken, err := token.GenerateAuthToken(rb)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"token": signedToken}, nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Completes groups, then the commands of the group, then global flags
+func bashCompletion(table commandTable) string {
+	var cases strings.Builder
+	for _, group := range table.groups() {
+		fmt.Fprintf(&cases, "        %s) commands=%q ;;\n", group, strings.Join(table.names(group), " "))
+	}
+
+	return fmt.Sprintf(`# bash completion for hmsctl
+# Load with: source <(hmsctl completion bash)
+_hmsctl() {
+    local cur words=() i group=""
+    cur="${COMP_WORDS[COMP_CWORD]}"
+    for ((i = 1; i < COMP_CWORD; i++)); do
+        case "${COMP_WORDS[i]}" in
+            --profile|--output) ((i++)) ;;
+            -*) ;;
+            *) words+=("${COMP_WORDS[i]}") ;;
+        esac
+    done
+
+    case "${COMP_WORDS[COMP_CWORD-1]}" in
+        --output) COMPREPLY=($(compgen -W "table json yaml" -- "$cur")); return ;;
+        --profile) return ;;
+    esac
+
+    if [[ "$cur" == -* ]]; then
+        COMPREPLY=($(compgen -W "--profile --output" -- "$cur"))
+        return
+    fi
+
+    if [[ ${#words[@]} -eq 0 ]]; then
+        COMPREPLY=($(compgen -W %q -- "$cur"))
+        return
+    fi
+
+    if [[ ${#words[@]} -eq 1 ]]; then
+        local commands=""
+        group="${words[0]}"
+        case "$group" in
+%s        esac
+        COMPREPLY=($(compgen -W "$commands" -- "$cur"))
+    fi
+}
+complete -F _hmsctl hmsctl
+`, strings.Join(table.groups(), " "), cases.String())
+}
+
+func zshCompletion(table commandTable) string {
+	return "#compdef hmsctl\n# Load with: source <(hmsctl completion zsh)\nautoload -U +X bashcompinit && bashcompinit\n" + bashCompletion(table)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestCompletionScripts(t *testing.T) {
+	table := commands()
+	bash := bashCompletion(table)
+	if !strings.Contains(bash, `"analytics completion live-streams peers polls profile recordings room-codes rooms templates token"`) {
+		t.Errorf("bash completion does not complete the groups:\n%s", bash)
+	}
+	if !strings.Contains(bash, `        rooms) commands="bulk-create create disable list" ;;`) {
+		t.Errorf("bash completion does not complete the commands of rooms:\n%s", bash)
+	}
+	zsh := zshCompletion(table)
+	if !strings.HasPrefix(zsh, "#compdef hmsctl\n") || !strings.HasSuffix(zsh, bash) {
+		t.Errorf("zsh completion is not the bash one loaded through bashcompinit:\n%s", zsh)
+	}
+}
+
+// Complete command lines with the bash script, where bash is installed
+func TestBashCompletion(t *testing.T) {
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash is not installed")
+	}
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"hmsctl ", "analytics completion live-streams peers polls profile recordings room-codes rooms templates token"},
+		{"hmsctl ro", "room-codes rooms"},
+		{"hmsctl rooms ", "bulk-create create disable list"},
+		{"hmsctl --profile prod templates p", "plan"},
+		{"hmsctl --output ", "table json yaml"},
+		{"hmsctl --output json -", "--profile --output"},
+		{"hmsctl rooms list ", ""},
+		{"hmsctl unknown ", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.line, func(t *testing.T) {
+			script := bashCompletion(commands()) + `
+COMP_WORDS=($COMP_LINE)
+[[ "$COMP_LINE" == *" " ]] && COMP_WORDS+=("")
+COMP_CWORD=$((${#COMP_WORDS[@]} - 1))
+_hmsctl
+echo "${COMPREPLY[*]}"
+`
+			cmd := exec.Command(bash, "--norc", "-c", script)
+			cmd.Env = append(cmd.Environ(), "COMP_LINE="+test.line)
+			out, err := cmd.CombinedOutput()
+			if err != nil {
+				t.Fatalf("%v: %s", err, out)
+			}
+			if got := strings.TrimSpace(string(out)); got != test.want {
+				t.Errorf("completed %q, want %q", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+// hmsctl administers 100ms workspaces from the command line, sending requests
+// through the same client, rate limits and circuit breakers as the API service.
+//
+// Usage:
+//
+//	hmsctl [--profile name] [--output table|json|yaml] <group> <command> [flags] [args]
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"api/helpers"
+	"api/vault"
+)
+
+type command struct {
+	usage   string
+	summary string
+	// Columns shown by the table output for lists
+	columns []string
+	run     func(args []string) (interface{}, error)
+}
+
+// Command groups, mirroring the route groups of the API service
+type commandTable map[string]map[string]*command
+
+func (t commandTable) groups() []string {
+	groups := make([]string, 0, len(t))
+	for group := range t {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+	return groups
+}
+
+func (t commandTable) names(group string) []string {
+	names := make([]string, 0, len(t[group]))
+	for name := range t[group] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (t commandTable) usage() string {
+	var usage strings.Builder
+	usage.WriteString("Usage: hmsctl [--profile name] [--output table|json|yaml] <group> <command> [flags] [args]\n\nCommands:\n")
+	for _, group := range t.groups() {
+		for _, name := range t.names(group) {
+			fmt.Fprintf(&usage, "  %-55s %s\n", "hmsctl "+group+" "+name+" "+t[group][name].usage, t[group][name].summary)
+		}
+	}
+	return usage.String()
+}
+
+// Parse flags wherever they appear between positional arguments
+func parseFlags(flags *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, err
+		}
+		args = flags.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "hmsctl:", err)
+	os.Exit(1)
+}
+
+func main() {
+	table := commands()
+	// Credentials referenced with credentials_ref come from the vault in DATA_DIR
+	helpers.RequestBodyRewriter = vault.InjectCredentials
+
+	global := flag.NewFlagSet("hmsctl", flag.ContinueOnError)
+	profileName := global.String("profile", os.Getenv("HMSCTL_PROFILE"), "workspace profile to use")
+	output := global.String("output", "table", "output format: table, json or yaml")
+	global.Usage = func() {
+		fmt.Fprint(os.Stderr, table.usage())
+	}
+	if err := global.Parse(os.Args[1:]); err != nil {
+		os.Exit(2)
+	}
+
+	args := global.Args()
+	if len(args) < 2 || table[args[0]] == nil || table[args[0]][args[1]] == nil {
+		global.Usage()
+		os.Exit(2)
+	}
+	group, name := args[0], args[1]
+
+	// Profiles and completion work without a workspace
+	if group != "profile" && group != "completion" {
+		if err := useProfile(*profileName); err != nil {
+			fail(err)
+		}
+	}
+
+	cmd := table[group][name]
+	result, err := cmd.run(args[2:])
+	if err != nil {
+		fail(err)
+	}
+	if result == nil {
+		return
+	}
+	if err := render(os.Stdout, *output, result, cmd.columns); err != nil {
+		fail(err)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseFlags(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       []string
+		positional []string
+		role       string
+		audioOnly  bool
+		err        bool
+	}{
+		{"flags first", []string{"--role", "host", "r1"}, []string{"r1"}, "host", false, false},
+		{"flags last", []string{"r1", "--role=host", "--audio-only"}, []string{"r1"}, "host", true, false},
+		{"flags between", []string{"r1", "--audio-only", "r2", "-role", "guest", "r3"}, []string{"r1", "r2", "r3"}, "guest", true, false},
+		{"no arguments", nil, nil, "", false, false},
+		{"after the terminator", []string{"r1", "--", "--role"}, []string{"r1", "--role"}, "", false, false},
+		{"unknown flag", []string{"r1", "--color"}, nil, "", false, true},
+		{"missing value", []string{"r1", "--role"}, nil, "", false, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			flags := flag.NewFlagSet("test", flag.ContinueOnError)
+			flags.SetOutput(io.Discard)
+			role := flags.String("role", "", "")
+			audioOnly := flags.Bool("audio-only", false, "")
+			positional, err := parseFlags(flags, test.args)
+			if (err != nil) != test.err {
+				t.Fatalf("got error %v, want one: %t", err, test.err)
+			}
+			if test.err {
+				return
+			}
+			if !reflect.DeepEqual(positional, test.positional) || *role != test.role || *audioOnly != test.audioOnly {
+				t.Errorf("got %q with role %q and audio only %t, want %q with %q and %t", positional, *role, *audioOnly, test.positional, test.role, test.audioOnly)
+			}
+		})
+	}
+}
+
+func TestUsage(t *testing.T) {
+	table := commands()
+	usage := table.usage()
+	for _, group := range table.groups() {
+		for _, name := range table.names(group) {
+			if !strings.Contains(usage, "hmsctl "+group+" "+name+" ") {
+				t.Errorf("usage leaves out %s %s", group, name)
+			}
+			if table[group][name].summary == "" || table[group][name].run == nil {
+				t.Errorf("%s %s has no summary or run", group, name)
+			}
+		}
+	}
+}
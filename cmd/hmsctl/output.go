@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Keys under which the 100ms API returns lists
+var listKeys = []string{"data", "events", "peers", "issues", "rooms"}
+
+func render(w io.Writer, format string, value interface{}, columns []string) error {
+	// Already formatted, e.g. completion scripts
+	if text, ok := value.(string); ok {
+		_, err := io.WriteString(w, text)
+		return err
+	}
+
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(value)
+	case "yaml":
+		encoder := yaml.NewEncoder(w)
+		encoder.SetIndent(2)
+		return encoder.Encode(value)
+	case "table":
+		return renderTable(w, value, columns)
+	default:
+		return fmt.Errorf("unknown output format %q", format)
+	}
+}
+
+// Items of a list response, if the value is one. Lists keyed by id,
+// such as the peers of a room, are ordered by key.
+func listItems(value interface{}) ([]map[string]interface{}, bool) {
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+
+	for _, key := range listKeys {
+		switch list := object[key].(type) {
+		case []interface{}:
+			items := make([]map[string]interface{}, 0, len(list))
+			for _, item := range list {
+				if itemObject, ok := item.(map[string]interface{}); ok {
+					items = append(items, itemObject)
+				}
+			}
+			return items, true
+		case map[string]interface{}:
+			ids := make([]string, 0, len(list))
+			for id := range list {
+				ids = append(ids, id)
+			}
+			sort.Strings(ids)
+			items := make([]map[string]interface{}, 0, len(list))
+			for _, id := range ids {
+				if itemObject, ok := list[id].(map[string]interface{}); ok {
+					items = append(items, itemObject)
+				}
+			}
+			return items, true
+		}
+	}
+	return nil, false
+}
+
+// Resolve a dotted column such as "data.room_id" against an item
+func lookup(item map[string]interface{}, path string) interface{} {
+	var value interface{} = item
+	for _, key := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = object[key]
+	}
+	return value
+}
+
+func cell(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		encoded, _ := json.Marshal(v)
+		return string(encoded)
+	}
+}
+
+func renderTable(w io.Writer, value interface{}, columns []string) error {
+	// Results with their own human readable form, such as template plans
+	if stringer, ok := value.(fmt.Stringer); ok {
+		_, err := io.WriteString(w, stringer.String())
+		return err
+	}
+	// Typed results are shown the way their JSON looks
+	if data, err := json.Marshal(value); err == nil {
+		json.Unmarshal(data, &value)
+	}
+
+	tab := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	if items, ok := listItems(value); ok {
+		if len(columns) == 0 && len(items) > 0 {
+			for key := range items[0] {
+				columns = append(columns, key)
+			}
+			sort.Strings(columns)
+		}
+		fmt.Fprintln(tab, strings.ToUpper(strings.Join(columns, "\t")))
+		for _, item := range items {
+			row := make([]string, len(columns))
+			for i, column := range columns {
+				row[i] = cell(lookup(item, column))
+			}
+			fmt.Fprintln(tab, strings.Join(row, "\t"))
+		}
+		return tab.Flush()
+	}
+
+	if object, ok := value.(map[string]interface{}); ok {
+		keys := make([]string, 0, len(object))
+		for key := range object {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Fprintf(tab, "%s\t%s\n", key, cell(object[key]))
+		}
+		return tab.Flush()
+	}
+
+	fmt.Fprintln(tab, cell(value))
+	return tab.Flush()
+}
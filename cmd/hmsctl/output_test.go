@@ -0,0 +1,80 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"api/policy"
+)
+
+type planText struct{}
+
+func (planText) String() string {
+	return "~ roles.host.priority: 1 => 2\n"
+}
+
+func TestRender(t *testing.T) {
+	rooms := map[string]interface{}{
+		"limit": 10.0,
+		"data": []interface{}{
+			map[string]interface{}{"id": "r1", "name": "cs101", "enabled": true, "size": 25.0, "data": map[string]interface{}{"course": "cs101"}},
+			map[string]interface{}{"id": "r2", "name": "cs102", "enabled": false},
+		},
+	}
+	tests := []struct {
+		name, format string
+		value        interface{}
+		columns      []string
+		want         string
+		err          string
+	}{
+		{
+			"table of a list", "table", rooms, []string{"id", "name", "enabled", "data.course"},
+			"ID  NAME   ENABLED  DATA.COURSE\nr1  cs101  true     cs101\nr2  cs102  false    \n", "",
+		},
+		{
+			"table of a list without columns", "table", map[string]interface{}{"peers": map[string]interface{}{
+				"p2": map[string]interface{}{"id": "p2", "role": "guest"},
+				"p1": map[string]interface{}{"id": "p1", "role": "host"},
+			}}, nil,
+			"ID  ROLE\np1  host\np2  guest\n", "",
+		},
+		{
+			"table of an object", "table", map[string]interface{}{"name": "cs101", "size": 25.0, "tags": []interface{}{"a"}}, nil,
+			"name  cs101\nsize  25\ntags  [\"a\"]\n", "",
+		},
+		{
+			"table of a typed result", "table", policy.LintResult{Issues: []policy.LintIssue{{Rule: "no-end-room", Severity: "warning", Path: "roles", Message: "m"}}}, []string{"severity", "rule"},
+			"SEVERITY  RULE\nwarning   no-end-room\n", "",
+		},
+		{"table of a stringer", "table", planText{}, nil, "~ roles.host.priority: 1 => 2\n", ""},
+		{"text in any format", "json", "complete -F _hmsctl hmsctl\n", nil, "complete -F _hmsctl hmsctl\n", ""},
+		{
+			"json", "json", map[string]interface{}{"id": "r1", "enabled": true}, nil,
+			"{\n  \"enabled\": true,\n  \"id\": \"r1\"\n}\n", "",
+		},
+		{
+			"yaml", "yaml", map[string]interface{}{"id": "r1", "roles": []interface{}{"host", "guest"}}, nil,
+			"id: r1\nroles:\n  - host\n  - guest\n", "",
+		},
+		{"unknown format", "xml", rooms, nil, "", `unknown output format "xml"`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var out strings.Builder
+			err := render(&out, test.format, test.value, test.columns)
+			if test.err != "" {
+				if err == nil || err.Error() != test.err {
+					t.Fatalf("got error %v, want %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != test.want {
+				t.Errorf("rendered\n%s\nwant\n%s", out.String(), test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"api/helpers"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Used when neither the environment nor the profile sets BASE_URL
+const defaultBaseUrl = "https://api.100ms.live/v2/"
+
+// Credentials of one 100ms workspace
+type Profile struct {
+	BaseUrl      string `yaml:"base_url,omitempty"`
+	AuthBaseUrl  string `yaml:"auth_base_url,omitempty"`
+	AppAccessKey string `yaml:"app_access_key"`
+	AppSecret    string `yaml:"app_secret"`
+}
+
+type Config struct {
+	Current  string              `yaml:"current,omitempty"`
+	Profiles map[string]*Profile `yaml:"profiles"`
+}
+
+// HMSCTL_CONFIG or hmsctl/config.yaml in the user's config directory
+func configPath() (string, error) {
+	if path := os.Getenv("HMSCTL_CONFIG"); path != "" {
+		return path, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "hmsctl", "config.yaml"), nil
+}
+
+func loadConfig() (*Config, error) {
+	config := &Config{Profiles: map[string]*Profile{}}
+
+	path, err := configPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return config, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if config.Profiles == nil {
+		config.Profiles = map[string]*Profile{}
+	}
+	return config, nil
+}
+
+func saveConfig(config *Config) error {
+	path, err := configPath()
+	if err != nil {
+		return err
+	}
+	data, err := yaml.Marshal(config)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	// The file holds app secrets
+	return os.WriteFile(path, data, 0o600)
+}
+
+// Point the client at the workspace of the named profile, or the current one.
+// Without any profiles the APP_ACCESS_KEY, APP_SECRET and BASE_URL environment
+// variables are used as they are by the API service, with the public 100ms API
+// when BASE_URL is not set.
+func useProfile(name string) error {
+	if err := applyProfile(name); err != nil {
+		return err
+	}
+	if helpers.GetBaseUrl() == "" {
+		return os.Setenv("BASE_URL", defaultBaseUrl)
+	}
+	return nil
+}
+
+func applyProfile(name string) error {
+	config, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		name = config.Current
+	}
+	if name == "" {
+		return nil
+	}
+
+	profile, ok := config.Profiles[name]
+	if !ok {
+		return fmt.Errorf("unknown profile %q", name)
+	}
+	env := map[string]string{
+		"BASE_URL":       profile.BaseUrl,
+		"AUTH_BASE_URL":  profile.AuthBaseUrl,
+		"APP_ACCESS_KEY": profile.AppAccessKey,
+		"APP_SECRET":     profile.AppSecret,
+	}
+	for key, value := range env {
+		if value == "" {
+			continue
+		}
+		if err := os.Setenv(key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// The workspace of a profile, for commands that work with two at once
+func profileWorkspace(name string) (*helpers.Workspace, error) {
+	config, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	profile, ok := config.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown profile %q", name)
+	}
+	return &helpers.Workspace{
+		Name:         name,
+		AppAccessKey: profile.AppAccessKey,
+		AppSecret:    profile.AppSecret,
+		BaseUrl:      profile.BaseUrl,
+	}, nil
+}
+
+func listProfiles(args []string) (interface{}, error) {
+	config, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(config.Profiles))
+	for name := range config.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	profiles := []interface{}{}
+	for _, name := range names {
+		profiles = append(profiles, map[string]interface{}{
+			"name":           name,
+			"current":        name == config.Current,
+			"base_url":       config.Profiles[name].BaseUrl,
+			"app_access_key": config.Profiles[name].AppAccessKey,
+		})
+	}
+	return map[string]interface{}{"data": profiles}, nil
+}
+
+func useProfileCommand(args []string) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, errors.New("usage: hmsctl profile use <name>")
+	}
+	config, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := config.Profiles[args[0]]; !ok {
+		return nil, fmt.Errorf("unknown profile %q", args[0])
+	}
+	config.Current = args[0]
+	return nil, saveConfig(config)
+}
+
+func setProfile(args []string) (interface{}, error) {
+	flags := flag.NewFlagSet("profile set", flag.ContinueOnError)
+	baseUrl := flags.String("base-url", "", "100ms API base url")
+	authBaseUrl := flags.String("auth-base-url", "", "100ms auth API base url")
+	accessKey := flags.String("access-key", "", "app access key")
+	secret := flags.String("secret", "", "app secret")
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return nil, err
+	}
+	if len(positional) != 1 {
+		return nil, errors.New("usage: hmsctl profile set <name> --access-key KEY --secret SECRET [--base-url URL]")
+	}
+
+	config, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	profile, ok := config.Profiles[positional[0]]
+	if !ok {
+		profile = &Profile{}
+		config.Profiles[positional[0]] = profile
+	}
+	if *baseUrl != "" {
+		profile.BaseUrl = *baseUrl
+	}
+	if *authBaseUrl != "" {
+		profile.AuthBaseUrl = *authBaseUrl
+	}
+	if *accessKey != "" {
+		profile.AppAccessKey = *accessKey
+	}
+	if *secret != "" {
+		profile.AppSecret = *secret
+	}
+	if config.Current == "" {
+		config.Current = positional[0]
+	}
+	return nil, saveConfig(config)
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"api/helpers"
+)
+
+const testConfig = `current: staging
+profiles:
+  staging:
+    base_url: https://staging.example.com/v2/
+    app_access_key: staging-key
+    app_secret: staging-secret
+  prod:
+    auth_base_url: https://auth.example.com/
+    app_access_key: prod-key
+    app_secret: prod-secret
+`
+
+// A config file in a temporary directory, and an environment without any of
+// the variables profiles set
+func useConfig(t *testing.T, config string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "hmsctl", "config.yaml")
+	t.Setenv("HMSCTL_CONFIG", path)
+	for _, key := range []string{"BASE_URL", "AUTH_BASE_URL", "APP_ACCESS_KEY", "APP_SECRET"} {
+		t.Setenv(key, "")
+		os.Unsetenv(key)
+	}
+	if config != "" {
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return path
+}
+
+func TestUseProfile(t *testing.T) {
+	tests := []struct {
+		name, config, profile string
+		env                   map[string]string
+		want                  map[string]string
+		err                   string
+	}{
+		{
+			name: "no profiles",
+			want: map[string]string{"BASE_URL": defaultBaseUrl},
+		},
+		{
+			name: "no profiles with the environment",
+			env:  map[string]string{"BASE_URL": "https://env.example.com/", "APP_ACCESS_KEY": "env-key"},
+			want: map[string]string{"BASE_URL": "https://env.example.com/", "APP_ACCESS_KEY": "env-key"},
+		},
+		{
+			name:   "current profile",
+			config: testConfig,
+			want:   map[string]string{"BASE_URL": "https://staging.example.com/v2/", "APP_ACCESS_KEY": "staging-key", "APP_SECRET": "staging-secret"},
+		},
+		{
+			name:    "named profile without a base url",
+			config:  testConfig,
+			profile: "prod",
+			want:    map[string]string{"BASE_URL": defaultBaseUrl, "AUTH_BASE_URL": "https://auth.example.com/", "APP_ACCESS_KEY": "prod-key"},
+		},
+		{
+			name:    "profile over the environment",
+			config:  testConfig,
+			profile: "prod",
+			env:     map[string]string{"BASE_URL": "https://env.example.com/", "APP_ACCESS_KEY": "env-key"},
+			want:    map[string]string{"BASE_URL": "https://env.example.com/", "APP_ACCESS_KEY": "prod-key"},
+		},
+		{
+			name:    "unknown profile",
+			config:  testConfig,
+			profile: "dev",
+			err:     `unknown profile "dev"`,
+		},
+		{
+			name:   "invalid config",
+			config: "profiles: [",
+			err:    "yaml",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useConfig(t, test.config)
+			for key, value := range test.env {
+				os.Setenv(key, value)
+			}
+			err := useProfile(test.profile)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("got error %v, want one with %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for key, want := range test.want {
+				if got := os.Getenv(key); got != want {
+					t.Errorf("%s = %q, want %q", key, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestSetProfile(t *testing.T) {
+	path := useConfig(t, "")
+	for _, args := range [][]string{
+		{"staging", "--access-key", "staging-key", "--secret", "staging-secret"},
+		{"--access-key", "prod-key", "prod", "--secret", "prod-secret", "--base-url", "https://prod.example.com/"},
+		// Updates keep what is not given
+		{"staging", "--base-url", "https://staging.example.com/"},
+	} {
+		if _, err := setProfile(args); err != nil {
+			t.Fatalf("%q: %v", args, err)
+		}
+	}
+	if _, err := setProfile([]string{"--secret", "s"}); err == nil {
+		t.Error("set a profile without a name")
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("config file mode %v, want 0600", info.Mode().Perm())
+	}
+
+	// The first profile set becomes the current one, until another is used
+	if config, _ := loadConfig(); config.Current != "staging" {
+		t.Errorf("current profile %q, want staging", config.Current)
+	}
+	if _, err := useProfileCommand([]string{"prod"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := useProfileCommand([]string{"dev"}); err == nil {
+		t.Error("used an unknown profile")
+	}
+	list, err := listProfiles(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{"data": []interface{}{
+		map[string]interface{}{"name": "prod", "current": true, "base_url": "https://prod.example.com/", "app_access_key": "prod-key"},
+		map[string]interface{}{"name": "staging", "current": false, "base_url": "https://staging.example.com/", "app_access_key": "staging-key"},
+	}}
+	if !reflect.DeepEqual(list, want) {
+		t.Errorf("listed %v, want %v", list, want)
+	}
+	config, err := loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Profiles["staging"].AppSecret != "staging-secret" {
+		t.Errorf("staging profile %+v lost its secret", config.Profiles["staging"])
+	}
+}
+
+// The base url of a profile is applied after the packages are initialised,
+// and used by those that call the 100ms API on behalf of hmsctl
+func TestProfileBaseUrl(t *testing.T) {
+	requested := ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = r.URL.Path
+		w.Write([]byte(`{"id": "t1", "name": "t", "roles": {}}`))
+	}))
+	defer server.Close()
+	useConfig(t, "profiles:\n  fake:\n    base_url: "+server.URL+"/v2/\n    app_access_key: key\n    app_secret: secret\n")
+	if err := useProfile("fake"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := lintTemplate([]string{"t1"}); err != nil {
+		t.Fatal(err)
+	}
+	if requested != "/v2/templates/t1" {
+		t.Errorf("requested %q, want /v2/templates/t1", requested)
+	}
+	if family := helpers.EndpointFamily(helpers.GetEndpointUrl("templates/t1")); family != "templates" {
+		t.Errorf("endpoint family %q, want templates", family)
+	}
+}
@@ -0,0 +1,365 @@
+package main
+
+import (
+	"net/http"
+
+	"api/activeroom"
+	"api/analytics"
+	externalstreams "api/externalstreams"
+	"api/health"
+	"api/helpers"
+	"api/janitor"
+	"api/livestreams"
+	"api/openapi"
+	"api/policy"
+	"api/polls"
+	"api/recording"
+	"api/recordingassets"
+	"api/room"
+	"api/roomcodes"
+	"api/schedule"
+	"api/sessions"
+	"api/streamkey"
+	"api/token"
+	"api/vault"
+)
+
+type pingResponse struct {
+	Message string `json:"message"`
+}
+
+type tokenResponse struct {
+	Token string `json:"token"`
+}
+
+type rolePresetsResponse struct {
+	Data []policy.RolePreset `json:"data"`
+}
+
+type schedulesResponse struct {
+	Data []schedule.ScheduleView `json:"data"`
+}
+
+type roomCodePoliciesResponse struct {
+	Data []roomcodes.RoomCodePolicy `json:"data"`
+}
+
+type roomCodeRotationsResponse struct {
+	Data []roomcodes.RoomCodeRotationView `json:"data"`
+}
+
+type codeExchangesResponse struct {
+	Data []roomcodes.CodeExchange `json:"data"`
+}
+
+type rateLimitedCodeExchangesResponse struct {
+	Data []roomcodes.RateLimitedExchanges `json:"data"`
+}
+
+type janitorRunsResponse struct {
+	Data []janitor.Run `json:"data"`
+}
+
+type credentialsResponse struct {
+	Data []vault.Entry `json:"data"`
+}
+
+type lintRulesResponse struct {
+	Data []policy.LintRule `json:"data"`
+	Mode string            `json:"mode"`
+}
+
+type templateHistoryResponse struct {
+	Data []policy.Snapshot `json:"data"`
+}
+
+// Document every route for the OpenAPI specification.
+// Routes registered in main without an entry here, or without their request body
+// and response, fail the openapi coverage test.
+func registerDocs() {
+	openapi.Register(ping, openapi.Operation{Summary: "Check that the service is up", Response: pingResponse{}})
+	openapi.Register(health.GetHealth, openapi.Operation{Summary: "Service health and circuit breaker states", Response: health.Health{}})
+	openapi.Register(health.GetMetrics, openapi.Operation{Summary: "Prometheus metrics", ContentType: "text/plain"})
+
+	openapi.Register(token.CreateToken, openapi.Operation{Summary: "Create a token for joining a room", Body: token.RequestBody{}, Response: tokenResponse{}})
+
+	// Rooms
+	openapi.Register(room.ListRooms, openapi.Operation{
+		Summary:     "Get the list of rooms",
+		Description: "Rooms include the tags kept by this service. With tag=key:value (or tag=key, repeated to require several) only the tagged rooms are listed, without paging.",
+		Query:       []interface{}{room.HMSRoomQueryParam{}},
+		Upstream:    true,
+	})
+	openapi.Register(room.GetRoom, openapi.Operation{Summary: "Get details of a single room", Upstream: true})
+	openapi.Register(room.CreateRoom, openapi.Operation{Summary: "Create a new room", Body: room.HMSRoom{}, Upstream: true})
+	openapi.Register(room.CreateRooms, openapi.Operation{
+		Summary:     "Create rooms in bulk with their room codes",
+		Description: "Takes a JSON list of rooms or a CSV file (Content-Type: text/csv). Rooms that already exist by name are kept, so a batch can be run again. Responds with 207 when some rooms failed.",
+		Body:        room.BulkRoomsBody{},
+		Query:       []interface{}{room.BulkRoomsQueryParam{}},
+		Response:    room.BulkManifest{},
+	})
+	openapi.Register(room.UpdateRoom, openapi.Operation{Summary: "Update a room", Body: room.HMSRoom{}, Upstream: true})
+	openapi.Register(room.CloneRoom, openapi.Operation{
+		Summary:     "Create a room with the settings of another",
+		Description: "Copies the template, region, recording_info, size, polls and other settings of the room, with the fields of the body on top. The name is not copied. With room_codes, a room code is created for every role the source room has an enabled code for. Tags are copied unless the body sets them.",
+		Body:        room.CloneRoomBody{},
+		Response:    room.ClonedRoom{},
+	})
+	openapi.Register(room.EnableRoom, openapi.Operation{Summary: "Enable a room", NoBody: true, Upstream: true})
+	openapi.Register(room.DisableRoom, openapi.Operation{Summary: "Disable a room", NoBody: true, Upstream: true})
+	openapi.Register(schedule.ListSchedules, openapi.Operation{Summary: "List the schedules of all rooms", Query: []interface{}{schedule.ScheduleQueryParam{}}, Response: schedulesResponse{}})
+	openapi.Register(schedule.ListRoomSchedules, openapi.Operation{Summary: "List the schedules of a room", Response: schedulesResponse{}})
+	openapi.Register(schedule.GetRoomSchedule, openapi.Operation{Summary: "Get a schedule of a room with its next windows", Response: schedule.ScheduleView{}})
+	openapi.Register(schedule.CreateRoomSchedule, openapi.Operation{
+		Summary:     "Schedule windows for a room to be enabled in",
+		Description: "A single window from start to end, or one of duration at every occurrence of a cron expression or an RRULE (FREQ of DAILY, WEEKLY or MONTHLY) starting at start. The room is enabled enable_before a window opens and disabled once it closes, ending its active session with end_sessions.",
+		Body:        schedule.ScheduleBody{},
+		Response:    schedule.ScheduleView{},
+		Status:      http.StatusCreated,
+	})
+	openapi.Register(schedule.DeleteRoomSchedule, openapi.Operation{Summary: "Delete a schedule of a room", Status: http.StatusNoContent})
+	openapi.Register(vault.ListCredentials, openapi.Operation{Summary: "List the names of the credentials in the vault", Response: credentialsResponse{}})
+	openapi.Register(vault.PutCredentials, openapi.Operation{
+		Summary:     "Store upload credentials in the vault",
+		Description: "The credentials are encrypted with VAULT_MASTER_KEY and never returned. Reference them by name with credentials_ref in the recording upload of a room or template instead of credentials.",
+		Body:        vault.Credentials{},
+		Response:    vault.Entry{},
+	})
+	openapi.Register(vault.DeleteCredentials, openapi.Operation{Summary: "Delete credentials from the vault", Status: http.StatusNoContent})
+	openapi.Register(janitor.ListJanitorRuns, openapi.Operation{Summary: "List the runs of the room janitor, newest first", Query: []interface{}{janitor.JanitorRunQueryParam{}}, Response: janitorRunsResponse{}})
+	openapi.Register(janitor.GetJanitorRun, openapi.Operation{Summary: "Get a run of the room janitor with the stale rooms it found", Response: janitor.Run{}})
+	openapi.Register(janitor.StartJanitorRun, openapi.Operation{
+		Summary:     "Start a run of the room janitor",
+		Description: "Finds the enabled rooms without a session in idle_days and reports them, or disables them and their room codes unless dry_run is set. Options left out of the body come from the JANITOR_ environment variables. The run continues in the background; poll it with GET /janitor/runs/:runId.",
+		Body:        janitor.JanitorRunBody{},
+		Response:    janitor.Run{},
+	})
+
+	// Room codes
+	openapi.Register(roomcodes.GetRoomCode, openapi.Operation{Summary: "Get Room Codes for all Roles in a Room", Upstream: true})
+	openapi.Register(roomcodes.CreateRoomCode, openapi.Operation{
+		Summary:     "Create a Room Code for every Role in the Room at once",
+		Description: "With a body, every code created gets it as its policy, as with PUT /room-codes/code/:code/policy.",
+		Body:        roomcodes.CodePolicy{},
+		Upstream:    true,
+	})
+	openapi.Register(roomcodes.CreateRoomCodeForRole, openapi.Operation{
+		Summary:     "Create a Room Code for a specific Role in a Room",
+		Description: "With a body, the code created gets it as its policy, as with PUT /room-codes/code/:code/policy.",
+		Body:        roomcodes.CodePolicy{},
+		Upstream:    true,
+	})
+	openapi.Register(roomcodes.UpdateRoomCode, openapi.Operation{Summary: "Update the current state for a given Room Code", Body: roomcodes.HMSRoomCodeUpdateRequestBody{}, Upstream: true})
+	openapi.Register(roomcodes.CreateShortCodeAuthToken, openapi.Operation{
+		Summary:     "Create the auth token for a given short code",
+		Description: "Attempts are limited per caller IP and per code, and need the X-Exchange-Secret header when CODE_EXCHANGE_SECRET is set and a valid X-Captcha-Token when CODE_EXCHANGE_CAPTCHA_URL is set. Codes on the denylist, off a non-empty allowlist, or whose policy expired, was used up or is outside its windows are refused with a 403. Every attempt is recorded in GET /room-codes/exchanges.",
+		NoBody:      true,
+		Response:    tokenResponse{},
+	})
+	openapi.Register(roomcodes.ListRoomCodePolicies, openapi.Operation{Summary: "List the policies of room codes", Query: []interface{}{roomcodes.RoomCodePolicyQueryParam{}}, Response: roomCodePoliciesResponse{}})
+	openapi.Register(roomcodes.GetRoomCodePolicy, openapi.Operation{Summary: "Get the policy of a room code with its redemptions", Response: roomcodes.RoomCodePolicy{}})
+	openapi.Register(roomcodes.PutRoomCodePolicy, openapi.Operation{
+		Summary:     "Set when and how many times a room code can be exchanged for an auth token",
+		Description: "Codes past expires_at or max_redemptions are refused and disabled in 100ms every ROOM_CODE_POLICY_INTERVAL. With windows, codes are only accepted from each cron occurrence for its duration, in timezone.",
+		Body:        roomcodes.RoomCodePolicyBody{},
+		Response:    roomcodes.RoomCodePolicy{},
+	})
+	openapi.Register(roomcodes.DeleteRoomCodePolicy, openapi.Operation{Summary: "Remove the policy of a room code", Status: http.StatusNoContent})
+	openapi.Register(roomcodes.RotateRoomCode, openapi.Operation{
+		Summary:     "Replace the room code of a role with a fresh one",
+		Description: "Creates a new room code for the role, disables the codes it had before and posts the new code to the webhook_url of the body, of the room's rotation or ROOM_CODE_WEBHOOK_URL. The webhook_url of the body must be on the host of ROOM_CODE_WEBHOOK_URL or in ROOM_CODE_WEBHOOK_ALLOWED_HOSTS. A 207 reports previous codes that could not be disabled.",
+		Body:        roomcodes.RotateRoomCodeBody{},
+		Response:    roomcodes.RotatedRoomCode{},
+	})
+	openapi.Register(roomcodes.ListRoomCodeRotations, openapi.Operation{Summary: "List the scheduled rotations of room codes", Response: roomCodeRotationsResponse{}})
+	openapi.Register(roomcodes.GetRoomCodeRotation, openapi.Operation{Summary: "Get the scheduled rotation of the room codes of a room", Response: roomcodes.RoomCodeRotationView{}})
+	openapi.Register(roomcodes.PutRoomCodeRotation, openapi.Operation{
+		Summary:     "Rotate the room codes of a room on a cron schedule",
+		Description: "Rotates the given roles, or every role with an enabled room code, at each occurrence of cron in timezone, e.g. \"0 3 * * *\" for nightly. The webhook_url must be on the host of ROOM_CODE_WEBHOOK_URL or in ROOM_CODE_WEBHOOK_ALLOWED_HOSTS.",
+		Body:        roomcodes.RoomCodeRotationBody{},
+		Response:    roomcodes.RoomCodeRotationView{},
+	})
+	openapi.Register(roomcodes.DeleteRoomCodeRotation, openapi.Operation{Summary: "Stop rotating the room codes of a room", Status: http.StatusNoContent})
+	openapi.Register(roomcodes.ListCodeExchanges, openapi.Operation{
+		Summary:     "List the attempts to exchange room codes for auth tokens, newest first",
+		Description: "Rate limited attempts are counted per caller IP and code, and listed at /room-codes/exchanges/rate-limited.",
+		Query:       []interface{}{roomcodes.CodeExchangeQueryParam{}},
+		Response:    codeExchangesResponse{},
+	})
+	openapi.Register(roomcodes.ListRateLimitedCodeExchanges, openapi.Operation{
+		Summary:     "List the callers and codes whose attempts to exchange room codes were rate limited",
+		Description: "Counts the attempts of each caller IP on each code since the service started, most recently limited first.",
+		Query:       []interface{}{roomcodes.RateLimitedExchangesQueryParam{}},
+		Response:    rateLimitedCodeExchangesResponse{},
+	})
+	openapi.Register(roomcodes.GetCodeAccessList, openapi.Operation{Summary: "Get the codes denied or exclusively allowed to be exchanged for auth tokens", Response: roomcodes.CodeAccessList{}})
+	openapi.Register(roomcodes.PutCodeAccessList, openapi.Operation{
+		Summary:     "Replace the allowlist and denylist of room codes",
+		Description: "Entries are codes or path.Match patterns such as abc-*. Denied codes are never exchanged; with an allowlist, only the codes on it are.",
+		Body:        roomcodes.CodeAccessList{},
+		Response:    roomcodes.CodeAccessList{},
+	})
+	openapi.Register(roomcodes.CreateJoinLinks, openapi.Operation{
+		Summary:     "Create ready to share join links for the roles of a room",
+		Description: "Embeds the enabled room code of each role in the link template of the body, JOIN_LINK_TEMPLATE or the prebuilt app of JOIN_LINK_SUBDOMAIN. Templates of the body must be on the host of a configured template or in JOIN_LINK_ALLOWED_HOSTS. Room codes are created for the given roles that have none. With short set, each link also gets a short link on SHORT_LINK_BASE_URL; with qr set, a PNG or SVG QR code of the link as a data URI.",
+		Body:        roomcodes.JoinLinksBody{},
+		Response:    roomcodes.JoinLinks{},
+	})
+	openapi.Register(roomcodes.GetJoinLinkQR, openapi.Operation{Summary: "Get the QR code of the join link of a role as a PNG or SVG image", Description: "With short set, the QR code is of the short link created for the join link by POST /room-codes/{roomId}/join-links.", Query: []interface{}{roomcodes.JoinLinkQRQueryParam{}}, ContentType: "image/png"})
+	openapi.Register(roomcodes.RedirectShortLink, openapi.Operation{Summary: "Redirect a short link to its join link", Status: http.StatusFound})
+
+	// Active rooms
+	openapi.Register(activeroom.GetActiveRoom, openapi.Operation{Summary: "Get details of a specific Active Room", Upstream: true})
+	openapi.Register(activeroom.GetPeer, openapi.Operation{Summary: "Get details of a specific Peer in an active Room", Upstream: true})
+	openapi.Register(activeroom.ListPeers, openapi.Operation{Summary: "List details of the Active Peers in a Room", Query: []interface{}{activeroom.HMSActiveRoomQueryParam{}}, Upstream: true})
+	openapi.Register(activeroom.UpdatePeer, openapi.Operation{Summary: "Update the details of a connected Peer", Body: activeroom.HMSPeerUpdateBody{}, Upstream: true})
+	openapi.Register(activeroom.SendMessage, openapi.Operation{Summary: "Send Message to the room", Body: activeroom.HMSMessageBody{}, Upstream: true})
+	openapi.Register(activeroom.RemovePeer, openapi.Operation{Summary: "Remove/Disconnect a connected Peer from an Active Room", Body: activeroom.HMSRemovePeerBody{}, Upstream: true})
+	openapi.Register(activeroom.EndRoom, openapi.Operation{Summary: "End an Active Room", Body: activeroom.HMSEndRoomBody{}, Upstream: true})
+
+	// Recordings
+	openapi.Register(recording.StartRecording, openapi.Operation{Summary: "Start a recording for a room", Body: recording.HMSStartRecordingBody{}, Upstream: true})
+	openapi.Register(recording.StopRecordings, openapi.Operation{Summary: "Stop all recordings running in a room", NoBody: true, Upstream: true})
+	openapi.Register(recording.StopRecording, openapi.Operation{Summary: "Stop a specific recording", NoBody: true, Upstream: true})
+	openapi.Register(recording.ListRecordings, openapi.Operation{Summary: "Get recording jobs of a workspace", Upstream: true})
+	openapi.Register(recording.GetRecording, openapi.Operation{Summary: "Get details of a recording", Upstream: true})
+	openapi.Register(recording.GetRecordingConfig, openapi.Operation{Summary: "Get the configuration of a recording", Upstream: true})
+
+	// Sessions
+	openapi.Register(sessions.ListSessions, openapi.Operation{Summary: "Get details of all sessions in an account", Query: []interface{}{sessions.HMSSessionQueryParam{}}, Upstream: true})
+	openapi.Register(sessions.ExportSessions, openapi.Operation{
+		Summary:     "Export all sessions as NDJSON or CSV",
+		Description: "Pages through all sessions and streams them as `application/x-ndjson` or `text/csv`.",
+		Query:       []interface{}{sessions.HMSSessionQueryParam{}, helpers.ExportQueryParam{}},
+		ContentType: "application/x-ndjson",
+	})
+	openapi.Register(sessions.GetSession, openapi.Operation{Summary: "Get details of a specific session", Upstream: true})
+
+	// Recording assets
+	openapi.Register(recordingassets.ListRecordingAssets, openapi.Operation{Summary: "Get details of all recording assets of a workspace", Query: []interface{}{recordingassets.HMSRecordingAssetsQueryParam{}}, Upstream: true})
+	openapi.Register(recordingassets.ExportRecordingAssets, openapi.Operation{
+		Summary:     "Export all recording assets as NDJSON or CSV",
+		Description: "Pages through all recording assets and streams them as `application/x-ndjson` or `text/csv`.",
+		Query:       []interface{}{recordingassets.HMSRecordingAssetsQueryParam{}, helpers.ExportQueryParam{}},
+		ContentType: "application/x-ndjson",
+	})
+	openapi.Register(recordingassets.GetRecordingAsset, openapi.Operation{Summary: "Get details of a Recording Asset", Upstream: true})
+	openapi.Register(recordingassets.GetPresignedUrl, openapi.Operation{Summary: "Generate a short-lived pre-signed URL for a recording asset", Query: []interface{}{recordingassets.HMSPresignedUrlQueryParam{}}, Upstream: true})
+
+	// External streams
+	openapi.Register(externalstreams.StartExternalStream, openapi.Operation{Summary: "Start an external stream for a room", Body: externalstreams.HMSStartExternalStreamBody{}, Upstream: true})
+	openapi.Register(externalstreams.StopExternalStreams, openapi.Operation{Summary: "Stop all external streams running in the room", NoBody: true, Upstream: true})
+	openapi.Register(externalstreams.StopExternalStream, openapi.Operation{Summary: "Stop an external stream using its unique identifier", NoBody: true, Upstream: true})
+	openapi.Register(externalstreams.ListExternalStreams, openapi.Operation{Summary: "Get details of all external streams of a workspace", Query: []interface{}{externalstreams.HMSExternalStreamsQueryParam{}}, Upstream: true})
+	openapi.Register(externalstreams.GetExternalStream, openapi.Operation{Summary: "Get the details of an external stream", Upstream: true})
+
+	// Polls
+	openapi.Register(polls.GetPoll, openapi.Operation{Summary: "Get a Poll", Upstream: true})
+	openapi.Register(polls.GetPollSessions, openapi.Operation{Summary: "Get Poll Sessions", Query: []interface{}{polls.PollQueryParam{}}, Upstream: true})
+	openapi.Register(polls.ListPollResults, openapi.Operation{Summary: "List Poll Results", Query: []interface{}{polls.PollQueryParam{}}, Upstream: true})
+	openapi.Register(polls.GetPollResult, openapi.Operation{Summary: "Get Poll Result", Upstream: true})
+	openapi.Register(polls.ListPollResponses, openapi.Operation{Summary: "List Poll Responses", Query: []interface{}{polls.PollQueryParam{}}, Upstream: true})
+	openapi.Register(polls.GetPollResponse, openapi.Operation{Summary: "Get Poll Response", Upstream: true})
+	openapi.Register(polls.CreatePoll, openapi.Operation{Summary: "Create a Poll", Body: polls.HMSPoll{}, Upstream: true})
+	openapi.Register(polls.UpdatePoll, openapi.Operation{Summary: "Update a Poll", Body: polls.HMSPoll{}, Upstream: true})
+	openapi.Register(polls.UpdatePollQuestion, openapi.Operation{Summary: "Update Poll Question", Body: polls.PollQuestion{}, Upstream: true})
+	openapi.Register(polls.UpdatePollOption, openapi.Operation{Summary: "Update Poll Option", Body: polls.PollOption{}, Upstream: true})
+	openapi.Register(polls.DeletePollOption, openapi.Operation{Summary: "Delete Poll Option", Upstream: true})
+	openapi.Register(polls.DeletePollQuestion, openapi.Operation{Summary: "Delete Poll Question", Upstream: true})
+
+	// Live streams
+	openapi.Register(livestreams.StartLiveStream, openapi.Operation{Summary: "Start a livestream for room", Body: livestreams.HMSLivestream{}, Upstream: true})
+	openapi.Register(livestreams.StopLiveStreams, openapi.Operation{Summary: "Stop all livestreams in a room", NoBody: true, Upstream: true})
+	openapi.Register(livestreams.StopLiveStream, openapi.Operation{Summary: "Stop a livestream using its unique identifier", NoBody: true, Upstream: true})
+	openapi.Register(livestreams.SendTimedMetada, openapi.Operation{Summary: "Send timed metadata for a running live stream", Body: livestreams.TimedMetaDataBody{}, Upstream: true})
+	openapi.Register(livestreams.PauseLiveStreamRecording, openapi.Operation{Summary: "Pause recording of a running livestream", NoBody: true, Upstream: true})
+	openapi.Register(livestreams.ResumeLiveStreamRecording, openapi.Operation{Summary: "Resume a paused livestream recording", NoBody: true, Upstream: true})
+	openapi.Register(livestreams.ListLiveStreams, openapi.Operation{Summary: "Get details of all livestreams of a workspace", Query: []interface{}{livestreams.HMSLiveStreamsQueryParam{}}, Upstream: true})
+	openapi.Register(livestreams.GetLiveStream, openapi.Operation{Summary: "Get details of a livestream", Upstream: true})
+
+	// Templates
+	openapi.Register(policy.ListTemplates, openapi.Operation{Summary: "Get the details of all templates in an account", Query: []interface{}{policy.HMSTemplateQueryParam{}}, Upstream: true})
+	openapi.Register(policy.GetTemplate, openapi.Operation{Summary: "Get the details of a specific template", Upstream: true})
+	openapi.Register(policy.GetTemplateRole, openapi.Operation{Summary: "Get details of a specific Role in a template", Upstream: true})
+	openapi.Register(policy.GetTemplateSettings, openapi.Operation{Summary: "Get settings of a template", Upstream: true})
+	openapi.Register(policy.GetTemplateDestinations, openapi.Operation{Summary: "Get the list of destinations in a template", Upstream: true})
+	openapi.Register(policy.CreateTemplate, openapi.Operation{Summary: "Create a template", Body: policy.HMSTemplate{}, Upstream: true})
+	openapi.Register(policy.UpdateTemplate, openapi.Operation{Summary: "Update the details of a template", Body: policy.HMSTemplate{}, Upstream: true})
+	openapi.Register(policy.ModifyTemplateRole, openapi.Operation{Summary: "Create or Modify a Role in a template", Body: policy.HMSRole{}, Upstream: true})
+	openapi.Register(policy.UpdateTemplateSettings, openapi.Operation{Summary: "Update the settings of a template", Body: policy.HMSSetting{}, Upstream: true})
+	openapi.Register(policy.UpdateTemplateDestinations, openapi.Operation{Summary: "Update the destinations in a template", Body: policy.HMSDestination{}, Upstream: true})
+	openapi.Register(policy.PatchTemplateRole, openapi.Operation{
+		Summary:     "Update fields of a role with a JSON merge patch",
+		Description: "The patch (RFC 7386) is applied to the current role and the result is sent to 100ms, so false and zero values such as permissions being turned off are kept.",
+		Body:        policy.HMSRole{},
+		Upstream:    true,
+	})
+	openapi.Register(policy.PatchTemplateSettings, openapi.Operation{Summary: "Update fields of the settings of a template with a JSON merge patch", Body: policy.HMSSetting{}, Upstream: true})
+	openapi.Register(policy.PatchTemplateDestinations, openapi.Operation{
+		Summary:     "Update fields of the destinations of a template with a JSON merge patch",
+		Description: "Setting a destination to null removes it.",
+		Body:        policy.HMSDestination{},
+		Upstream:    true,
+	})
+	openapi.Register(policy.DeleteTemplateRole, openapi.Operation{Summary: "Delete a Role in a template", Upstream: true})
+	openapi.Register(policy.ListRolePresets, openapi.Operation{Summary: "List the role presets templates can be built from", Response: rolePresetsResponse{}})
+	openapi.Register(policy.CreateTemplateFromPresets, openapi.Operation{
+		Summary:     "Create a template with roles made from presets",
+		Description: "The overrides of each role are a JSON merge patch of its preset. Roles watching the publishers subscribe to every role that publishes unless subscribeToRoles is overridden.",
+		Body:        policy.TemplateFromPresetsBody{},
+		Upstream:    true,
+	})
+	openapi.Register(policy.AddTemplateRoleFromPreset, openapi.Operation{Summary: "Create or replace a role of a template from a preset", Body: policy.RoleFromPreset{}, Upstream: true})
+	openapi.Register(policy.ListLintRules, openapi.Operation{Summary: "List the rules templates are linted with", Response: lintRulesResponse{}})
+	openapi.Register(policy.LintTemplateFile, openapi.Operation{Summary: "Lint a YAML or JSON template without saving it", Body: policy.HMSTemplate{}, Response: policy.LintResult{}})
+	openapi.Register(policy.LintExistingTemplate, openapi.Operation{Summary: "Lint a template as it is in 100ms", Response: policy.LintResult{}})
+	openapi.Register(policy.ListTemplateHistory, openapi.Operation{Summary: "List the recorded versions of a template", Response: templateHistoryResponse{}})
+	openapi.Register(policy.GetTemplateVersion, openapi.Operation{Summary: "Get a recorded version of a template", Response: policy.Snapshot{}})
+	openapi.Register(policy.RollbackTemplate, openapi.Operation{
+		Summary:     "Roll a template back to a recorded version",
+		Description: "Updates the name, roles, settings and destinations of the template and deletes roles added since the version.",
+		Response:    policy.ApplyResult{},
+		NoBody:      true,
+	})
+	openapi.Register(policy.CloneTemplateToWorkspace, openapi.Operation{
+		Summary:     "Clone a template into another workspace",
+		Description: "Creates or updates the template with the same, or mapped, name in the target workspace. Upload credentials and RTMP urls are not copied; an updated template keeps its own. With dry_run the changes are only reported.",
+		Body:        policy.CloneTemplateBody{},
+		Response:    policy.CloneReport{},
+	})
+	openapi.Register(policy.ExportTemplateFile, openapi.Operation{
+		Summary:     "Export a template as a YAML file",
+		Description: "Responds with JSON instead when format=json.",
+		Query:       []interface{}{policy.TemplateFileQueryParam{}},
+		Response:    policy.HMSTemplate{},
+	})
+	openapi.Register(policy.PlanTemplateFile, openapi.Operation{
+		Summary:     "Show the changes applying a template file would make",
+		Description: "Compares the file with the current template. format=text responds with a human readable plan.",
+		Body:        policy.HMSTemplate{},
+		Query:       []interface{}{policy.PlanTemplateQueryParam{}},
+		Response:    policy.Plan{},
+	})
+	openapi.Register(policy.ApplyTemplateFile, openapi.Operation{
+		Summary:     "Apply a YAML or JSON template file",
+		Description: "Creates a template, or with a template ID in the path updates its name, roles, settings and destinations one by one. Send YAML with Content-Type application/yaml. prune=true deletes roles missing from the file. Updates respond with 428 and the plan unless plan=<plan_id> confirms it or auto_approve=true is set.",
+		Body:        policy.HMSTemplate{},
+		Query:       []interface{}{policy.ApplyTemplateQueryParam{}},
+		Response:    policy.ApplyResult{},
+	})
+
+	// Stream keys
+	openapi.Register(streamkey.GetStreamKey, openapi.Operation{Summary: "Get the RTMP stream key and URL for a specific room", Upstream: true})
+	openapi.Register(streamkey.CreateStreamKey, openapi.Operation{Summary: "Create RTMP Stream Key and URL", NoBody: true, Upstream: true})
+	openapi.Register(streamkey.DisableStreamKey, openapi.Operation{Summary: "Disable the RTMP stream key for a specific room", NoBody: true, Upstream: true})
+
+	// Analytics
+	openapi.Register(analytics.GetAnalyticsEvents, openapi.Operation{Summary: "Get analytics events", Query: []interface{}{analytics.HMSAnalyticsQueryParam{}}, Upstream: true})
+	openapi.Register(analytics.ExportAnalyticsEvents, openapi.Operation{
+		Summary:     "Export all analytics events as NDJSON or CSV",
+		Description: "Pages through all analytics events and streams them as `application/x-ndjson` or `text/csv`.",
+		Query:       []interface{}{analytics.HMSAnalyticsQueryParam{}, helpers.ExportQueryParam{}},
+		ContentType: "application/x-ndjson",
+	})
+}
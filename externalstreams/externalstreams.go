@@ -13,7 +13,9 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-var externalStreamsBaseUrl = helpers.GetEndpointUrl("external-streams")
+func externalStreamsBaseUrl() string {
+	return helpers.GetEndpointUrl("external-streams")
+}
 
 type VideoResolution struct {
 	Height uint32 `json:"height,omitempty"`
@@ -22,7 +24,7 @@ type VideoResolution struct {
 
 type HMSStartExternalStreamBody struct {
 	MeetingUrl  string           `json:"meeting_url,omitempty"`
-	RTMPUrls    []string         `json:"rtmp_urls"`
+	RTMPUrls    []string         `json:"rtmp_urls" binding:"required,min=1,max=3,dive,required,url"`
 	Recording   bool             `json:"recording,omitempty"`
 	Destination string           `json:"destination,omitempty"`
 	Resolution  *VideoResolution `json:"resolution,omitempty"`
@@ -44,8 +46,8 @@ func StartExternalStream(ctx *gin.Context) {
 	}
 
 	var rb HMSStartExternalStreamBody
-	if err := ctx.ShouldBindJSON(&rb); err != nil {
-		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !helpers.BindJSON(ctx, &rb) {
+		return
 	}
 
 	var videoResolution *VideoResolution
@@ -65,7 +67,7 @@ func StartExternalStream(ctx *gin.Context) {
 		Destination: rb.Destination,
 	})
 	payload := bytes.NewBuffer(postBody)
-	helpers.MakeApiRequest(ctx, externalStreamsBaseUrl+"/room/"+roomId+"/start", "POST", payload)
+	helpers.MakeApiRequest(ctx, externalStreamsBaseUrl()+"/room/"+roomId+"/start", "POST", payload)
 }
 
 // Stop all external streams in the given room
@@ -74,7 +76,7 @@ func StopExternalStreams(ctx *gin.Context) {
 	if !ok {
 		ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": hmserrors.ErrMissingRoomId})
 	}
-	helpers.MakeApiRequest(ctx, externalStreamsBaseUrl+"/room/"+roomId+"/stop", "POST", nil)
+	helpers.MakeApiRequest(ctx, externalStreamsBaseUrl()+"/room/"+roomId+"/stop", "POST", nil)
 }
 
 // Stop an external stream given the stream ID
@@ -83,7 +85,7 @@ func StopExternalStream(ctx *gin.Context) {
 	if !ok {
 		ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": hmserrors.ErrMissingStreamId})
 	}
-	helpers.MakeApiRequest(ctx, externalStreamsBaseUrl+"/"+streamId+"/stop", "POST", nil)
+	helpers.MakeApiRequest(ctx, externalStreamsBaseUrl()+"/"+streamId+"/stop", "POST", nil)
 }
 
 // Get an external stream by its ID
@@ -92,7 +94,7 @@ func GetExternalStream(ctx *gin.Context) {
 	if !ok {
 		ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": hmserrors.ErrMissingStreamId})
 	}
-	helpers.MakeApiRequest(ctx, externalStreamsBaseUrl+"/"+streamId, "GET", nil)
+	helpers.MakeApiRequest(ctx, externalStreamsBaseUrl()+"/"+streamId, "GET", nil)
 }
 
 // List all external streams
@@ -109,6 +111,6 @@ func ListExternalStreams(ctx *gin.Context) {
 		qs.Add("start", param.Start)
 		qs.Add("limit", strconv.Itoa(int(param.Limit)))
 	}
-	helpers.MakeApiRequest(ctx, externalStreamsBaseUrl+"?"+qs.Encode(), "GET", nil)
+	helpers.MakeApiRequest(ctx, externalStreamsBaseUrl()+"?"+qs.Encode(), "GET", nil)
 
 }
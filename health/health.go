@@ -0,0 +1,57 @@
+package health
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"api/breaker"
+	"api/helpers"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Health struct {
+	// "ok", or "degraded" while a circuit breaker is not closed
+	Status          string             `json:"status"`
+	CircuitBreakers []breaker.Snapshot `json:"circuit_breakers"`
+}
+
+// Report whether the 100ms API is reachable through the circuit breakers
+func GetHealth(ctx *gin.Context) {
+	status := "ok"
+	snapshots := helpers.CircuitBreakers()
+	for _, snapshot := range snapshots {
+		if snapshot.State != breaker.Closed {
+			status = "degraded"
+		}
+	}
+
+	ctx.JSON(http.StatusOK, Health{Status: status, CircuitBreakers: snapshots})
+}
+
+// Expose the circuit breaker state in the Prometheus text format
+func GetMetrics(ctx *gin.Context) {
+	var metrics strings.Builder
+	snapshots := helpers.CircuitBreakers()
+
+	metrics.WriteString("# HELP hms_circuit_breaker_state State of the circuit breaker: 0 closed, 1 open, 2 half-open.\n")
+	metrics.WriteString("# TYPE hms_circuit_breaker_state gauge\n")
+	for _, snapshot := range snapshots {
+		fmt.Fprintf(&metrics, "hms_circuit_breaker_state{family=%q} %d\n", snapshot.Family, snapshot.State)
+	}
+
+	metrics.WriteString("# HELP hms_circuit_breaker_failures Consecutive failed requests to the 100ms API.\n")
+	metrics.WriteString("# TYPE hms_circuit_breaker_failures gauge\n")
+	for _, snapshot := range snapshots {
+		fmt.Fprintf(&metrics, "hms_circuit_breaker_failures{family=%q} %d\n", snapshot.Family, snapshot.Failures)
+	}
+
+	metrics.WriteString("# HELP hms_circuit_breaker_opened_total Times the circuit breaker has opened.\n")
+	metrics.WriteString("# TYPE hms_circuit_breaker_opened_total counter\n")
+	for _, snapshot := range snapshots {
+		fmt.Fprintf(&metrics, "hms_circuit_breaker_opened_total{family=%q} %d\n", snapshot.Family, snapshot.Opened)
+	}
+
+	ctx.Data(http.StatusOK, "text/plain; version=0.0.4", []byte(metrics.String()))
+}
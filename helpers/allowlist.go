@@ -0,0 +1,38 @@
+package helpers
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Read a comma separated environment variable, leaving out empty entries
+func GetEnvironmentList(key string) []string {
+	value, _ := GetEnvironmentVariable(key)
+	var list []string
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			list = append(list, entry)
+		}
+	}
+	return list
+}
+
+// Whether a url is http or https on one of the hosts, which are host names
+// such as "example.com" or patterns such as "*.example.com" for its subdomains
+func HostAllowed(rawUrl string, hosts []string) bool {
+	parsed, err := url.Parse(rawUrl)
+	if err != nil || parsed.Scheme != "http" && parsed.Scheme != "https" || parsed.User != nil {
+		return false
+	}
+	host := strings.ToLower(parsed.Hostname())
+	for _, allowed := range hosts {
+		allowed = strings.ToLower(allowed)
+		if host == allowed {
+			return true
+		}
+		if suffix, ok := strings.CutPrefix(allowed, "*"); ok && strings.HasPrefix(suffix, ".") && strings.HasSuffix(host, suffix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,45 @@
+package helpers
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGetEnvironmentList(t *testing.T) {
+	t.Setenv("TEST_LIST", " a.example.com, ,*.b.example.com,")
+	if got, want := GetEnvironmentList("TEST_LIST"), []string{"a.example.com", "*.b.example.com"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("list %q, want %q", got, want)
+	}
+	if got := GetEnvironmentList("TEST_LIST_UNSET"); got != nil {
+		t.Errorf("list %q of an unset variable", got)
+	}
+}
+
+func TestHostAllowed(t *testing.T) {
+	hosts := []string{"example.com", "*.apps.example.com"}
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"https://example.com/join?code=abc", true},
+		{"http://EXAMPLE.com:8080/join", true},
+		{"https://meet.apps.example.com/join", true},
+		{"https://apps.example.com/join", false},
+		{"https://www.example.com/join", false},
+		{"https://example.com.evil.test/join", false},
+		{"https://evilexample.com/join", false},
+		{"https://example.com@evil.test/join", false},
+		{"https://user@example.com/join", false},
+		{"javascript://example.com/%0Aalert(1)", false},
+		{"//example.com/join", false},
+		{"not a url", false},
+	}
+	for _, test := range tests {
+		if got := HostAllowed(test.url, hosts); got != test.want {
+			t.Errorf("HostAllowed(%q) = %v, want %v", test.url, got, test.want)
+		}
+	}
+	if HostAllowed("https://example.com", nil) {
+		t.Error("a host is allowed by an empty list")
+	}
+}
@@ -0,0 +1,53 @@
+package helpers
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"api/breaker"
+)
+
+var (
+	breakersMu sync.Mutex
+	breakers   = map[string]*breaker.Breaker{}
+)
+
+// Circuit breaker of an endpoint family, configured through
+// HMS_BREAKER_THRESHOLD consecutive failures and HMS_BREAKER_COOLDOWN
+func circuitBreaker(family string) *breaker.Breaker {
+	breakersMu.Lock()
+	defer breakersMu.Unlock()
+
+	b, ok := breakers[family]
+	if !ok {
+		b = breaker.New(
+			family,
+			GetEnvironmentInt("HMS_BREAKER_THRESHOLD", 5),
+			GetEnvironmentDuration("HMS_BREAKER_COOLDOWN", 30*time.Second),
+		)
+		breakers[family] = b
+	}
+	return b
+}
+
+// State of every circuit breaker used so far, ordered by family
+func CircuitBreakers() []breaker.Snapshot {
+	breakersMu.Lock()
+	defer breakersMu.Unlock()
+
+	snapshots := make([]breaker.Snapshot, 0, len(breakers))
+	for _, b := range breakers {
+		snapshots = append(snapshots, b.Snapshot())
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].Family < snapshots[j].Family
+	})
+	return snapshots
+}
+
+// Server errors count against the breaker, client errors do not
+func isUpstreamFailure(res *http.Response) bool {
+	return res.StatusCode >= http.StatusInternalServerError
+}
@@ -0,0 +1,325 @@
+package helpers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	ExportFormatNDJSON = "ndjson"
+	ExportFormatCSV    = "csv"
+
+	// Largest page size accepted by the 100ms list endpoints
+	exportPageLimit = 100
+
+	// Trailer set when an export stops before its last page, also written as the last record
+	HeaderExportError = "X-Export-Error"
+	exportErrorKey    = "export_error"
+)
+
+type ExportQueryParam struct {
+	Format  string `form:"format,omitempty"`
+	Columns string `form:"columns,omitempty"`
+	After   string `form:"after,omitempty"`
+	Before  string `form:"before,omitempty"`
+}
+
+// Describes how a 100ms list endpoint pages its results
+type ExportOptions struct {
+	// Key holding the items of a page, e.g. "data" or "events"
+	ItemsKey string
+	// Key holding the cursor of the next page, e.g. "last" or "next"
+	CursorKey string
+	// Item field compared against the after/before range. Filtering is skipped when empty.
+	TimeField string
+	// Columns exported when the client selects none. CSV always has a header, NDJSON
+	// items are passed through whole.
+	Columns []string
+}
+
+type exportPage struct {
+	items  []map[string]interface{}
+	cursor string
+}
+
+type exportWriter interface {
+	Begin() error
+	Write(item map[string]interface{}) error
+	// Mark the export as incomplete after the items written so far
+	Fail(err error) error
+	Flush() error
+}
+
+type ndjsonWriter struct {
+	encoder *json.Encoder
+	// Selected columns, every field of the item when nil
+	columns []string
+}
+
+func (w *ndjsonWriter) Begin() error {
+	return nil
+}
+
+// Selected columns are written under their dotted names, e.g. {"peer.name": "..."}
+func (w *ndjsonWriter) Write(item map[string]interface{}) error {
+	if w.columns == nil {
+		return w.encoder.Encode(item)
+	}
+	selected := make(map[string]interface{}, len(w.columns))
+	for _, column := range w.columns {
+		selected[column] = lookupField(item, column)
+	}
+	return w.encoder.Encode(selected)
+}
+
+// A last line {"export_error": "..."} tells an incomplete export from a complete one
+func (w *ndjsonWriter) Fail(err error) error {
+	return w.encoder.Encode(map[string]string{exportErrorKey: err.Error()})
+}
+
+func (w *ndjsonWriter) Flush() error {
+	return nil
+}
+
+type csvWriter struct {
+	writer  *csv.Writer
+	columns []string
+}
+
+// The columns are written as the header before any item
+func (w *csvWriter) Begin() error {
+	return w.writer.Write(w.columns)
+}
+
+func (w *csvWriter) Write(item map[string]interface{}) error {
+	record := make([]string, len(w.columns))
+	for i, column := range w.columns {
+		record[i] = csvValue(lookupField(item, column))
+	}
+	return w.writer.Write(record)
+}
+
+// A last record "#export_error", "..." tells an incomplete export from a complete one
+func (w *csvWriter) Fail(err error) error {
+	return w.writer.Write([]string{"#" + exportErrorKey, err.Error()})
+}
+
+func (w *csvWriter) Flush() error {
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+// Resolve a dotted column such as "peer.name" against an item
+func lookupField(item map[string]interface{}, path string) interface{} {
+	var value interface{} = item
+	for _, key := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = object[key]
+	}
+	return value
+}
+
+func csvValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		encoded, _ := json.Marshal(v)
+		return string(encoded)
+	}
+}
+
+func parseExportTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// Keep items whose time field lies within [after, before)
+func inExportRange(item map[string]interface{}, field string, after, before time.Time) bool {
+	if field == "" || (after.IsZero() && before.IsZero()) {
+		return true
+	}
+	value, ok := lookupField(item, field).(string)
+	if !ok {
+		return false
+	}
+	at, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return false
+	}
+	if !after.IsZero() && at.Before(after) {
+		return false
+	}
+	if !before.IsZero() && !at.Before(before) {
+		return false
+	}
+	return true
+}
+
+func decodeExportPage(body io.Reader, options ExportOptions) (*exportPage, error) {
+	var raw map[string]json.RawMessage
+	if err := json.NewDecoder(body).Decode(&raw); err != nil {
+		return nil, err
+	}
+
+	page := &exportPage{}
+	if items, ok := raw[options.ItemsKey]; ok && string(items) != "null" {
+		if err := json.Unmarshal(items, &page.items); err != nil {
+			return nil, err
+		}
+	}
+	if cursor, ok := raw[options.CursorKey]; ok && string(cursor) != "null" {
+		if err := json.Unmarshal(cursor, &page.cursor); err != nil {
+			return nil, err
+		}
+	}
+	return page, nil
+}
+
+// Page through a 100ms list endpoint and stream every item to the client as NDJSON or CSV.
+// Only one page is held in memory at a time.
+func ExportApiPages(ctx *gin.Context, baseUrl string, qs url.Values, options ExportOptions) {
+	var param ExportQueryParam
+	if err := ctx.ShouldBindQuery(&param); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if param.Format == "" {
+		param.Format = ExportFormatNDJSON
+	}
+	if param.Format != ExportFormatNDJSON && param.Format != ExportFormatCSV {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unsupported export format %q", param.Format)})
+		return
+	}
+
+	after, err := parseExportTime(param.After)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	before, err := parseExportTime(param.Before)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var columns []string
+	if param.Columns != "" {
+		columns = strings.Split(param.Columns, ",")
+	}
+	var writer exportWriter
+	if param.Format == ExportFormatCSV {
+		if columns == nil {
+			columns = options.Columns
+		}
+		writer = &csvWriter{writer: csv.NewWriter(ctx.Writer), columns: columns}
+	} else {
+		writer = &ndjsonWriter{encoder: json.NewEncoder(ctx.Writer), columns: columns}
+	}
+
+	qs.Set("limit", strconv.Itoa(exportPageLimit))
+	started := false
+
+	// Once the status is sent, an error can only be reported in the body and the trailer
+	stop := func(err error) {
+		log.Printf("export of %s stopped: %v", baseUrl, err)
+		ctx.Writer.Header().Set(HeaderExportError, err.Error())
+		writer.Fail(err)
+		writer.Flush()
+	}
+
+	for {
+		res, err := DoApiRequest(ctx.Request.Context(), "GET", baseUrl+"?"+qs.Encode(), nil)
+		if err != nil {
+			if !started {
+				AbortWithApiError(ctx, err)
+			} else {
+				stop(err)
+			}
+			return
+		}
+
+		// Upstream errors on the first page are passed through as-is
+		if res.StatusCode != http.StatusOK {
+			if !started {
+				ctx.Status(res.StatusCode)
+				ctx.Header("Content-Type", gin.MIMEJSON)
+				io.Copy(ctx.Writer, res.Body)
+			} else {
+				stop(fmt.Errorf("upstream responded with %d", res.StatusCode))
+			}
+			res.Body.Close()
+			return
+		}
+
+		page, err := decodeExportPage(res.Body, options)
+		res.Body.Close()
+		if err != nil {
+			if !started {
+				ctx.AbortWithStatusJSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+			} else {
+				stop(err)
+			}
+			return
+		}
+
+		if !started {
+			started = true
+			if param.Format == ExportFormatCSV {
+				ctx.Header("Content-Type", "text/csv")
+				ctx.Header("Content-Disposition", "attachment; filename=export.csv")
+			} else {
+				ctx.Header("Content-Type", "application/x-ndjson")
+				ctx.Header("Content-Disposition", "attachment; filename=export.ndjson")
+			}
+			ctx.Header("Trailer", HeaderExportError)
+			ctx.Status(http.StatusOK)
+			if err := writer.Begin(); err != nil {
+				log.Printf("export of %s stopped: %v", baseUrl, err)
+				return
+			}
+		}
+
+		for _, item := range page.items {
+			if !inExportRange(item, options.TimeField, after, before) {
+				continue
+			}
+			if err := writer.Write(item); err != nil {
+				log.Printf("export of %s stopped: %v", baseUrl, err)
+				return
+			}
+		}
+		if err := writer.Flush(); err != nil {
+			log.Printf("export of %s stopped: %v", baseUrl, err)
+			return
+		}
+		ctx.Writer.Flush()
+
+		if page.cursor == "" || len(page.items) == 0 {
+			return
+		}
+		qs.Set("start", page.cursor)
+	}
+}
@@ -0,0 +1,143 @@
+package helpers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// A 100ms list endpoint serving the given pages, answering 500 past the last one
+func fakeListEndpoint(t *testing.T, pages ...string) {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page := 0
+		if start := r.URL.Query().Get("start"); start != "" {
+			page = int(start[0] - '0')
+		}
+		if page >= len(pages) {
+			w.WriteHeader(http.StatusInternalServerError)
+			io.WriteString(w, `{"message":"internal error"}`)
+			return
+		}
+		io.WriteString(w, pages[page])
+	}))
+	t.Cleanup(server.Close)
+	t.Setenv("BASE_URL", server.URL+"/")
+	t.Setenv("APP_ACCESS_KEY", "access")
+	t.Setenv("APP_SECRET", "secret")
+}
+
+// Run an export through a real server so that trailers are sent
+func export(t *testing.T, query string, options ExportOptions) (*http.Response, string) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/export", func(ctx *gin.Context) {
+		ExportApiPages(ctx, GetBaseUrl()+"sessions", url.Values{}, options)
+	})
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+
+	res, err := http.Get(server.URL + "/export?" + query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res, string(body)
+}
+
+var sessionOptions = ExportOptions{ItemsKey: "data", CursorKey: "last", Columns: []string{"id", "peer.name"}}
+
+func TestExportApiPages(t *testing.T) {
+	pages := []string{
+		`{"data":[{"id":"a","peer":{"name":"Ann"}},{"id":"b","extra":true}],"last":"1"}`,
+		`{"data":[{"id":"c","peer":{"name":"Cy"}}],"last":""}`,
+	}
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{"ndjson passes items through", "", `{"id":"a","peer":{"name":"Ann"}}
+{"extra":true,"id":"b"}
+{"id":"c","peer":{"name":"Cy"}}
+`},
+		{"ndjson selects columns", "columns=id,peer.name", `{"id":"a","peer.name":"Ann"}
+{"id":"b","peer.name":null}
+{"id":"c","peer.name":"Cy"}
+`},
+		{"csv uses the default columns", "format=csv", "id,peer.name\na,Ann\nb,\nc,Cy\n"},
+		{"csv selects columns", "format=csv&columns=extra,id", "extra,id\n,a\ntrue,b\n,c\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fakeListEndpoint(t, pages...)
+			res, body := export(t, test.query, sessionOptions)
+			if res.StatusCode != http.StatusOK {
+				t.Fatalf("status %d", res.StatusCode)
+			}
+			if body != test.want {
+				t.Errorf("body\n%s\nwant\n%s", body, test.want)
+			}
+			if got := res.Trailer.Get(HeaderExportError); got != "" {
+				t.Errorf("trailer %s = %q on a complete export", HeaderExportError, got)
+			}
+		})
+	}
+}
+
+func TestExportApiPagesFailingMidStream(t *testing.T) {
+	tests := []struct {
+		format   string
+		lastLine func(line string) bool
+	}{
+		{"ndjson", func(line string) bool {
+			var record map[string]string
+			return json.Unmarshal([]byte(line), &record) == nil && strings.Contains(record["export_error"], "500")
+		}},
+		{"csv", func(line string) bool {
+			return strings.HasPrefix(line, "#export_error,") && strings.Contains(line, "500")
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.format, func(t *testing.T) {
+			// The second page fails
+			fakeListEndpoint(t, `{"data":[{"id":"a"}],"last":"1"}`)
+			res, body := export(t, "format="+test.format, sessionOptions)
+			if res.StatusCode != http.StatusOK {
+				t.Fatalf("status %d", res.StatusCode)
+			}
+			lines := strings.Split(strings.TrimSpace(body), "\n")
+			if !strings.Contains(lines[0]+lines[1], "a") {
+				t.Errorf("items before the failure are missing:\n%s", body)
+			}
+			if last := lines[len(lines)-1]; !test.lastLine(last) {
+				t.Errorf("last line %q does not report the failure", last)
+			}
+			if res.Trailer.Get(HeaderExportError) == "" {
+				t.Errorf("trailer %s not set", HeaderExportError)
+			}
+		})
+	}
+}
+
+func TestExportApiPagesFailingFirstPage(t *testing.T) {
+	fakeListEndpoint(t)
+	res, body := export(t, "", sessionOptions)
+	if res.StatusCode != http.StatusInternalServerError {
+		t.Errorf("status %d, want the upstream 500", res.StatusCode)
+	}
+	if !strings.Contains(body, "internal error") {
+		t.Errorf("body %q, want the upstream error", body)
+	}
+}
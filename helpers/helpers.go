@@ -1,11 +1,20 @@
 package helpers
 
 import (
+	"api/breaker"
 	"api/hmserrors"
 	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
 	"time"
 
 	"io"
+	"net"
 	"net/http"
 	"os"
 
@@ -14,6 +23,10 @@ import (
 	"github.com/google/uuid"
 )
 
+var apiClient = &http.Client{
+	Timeout: GetEnvironmentDuration("HMS_REQUEST_TIMEOUT", 30*time.Second),
+}
+
 func GetEnvironmentVariable(key string) (string, bool) {
 	envValue, ok := os.LookupEnv(key)
 	if ok {
@@ -22,12 +35,73 @@ func GetEnvironmentVariable(key string) (string, bool) {
 	return "", ok
 }
 
-func GetEndpointUrl(path string) string {
-	baseUrl, ok := GetEnvironmentVariable("BASE_URL")
+// Read a numeric environment variable, falling back to the default when unset or invalid
+func GetEnvironmentFloat(key string, defaultValue float64) float64 {
+	envValue, ok := GetEnvironmentVariable(key)
+	if !ok {
+		return defaultValue
+	}
+	value, err := strconv.ParseFloat(envValue, 64)
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+// Read an integer environment variable, falling back to the default when unset or invalid
+func GetEnvironmentInt(key string, defaultValue int) int {
+	envValue, ok := GetEnvironmentVariable(key)
+	if !ok {
+		return defaultValue
+	}
+	value, err := strconv.Atoi(envValue)
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+// Read a duration environment variable such as "10s", falling back to the default when unset or invalid
+func GetEnvironmentDuration(key string, defaultValue time.Duration) time.Duration {
+	envValue, ok := GetEnvironmentVariable(key)
 	if !ok {
-		panic(hmserrors.ErrMissingBaseUrl)
+		return defaultValue
+	}
+	value, err := time.ParseDuration(envValue)
+	if err != nil {
+		return defaultValue
 	}
-	return baseUrl + path
+	return value
+}
+
+// Base url of the 100ms API from BASE_URL, empty when it is not set
+func GetBaseUrl() string {
+	baseUrl, _ := GetEnvironmentVariable("BASE_URL")
+	return baseUrl
+}
+
+// Url of an endpoint of the 100ms API under BASE_URL as it is now. Packages
+// build their urls with it on every request, since hmsctl sets BASE_URL from
+// its profile only after they are initialised.
+func GetEndpointUrl(path string) string {
+	return GetBaseUrl() + path
+}
+
+// Endpoint family of a 100ms API url, i.e. the first path segment after BASE_URL.
+// Requests to AUTH_BASE_URL belong to the "auth" family.
+func EndpointFamily(url string) string {
+	if authBaseUrl, _ := GetEnvironmentVariable("AUTH_BASE_URL"); authBaseUrl != "" && strings.HasPrefix(url, authBaseUrl) {
+		return "auth"
+	}
+	baseUrl := GetBaseUrl()
+	if !strings.HasPrefix(url, baseUrl) {
+		return ""
+	}
+	path := strings.TrimPrefix(url, baseUrl)
+	if i := strings.IndexAny(path, "/?"); i >= 0 {
+		path = path[:i]
+	}
+	return path
 }
 
 func GenerateManagementToken() (string, error) {
@@ -40,7 +114,10 @@ func GenerateManagementToken() (string, error) {
 	if !ok {
 		return "", hmserrors.ErrMissingAppSecretKey
 	}
+	return signManagementToken(appAccessKey, appSecret), nil
+}
 
+func signManagementToken(appAccessKey, appSecret string) string {
 	mySigningKey := []byte(appSecret)
 	expiresIn := uint32(24 * 3600)
 	now := uint32(time.Now().UTC().Unix())
@@ -57,48 +134,174 @@ func GenerateManagementToken() (string, error) {
 
 	// Sign and get the complete encoded token as a string using the secret
 	signedToken, _ := token.SignedString(mySigningKey)
-	return signedToken, nil
+	return signedToken
 }
 
-// Helper method to make all api calls to 100ms
-func MakeApiRequest(ctx *gin.Context, url, method string, payload *bytes.Buffer) {
+// Rewrites request bodies on their way to 100ms, e.g. to fill in secrets that
+// callers only reference by name. Set once at startup.
+var RequestBodyRewriter func(body []byte) ([]byte, error)
 
-	var requestBody io.Reader
-	managementToken, err := GenerateManagementToken()
-	if err != nil {
-		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+// Send a request to the 100ms API, signed with a fresh management token for
+// the workspace of the context. The caller is responsible for closing the response body.
+func DoApiRequest(ctx context.Context, method, url string, payload io.Reader) (*http.Response, error) {
+	if payload != nil && RequestBodyRewriter != nil {
+		body, err := io.ReadAll(payload)
+		if err != nil {
+			return nil, err
+		}
+		if body, err = RequestBodyRewriter(body); err != nil {
+			return nil, err
+		}
+		payload = bytes.NewReader(body)
 	}
 
-	client := &http.Client{}
-
-	if payload == nil {
-		requestBody = nil
+	// Circuit breakers and rate limits go by the url built from BASE_URL
+	var managementToken string
+	requestUrl := url
+	if workspace, ok := WorkspaceFromContext(ctx); ok {
+		managementToken = signManagementToken(workspace.AppAccessKey, workspace.AppSecret)
+		requestUrl = workspace.endpointUrl(url)
 	} else {
-		requestBody = payload
+		var err error
+		if managementToken, err = GenerateManagementToken(); err != nil {
+			return nil, err
+		}
+	}
+
+	circuit := circuitBreaker(EndpointFamily(url))
+	if err := circuit.Allow(); err != nil {
+		return nil, err
+	}
+
+	if err := waitForRateLimit(ctx, url); err != nil {
+		circuit.Cancel()
+		return nil, err
 	}
 
-	req, err := http.NewRequest(method, url, requestBody)
+	req, err := http.NewRequestWithContext(ctx, method, requestUrl, payload)
 	if err != nil {
-		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		circuit.Cancel()
+		return nil, err
 	}
 	// Add Authorization header
 	req.Header.Add("Authorization", "Bearer "+managementToken)
 	req.Header.Add("Content-Type", "application/json")
 
+	res, err := apiClient.Do(req)
+	switch {
+	case err != nil && ctx.Err() != nil:
+		circuit.Cancel()
+	case err != nil || isUpstreamFailure(res):
+		circuit.Failure()
+	default:
+		circuit.Success()
+	}
+	return res, err
+}
+
+// Respond with the status matching an error from DoApiRequest
+func AbortWithApiError(ctx *gin.Context, err error) {
+	var apiError *ApiError
+	if errors.As(err, &apiError) {
+		ctx.Data(apiError.StatusCode, gin.MIMEJSON, apiError.Body)
+		ctx.Abort()
+		return
+	}
+	var circuitOpen *breaker.OpenError
+	if errors.As(err, &circuitOpen) {
+		retryAfter := int(math.Ceil(circuitOpen.RetryAfter.Seconds()))
+		ctx.Header("Retry-After", strconv.Itoa(retryAfter))
+		ctx.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+			"error":       circuitOpen.Error(),
+			"family":      circuitOpen.Family,
+			"retry_after": retryAfter,
+		})
+		return
+	}
+	if errors.Is(err, hmserrors.ErrCredentialsNotFound) || errors.Is(err, hmserrors.ErrCredentialsAndRef) {
+		ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, hmserrors.ErrRateLimitWaitExceeded) {
+		ctx.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+		return
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		ctx.AbortWithStatusJSON(http.StatusGatewayTimeout, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
+
+// Helper method to make all api calls to 100ms
+func MakeApiRequest(ctx *gin.Context, url, method string, payload *bytes.Buffer) {
+
+	var requestBody io.Reader
+
+	if payload == nil {
+		requestBody = nil
+	} else {
+		requestBody = payload
+	}
+
 	// Send HTTP request
-	res, err := client.Do(req)
+	res, err := DoApiRequest(ctx.Request.Context(), method, url, requestBody)
 	if err != nil {
-		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		AbortWithApiError(ctx, err)
+		return
 	}
 
+	defer res.Body.Close()
+
 	resp, err := io.ReadAll(res.Body)
 
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
 
-	defer res.Body.Close()
-
 	ctx.Data(res.StatusCode, gin.MIMEJSON, resp)
 
 }
+
+// Error response of the 100ms API
+type ApiError struct {
+	StatusCode int
+	Body       []byte
+}
+
+func (e *ApiError) Error() string {
+	return fmt.Sprintf("100ms API responded with %d: %s", e.StatusCode, bytes.TrimSpace(e.Body))
+}
+
+// Send a JSON body to the 100ms API and decode the JSON response into result.
+// Responses outside 2xx are returned as an *ApiError.
+func CallApi(ctx context.Context, method, url string, body, result interface{}) error {
+	var requestBody io.Reader
+	if body != nil {
+		postBody, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		requestBody = bytes.NewBuffer(postBody)
+	}
+
+	res, err := DoApiRequest(ctx, method, url, requestBody)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	resp, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return &ApiError{StatusCode: res.StatusCode, Body: resp}
+	}
+	if result == nil || len(bytes.TrimSpace(resp)) == 0 {
+		return nil
+	}
+	return json.Unmarshal(resp, result)
+}
@@ -0,0 +1,37 @@
+package helpers
+
+import "encoding/json"
+
+// Apply a JSON merge patch (RFC 7386) to a JSON document: objects are merged
+// member by member, null removes a member and any other value replaces it
+func MergePatch(document, patch []byte) ([]byte, error) {
+	var target, changes interface{}
+	if len(document) > 0 {
+		if err := json.Unmarshal(document, &target); err != nil {
+			return nil, err
+		}
+	}
+	if err := json.Unmarshal(patch, &changes); err != nil {
+		return nil, err
+	}
+	return json.Marshal(mergePatchValue(target, changes))
+}
+
+func mergePatchValue(target, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = map[string]interface{}{}
+	}
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+			continue
+		}
+		targetObject[key] = mergePatchValue(targetObject[key], value)
+	}
+	return targetObject
+}
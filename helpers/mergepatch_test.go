@@ -0,0 +1,58 @@
+package helpers
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestMergePatch(t *testing.T) {
+	// The examples of RFC 7386, appendix A, and documents without a target
+	tests := []struct {
+		document, patch, want string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+		{``, `{"a":{"b":false}}`, `{"a":{"b":false}}`},
+		{`{"permissions":{"endRoom":true,"mute":true}}`, `{"permissions":{"endRoom":false}}`, `{"permissions":{"endRoom":false,"mute":true}}`},
+	}
+	for _, test := range tests {
+		t.Run(test.document+" "+test.patch, func(t *testing.T) {
+			merged, err := MergePatch([]byte(test.document), []byte(test.patch))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got, want interface{}
+			json.Unmarshal(merged, &got)
+			json.Unmarshal([]byte(test.want), &want)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("merged %s, want %s", merged, test.want)
+			}
+		})
+	}
+}
+
+func TestMergePatchInvalid(t *testing.T) {
+	tests := []struct{ document, patch string }{
+		{`{"a":`, `{}`},
+		{`{}`, `{"a"}`},
+	}
+	for _, test := range tests {
+		if _, err := MergePatch([]byte(test.document), []byte(test.patch)); err == nil {
+			t.Errorf("MergePatch(%s, %s) succeeded", test.document, test.patch)
+		}
+	}
+}
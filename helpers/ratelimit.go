@@ -0,0 +1,90 @@
+package helpers
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"api/ratelimit"
+)
+
+var (
+	limitersOnce    sync.Once
+	globalLimiter   *ratelimit.Bucket
+	familyLimiters  map[string]*ratelimit.Bucket
+	rateLimitWait   time.Duration
+	rateLimitFamily = []string{"rooms", "active-rooms", "recordings"}
+)
+
+// Environment variable suffix of an endpoint family e.g. ACTIVE_ROOMS
+func familyEnvSuffix(family string) string {
+	return strings.ToUpper(strings.ReplaceAll(family, "-", "_"))
+}
+
+// Outbound limits are read once from the environment:
+// HMS_RATE_LIMIT and HMS_RATE_LIMIT_BURST for all requests,
+// HMS_RATE_LIMIT_<FAMILY> and HMS_RATE_LIMIT_<FAMILY>_BURST per endpoint family,
+// HMS_RATE_LIMIT_WAIT for how long a request may queue for a token.
+func loadRateLimiters() {
+	rateLimitWait = GetEnvironmentDuration("HMS_RATE_LIMIT_WAIT", 10*time.Second)
+
+	if rate := GetEnvironmentFloat("HMS_RATE_LIMIT", 0); rate > 0 {
+		globalLimiter = ratelimit.NewBucket(rate, GetEnvironmentInt("HMS_RATE_LIMIT_BURST", int(rate)))
+	}
+
+	familyLimiters = map[string]*ratelimit.Bucket{}
+	for _, family := range rateLimitFamily {
+		key := "HMS_RATE_LIMIT_" + familyEnvSuffix(family)
+		if rate := GetEnvironmentFloat(key, 0); rate > 0 {
+			familyLimiters[family] = ratelimit.NewBucket(rate, GetEnvironmentInt(key+"_BURST", int(rate)))
+		}
+	}
+}
+
+// Queue an outbound request until both the global and its family limit allow it.
+// Tokens are reserved from both buckets first, so none is lost when either wait fails.
+func waitForRateLimit(ctx context.Context, url string) error {
+	limitersOnce.Do(loadRateLimiters)
+
+	family := familyLimiters[EndpointFamily(url)]
+	if globalLimiter == nil && family == nil {
+		return nil
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, rateLimitWait)
+	defer cancel()
+
+	var reserved []*ratelimit.Bucket
+	release := func() {
+		for _, limiter := range reserved {
+			limiter.Release()
+		}
+	}
+	var delay time.Duration
+	for _, limiter := range []*ratelimit.Bucket{globalLimiter, family} {
+		if limiter == nil {
+			continue
+		}
+		wait, err := limiter.Reserve(waitCtx)
+		if err != nil {
+			release()
+			return err
+		}
+		reserved = append(reserved, limiter)
+		delay = max(delay, wait)
+	}
+	if delay == 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		release()
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,66 @@
+package helpers
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"api/hmserrors"
+	"api/ratelimit"
+)
+
+func setRateLimits(t *testing.T, global, family *ratelimit.Bucket, wait time.Duration) {
+	t.Helper()
+	t.Setenv("BASE_URL", "https://api.example/v2/")
+	limitersOnce.Do(func() {})
+	saved := []interface{}{globalLimiter, familyLimiters, rateLimitWait}
+	globalLimiter, familyLimiters, rateLimitWait = global, map[string]*ratelimit.Bucket{"rooms": family}, wait
+	t.Cleanup(func() {
+		globalLimiter = saved[0].(*ratelimit.Bucket)
+		familyLimiters = saved[1].(map[string]*ratelimit.Bucket)
+		rateLimitWait = saved[2].(time.Duration)
+		limitersOnce = sync.Once{}
+	})
+}
+
+func TestWaitForRateLimitKeepsGlobalTokenWhenFamilyWaitFails(t *testing.T) {
+	global := ratelimit.NewBucket(0.001, 1)
+	family := ratelimit.NewBucket(0.001, 1)
+	family.Allow()
+	setRateLimits(t, global, family, 50*time.Millisecond)
+
+	err := waitForRateLimit(context.Background(), "https://api.example/v2/rooms/abc")
+	if !errors.Is(err, hmserrors.ErrRateLimitWaitExceeded) {
+		t.Fatalf("wait: %v", err)
+	}
+	if !global.Allow() {
+		t.Error("global token lost to the failed family wait")
+	}
+}
+
+func TestWaitForRateLimit(t *testing.T) {
+	tests := []struct {
+		name    string
+		url     string
+		global  float64
+		family  float64
+		wantErr error
+	}{
+		{"within both limits", "https://api.example/v2/rooms", 1000, 1000, nil},
+		{"other families skip the family limit", "https://api.example/v2/sessions", 1000, 0.001, nil},
+		{"global limit exhausted", "https://api.example/v2/sessions", 0.001, 1000, hmserrors.ErrRateLimitWaitExceeded},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			global, family := ratelimit.NewBucket(test.global, 1), ratelimit.NewBucket(test.family, 1)
+			global.Allow()
+			family.Allow()
+			setRateLimits(t, global, family, 50*time.Millisecond)
+			if err := waitForRateLimit(context.Background(), test.url); !errors.Is(err, test.wantErr) {
+				t.Errorf("wait: %v, want %v", err, test.wantErr)
+			}
+		})
+	}
+}
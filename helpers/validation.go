@@ -0,0 +1,121 @@
+package helpers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+var validatorOnce sync.Once
+
+// Report fields by their json names, e.g. "questions[0].format" instead of "Questions[0].Format"
+func useJsonFieldNames() {
+	validate, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return
+	}
+	validate.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		if name == "" {
+			return field.Name
+		}
+		return name
+	})
+}
+
+func fieldMessage(err validator.FieldError) string {
+	collection := err.Kind() == reflect.Slice || err.Kind() == reflect.Map || err.Kind() == reflect.Array
+	switch err.Tag() {
+	case "required":
+		return "is required"
+	case "oneof":
+		return "must be one of: " + strings.ReplaceAll(err.Param(), " ", ", ")
+	case "gt":
+		return "must be greater than " + err.Param()
+	case "gte":
+		return "must be greater than or equal to " + err.Param()
+	case "lte":
+		return "must be less than or equal to " + err.Param()
+	case "min":
+		if collection {
+			return "must contain at least " + err.Param() + " item(s)"
+		}
+		return "must be at least " + err.Param() + " characters long"
+	case "max":
+		if collection {
+			return "must contain at most " + err.Param() + " item(s)"
+		}
+		return "must be at most " + err.Param() + " characters long"
+	case "excludesall":
+		return "must not contain any of: " + err.Param()
+	case "url":
+		return "must be a valid url"
+	default:
+		return fmt.Sprintf("failed the %q rule", err.Tag())
+	}
+}
+
+// Turn a binding error into one entry per invalid field
+func ValidationErrors(err error) []FieldError {
+	var invalid validator.ValidationErrors
+	if !errors.As(err, &invalid) {
+		return []FieldError{{Message: err.Error()}}
+	}
+
+	fieldErrors := make([]FieldError, 0, len(invalid))
+	for _, fieldError := range invalid {
+		// Drop the name of the top level struct from the path
+		field := fieldError.Namespace()
+		if _, path, ok := strings.Cut(field, "."); ok {
+			field = path
+		}
+		fieldErrors = append(fieldErrors, FieldError{
+			Field:   field,
+			Message: fieldMessage(fieldError),
+		})
+	}
+	// Map entries are validated in random order
+	sort.SliceStable(fieldErrors, func(i, j int) bool {
+		return fieldErrors[i].Field < fieldErrors[j].Field
+	})
+	return fieldErrors
+}
+
+// Validate a request body outside of a gin handler, e.g. in the CLI
+func Validate(obj interface{}) error {
+	validatorOnce.Do(useJsonFieldNames)
+	return binding.Validator.ValidateStruct(obj)
+}
+
+// Bind and validate the JSON request body, responding with every
+// violation at once when it is invalid
+func BindJSON(ctx *gin.Context, obj interface{}) bool {
+	validatorOnce.Do(useJsonFieldNames)
+
+	if err := ctx.ShouldBindJSON(obj); err != nil {
+		AbortWithFieldErrors(ctx, ValidationErrors(err))
+		return false
+	}
+	return true
+}
+
+// Respond to a request whose body is invalid with each of its violations
+func AbortWithFieldErrors(ctx *gin.Context, fieldErrors []FieldError) {
+	ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid request body", "errors": fieldErrors})
+}
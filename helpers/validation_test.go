@@ -0,0 +1,55 @@
+package helpers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestBindJSON(t *testing.T) {
+	type body struct {
+		Name   string `json:"name" binding:"required"`
+		Region string `json:"region,omitempty" binding:"omitempty,oneof=in us"`
+	}
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/", func(ctx *gin.Context) {
+		var rb body
+		if BindJSON(ctx, &rb) {
+			ctx.Status(http.StatusNoContent)
+		}
+	})
+
+	tests := []struct {
+		body       string
+		wantStatus int
+		wantErrors []FieldError
+	}{
+		{`{"name": "r"}`, http.StatusNoContent, nil},
+		{`{"region": "eu"}`, http.StatusBadRequest, []FieldError{{Field: "name", Message: "is required"}, {Field: "region", Message: "must be one of: in, us"}}},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("POST", "/", strings.NewReader(test.body)))
+		if w.Code != test.wantStatus {
+			t.Errorf("%s: status %d, want %d", test.body, w.Code, test.wantStatus)
+			continue
+		}
+		if test.wantErrors == nil {
+			continue
+		}
+		var response struct {
+			Error  string       `json:"error"`
+			Errors []FieldError `json:"errors"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		if response.Error != "invalid request body" || !reflect.DeepEqual(response.Errors, test.wantErrors) {
+			t.Errorf("%s: responded %s, want the field errors %+v", test.body, w.Body, test.wantErrors)
+		}
+	}
+}
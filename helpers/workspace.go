@@ -0,0 +1,76 @@
+package helpers
+
+import (
+	"context"
+	"sort"
+	"strings"
+)
+
+// Credentials of a 100ms workspace other than the one of APP_ACCESS_KEY and APP_SECRET
+type Workspace struct {
+	Name         string
+	AppAccessKey string
+	AppSecret    string
+	// Optional, requests go to BASE_URL otherwise
+	BaseUrl string
+}
+
+type workspaceKey struct{}
+
+// Send the requests made with the returned context to the given workspace
+func WithWorkspace(ctx context.Context, workspace *Workspace) context.Context {
+	return context.WithValue(ctx, workspaceKey{}, workspace)
+}
+
+func WorkspaceFromContext(ctx context.Context) (*Workspace, bool) {
+	workspace, ok := ctx.Value(workspaceKey{}).(*Workspace)
+	return workspace, ok && workspace != nil
+}
+
+// Point a url built from BASE_URL at the base url of the workspace
+func (w *Workspace) endpointUrl(url string) string {
+	baseUrl := GetBaseUrl()
+	if w.BaseUrl == "" || !strings.HasPrefix(url, baseUrl) {
+		return url
+	}
+	return w.BaseUrl + strings.TrimPrefix(url, baseUrl)
+}
+
+// Workspaces named in HMS_WORKSPACES (comma separated), each configured with
+// HMS_WORKSPACE_<NAME>_APP_ACCESS_KEY, _APP_SECRET and optionally _BASE_URL.
+// The workspace of APP_ACCESS_KEY and APP_SECRET is always available as "default".
+func GetWorkspace(name string) (*Workspace, bool) {
+	if name == "default" {
+		appAccessKey, _ := GetEnvironmentVariable("APP_ACCESS_KEY")
+		appSecret, _ := GetEnvironmentVariable("APP_SECRET")
+		return &Workspace{Name: name, AppAccessKey: appAccessKey, AppSecret: appSecret}, true
+	}
+
+	for _, configured := range WorkspaceNames() {
+		if configured != name {
+			continue
+		}
+		prefix := "HMS_WORKSPACE_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		appAccessKey, ok := GetEnvironmentVariable(prefix + "APP_ACCESS_KEY")
+		appSecret, ok1 := GetEnvironmentVariable(prefix + "APP_SECRET")
+		if !ok || !ok1 {
+			return nil, false
+		}
+		baseUrl, _ := GetEnvironmentVariable(prefix + "BASE_URL")
+		return &Workspace{Name: name, AppAccessKey: appAccessKey, AppSecret: appSecret, BaseUrl: baseUrl}, true
+	}
+	return nil, false
+}
+
+// Names of the configured workspaces, including "default"
+func WorkspaceNames() []string {
+	names := []string{"default"}
+	value, _ := GetEnvironmentVariable("HMS_WORKSPACES")
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name != "" && name != "default" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names[1:])
+	return names
+}
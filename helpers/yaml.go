@@ -0,0 +1,73 @@
+package helpers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
+)
+
+// Convert a YAML document to JSON, so it can be decoded into the json tagged request structs
+func YAMLToJSON(data []byte) ([]byte, error) {
+	var document interface{}
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, err
+	}
+	return json.Marshal(document)
+}
+
+// Convert JSON to block style YAML, keeping the order of the keys
+func JSONToYAML(data []byte) ([]byte, error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, err
+	}
+	useBlockStyle(&document)
+
+	var out bytes.Buffer
+	encoder := yaml.NewEncoder(&out)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&document); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+func useBlockStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		useBlockStyle(child)
+	}
+}
+
+// Whether the request body is YAML rather than JSON
+func IsYAMLRequest(ctx *gin.Context) bool {
+	mediaType, _, _ := mime.ParseMediaType(ctx.GetHeader("Content-Type"))
+	switch mediaType {
+	case "application/yaml", "application/x-yaml", "text/yaml", "text/x-yaml":
+		return true
+	}
+	return false
+}
+
+// Bind and validate a request body sent as YAML or JSON, depending on its Content-Type
+func BindYAMLOrJSON(ctx *gin.Context, obj interface{}) bool {
+	if IsYAMLRequest(ctx) {
+		data, err := io.ReadAll(ctx.Request.Body)
+		if err == nil {
+			data, err = YAMLToJSON(data)
+		}
+		if err != nil {
+			AbortWithFieldErrors(ctx, []FieldError{{Message: err.Error()}})
+			return false
+		}
+		ctx.Request.Body = io.NopCloser(bytes.NewReader(data))
+	}
+	return BindJSON(ctx, obj)
+}
@@ -40,4 +40,90 @@ var (
 	ErrMissingSessionId = errors.New("provide a session ID")
 
 	ErrMissingAssetId = errors.New("provide a asset ID")
+
+	ErrRateLimited = errors.New("too many requests, retry later")
+
+	ErrRateLimitWaitExceeded = errors.New("timed out waiting for the 100ms API rate limit")
+
+	ErrCircuitOpen = errors.New("the 100ms API is unavailable, retry later")
+
+	ErrInvalidIdempotencyKey = errors.New("the idempotency key must be at most 255 characters")
+
+	ErrIdempotencyKeyReused = errors.New("the idempotency key was already used for a different request")
+
+	ErrIdempotencyKeyInProgress = errors.New("a request with this idempotency key is still in progress")
+
+	ErrTemplatePlanRequired = errors.New("review the plan and confirm it by passing its plan_id as plan, or set auto_approve=true")
+
+	ErrTemplatePlanStale = errors.New("the template changed since the plan was made, review the new plan")
+
+	ErrInvalidTemplateVersion = errors.New("provide a template version number")
+
+	ErrTemplateVersionNotFound = errors.New("no such version in the template history")
+
+	ErrTemplateLintFailed = errors.New("the template failed linting")
+
+	ErrUnknownWorkspace = errors.New("no such workspace, configure it in HMS_WORKSPACES")
+
+	ErrUnknownRolePreset = errors.New("no such role preset")
+
+	ErrInvalidMergePatch = errors.New("provide a JSON merge patch object")
+
+	ErrInvalidMergePatchType = errors.New("send the patch as application/merge-patch+json")
+
+	ErrMissingRoomIdAndScheduleId = errors.New("provide a room ID and schedule ID")
+
+	ErrScheduleNotFound = errors.New("no such schedule for this room")
+
+	ErrInvalidTagFilter = errors.New("filter tags as key:value or key")
+
+	ErrMissingJanitorRunId = errors.New("provide a janitor run ID")
+
+	ErrJanitorRunNotFound = errors.New("no such janitor run")
+
+	ErrJanitorRunning = errors.New("the janitor is already running")
+
+	ErrVaultMasterKeyMissing = errors.New("set VAULT_MASTER_KEY to store and use credentials")
+
+	ErrVaultMasterKeyInvalid = errors.New("VAULT_MASTER_KEY must be 32 bytes encoded as base64")
+
+	ErrCredentialsNotFound = errors.New("no such credentials in the vault")
+
+	ErrCredentialsUnreadable = errors.New("the credentials cannot be decrypted with VAULT_MASTER_KEY")
+
+	ErrCredentialsAndRef = errors.New("set either credentials or credentials_ref")
+
+	ErrInvalidCredentialsName = errors.New("name credentials with up to 64 letters, digits, dots, dashes and underscores")
+
+	ErrJoinLinkTemplateMissing = errors.New("set JOIN_LINK_TEMPLATE or JOIN_LINK_SUBDOMAIN, or send a template")
+
+	ErrInvalidJoinLinkTemplate = errors.New("the join link template must contain {code}")
+
+	ErrJoinLinkTemplateNotAllowed = errors.New("the join link template must be an http or https url on a host in JOIN_LINK_ALLOWED_HOSTS")
+
+	ErrRoomCodeNotFound = errors.New("no enabled room code for this role")
+
+	ErrShortLinkNotFound = errors.New("no such short link")
+
+	ErrShortLinkBaseUrlMissing = errors.New("set SHORT_LINK_BASE_URL to create short links")
+
+	ErrShortLinkNotCreated = errors.New("no short link for this join link, create it with POST /room-codes/:roomId/join-links")
+
+	ErrRoomCodeExpired = errors.New("the room code has expired")
+
+	ErrRoomCodeUsedUp = errors.New("the room code has been used up")
+
+	ErrRoomCodeOutsideWindow = errors.New("the room code cannot be used at this time")
+
+	ErrRoomCodePolicyNotFound = errors.New("no policy for this room code")
+
+	ErrRotationNotFound = errors.New("the room codes of this room are not rotated on a schedule")
+
+	ErrWebhookNotAllowed = errors.New("the webhook must be an http or https url on a host in ROOM_CODE_WEBHOOK_ALLOWED_HOSTS or that of ROOM_CODE_WEBHOOK_URL")
+
+	ErrRoomCodeDenied = errors.New("the room code is not allowed")
+
+	ErrExchangeSecretInvalid = errors.New("send the exchange secret in X-Exchange-Secret")
+
+	ErrCaptchaFailed = errors.New("the CAPTCHA could not be verified")
 )
@@ -0,0 +1,190 @@
+package idempotency
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"api/hmserrors"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	HeaderKey      = "Idempotency-Key"
+	HeaderReplayed = "Idempotent-Replayed"
+
+	maxKeyLength = 255
+)
+
+type record struct {
+	fingerprint string
+	done        bool
+	status      int
+	contentType string
+	body        []byte
+	expires     time.Time
+}
+
+// First responses of mutating requests, keyed by their Idempotency-Key
+type Store struct {
+	mu      sync.Mutex
+	window  time.Duration
+	records map[string]*record
+	swept   time.Time
+}
+
+func NewStore(window time.Duration) *Store {
+	return &Store{
+		window:  window,
+		records: map[string]*record{},
+		swept:   time.Now(),
+	}
+}
+
+// Look up the key, reserving it for this request when it is unused
+func (s *Store) begin(key, fingerprint string) (*record, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.swept) > time.Minute {
+		for k, r := range s.records {
+			if r.done && now.After(r.expires) {
+				delete(s.records, k)
+			}
+		}
+		s.swept = now
+	}
+
+	if r, ok := s.records[key]; ok && (!r.done || now.Before(r.expires)) {
+		return r, false
+	}
+	r := &record{fingerprint: fingerprint}
+	s.records[key] = r
+	return r, true
+}
+
+func (s *Store) complete(key string, r *record, status int, contentType string, body []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Failures that are worth retrying are not remembered
+	if status >= http.StatusInternalServerError || status == http.StatusTooManyRequests {
+		delete(s.records, key)
+		return
+	}
+	r.done = true
+	r.status = status
+	r.contentType = contentType
+	r.body = body
+	r.expires = time.Now().Add(s.window)
+}
+
+func (s *Store) abandon(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.records, key)
+}
+
+// Copies the response into a buffer while it is sent to the client
+type teeWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *teeWriter) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *teeWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Keys are only shared by requests of the same caller: the same Authorization
+// header, or the same client IP when there is none
+func callerKey(ctx *gin.Context, key string) string {
+	caller := "ip " + ctx.ClientIP()
+	if authorization := ctx.GetHeader("Authorization"); authorization != "" {
+		caller = "authorization " + authorization
+	}
+	hash := sha256.Sum256([]byte(caller))
+	return hex.EncodeToString(hash[:]) + " " + key
+}
+
+func fingerprintOf(ctx *gin.Context, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(ctx.Request.Method + " " + ctx.Request.URL.RequestURI() + "\n"))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// Replay the stored response of mutating requests that reuse an Idempotency-Key,
+// on every route but the exempt ones, given as route paths such as "/token".
+// Exempt routes issuing auth tokens, as a replay skips their limits. Reusing a
+// key for a different request is rejected with 422, and a duplicate arriving
+// while the first request is still running is rejected with 409.
+func (s *Store) Middleware(exempt ...string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		key := ctx.GetHeader(HeaderKey)
+		if key == "" || ctx.Request.Method == http.MethodGet || ctx.Request.Method == http.MethodHead || ctx.Request.Method == http.MethodOptions || slices.Contains(exempt, ctx.FullPath()) {
+			ctx.Next()
+			return
+		}
+		if len(key) > maxKeyLength {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": hmserrors.ErrInvalidIdempotencyKey.Error()})
+			return
+		}
+
+		var body []byte
+		if ctx.Request.Body != nil {
+			var err error
+			body, err = io.ReadAll(ctx.Request.Body)
+			if err != nil {
+				ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			ctx.Request.Body = io.NopCloser(bytes.NewReader(body))
+		}
+
+		key = callerKey(ctx, key)
+		fingerprint := fingerprintOf(ctx, body)
+		r, fresh := s.begin(key, fingerprint)
+		if !fresh {
+			switch {
+			case r.fingerprint != fingerprint:
+				ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": hmserrors.ErrIdempotencyKeyReused.Error()})
+			case !r.done:
+				ctx.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": hmserrors.ErrIdempotencyKeyInProgress.Error()})
+			default:
+				ctx.Header(HeaderReplayed, "true")
+				ctx.Data(r.status, r.contentType, r.body)
+				ctx.Abort()
+			}
+			return
+		}
+
+		completed := false
+		defer func() {
+			if !completed {
+				s.abandon(key)
+			}
+		}()
+
+		writer := &teeWriter{ResponseWriter: ctx.Writer}
+		ctx.Writer = writer
+		ctx.Next()
+		ctx.Writer = writer.ResponseWriter
+
+		s.complete(key, r, writer.Status(), writer.Header().Get("Content-Type"), writer.body.Bytes())
+		completed = true
+	}
+}
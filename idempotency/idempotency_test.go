@@ -0,0 +1,160 @@
+package idempotency
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type request struct {
+	path, body, key, caller, authorization string
+}
+
+func (r request) send(router http.Handler) *httptest.ResponseRecorder {
+	path := r.path
+	if path == "" {
+		path = "/rooms"
+	}
+	req := httptest.NewRequest("POST", path, strings.NewReader(r.body))
+	req.RemoteAddr = "10.0.0.1:1234"
+	if r.caller != "" {
+		req.RemoteAddr = r.caller + ":1234"
+	}
+	if r.key != "" {
+		req.Header.Set(HeaderKey, r.key)
+	}
+	if r.authorization != "" {
+		req.Header.Set("Authorization", r.authorization)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// A router creating rooms, answering with the given status and counting its calls
+func idempotentRouter(s *Store, status int, calls *int32) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	handler := func(ctx *gin.Context) {
+		n := atomic.AddInt32(calls, 1)
+		ctx.JSON(status, gin.H{"call": n})
+	}
+	router.POST("/rooms", s.Middleware(), handler)
+	router.POST("/other", s.Middleware(), handler)
+	return router
+}
+
+func TestMiddleware(t *testing.T) {
+	tests := []struct {
+		name         string
+		status       int
+		first, retry request
+		wantStatus   int
+		wantReplayed bool
+		wantCalls    int32
+	}{
+		{"retry is replayed", http.StatusOK,
+			request{key: "k", body: "{}"}, request{key: "k", body: "{}"}, http.StatusOK, true, 1},
+		{"no key is not replayed", http.StatusOK,
+			request{body: "{}"}, request{body: "{}"}, http.StatusOK, false, 2},
+		{"different body is rejected", http.StatusOK,
+			request{key: "k", body: `{"a":1}`}, request{key: "k", body: `{"a":2}`}, http.StatusUnprocessableEntity, false, 1},
+		{"different path is rejected", http.StatusOK,
+			request{key: "k"}, request{key: "k", path: "/other"}, http.StatusUnprocessableEntity, false, 1},
+		{"client errors are replayed", http.StatusBadRequest,
+			request{key: "k"}, request{key: "k"}, http.StatusBadRequest, true, 1},
+		{"server errors are not stored", http.StatusBadGateway,
+			request{key: "k"}, request{key: "k"}, http.StatusBadGateway, false, 2},
+		{"429 is not stored", http.StatusTooManyRequests,
+			request{key: "k"}, request{key: "k"}, http.StatusTooManyRequests, false, 2},
+		{"other client IPs do not share keys", http.StatusOK,
+			request{key: "k"}, request{key: "k", caller: "10.0.0.2"}, http.StatusOK, false, 2},
+		{"other credentials do not share keys", http.StatusOK,
+			request{key: "k", authorization: "Bearer a"}, request{key: "k", authorization: "Bearer b"}, http.StatusOK, false, 2},
+		{"same credentials share keys across IPs", http.StatusOK,
+			request{key: "k", authorization: "Bearer a"}, request{key: "k", authorization: "Bearer a", caller: "10.0.0.2"}, http.StatusOK, true, 1},
+		{"overlong key is rejected", http.StatusOK,
+			request{}, request{key: strings.Repeat("k", maxKeyLength+1)}, http.StatusBadRequest, false, 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var calls int32
+			router := idempotentRouter(NewStore(time.Hour), test.status, &calls)
+			first := test.first.send(router)
+			retry := test.retry.send(router)
+
+			if retry.Code != test.wantStatus {
+				t.Errorf("retry status %d, want %d", retry.Code, test.wantStatus)
+			}
+			if replayed := retry.Header().Get(HeaderReplayed) == "true"; replayed != test.wantReplayed {
+				t.Errorf("replayed %v, want %v", replayed, test.wantReplayed)
+			}
+			if test.wantReplayed && retry.Body.String() != first.Body.String() {
+				t.Errorf("replayed body %s, want %s", retry.Body, first.Body)
+			}
+			if calls != test.wantCalls {
+				t.Errorf("%d handler calls, want %d", calls, test.wantCalls)
+			}
+		})
+	}
+}
+
+func TestMiddlewareWindow(t *testing.T) {
+	var calls int32
+	s := NewStore(time.Hour)
+	router := idempotentRouter(s, http.StatusOK, &calls)
+	request{key: "k"}.send(router)
+	for _, r := range s.records {
+		r.expires = time.Now().Add(-time.Second)
+	}
+	if w := (request{key: "k"}).send(router); w.Header().Get(HeaderReplayed) != "" || calls != 2 {
+		t.Errorf("replayed after the window: %d calls", calls)
+	}
+}
+
+func TestMiddlewareInProgress(t *testing.T) {
+	s := NewStore(time.Hour)
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	started, release := make(chan struct{}), make(chan struct{})
+	router.POST("/rooms", s.Middleware(), func(ctx *gin.Context) {
+		close(started)
+		<-release
+		ctx.Status(http.StatusOK)
+	})
+
+	done := make(chan struct{})
+	go func() {
+		request{key: "k"}.send(router)
+		close(done)
+	}()
+	<-started
+	if w := (request{key: "k"}).send(router); w.Code != http.StatusConflict {
+		t.Errorf("duplicate in progress: %d, want 409", w.Code)
+	}
+	close(release)
+	<-done
+}
+
+func TestMiddlewareExempt(t *testing.T) {
+	var calls int32
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(NewStore(time.Hour).Middleware("/token/:code"))
+	router.POST("/token/:code", func(ctx *gin.Context) {
+		ctx.JSON(http.StatusOK, gin.H{"call": atomic.AddInt32(&calls, 1)})
+	})
+	for i := 0; i < 2; i++ {
+		if w := (request{key: "k", path: "/token/abc"}).send(router); w.Header().Get(HeaderReplayed) != "" {
+			t.Errorf("exempt route replayed")
+		}
+	}
+	if calls != 2 {
+		t.Errorf("%d handler calls, want 2", calls)
+	}
+}
@@ -0,0 +1,281 @@
+// Package janitor finds rooms that have had no session for a number of days,
+// reports them and optionally disables them and their room codes.
+package janitor
+
+import (
+	"api/helpers"
+	"api/hmserrors"
+	"api/store"
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	RunRunning   = "running"
+	RunCompleted = "completed"
+	RunFailed    = "failed"
+
+	// What a run did with a stale room
+	ActionReported    = "reported"
+	ActionAllowlisted = "allowlisted"
+	ActionDisabled    = "disabled"
+	ActionFailed      = "failed"
+	// Kept because a schedule enables the room again later
+	ActionScheduled = "scheduled"
+
+	// Runs kept in the audit trail
+	maxRuns = 100
+)
+
+// How a run finds and handles stale rooms
+type Options struct {
+	// Rooms without a session for this many days are stale
+	IdleDays int `json:"idle_days"`
+	// Only report stale rooms
+	DryRun bool `json:"dry_run"`
+	// Disable the room codes of the rooms that are disabled
+	DisableRoomCodes bool `json:"disable_room_codes"`
+	// Room ids, room name patterns such as "cs101-*", or tags as "tag:key:value" or "tag:key"
+	Allowlist []string `json:"allowlist,omitempty"`
+}
+
+// A room without a session in the idle period
+type StaleRoom struct {
+	RoomId        string     `json:"room_id"`
+	Name          string     `json:"name,omitempty"`
+	CreatedAt     *time.Time `json:"created_at,omitempty"`
+	LastSessionAt *time.Time `json:"last_session_at,omitempty"`
+	Action        string     `json:"action"`
+	// The allowlist entry that kept the room
+	AllowedBy string `json:"allowed_by,omitempty"`
+	// Room codes disabled along with the room
+	RoomCodes []string `json:"room_codes,omitempty"`
+	Error     string   `json:"error,omitempty"`
+}
+
+// A run of the janitor, kept as its audit trail
+type Run struct {
+	Id      string `json:"id"`
+	Trigger string `json:"trigger"`
+	Options
+	State      string     `json:"state"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	// Enabled rooms looked at, and those that were stale
+	Checked  int         `json:"checked"`
+	Stale    int         `json:"stale"`
+	Disabled int         `json:"disabled"`
+	Rooms    []StaleRoom `json:"rooms"`
+}
+
+type janitorStore struct {
+	mu       sync.Mutex
+	document *store.Document
+	Runs     []*Run `json:"runs"`
+	// Called with the id of every room that is disabled, e.g. to purge cached responses
+	changed func(roomId string)
+}
+
+// Loaded on first use from JANITOR_FILE in DATA_DIR
+var janitor = sync.OnceValue(func() *janitorStore {
+	name, ok := helpers.GetEnvironmentVariable("JANITOR_FILE")
+	if !ok || name == "" {
+		name = "janitor.json"
+	}
+	s := &janitorStore{document: store.Open(name)}
+	if err := s.document.Load(s); err != nil {
+		log.Printf("janitor: %s: %v", s.document.Path(), err)
+	}
+	// Runs cut short by a restart
+	for _, run := range s.Runs {
+		if run.State == RunRunning {
+			run.State = RunFailed
+			run.Error = "interrupted"
+		}
+	}
+	return s
+})
+
+func (s *janitorStore) save() {
+	if err := s.document.Save(s); err != nil {
+		log.Printf("janitor: %s: %v", s.document.Path(), err)
+	}
+}
+
+// Start a run unless one is running already
+func (s *janitorStore) start(trigger string, options Options) (*Run, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, run := range s.Runs {
+		if run.State == RunRunning {
+			return nil, hmserrors.ErrJanitorRunning
+		}
+	}
+
+	run := &Run{
+		Id:        uuid.NewString(),
+		Trigger:   trigger,
+		Options:   options,
+		State:     RunRunning,
+		StartedAt: time.Now().UTC(),
+		Rooms:     []StaleRoom{},
+	}
+	s.Runs = append([]*Run{run}, s.Runs...)
+	if len(s.Runs) > maxRuns {
+		s.Runs = s.Runs[:maxRuns]
+	}
+	s.save()
+	return run, nil
+}
+
+// Add a stale room to a run in progress and save the audit trail, so that
+// rooms already disabled are on record if the run is cut short
+func (s *janitorStore) record(run *Run, room StaleRoom) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	run.Stale++
+	if room.Action == ActionDisabled {
+		run.Disabled++
+	}
+	run.Rooms = append(run.Rooms, room)
+	s.save()
+}
+
+// Record the outcome of a run and save the audit trail
+func (s *janitorStore) finish(run *Run, checked int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now().UTC()
+	run.FinishedAt = &now
+	run.Checked = checked
+	run.State = RunCompleted
+	if err != nil {
+		run.State = RunFailed
+		run.Error = err.Error()
+	}
+	s.save()
+}
+
+// Copies of the runs, newest first
+func (s *janitorStore) list(limit int) []Run {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	runs := []Run{}
+	for _, run := range s.Runs {
+		if limit > 0 && len(runs) == limit {
+			break
+		}
+		runs = append(runs, *run)
+	}
+	return runs
+}
+
+func (s *janitorStore) get(id string) (Run, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, run := range s.Runs {
+		if run.Id == id {
+			return *run, true
+		}
+	}
+	return Run{}, false
+}
+
+func environmentBool(key string, defaultValue bool) bool {
+	value, ok := helpers.GetEnvironmentVariable(key)
+	if !ok {
+		return defaultValue
+	}
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("janitor: %s must be true or false, using %t", key, defaultValue)
+		return defaultValue
+	}
+	return enabled
+}
+
+// Options of scheduled runs, and the defaults of runs started by hand, from
+// JANITOR_IDLE_DAYS, JANITOR_DRY_RUN, JANITOR_DISABLE_ROOM_CODES and JANITOR_ALLOWLIST
+func defaultOptions() Options {
+	return Options{
+		IdleDays:         helpers.GetEnvironmentInt("JANITOR_IDLE_DAYS", 90),
+		DryRun:           environmentBool("JANITOR_DRY_RUN", true),
+		DisableRoomCodes: environmentBool("JANITOR_DISABLE_ROOM_CODES", true),
+		Allowlist:        helpers.GetEnvironmentList("JANITOR_ALLOWLIST"),
+	}
+}
+
+type JanitorRunBody struct {
+	IdleDays         int   `json:"idle_days,omitempty" binding:"omitempty,gte=1"`
+	DryRun           *bool `json:"dry_run,omitempty"`
+	DisableRoomCodes *bool `json:"disable_room_codes,omitempty"`
+	// Added to the allowlist in JANITOR_ALLOWLIST
+	Allowlist []string `json:"allowlist,omitempty"`
+}
+
+type JanitorRunQueryParam struct {
+	Limit int `form:"limit" binding:"omitempty,gte=1,lte=100"`
+}
+
+// List the runs of the janitor, newest first
+func ListJanitorRuns(ctx *gin.Context) {
+	var param JanitorRunQueryParam
+	if err := ctx.ShouldBindQuery(&param); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"data": janitor().list(param.Limit)})
+}
+
+// Get a run of the janitor with the stale rooms it found
+func GetJanitorRun(ctx *gin.Context) {
+	runId, ok := ctx.Params.Get("runId")
+	if !ok {
+		ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": hmserrors.ErrMissingJanitorRunId.Error()})
+		return
+	}
+	run, ok := janitor().get(runId)
+	if !ok {
+		ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": hmserrors.ErrJanitorRunNotFound.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, run)
+}
+
+// Start a run of the janitor in the background, with the configured options
+// unless the body overrides them
+func StartJanitorRun(ctx *gin.Context) {
+	var rb JanitorRunBody
+	if ctx.Request.ContentLength != 0 && !helpers.BindJSON(ctx, &rb) {
+		return
+	}
+
+	options := defaultOptions()
+	if rb.IdleDays > 0 {
+		options.IdleDays = rb.IdleDays
+	}
+	if rb.DryRun != nil {
+		options.DryRun = *rb.DryRun
+	}
+	if rb.DisableRoomCodes != nil {
+		options.DisableRoomCodes = *rb.DisableRoomCodes
+	}
+	options.Allowlist = append(options.Allowlist, rb.Allowlist...)
+
+	run, err := janitor().start("manual", options)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	started := *run
+	go janitor().sweep(context.WithoutCancel(ctx.Request.Context()), run)
+	ctx.JSON(http.StatusAccepted, started)
+}
@@ -0,0 +1,16 @@
+package janitor
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDefaultOptions(t *testing.T) {
+	t.Setenv("JANITOR_IDLE_DAYS", "30")
+	t.Setenv("JANITOR_DRY_RUN", "false")
+	t.Setenv("JANITOR_ALLOWLIST", " r05, cs101-*,,tag:keep:yes ")
+	want := Options{IdleDays: 30, DisableRoomCodes: true, Allowlist: []string{"r05", "cs101-*", "tag:keep:yes"}}
+	if got := defaultOptions(); !reflect.DeepEqual(got, want) {
+		t.Errorf("options %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,214 @@
+package janitor
+
+import (
+	"api/helpers"
+	"api/room"
+	"api/schedule"
+	"context"
+	"log"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// The fields of rooms and sessions that the janitor looks at
+type listItem struct {
+	Id        string     `json:"id"`
+	Name      string     `json:"name"`
+	RoomId    string     `json:"room_id"`
+	CreatedAt *time.Time `json:"created_at"`
+}
+
+// Call fn with every item of a paged list of the 100ms API
+func eachItem(ctx context.Context, endpoint string, qs url.Values, fn func(item listItem)) error {
+	qs.Set("limit", "100")
+	for {
+		var page struct {
+			Data []listItem `json:"data"`
+			Last string     `json:"last"`
+		}
+		if err := helpers.CallApi(ctx, "GET", helpers.GetEndpointUrl(endpoint)+"?"+qs.Encode(), nil, &page); err != nil {
+			return err
+		}
+		for _, item := range page.Data {
+			fn(item)
+		}
+		if page.Last == "" || len(page.Data) == 0 {
+			return nil
+		}
+		qs.Set("start", page.Last)
+	}
+}
+
+// Ids of the rooms with a session that started after the given time or is still running
+func roomsInUse(ctx context.Context, since time.Time) (map[string]bool, error) {
+	inUse := map[string]bool{}
+	collect := func(session listItem) {
+		inUse[session.RoomId] = true
+	}
+	if err := eachItem(ctx, "sessions", url.Values{"after": {since.Format(time.RFC3339)}}, collect); err != nil {
+		return nil, err
+	}
+	if err := eachItem(ctx, "sessions", url.Values{"active": {"true"}}, collect); err != nil {
+		return nil, err
+	}
+	return inUse, nil
+}
+
+// Start of the last session of a room, nil when it never had one
+func lastSessionAt(ctx context.Context, roomId string) (*time.Time, error) {
+	qs := url.Values{"room_id": {roomId}, "limit": {"1"}}
+	var page struct {
+		Data []listItem `json:"data"`
+	}
+	if err := helpers.CallApi(ctx, "GET", helpers.GetEndpointUrl("sessions")+"?"+qs.Encode(), nil, &page); err != nil {
+		return nil, err
+	}
+	if len(page.Data) == 0 {
+		return nil, nil
+	}
+	return page.Data[0].CreatedAt, nil
+}
+
+// The allowlist entry matching a room, if any
+func allowedBy(allowlist []string, item listItem) string {
+	for _, entry := range allowlist {
+		if tag, ok := strings.CutPrefix(entry, "tag:"); ok {
+			key, value, hasValue := strings.Cut(tag, ":")
+			tagValue, tagged := room.Tags(item.Id)[key]
+			if tagged && (!hasValue || value == tagValue) {
+				return entry
+			}
+			continue
+		}
+		if entry == item.Id {
+			return entry
+		}
+		if matched, _ := path.Match(entry, item.Name); matched {
+			return entry
+		}
+	}
+	return ""
+}
+
+// Disable a room and, when asked to, its enabled room codes
+func disableRoom(ctx context.Context, roomId string, disableRoomCodes bool) ([]string, error) {
+	if err := helpers.CallApi(ctx, "POST", helpers.GetEndpointUrl("rooms/"+roomId), map[string]bool{"enabled": false}, nil); err != nil {
+		return nil, err
+	}
+	if !disableRoomCodes {
+		return nil, nil
+	}
+
+	var codes struct {
+		Data []struct {
+			Code    string `json:"code"`
+			Enabled bool   `json:"enabled"`
+		} `json:"data"`
+	}
+	if err := helpers.CallApi(ctx, "GET", helpers.GetEndpointUrl("room-codes/room/"+roomId), nil, &codes); err != nil {
+		return nil, err
+	}
+	var disabled []string
+	for _, code := range codes.Data {
+		if !code.Enabled {
+			continue
+		}
+		body := map[string]interface{}{"code": code.Code, "enabled": false}
+		if err := helpers.CallApi(ctx, "POST", helpers.GetEndpointUrl("room-codes/code"), body, nil); err != nil {
+			return disabled, err
+		}
+		disabled = append(disabled, code.Code)
+	}
+	return disabled, nil
+}
+
+// Find the enabled rooms without a session in the idle period and report,
+// keep or disable each of them. Rooms created within the period are not stale,
+// and rooms with a schedule that has windows to come are kept.
+func (s *janitorStore) sweep(ctx context.Context, run *Run) {
+	options := run.Options
+	since := run.StartedAt.AddDate(0, 0, -options.IdleDays)
+
+	inUse, err := roomsInUse(ctx, since)
+	if err != nil {
+		s.finish(run, 0, err)
+		return
+	}
+
+	var stale []listItem
+	checked := 0
+	err = eachItem(ctx, "rooms", url.Values{"enabled": {"true"}}, func(item listItem) {
+		checked++
+		if inUse[item.Id] || item.CreatedAt != nil && item.CreatedAt.After(since) {
+			return
+		}
+		stale = append(stale, item)
+	})
+	if err != nil {
+		s.finish(run, checked, err)
+		return
+	}
+
+	disabled := 0
+	for _, item := range stale {
+		staleRoom := StaleRoom{RoomId: item.Id, Name: item.Name, CreatedAt: item.CreatedAt, Action: ActionReported}
+		staleRoom.LastSessionAt, err = lastSessionAt(ctx, item.Id)
+		staleRoom.AllowedBy = allowedBy(options.Allowlist, item)
+		switch {
+		case err != nil:
+			staleRoom.Action = ActionFailed
+			staleRoom.Error = err.Error()
+		case staleRoom.AllowedBy != "":
+			staleRoom.Action = ActionAllowlisted
+		case schedule.Scheduled(item.Id, run.StartedAt):
+			staleRoom.Action = ActionScheduled
+		case !options.DryRun:
+			staleRoom.RoomCodes, err = disableRoom(ctx, item.Id, options.DisableRoomCodes)
+			if err != nil {
+				staleRoom.Action = ActionFailed
+				staleRoom.Error = err.Error()
+			} else {
+				staleRoom.Action = ActionDisabled
+				disabled++
+				if s.changed != nil {
+					s.changed(item.Id)
+				}
+			}
+		}
+		s.record(run, staleRoom)
+	}
+
+	s.finish(run, checked, nil)
+	log.Printf("janitor: run %s found %d stale rooms out of %d, disabled %d", run.Id, len(stale), checked, disabled)
+}
+
+// Start running the janitor every interval in the background, unless the
+// interval is zero. Changed is called with the id of every room the janitor
+// disables, including in runs started by hand.
+func Start(ctx context.Context, interval time.Duration, changed func(roomId string)) {
+	s := janitor()
+	s.changed = changed
+	if interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			run, err := s.start("scheduled", defaultOptions())
+			if err != nil {
+				log.Printf("janitor: %v", err)
+				continue
+			}
+			s.sweep(ctx, run)
+		}
+	}()
+}
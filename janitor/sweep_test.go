@@ -0,0 +1,229 @@
+package janitor
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"api/store"
+)
+
+// Room tags and schedules are loaded once, so they are written to DATA_DIR
+// before any test runs. r07 and r08 differ in the value of the keep tag, r09
+// is allowlisted by the archive tag whatever its value and r10 has a schedule
+// with a window to come.
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "janitor")
+	if err != nil {
+		panic(err)
+	}
+	os.Setenv("DATA_DIR", dir)
+	now := time.Now().UTC()
+	fixtures := map[string]interface{}{
+		"room_tags.json": map[string]interface{}{"rooms": map[string]interface{}{
+			"r07": map[string]interface{}{"tags": map[string]string{"keep": "yes"}},
+			"r08": map[string]interface{}{"tags": map[string]string{"keep": "no"}},
+			"r09": map[string]interface{}{"tags": map[string]string{"archive": "2023"}},
+		}},
+		"schedules.json": map[string]interface{}{"schedules": map[string]interface{}{
+			"s1": map[string]interface{}{"id": "s1", "room_id": "r10", "start": now.Add(-time.Hour), "end": now.AddDate(0, 1, 0), "created_at": now},
+		}},
+	}
+	for name, fixture := range fixtures {
+		data, _ := json.Marshal(fixture)
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o600); err != nil {
+			panic(err)
+		}
+	}
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// A 100ms endpoint with the enabled rooms of the fixtures, served three at a
+// time. r02 had a session in the idle period, r03 has one running, r04 is
+// new and disabling r11 fails.
+type fakeUpstream struct {
+	mu            sync.Mutex
+	disabledRooms []string
+	disabledCodes []string
+}
+
+func fakeUpstreamEndpoint(t *testing.T) *fakeUpstream {
+	t.Helper()
+	old := "2023-01-01T00:00:00Z"
+	rooms := []map[string]interface{}{
+		{"id": "r01", "name": "lecture-idle", "created_at": old},
+		{"id": "r02", "name": "lecture-recent", "created_at": old},
+		{"id": "r03", "name": "lecture-live", "created_at": old},
+		{"id": "r04", "name": "lecture-new", "created_at": time.Now().UTC().AddDate(0, 0, -1).Format(time.RFC3339)},
+		{"id": "r05", "name": "kept-by-id", "created_at": old},
+		{"id": "r06", "name": "cs101-lab", "created_at": old},
+		{"id": "r07", "name": "tagged-keep", "created_at": old},
+		{"id": "r08", "name": "tagged-other", "created_at": old},
+		{"id": "r09", "name": "archived", "created_at": old},
+		{"id": "r10", "name": "scheduled", "created_at": old},
+		{"id": "r11", "name": "broken", "created_at": old},
+	}
+	fake := &fakeUpstream{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fake.mu.Lock()
+		defer fake.mu.Unlock()
+		query := r.URL.Query()
+		list := func(data []map[string]interface{}, last string) {
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": data, "last": last})
+		}
+
+		switch {
+		case r.URL.Path == "/sessions" && query.Get("after") != "":
+			list([]map[string]interface{}{{"id": "s2", "room_id": "r02"}}, "")
+		case r.URL.Path == "/sessions" && query.Get("active") == "true":
+			list([]map[string]interface{}{{"id": "s3", "room_id": "r03"}}, "")
+		case r.URL.Path == "/sessions" && query.Get("room_id") == "r01":
+			list([]map[string]interface{}{{"id": "s1", "room_id": "r01", "created_at": "2023-06-01T00:00:00Z"}}, "")
+		case r.URL.Path == "/sessions":
+			list([]map[string]interface{}{}, "")
+		case r.Method == "GET" && r.URL.Path == "/rooms":
+			if query.Get("enabled") != "true" {
+				t.Errorf("rooms listed with enabled=%q", query.Get("enabled"))
+			}
+			start := sort.Search(len(rooms), func(i int) bool { return rooms[i]["id"].(string) > query.Get("start") })
+			end := min(start+3, len(rooms))
+			last := ""
+			if end < len(rooms) {
+				last = rooms[end-1]["id"].(string)
+			}
+			list(rooms[start:end], last)
+		case r.Method == "POST" && r.URL.Path == "/rooms/r11":
+			w.WriteHeader(http.StatusInternalServerError)
+			io.WriteString(w, `{"message":"internal error"}`)
+		case r.Method == "POST" && strings.HasPrefix(r.URL.Path, "/rooms/"):
+			fake.disabledRooms = append(fake.disabledRooms, strings.TrimPrefix(r.URL.Path, "/rooms/"))
+			io.WriteString(w, `{}`)
+		case strings.HasPrefix(r.URL.Path, "/room-codes/room/"):
+			roomId := strings.TrimPrefix(r.URL.Path, "/room-codes/room/")
+			list([]map[string]interface{}{{"code": roomId + "-host", "enabled": true}, {"code": roomId + "-guest", "enabled": false}}, "")
+		case r.URL.Path == "/room-codes/code":
+			var body struct {
+				Code string `json:"code"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			fake.disabledCodes = append(fake.disabledCodes, body.Code)
+			io.WriteString(w, `{}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, `{"message":"not found"}`)
+		}
+	}))
+	t.Cleanup(server.Close)
+	t.Setenv("BASE_URL", server.URL+"/")
+	t.Setenv("APP_ACCESS_KEY", "access")
+	t.Setenv("APP_SECRET", "secret")
+	return fake
+}
+
+func TestSweep(t *testing.T) {
+	allowlist := []string{"r05", "cs101-*", "tag:keep:yes", "tag:archive"}
+	tests := []struct {
+		name    string
+		options Options
+		actions map[string]string
+		// Rooms and room codes disabled in 100ms, and the rooms reported as changed
+		disabledRooms, disabledCodes, changed []string
+	}{
+		{
+			"dry run",
+			Options{IdleDays: 30, DryRun: true, DisableRoomCodes: true, Allowlist: allowlist},
+			map[string]string{
+				"r01": ActionReported, "r05": ActionAllowlisted, "r06": ActionAllowlisted, "r07": ActionAllowlisted,
+				"r08": ActionReported, "r09": ActionAllowlisted, "r10": ActionScheduled, "r11": ActionReported,
+			},
+			nil, nil, nil,
+		},
+		{
+			"disable",
+			Options{IdleDays: 30, DisableRoomCodes: true, Allowlist: allowlist},
+			map[string]string{
+				"r01": ActionDisabled, "r05": ActionAllowlisted, "r06": ActionAllowlisted, "r07": ActionAllowlisted,
+				"r08": ActionDisabled, "r09": ActionAllowlisted, "r10": ActionScheduled, "r11": ActionFailed,
+			},
+			[]string{"r01", "r08"}, []string{"r01-host", "r08-host"}, []string{"r01", "r08"},
+		},
+		{
+			"disable keeping room codes",
+			Options{IdleDays: 30},
+			map[string]string{
+				"r01": ActionDisabled, "r05": ActionDisabled, "r06": ActionDisabled, "r07": ActionDisabled,
+				"r08": ActionDisabled, "r09": ActionDisabled, "r10": ActionScheduled, "r11": ActionFailed,
+			},
+			[]string{"r01", "r05", "r06", "r07", "r08", "r09"}, nil, []string{"r01", "r05", "r06", "r07", "r08", "r09"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake := fakeUpstreamEndpoint(t)
+			var changed []string
+			s := &janitorStore{document: store.Open("janitor_" + strings.ReplaceAll(test.name, " ", "_") + ".json"), changed: func(roomId string) {
+				changed = append(changed, roomId)
+			}}
+			run, err := s.start("manual", test.options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s.sweep(context.Background(), run)
+
+			if run.State != RunCompleted || run.Checked != 11 || run.Stale != len(test.actions) || run.Disabled != len(test.disabledRooms) {
+				t.Errorf("run %s with %d checked, %d stale and %d disabled: %s", run.State, run.Checked, run.Stale, run.Disabled, run.Error)
+			}
+			actions := map[string]string{}
+			for _, room := range run.Rooms {
+				actions[room.RoomId] = room.Action
+			}
+			if !reflect.DeepEqual(actions, test.actions) {
+				t.Errorf("actions %v, want %v", actions, test.actions)
+			}
+			if !reflect.DeepEqual(fake.disabledRooms, test.disabledRooms) || !reflect.DeepEqual(fake.disabledCodes, test.disabledCodes) {
+				t.Errorf("disabled rooms %v and codes %v, want %v and %v", fake.disabledRooms, fake.disabledCodes, test.disabledRooms, test.disabledCodes)
+			}
+			if !reflect.DeepEqual(changed, test.changed) {
+				t.Errorf("changed %v, want %v", changed, test.changed)
+			}
+			if first := run.Rooms[0]; first.RoomId != "r01" || first.LastSessionAt == nil || first.LastSessionAt.Format(time.DateOnly) != "2023-06-01" {
+				t.Errorf("first stale room %+v, want r01 with its last session", first)
+			}
+		})
+	}
+}
+
+func TestAllowedBy(t *testing.T) {
+	allowlist := []string{"r05", "cs101-*", "tag:keep:yes", "tag:archive"}
+	tests := []struct {
+		item listItem
+		want string
+	}{
+		{listItem{Id: "r05", Name: "anything"}, "r05"},
+		{listItem{Id: "r06", Name: "cs101-lab"}, "cs101-*"},
+		{listItem{Id: "r01", Name: "cs102-lab"}, ""},
+		{listItem{Id: "r07", Name: "tagged-keep"}, "tag:keep:yes"},
+		{listItem{Id: "r08", Name: "tagged-other"}, ""},
+		{listItem{Id: "r09", Name: "archived"}, "tag:archive"},
+		// Ids are matched exactly
+		{listItem{Id: "r050", Name: "lecture"}, ""},
+		{listItem{Id: "cs101-lab", Name: "lecture"}, ""},
+	}
+	for _, test := range tests {
+		if got := allowedBy(allowlist, test.item); got != test.want {
+			t.Errorf("allowedBy(%+v) = %q, want %q", test.item, got, test.want)
+		}
+	}
+}
@@ -12,7 +12,9 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-var liveStreamsBaseUrl = helpers.GetEndpointUrl("live-streams")
+func liveStreamsBaseUrl() string {
+	return helpers.GetEndpointUrl("live-streams")
+}
 
 type TranscriptionSummarySection struct {
 	Title  string `json:"title"`
@@ -55,8 +57,8 @@ type HMSLiveStreamsQueryParam struct {
 }
 
 type TimedMetaDataBody struct {
-	Payload  string `json:"payload"`
-	Duration int32  `json:"duration"`
+	Payload  string `json:"payload" binding:"required"`
+	Duration int32  `json:"duration" binding:"gt=0"`
 }
 
 // Start a live stream for a room
@@ -78,7 +80,7 @@ func StartLiveStream(ctx *gin.Context) {
 		Transcription: rb.Transcription,
 	})
 	payload := bytes.NewBuffer(postBody)
-	helpers.MakeApiRequest(ctx, liveStreamsBaseUrl+"/room/"+roomId+"/start", "POST", payload)
+	helpers.MakeApiRequest(ctx, liveStreamsBaseUrl()+"/room/"+roomId+"/start", "POST", payload)
 }
 
 // Stop all live stream in the given room
@@ -87,7 +89,7 @@ func StopLiveStreams(ctx *gin.Context) {
 	if !ok {
 		ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": hmserrors.ErrMissingRoomId})
 	}
-	helpers.MakeApiRequest(ctx, liveStreamsBaseUrl+"/room/"+roomId+"/stop", "POST", nil)
+	helpers.MakeApiRequest(ctx, liveStreamsBaseUrl()+"/room/"+roomId+"/stop", "POST", nil)
 }
 
 // Stop a livestream given the stream ID
@@ -96,7 +98,7 @@ func StopLiveStream(ctx *gin.Context) {
 	if !ok {
 		ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": hmserrors.ErrMissingStreamId})
 	}
-	helpers.MakeApiRequest(ctx, liveStreamsBaseUrl+"/"+streamId+"/stop", "POST", nil)
+	helpers.MakeApiRequest(ctx, liveStreamsBaseUrl()+"/"+streamId+"/stop", "POST", nil)
 }
 
 // Get a livestream by its ID
@@ -105,7 +107,7 @@ func GetLiveStream(ctx *gin.Context) {
 	if !ok {
 		ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": hmserrors.ErrMissingStreamId})
 	}
-	helpers.MakeApiRequest(ctx, liveStreamsBaseUrl+"/"+streamId, "GET", nil)
+	helpers.MakeApiRequest(ctx, liveStreamsBaseUrl()+"/"+streamId, "GET", nil)
 }
 
 // List all livestreams
@@ -120,7 +122,7 @@ func ListLiveStreams(ctx *gin.Context) {
 		qs.Add("start", param.Start)
 		qs.Add("limit", strconv.Itoa(int(param.Limit)))
 	}
-	helpers.MakeApiRequest(ctx, liveStreamsBaseUrl+"?"+qs.Encode(), "GET", nil)
+	helpers.MakeApiRequest(ctx, liveStreamsBaseUrl()+"?"+qs.Encode(), "GET", nil)
 
 }
 
@@ -132,8 +134,8 @@ func SendTimedMetada(ctx *gin.Context) {
 	}
 
 	var rb TimedMetaDataBody
-	if err := ctx.ShouldBindJSON(&rb); err != nil {
-		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !helpers.BindJSON(ctx, &rb) {
+		return
 	}
 
 	postBody, _ := json.Marshal(TimedMetaDataBody{
@@ -142,7 +144,7 @@ func SendTimedMetada(ctx *gin.Context) {
 	})
 
 	payload := bytes.NewBuffer(postBody)
-	helpers.MakeApiRequest(ctx, liveStreamsBaseUrl+"/"+streamId+"/timed-metadata", "POST", payload)
+	helpers.MakeApiRequest(ctx, liveStreamsBaseUrl()+"/"+streamId+"/timed-metadata", "POST", payload)
 }
 
 // Pause a livestream recording
@@ -151,7 +153,7 @@ func PauseLiveStreamRecording(ctx *gin.Context) {
 	if !ok {
 		ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": hmserrors.ErrMissingStreamId})
 	}
-	helpers.MakeApiRequest(ctx, liveStreamsBaseUrl+"/"+streamId+"/pause-recording", "POST", nil)
+	helpers.MakeApiRequest(ctx, liveStreamsBaseUrl()+"/"+streamId+"/pause-recording", "POST", nil)
 }
 
 // Resuming a livestream recording
@@ -160,5 +162,5 @@ func ResumeLiveStreamRecording(ctx *gin.Context) {
 	if !ok {
 		ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": hmserrors.ErrMissingStreamId})
 	}
-	helpers.MakeApiRequest(ctx, liveStreamsBaseUrl+"/"+streamId+"/resume-recording", "POST", nil)
+	helpers.MakeApiRequest(ctx, liveStreamsBaseUrl()+"/"+streamId+"/resume-recording", "POST", nil)
 }
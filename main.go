@@ -1,21 +1,34 @@
 package main
 
 import (
+	"context"
+	"log"
 	"net/http"
+	"time"
 
 	"api/activeroom"
 	"api/analytics"
+	"api/cache"
 	externalstreams "api/externalstreams"
+	"api/health"
+	"api/helpers"
+	"api/hmserrors"
+	"api/idempotency"
+	"api/janitor"
 	"api/livestreams"
+	"api/openapi"
 	"api/policy"
 	"api/polls"
+	"api/ratelimit"
 	"api/recording"
 	"api/recordingassets"
 	"api/room"
 	"api/roomcodes"
+	"api/schedule"
 	"api/sessions"
 	"api/streamkey"
 	"api/token"
+	"api/vault"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -37,42 +50,150 @@ func CORSMiddleware() gin.HandlerFunc {
 	}
 }
 
+// Routes that hand out auth tokens
+var tokenRoutes = []string{"/token", "/room-codes/code/:code"}
+
 func main() {
 
+	if helpers.GetBaseUrl() == "" {
+		log.Fatal(hmserrors.ErrMissingBaseUrl)
+	}
+
+	// Fill in upload credentials referenced with credentials_ref when forwarding to 100ms
+	helpers.RequestBodyRewriter = vault.InjectCredentials
+
+	// Cache for read-heavy endpoints, purged when the matching resource changes
+	responseCache := cache.New(helpers.GetEnvironmentInt("CACHE_MAX_ENTRIES", 0))
+	router := newRouter(responseCache)
+
+	// Enable and disable scheduled rooms in the background
+	go schedule.Run(context.Background(), helpers.GetEnvironmentDuration("SCHEDULER_INTERVAL", 30*time.Second), func(roomId string) {
+		responseCache.Purge("/rooms/" + roomId)
+	})
+	// Disable room codes that expired or were used up
+	go roomcodes.EnforcePolicies(context.Background(), helpers.GetEnvironmentDuration("ROOM_CODE_POLICY_INTERVAL", time.Minute), func(roomId string) {
+		responseCache.Purge("/room-codes/" + roomId)
+	})
+	// Rotate room codes on the schedules of their rooms
+	go roomcodes.RotateOnSchedule(context.Background(), helpers.GetEnvironmentDuration("ROOM_CODE_ROTATION_INTERVAL", time.Minute), func(roomId string) {
+		responseCache.Purge("/room-codes/" + roomId)
+	})
+	// Report and disable rooms without recent sessions every JANITOR_INTERVAL, if set
+	janitor.Start(context.Background(), helpers.GetEnvironmentDuration("JANITOR_INTERVAL", 0), func(roomId string) {
+		responseCache.Purge("/rooms/" + roomId)
+		responseCache.Purge("/room-codes/" + roomId)
+	})
+
+	router.Run()
+
+}
+
+// The service's routes, with the global middleware and the OpenAPI document
+func newRouter(responseCache *cache.Cache) *gin.Engine {
 	router := gin.Default()
-	router.Use(cors.Default())
+	// Rate limits and logs go by the caller IP, which is only read from X-Forwarded-For
+	// and X-Real-IP when the request comes through one of TRUSTED_PROXIES
+	if err := router.SetTrustedProxies(helpers.GetEnvironmentList("TRUSTED_PROXIES")); err != nil {
+		log.Fatal(err)
+	}
+	corsConfig := cors.DefaultConfig()
+	corsConfig.AllowAllOrigins = true
+	corsConfig.AddAllowHeaders(idempotency.HeaderKey, "If-None-Match", policy.HeaderAuthor, roomcodes.HeaderExchangeSecret, roomcodes.HeaderCaptchaToken)
+	corsConfig.AddExposeHeaders(idempotency.HeaderReplayed, "ETag", "Retry-After", "Warning")
+	router.Use(cors.New(corsConfig))
+
+	// Replay responses of mutating requests retried with the same Idempotency-Key, except on
+	// the routes issuing auth tokens, whose limits a replay would skip
+	idempotencyKeys := idempotency.NewStore(helpers.GetEnvironmentDuration("IDEMPOTENCY_WINDOW", 24*time.Hour))
+	router.Use(idempotencyKeys.Middleware(tokenRoutes...))
+
+	// Per caller limits on routes that are cheap to abuse
+	tokenRateLimit := ratelimit.PerCaller(
+		helpers.GetEnvironmentFloat("CALLER_RATE_LIMIT_TOKEN", 5),
+		helpers.GetEnvironmentInt("CALLER_RATE_LIMIT_TOKEN_BURST", 10),
+	)
+	sendMessageRateLimit := ratelimit.PerCaller(
+		helpers.GetEnvironmentFloat("CALLER_RATE_LIMIT_SEND_MESSAGE", 1),
+		helpers.GetEnvironmentInt("CALLER_RATE_LIMIT_SEND_MESSAGE_BURST", 5),
+	)
+
+	roomsCache := responseCache.Handler(helpers.GetEnvironmentDuration("CACHE_TTL_ROOMS", time.Minute))
+	roomCodesCache := responseCache.Handler(helpers.GetEnvironmentDuration("CACHE_TTL_ROOM_CODES", time.Minute))
+	templatesCache := responseCache.Handler(helpers.GetEnvironmentDuration("CACHE_TTL_TEMPLATES", 5*time.Minute))
 
 	router.GET("/", ping)
-	router.POST("/token", token.CreateToken)
+	router.GET("/health", health.GetHealth)
+	router.GET("/metrics", health.GetMetrics)
+	router.POST("/token", tokenRateLimit, token.CreateToken)
 
 	roomEndpoints := router.Group("/rooms")
 	{
 
 		roomEndpoints.GET("", room.ListRooms)
-		roomEndpoints.GET("/:roomId", room.GetRoom)
+		roomEndpoints.GET("/:roomId", roomsCache, room.GetRoom)
 		roomEndpoints.POST("", room.CreateRoom)
-		roomEndpoints.POST("/:roomId", room.UpdateRoom)
-		roomEndpoints.POST("/:roomId/enable", room.EnableRoom)
-		roomEndpoints.POST("/:roomId/disable", room.DisableRoom)
+		roomEndpoints.POST("/bulk", room.CreateRooms)
+		roomEndpoints.POST("/:roomId", responseCache.Invalidate("/rooms/:roomId"), room.UpdateRoom)
+		roomEndpoints.POST("/:roomId/enable", responseCache.Invalidate("/rooms/:roomId"), room.EnableRoom)
+		roomEndpoints.POST("/:roomId/disable", responseCache.Invalidate("/rooms/:roomId"), room.DisableRoom)
+		roomEndpoints.POST("/:roomId/clone", room.CloneRoom)
+		roomEndpoints.GET("/:roomId/schedules", schedule.ListRoomSchedules)
+		roomEndpoints.GET("/:roomId/schedules/:scheduleId", schedule.GetRoomSchedule)
+		roomEndpoints.POST("/:roomId/schedules", schedule.CreateRoomSchedule)
+		roomEndpoints.DELETE("/:roomId/schedules/:scheduleId", schedule.DeleteRoomSchedule)
+	}
+
+	router.GET("/schedules", schedule.ListSchedules)
+
+	credentialsEndpoints := router.Group("/credentials")
+	{
+		credentialsEndpoints.GET("", vault.ListCredentials)
+		credentialsEndpoints.PUT("/:name", vault.PutCredentials)
+		credentialsEndpoints.DELETE("/:name", vault.DeleteCredentials)
+	}
+
+	janitorEndpoints := router.Group("/janitor")
+	{
+		janitorEndpoints.GET("/runs", janitor.ListJanitorRuns)
+		janitorEndpoints.GET("/runs/:runId", janitor.GetJanitorRun)
+		janitorEndpoints.POST("/runs", janitor.StartJanitorRun)
 	}
 
 	roomCodesEndpoints := router.Group("/room-codes")
 	{
-		roomCodesEndpoints.GET("/:roomId", roomcodes.GetRoomCode)
+		roomCodesEndpoints.GET("/:roomId", roomCodesCache, roomcodes.GetRoomCode)
 		roomCodesEndpoints.POST("/code/:code", roomcodes.CreateShortCodeAuthToken)
-		roomCodesEndpoints.POST("/:roomId", roomcodes.CreateRoomCode)
-		roomCodesEndpoints.POST("/:roomId/role/:role", roomcodes.CreateRoomCodeForRole)
-		roomCodesEndpoints.POST("/update", roomcodes.UpdateRoomCode)
+		roomCodesEndpoints.POST("/:roomId", responseCache.Invalidate("/room-codes/:roomId"), roomcodes.CreateRoomCode)
+		roomCodesEndpoints.POST("/:roomId/role/:role", responseCache.Invalidate("/room-codes/:roomId"), roomcodes.CreateRoomCodeForRole)
+		roomCodesEndpoints.POST("/update", responseCache.Invalidate("/room-codes"), roomcodes.UpdateRoomCode)
+		roomCodesEndpoints.POST("/:roomId/join-links", responseCache.Invalidate("/room-codes/:roomId"), roomcodes.CreateJoinLinks)
+		roomCodesEndpoints.GET("/:roomId/join-links/:role/qr", roomcodes.GetJoinLinkQR)
+		roomCodesEndpoints.GET("/policies", roomcodes.ListRoomCodePolicies)
+		roomCodesEndpoints.POST("/:roomId/role/:role/rotate", responseCache.Invalidate("/room-codes/:roomId"), roomcodes.RotateRoomCode)
+		roomCodesEndpoints.GET("/rotations", roomcodes.ListRoomCodeRotations)
+		roomCodesEndpoints.GET("/exchanges", roomcodes.ListCodeExchanges)
+		roomCodesEndpoints.GET("/exchanges/rate-limited", roomcodes.ListRateLimitedCodeExchanges)
+		roomCodesEndpoints.GET("/access-list", roomcodes.GetCodeAccessList)
+		roomCodesEndpoints.PUT("/access-list", roomcodes.PutCodeAccessList)
+		roomCodesEndpoints.GET("/:roomId/rotation", roomcodes.GetRoomCodeRotation)
+		roomCodesEndpoints.PUT("/:roomId/rotation", roomcodes.PutRoomCodeRotation)
+		roomCodesEndpoints.DELETE("/:roomId/rotation", roomcodes.DeleteRoomCodeRotation)
+		roomCodesEndpoints.GET("/code/:code/policy", roomcodes.GetRoomCodePolicy)
+		roomCodesEndpoints.PUT("/code/:code/policy", roomcodes.PutRoomCodePolicy)
+		roomCodesEndpoints.DELETE("/code/:code/policy", roomcodes.DeleteRoomCodePolicy)
 
 	}
 
+	// Short join links
+	router.GET("/j/:slug", roomcodes.RedirectShortLink)
+
 	activeRoomsEndpoints := router.Group("/active-rooms")
 	{
 		activeRoomsEndpoints.GET("/:roomId", activeroom.GetActiveRoom)
 		activeRoomsEndpoints.GET("/:roomId/peers/:peerId", activeroom.GetPeer)
 		activeRoomsEndpoints.GET("/:roomId/peers", activeroom.ListPeers)
 		activeRoomsEndpoints.POST("/:roomId/peers/:peerId", activeroom.UpdatePeer)
-		activeRoomsEndpoints.POST("/:roomId/send-message", activeroom.SendMessage)
+		activeRoomsEndpoints.POST("/:roomId/send-message", sendMessageRateLimit, activeroom.SendMessage)
 		activeRoomsEndpoints.POST("/:roomId/remove-peers", activeroom.RemovePeer)
 		activeRoomsEndpoints.POST("/:roomId/end-room", activeroom.EndRoom)
 	}
@@ -90,12 +211,14 @@ func main() {
 	sessionsEndpoints := router.Group("/sessions")
 	{
 		sessionsEndpoints.GET("", sessions.ListSessions)
+		sessionsEndpoints.GET("/export", sessions.ExportSessions)
 		sessionsEndpoints.GET("/:sessionId", sessions.GetSession)
 	}
 
 	recordingAssetsEndpoints := router.Group("/recording-assets")
 	{
 		recordingAssetsEndpoints.GET("", recordingassets.ListRecordingAssets)
+		recordingAssetsEndpoints.GET("/export", recordingassets.ExportRecordingAssets)
 		recordingAssetsEndpoints.GET("/:assetId", recordingassets.GetRecordingAsset)
 		recordingAssetsEndpoints.GET("/:assetId/url", recordingassets.GetPresignedUrl)
 	}
@@ -142,18 +265,38 @@ func main() {
 	{
 
 		policyEndpoints.GET("", policy.ListTemplates)
-		policyEndpoints.GET("/:templateId", policy.GetTemplate)
-		policyEndpoints.GET("/:templateId/roles/:roleName", policy.GetTemplateRole)
+		policyEndpoints.GET("/lint-rules", policy.ListLintRules)
+		policyEndpoints.GET("/presets", policy.ListRolePresets)
+		policyEndpoints.GET("/:templateId", templatesCache, policy.GetTemplate)
+		policyEndpoints.GET("/:templateId/roles/:roleName", templatesCache, policy.GetTemplateRole)
 		policyEndpoints.GET("/:templateId/settings", policy.GetTemplateSettings)
 		policyEndpoints.GET("/:templateId/destinations", policy.GetTemplateDestinations)
+		policyEndpoints.GET("/:templateId/export", policy.ExportTemplateFile)
+		policyEndpoints.GET("/:templateId/lint", policy.LintExistingTemplate)
+		policyEndpoints.GET("/:templateId/history", policy.ListTemplateHistory)
+		policyEndpoints.GET("/:templateId/history/:version", policy.GetTemplateVersion)
+
+		policyEndpoints.POST("", policy.RecordHistory, policy.CreateTemplate)
+		policyEndpoints.POST("/apply", policy.RecordHistory, policy.ApplyTemplateFile)
+		policyEndpoints.POST("/presets", policy.RecordHistory, policy.CreateTemplateFromPresets)
+		policyEndpoints.POST("/lint", policy.LintTemplateFile)
+		policyEndpoints.POST("/:templateId/plan", policy.PlanTemplateFile)
+		// The target template may be in this workspace under any id
+		policyEndpoints.POST("/:templateId/clone", responseCache.Invalidate("/templates"), policy.RecordHistory, policy.CloneTemplateToWorkspace)
+		policyEndpoints.POST("/:templateId/apply", responseCache.Invalidate("/templates/:templateId"), policy.RecordHistory, policy.ApplyTemplateFile)
+		policyEndpoints.POST("/:templateId", responseCache.Invalidate("/templates/:templateId"), policy.RecordHistory, policy.UpdateTemplate)
+		policyEndpoints.POST("/:templateId/roles/:roleName", responseCache.Invalidate("/templates/:templateId"), policy.RecordHistory, policy.ModifyTemplateRole)
+		policyEndpoints.POST("/:templateId/roles/:roleName/preset", responseCache.Invalidate("/templates/:templateId"), policy.RecordHistory, policy.AddTemplateRoleFromPreset)
+		policyEndpoints.POST("/:templateId/settings", responseCache.Invalidate("/templates/:templateId"), policy.RecordHistory, policy.UpdateTemplateSettings)
+		policyEndpoints.POST("/:templateId/destinations", responseCache.Invalidate("/templates/:templateId"), policy.RecordHistory, policy.UpdateTemplateDestinations)
+
+		policyEndpoints.POST("/:templateId/history/:version/rollback", responseCache.Invalidate("/templates/:templateId"), policy.RecordHistory, policy.RollbackTemplate)
 
-		policyEndpoints.POST("", policy.CreateTemplate)
-		policyEndpoints.POST("/:templateId", policy.UpdateTemplate)
-		policyEndpoints.POST("/:templateId/roles/:roleName", policy.ModifyTemplateRole)
-		policyEndpoints.POST("/:templateId/settings", policy.UpdateTemplateSettings)
-		policyEndpoints.POST("/:templateId/destinations", policy.UpdateTemplateDestinations)
+		policyEndpoints.PATCH("/:templateId/roles/:roleName", responseCache.Invalidate("/templates/:templateId"), policy.RecordHistory, policy.PatchTemplateRole)
+		policyEndpoints.PATCH("/:templateId/settings", responseCache.Invalidate("/templates/:templateId"), policy.RecordHistory, policy.PatchTemplateSettings)
+		policyEndpoints.PATCH("/:templateId/destinations", responseCache.Invalidate("/templates/:templateId"), policy.RecordHistory, policy.PatchTemplateDestinations)
 
-		policyEndpoints.DELETE("/:templateId/roles/:roleName", policy.DeleteTemplateRole)
+		policyEndpoints.DELETE("/:templateId/roles/:roleName", responseCache.Invalidate("/templates/:templateId"), policy.RecordHistory, policy.DeleteTemplateRole)
 	}
 
 	streamKeyEndpoints := router.Group("/stream-keys")
@@ -165,7 +308,12 @@ func main() {
 
 	// Analytics Events
 	router.GET("/analytics", analytics.GetAnalyticsEvents)
+	router.GET("/analytics/export", analytics.ExportAnalyticsEvents)
 
-	router.Run()
-
+	registerDocs()
+	if missing := openapi.Missing(router.Routes()); len(missing) > 0 {
+		log.Fatalf("routes missing from the OpenAPI document: %v", missing)
+	}
+	openapi.Serve(router, "100ms Golang API", "/openapi.json", "/docs")
+	return router
 }
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+
+	"api/cache"
+	"api/hmserrors"
+	"api/idempotency"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Every mutating route but those issuing auth tokens takes an Idempotency-Key, which the
+// middleware checks before the route runs: an overlong key is refused without calling 100ms
+func TestIdempotencyKeysOnMutatingRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("DATA_DIR", t.TempDir())
+	router := newRouter(cache.New(0))
+	param := regexp.MustCompile(`[:*][^/]*`)
+	checked := 0
+	for _, route := range router.Routes() {
+		if route.Method == http.MethodGet || route.Method == http.MethodHead || route.Method == http.MethodOptions {
+			continue
+		}
+		checked++
+		req := httptest.NewRequest(route.Method, param.ReplaceAllString(route.Path, "x"), strings.NewReader("{}"))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(idempotency.HeaderKey, strings.Repeat("k", 256))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		refused := w.Code == http.StatusBadRequest && strings.Contains(w.Body.String(), hmserrors.ErrInvalidIdempotencyKey.Error())
+		if exempt := slices.Contains(tokenRoutes, route.Path); refused == exempt {
+			t.Errorf("%s %s: idempotency keys checked %v, want %v", route.Method, route.Path, refused, !exempt)
+		}
+	}
+	if checked < 50 {
+		t.Errorf("only %d mutating routes", checked)
+	}
+}
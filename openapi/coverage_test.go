@@ -0,0 +1,102 @@
+package openapi
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"testing"
+)
+
+var routeMethods = map[string]bool{
+	"GET":     true,
+	"POST":    true,
+	"PUT":     true,
+	"PATCH":   true,
+	"DELETE":  true,
+	"HEAD":    true,
+	"OPTIONS": true,
+	"Any":     true,
+}
+
+// The handler packages read BASE_URL when they are initialised, so the route
+// table is checked from the source of the main package instead of a live router.
+// Every route needs its request body and its response documented.
+func TestEveryRouteIsDocumented(t *testing.T) {
+	files, err := filepath.Glob("../*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fset := token.NewFileSet()
+	routes := map[string]token.Position{}
+	methods := map[string][]string{}
+	documented := map[string]map[string]string{}
+
+	for _, file := range files {
+		parsed, err := parser.ParseFile(fset, file, nil, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ast.Inspect(parsed, func(node ast.Node) bool {
+			call, ok := node.(*ast.CallExpr)
+			if !ok {
+				return true
+			}
+			selector, ok := call.Fun.(*ast.SelectorExpr)
+			if !ok || len(call.Args) == 0 {
+				return true
+			}
+
+			switch {
+			case types.ExprString(selector) == "openapi.Register" && len(call.Args) == 2:
+				documented[types.ExprString(call.Args[0])] = operationFields(call.Args[1])
+			case routeMethods[selector.Sel.Name] && len(call.Args) >= 2:
+				handler := types.ExprString(call.Args[len(call.Args)-1])
+				routes[handler] = fset.Position(call.Args[len(call.Args)-1].Pos())
+				methods[handler] = append(methods[handler], selector.Sel.Name)
+			}
+			return true
+		})
+	}
+
+	if len(routes) == 0 {
+		t.Fatal("no routes found in the main package")
+	}
+	for handler, position := range routes {
+		fields, ok := documented[handler]
+		if !ok {
+			t.Errorf("%s: route handler %s has no openapi.Register entry", position, handler)
+			continue
+		}
+		for _, method := range methods[handler] {
+			if bodyMethods[method] && fields["Body"] == "" && fields["NoBody"] != "true" {
+				t.Errorf("%s: %s route %s documents no request body; set Body, or NoBody when it takes none", position, method, handler)
+			}
+		}
+		if fields["Response"] == "" && fields["Upstream"] != "true" && fields["ContentType"] == "" && !bodylessStatus[fields["Status"]] {
+			t.Errorf("%s: route %s documents no response; set Response, Upstream, ContentType or a Status without a body", position, handler)
+		}
+	}
+}
+
+var bodyMethods = map[string]bool{"POST": true, "PUT": true, "PATCH": true}
+
+var bodylessStatus = map[string]bool{"http.StatusNoContent": true, "http.StatusFound": true}
+
+// Fields set in an openapi.Operation literal, with their source
+func operationFields(expr ast.Expr) map[string]string {
+	fields := map[string]string{}
+	literal, ok := expr.(*ast.CompositeLit)
+	if !ok {
+		return fields
+	}
+	for _, element := range literal.Elts {
+		if pair, ok := element.(*ast.KeyValueExpr); ok {
+			fields[types.ExprString(pair.Key)] = types.ExprString(pair.Value)
+		}
+	}
+	return fields
+}
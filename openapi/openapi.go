@@ -0,0 +1,358 @@
+package openapi
+
+import (
+	_ "embed"
+	"net/http"
+	"reflect"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Self-contained documentation page, loading no third-party code
+//
+//go:embed docs.html
+var docsPage string
+
+// Documentation of a route, looked up by its handler
+type Operation struct {
+	Summary     string
+	Description string
+	// Request body struct, described through its json tags
+	Body interface{}
+	// Query parameter structs, described through their form tags
+	Query []interface{}
+	// Response body struct, for routes answered by this service instead of 100ms
+	Response interface{}
+	// The route is mutating but takes no request body
+	NoBody bool
+	// The route responds with the response of the 100ms API as it is
+	Upstream bool
+	// Success status other than 200, e.g. 204 without a body or 302
+	Status int
+	// Response content type other than JSON, e.g. image/png
+	ContentType string
+}
+
+var (
+	mu         sync.Mutex
+	operations = map[string]Operation{}
+)
+
+func handlerName(handler gin.HandlerFunc) string {
+	return runtime.FuncForPC(reflect.ValueOf(handler).Pointer()).Name()
+}
+
+// Document the route(s) served by the handler
+func Register(handler gin.HandlerFunc, op Operation) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	operations[handlerName(handler)] = op
+}
+
+// Routes whose handler has not been documented
+func Missing(routes gin.RoutesInfo) []string {
+	mu.Lock()
+	defer mu.Unlock()
+
+	var missing []string
+	for _, route := range routes {
+		if _, ok := operations[route.Handler]; !ok {
+			missing = append(missing, route.Method+" "+route.Path)
+		}
+	}
+	return missing
+}
+
+// Serve the OpenAPI document of the router's routes at specPath and a page rendering it at uiPath
+func Serve(router *gin.Engine, title, specPath, uiPath string) {
+	var (
+		once     sync.Once
+		document map[string]interface{}
+	)
+	router.GET(specPath, func(ctx *gin.Context) {
+		once.Do(func() {
+			var routes gin.RoutesInfo
+			for _, route := range router.Routes() {
+				if route.Path != specPath && route.Path != uiPath {
+					routes = append(routes, route)
+				}
+			}
+			document = Document(routes, title)
+		})
+		ctx.JSON(http.StatusOK, document)
+	})
+
+	page := strings.ReplaceAll(docsPage, "{{title}}", title)
+	page = strings.ReplaceAll(page, "{{specPath}}", specPath)
+	router.GET(uiPath, func(ctx *gin.Context) {
+		ctx.Data(http.StatusOK, "text/html; charset=utf-8", []byte(page))
+	})
+}
+
+// Build an OpenAPI 3 document from the routes and the registered operations
+func Document(routes gin.RoutesInfo, title string) map[string]interface{} {
+	mu.Lock()
+	defer mu.Unlock()
+
+	schemas := &schemaSet{components: map[string]interface{}{}}
+	paths := map[string]map[string]interface{}{}
+
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Path != routes[j].Path {
+			return routes[i].Path < routes[j].Path
+		}
+		return routes[i].Method < routes[j].Method
+	})
+
+	for _, route := range routes {
+		path, parameters := convertPath(route.Path)
+		op, documented := operations[route.Handler]
+
+		operation := map[string]interface{}{
+			"operationId": operationId(route.Handler),
+			"tags":        []string{tagOf(route.Path)},
+		}
+		if op.Summary != "" {
+			operation["summary"] = op.Summary
+		}
+		if op.Description != "" {
+			operation["description"] = op.Description
+		}
+		if !documented {
+			operation["x-undocumented"] = true
+		}
+
+		for _, query := range op.Query {
+			parameters = append(parameters, queryParameters(schemas, query)...)
+		}
+		if len(parameters) > 0 {
+			operation["parameters"] = parameters
+		}
+
+		if op.Body != nil {
+			operation["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{"schema": schemas.of(reflect.TypeOf(op.Body))},
+				},
+			}
+		}
+
+		status, success := responseOf(schemas, op)
+		operation["responses"] = map[string]interface{}{
+			status: success,
+			"default": map[string]interface{}{
+				"description": "Error",
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{"schema": map[string]interface{}{"$ref": "#/components/schemas/Error"}},
+				},
+			},
+		}
+
+		if paths[path] == nil {
+			paths[path] = map[string]interface{}{}
+		}
+		paths[path][strings.ToLower(route.Method)] = operation
+	}
+
+	schemas.components["Error"] = map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"error": map[string]interface{}{"type": "string"},
+		},
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   title,
+			"version": "2.0.0",
+		},
+		"paths":      paths,
+		"components": map[string]interface{}{"schemas": schemas.components},
+	}
+}
+
+// Status and description of the successful response of an operation
+func responseOf(schemas *schemaSet, op Operation) (string, map[string]interface{}) {
+	status := http.StatusOK
+	if op.Status != 0 {
+		status = op.Status
+	}
+	response := map[string]interface{}{"description": http.StatusText(status)}
+	switch {
+	case op.Response != nil:
+		response["content"] = map[string]interface{}{
+			"application/json": map[string]interface{}{"schema": schemas.of(reflect.TypeOf(op.Response))},
+		}
+	case op.ContentType != "":
+		response["content"] = map[string]interface{}{
+			op.ContentType: map[string]interface{}{"schema": map[string]interface{}{"type": "string", "format": "binary"}},
+		}
+	case op.Upstream:
+		response["description"] = "Response from the 100ms API"
+		response["content"] = map[string]interface{}{
+			"application/json": map[string]interface{}{"schema": map[string]interface{}{"type": "object"}},
+		}
+	}
+	return strconv.Itoa(status), response
+}
+
+// "/rooms/:roomId" becomes "/rooms/{roomId}" with a path parameter
+func convertPath(path string) (string, []interface{}) {
+	var parameters []interface{}
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			name := segment[1:]
+			segments[i] = "{" + name + "}"
+			parameters = append(parameters, map[string]interface{}{
+				"name":     name,
+				"in":       "path",
+				"required": true,
+				"schema":   map[string]interface{}{"type": "string"},
+			})
+		}
+	}
+	return strings.Join(segments, "/"), parameters
+}
+
+func tagOf(path string) string {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	if segments[0] == "" {
+		return "service"
+	}
+	return segments[0]
+}
+
+// "api/room.CreateRoom" becomes "room.CreateRoom"
+func operationId(handler string) string {
+	return handler[strings.LastIndex(handler, "/")+1:]
+}
+
+func queryParameters(schemas *schemaSet, query interface{}) []interface{} {
+	var parameters []interface{}
+	t := reflect.TypeOf(query)
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("form"), ",")
+		if name == "" || name == "-" || !field.IsExported() {
+			continue
+		}
+		parameters = append(parameters, map[string]interface{}{
+			"name":     name,
+			"in":       "query",
+			"required": isRequired(field),
+			"schema":   schemas.of(field.Type),
+		})
+	}
+	return parameters
+}
+
+func isRequired(field reflect.StructField) bool {
+	for _, rule := range strings.Split(field.Tag.Get("binding"), ",") {
+		if rule == "required" {
+			return true
+		}
+	}
+	return false
+}
+
+// Named struct schemas collected under components
+type schemaSet struct {
+	components map[string]interface{}
+}
+
+// Component name of a struct, qualified by package since e.g. room and policy
+// both declare UploadCredentials
+func componentName(t reflect.Type) string {
+	pkg := t.PkgPath()
+	return pkg[strings.LastIndex(pkg, "/")+1:] + "." + t.Name()
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func (s *schemaSet) of(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32:
+		return map[string]interface{}{"type": "integer", "format": "int32"}
+	case reflect.Int64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "minimum": 0}
+	case reflect.Float32:
+		return map[string]interface{}{"type": "number", "format": "float"}
+	case reflect.Float64:
+		return map[string]interface{}{"type": "number", "format": "double"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": s.of(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": s.of(t.Elem())}
+	case reflect.Struct:
+		if t == timeType {
+			return map[string]interface{}{"type": "string", "format": "date-time"}
+		}
+		if t.Name() == "" {
+			return s.object(t)
+		}
+		name := componentName(t)
+		if _, ok := s.components[name]; !ok {
+			// Reserve the name first so self-referencing structs terminate
+			s.components[name] = map[string]interface{}{}
+			s.components[name] = s.object(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+func (s *schemaSet) object(t reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+	var required []string
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = s.of(field.Type)
+		if isRequired(field) {
+			required = append(required, name)
+		}
+	}
+
+	object := map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+	}
+	if len(required) > 0 {
+		object["required"] = required
+	}
+	return object
+}
@@ -0,0 +1,205 @@
+package policy
+
+import (
+	"api/helpers"
+	"api/hmserrors"
+	"context"
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CloneTemplateBody struct {
+	// Workspaces from HMS_WORKSPACES, or "default"
+	From string `json:"from" binding:"required"`
+	To   string `json:"to" binding:"required"`
+	// Template to update in the target workspace. Without it the template with
+	// the same (mapped) name is updated, or a new one is created.
+	TargetTemplateId string `json:"target_template_id,omitempty"`
+	// Template names in the target workspace by their name in the source workspace
+	NameMapping map[string]string `json:"name_mapping,omitempty"`
+	// Delete roles of the target template that the source template does not have
+	Prune bool `json:"prune,omitempty"`
+	// Report the changes without making them
+	DryRun bool `json:"dry_run,omitempty"`
+}
+
+type CloneReport struct {
+	From             string   `json:"from"`
+	To               string   `json:"to"`
+	SourceTemplateId string   `json:"source_template_id"`
+	TemplateId       string   `json:"template_id,omitempty"`
+	Name             string   `json:"name"`
+	Created          bool     `json:"created"`
+	DryRun           bool     `json:"dry_run"`
+	Stripped         []string `json:"stripped,omitempty"`
+	Changes          []Change `json:"changes"`
+	Applied          []string `json:"applied,omitempty"`
+	Deleted          []string `json:"deleted,omitempty"`
+	// The target template before the clone, nil when it is created
+	before TemplateDocument
+}
+
+// Leave out the secrets that belong to a single workspace, returning their paths.
+// Applying the template to one that has them keeps them, since a field missing
+// from a template document is left as it is.
+func (template TemplateDocument) StripSecrets() []string {
+	var stripped []string
+	if upload := template.object("settings", "recording", "upload"); upload != nil {
+		if _, ok := upload["credentials"]; ok {
+			delete(upload, "credentials")
+			stripped = append(stripped, "settings.recording.upload.credentials")
+		}
+	}
+	// RTMP urls carry the stream key
+	rtmpDestinations := template.object("destinations", "rtmpDestinations")
+	for _, name := range sortedKeys(rtmpDestinations) {
+		destination, ok := rtmpDestinations[name].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if _, ok := destination["rtmpUrls"]; ok {
+			delete(destination, "rtmpUrls")
+			stripped = append(stripped, "destinations.rtmpDestinations."+name+".rtmpUrls")
+		}
+	}
+	return stripped
+}
+
+// Fill in the secrets a template was stripped of from the current template
+func (template TemplateDocument) keepSecrets(current TemplateDocument) {
+	upload, currentUpload := template.object("settings", "recording", "upload"), current.object("settings", "recording", "upload")
+	if _, ok := currentUpload["credentials"]; ok && upload != nil {
+		if _, ok := upload["credentials"]; !ok {
+			upload["credentials"] = currentUpload["credentials"]
+		}
+	}
+	currentRtmp := current.object("destinations", "rtmpDestinations")
+	for name, value := range template.object("destinations", "rtmpDestinations") {
+		destination, ok := value.(map[string]interface{})
+		currentDestination, ok1 := currentRtmp[name].(map[string]interface{})
+		if !ok || !ok1 {
+			continue
+		}
+		if _, ok := destination["rtmpUrls"]; !ok && currentDestination["rtmpUrls"] != nil {
+			destination["rtmpUrls"] = currentDestination["rtmpUrls"]
+		}
+	}
+}
+
+// Id of the first template with the given name, or "" when there is none
+func findTemplateByName(ctx context.Context, name string) (string, error) {
+	start := ""
+	for {
+		qs := url.Values{}
+		qs.Add("limit", "100")
+		if start != "" {
+			qs.Add("start", start)
+		}
+		var page struct {
+			Data []struct {
+				Id   string `json:"id"`
+				Name string `json:"name"`
+			} `json:"data"`
+			Last string `json:"last"`
+		}
+		if err := helpers.CallApi(ctx, "GET", policyBaseUrl()+"?"+qs.Encode(), nil, &page); err != nil {
+			return "", err
+		}
+		for _, template := range page.Data {
+			if template.Name == name {
+				return template.Id, nil
+			}
+		}
+		if page.Last == "" || len(page.Data) == 0 {
+			return "", nil
+		}
+		start = page.Last
+	}
+}
+
+// Copy a template from one workspace to another. Workspace specific secrets
+// are not copied; an updated template keeps its own.
+func CloneTemplate(ctx context.Context, templateId string, options CloneTemplateBody, from, to *helpers.Workspace) (*CloneReport, error) {
+	report := &CloneReport{From: from.Name, To: to.Name, SourceTemplateId: templateId, DryRun: options.DryRun}
+
+	template, err := FetchTemplateDocument(helpers.WithWorkspace(ctx, from), templateId)
+	if err != nil {
+		return report, err
+	}
+	if name, ok := options.NameMapping[template.name()]; ok {
+		template["name"] = name
+	}
+	report.Name = template.name()
+	report.Stripped = template.StripSecrets()
+
+	targetCtx := helpers.WithWorkspace(ctx, to)
+	targetId := options.TargetTemplateId
+	if targetId == "" {
+		if targetId, err = findTemplateByName(targetCtx, report.Name); err != nil {
+			return report, err
+		}
+	}
+	report.TemplateId = targetId
+
+	if targetId == "" {
+		report.Created = true
+		report.Changes = diffDocuments(TemplateDocument{}, template)
+	} else {
+		current, err := FetchTemplateDocument(targetCtx, targetId)
+		if err != nil {
+			return report, err
+		}
+		report.before = current
+		report.Changes = diffDocuments(current, appliedDocument(current, template, options.Prune))
+	}
+	if options.DryRun {
+		return report, nil
+	}
+
+	result, err := ApplyTemplate(targetCtx, targetId, template, options.Prune)
+	report.TemplateId = result.TemplateId
+	report.Applied = result.Applied
+	report.Deleted = result.Deleted
+	return report, err
+}
+
+// Clone a template into another configured workspace
+func CloneTemplateToWorkspace(ctx *gin.Context) {
+	templateId, ok := ctx.Params.Get("templateId")
+	if !ok {
+		ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": hmserrors.ErrMissingTemplateId})
+		return
+	}
+
+	var rb CloneTemplateBody
+	if !helpers.BindJSON(ctx, &rb) {
+		return
+	}
+	from, ok := helpers.GetWorkspace(rb.From)
+	to, ok1 := helpers.GetWorkspace(rb.To)
+	if !ok || !ok1 {
+		ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": hmserrors.ErrUnknownWorkspace.Error(), "workspaces": helpers.WorkspaceNames()})
+		return
+	}
+
+	report, err := CloneTemplate(ctx.Request.Context(), templateId, rb, from, to)
+	if err != nil {
+		abortWithApplyError(ctx, err, &ApplyResult{TemplateId: report.TemplateId, Applied: report.Applied})
+		return
+	}
+
+	// The history covers the templates of this workspace
+	var changed *changedTemplate
+	if rb.To == "default" && !report.DryRun {
+		changed = &changedTemplate{templateId: report.TemplateId, before: report.before}
+	}
+	ctx.Set(changedTemplateKey, changed)
+
+	status := http.StatusOK
+	if report.Created && !report.DryRun {
+		status = http.StatusCreated
+	}
+	ctx.JSON(status, report)
+}
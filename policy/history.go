@@ -0,0 +1,381 @@
+package policy
+
+import (
+	"api/helpers"
+	"api/hmserrors"
+	"api/store"
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Header naming who made a template change, recorded in its snapshot
+const HeaderAuthor = "X-Author"
+
+// Action of snapshots of changes that were not made through this service
+const ActionObserved = "observed"
+
+// The state of a template after a change, with the fields that changed
+type Snapshot struct {
+	Version    int              `json:"version"`
+	TemplateId string           `json:"template_id"`
+	Author     string           `json:"author,omitempty"`
+	Timestamp  time.Time        `json:"timestamp"`
+	Action     string           `json:"action"`
+	Template   TemplateDocument `json:"template"`
+	Changes    []Change         `json:"changes"`
+}
+
+type templateHistory struct {
+	mu       sync.Mutex
+	document *store.Document
+	// Oldest snapshots of a template are dropped beyond this
+	limit     int
+	Snapshots map[string][]*Snapshot `json:"snapshots"`
+}
+
+// Loaded on first use from TEMPLATE_HISTORY_FILE in DATA_DIR
+var history = sync.OnceValue(func() *templateHistory {
+	name, ok := helpers.GetEnvironmentVariable("TEMPLATE_HISTORY_FILE")
+	if !ok || name == "" {
+		name = "template-history.json"
+	}
+	return loadHistory(store.Open(name), helpers.GetEnvironmentInt("TEMPLATE_HISTORY_LIMIT", 50))
+})
+
+// Load the history from a document. Secrets recorded before snapshots were
+// stripped of them are removed, and the document saved without them.
+func loadHistory(document *store.Document, limit int) *templateHistory {
+	h := &templateHistory{
+		document:  document,
+		limit:     limit,
+		Snapshots: map[string][]*Snapshot{},
+	}
+	if err := h.document.Load(h); err != nil {
+		log.Printf("template history: %s: %v", h.document.Path(), err)
+	}
+	if h.Snapshots == nil {
+		h.Snapshots = map[string][]*Snapshot{}
+	}
+
+	scrubbed := false
+	for _, snapshots := range h.Snapshots {
+		for _, snapshot := range snapshots {
+			if snapshot.stripSecrets() {
+				scrubbed = true
+			}
+		}
+	}
+	if scrubbed {
+		if err := h.document.Save(h); err != nil {
+			log.Printf("template history: %s: %v", h.document.Path(), err)
+		}
+	}
+	return h
+}
+
+func (h *templateHistory) list(templateId string) []*Snapshot {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]*Snapshot{}, h.Snapshots[templateId]...)
+}
+
+func (h *templateHistory) get(templateId string, version int) *Snapshot {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, snapshot := range h.Snapshots[templateId] {
+		if snapshot.Version == version {
+			return snapshot
+		}
+	}
+	return nil
+}
+
+// Record the state of a template after a change. When the template no longer
+// matches its last snapshot, e.g. after an edit in the dashboard, the state
+// before the change is recorded first so it can be rolled back to.
+func (h *templateHistory) record(templateId, author, action string, before, after TemplateDocument) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	snapshots := h.Snapshots[templateId]
+	add := func(snapshot *Snapshot) {
+		snapshot.TemplateId = templateId
+		snapshot.Timestamp = time.Now().UTC()
+		snapshot.Version = 1
+		if len(snapshots) > 0 {
+			snapshot.Version = snapshots[len(snapshots)-1].Version + 1
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+
+	previous := TemplateDocument{}
+	if len(snapshots) > 0 {
+		previous = snapshots[len(snapshots)-1].Template
+	}
+	if before != nil {
+		if changes := diffDocuments(previous, before); len(snapshots) == 0 || len(changes) > 0 {
+			add(&Snapshot{Action: ActionObserved, Template: before, Changes: changes})
+		}
+		previous = before
+	}
+	add(&Snapshot{Author: author, Action: action, Template: after, Changes: diffDocuments(previous, after)})
+
+	if h.limit > 0 && len(snapshots) > h.limit {
+		snapshots = snapshots[len(snapshots)-h.limit:]
+	}
+	h.Snapshots[templateId] = snapshots
+
+	if err := h.document.Save(h); err != nil {
+		log.Printf("template history: %s: %v", h.document.Path(), err)
+	}
+}
+
+// Leave the secrets of TemplateDocument.StripSecrets out of a snapshot and its
+// changes, so that the history does not hold storage credentials or stream
+// keys. Rollbacks keep the secrets the template has. Whether any were found.
+func (snapshot *Snapshot) stripSecrets() bool {
+	stripped := len(snapshot.Template.StripSecrets()) > 0
+	changes := []Change{}
+	for _, change := range snapshot.Changes {
+		old, oldStripped := stripValueSecrets(change.Path, change.Old)
+		new, newStripped := stripValueSecrets(change.Path, change.New)
+		stripped = stripped || oldStripped || newStripped
+		if old == nil && new == nil {
+			// A change to the secret itself
+			continue
+		}
+		change.Old, change.New = old, new
+		changes = append(changes, change)
+	}
+	snapshot.Changes = changes
+	return stripped
+}
+
+// Strip the secrets of a value at a path of a template, nil when the value is a secret
+func stripValueSecrets(path string, value interface{}) (interface{}, bool) {
+	if value == nil {
+		return nil, false
+	}
+	keys := strings.Split(path, ".")
+	document := TemplateDocument{}
+	parent := map[string]interface{}(document)
+	for _, key := range keys[:len(keys)-1] {
+		child := map[string]interface{}{}
+		parent[key] = child
+		parent = child
+	}
+	leaf := keys[len(keys)-1]
+	parent[leaf] = value
+	if len(document.StripSecrets()) == 0 {
+		return value, false
+	}
+	return parent[leaf], true
+}
+
+// Keeps a copy of the response, to find the id of a created template
+type recordingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *recordingWriter) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *recordingWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Set by handlers that change a template other than the one in the path,
+// along with its state before the change (nil when it was created).
+// A nil changedTemplate means there is nothing to record.
+type changedTemplate struct {
+	templateId string
+	before     TemplateDocument
+}
+
+const changedTemplateKey = "policy.changedTemplate"
+
+// Snapshot the template changed by the handler once it succeeds. The author
+// is taken from the X-Author header, falling back to the caller's IP.
+func RecordHistory(ctx *gin.Context) {
+	templateId := ctx.Param("templateId")
+	requestCtx := context.WithoutCancel(ctx.Request.Context())
+
+	var before TemplateDocument
+	if templateId != "" {
+		var err error
+		if before, err = FetchTemplateDocument(requestCtx, templateId); err != nil {
+			before = nil
+		}
+	}
+
+	writer := &recordingWriter{ResponseWriter: ctx.Writer}
+	ctx.Writer = writer
+	ctx.Next()
+	ctx.Writer = writer.ResponseWriter
+
+	if ctx.Writer.Status() >= http.StatusMultipleChoices {
+		return
+	}
+	if value, ok := ctx.Get(changedTemplateKey); ok {
+		changed, _ := value.(*changedTemplate)
+		if changed == nil {
+			return
+		}
+		templateId, before = changed.templateId, changed.before
+	}
+	if templateId == "" {
+		var created struct {
+			Id         string `json:"id"`
+			TemplateId string `json:"template_id"`
+		}
+		json.Unmarshal(writer.body.Bytes(), &created)
+		templateId = created.Id
+		if templateId == "" {
+			templateId = created.TemplateId
+		}
+		if templateId == "" {
+			return
+		}
+	}
+
+	after, err := FetchTemplateDocument(requestCtx, templateId)
+	if err != nil {
+		log.Printf("template history: could not snapshot template %s: %v", templateId, err)
+		return
+	}
+
+	before.StripSecrets()
+	after.StripSecrets()
+	author := ctx.GetHeader(HeaderAuthor)
+	if author == "" {
+		author = ctx.ClientIP()
+	}
+	history().record(templateId, author, ctx.Request.Method+" "+ctx.FullPath(), before, after)
+}
+
+func snapshotVersion(ctx *gin.Context) (string, int, bool) {
+	templateId, ok := ctx.Params.Get("templateId")
+	if !ok {
+		ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": hmserrors.ErrMissingTemplateId})
+		return "", 0, false
+	}
+	version, err := strconv.Atoi(ctx.Param("version"))
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": hmserrors.ErrInvalidTemplateVersion.Error()})
+		return "", 0, false
+	}
+	return templateId, version, true
+}
+
+// List the recorded versions of a template, oldest first
+func ListTemplateHistory(ctx *gin.Context) {
+	templateId, ok := ctx.Params.Get("templateId")
+	if !ok {
+		ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": hmserrors.ErrMissingTemplateId})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"data": history().list(templateId)})
+}
+
+// Get a recorded version of a template
+func GetTemplateVersion(ctx *gin.Context) {
+	templateId, version, ok := snapshotVersion(ctx)
+	if !ok {
+		return
+	}
+	snapshot := history().get(templateId, version)
+	if snapshot == nil {
+		ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": hmserrors.ErrTemplateVersionNotFound.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, snapshot)
+}
+
+// The merge patch turning one JSON value into another: changed fields are set,
+// and fields missing from the target are set to null
+func mergePatchBetween(current, target interface{}) interface{} {
+	currentObject, ok := current.(map[string]interface{})
+	targetObject, ok1 := target.(map[string]interface{})
+	if !ok || !ok1 {
+		return target
+	}
+	patch := map[string]interface{}{}
+	for key, value := range targetObject {
+		if currentValue, ok := currentObject[key]; !ok || !reflect.DeepEqual(currentValue, value) {
+			patch[key] = mergePatchBetween(currentValue, value)
+		}
+	}
+	for key := range currentObject {
+		if _, ok := targetObject[key]; !ok {
+			patch[key] = nil
+		}
+	}
+	return patch
+}
+
+// The template document that, applied with prune, turns the current template
+// back into a snapshot. Fields added since the snapshot are removed, except
+// the secrets the snapshot was stripped of, which are kept as they are.
+func rollbackDocument(current, snapshot TemplateDocument) TemplateDocument {
+	data, _ := json.Marshal(snapshot)
+	target, _ := NewTemplateDocument(data)
+	target.keepSecrets(current)
+
+	document := TemplateDocument{}
+	if name := target.name(); name != "" {
+		document["name"] = name
+	}
+	currentRoles := current.object("roles")
+	roles := map[string]interface{}{}
+	for roleName, role := range target.object("roles") {
+		roles[roleName] = mergePatchBetween(currentRoles[roleName], role)
+	}
+	document["roles"] = roles
+	for _, section := range []string{"settings", "destinations"} {
+		if value, ok := target[section]; ok {
+			document[section] = mergePatchBetween(current[section], value)
+		}
+	}
+	return document
+}
+
+// Restore a recorded version of a template, updating its name, roles, settings and
+// destinations and deleting roles added since
+func RollbackTemplate(ctx *gin.Context) {
+	templateId, version, ok := snapshotVersion(ctx)
+	if !ok {
+		return
+	}
+	snapshot := history().get(templateId, version)
+	if snapshot == nil {
+		ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": hmserrors.ErrTemplateVersionNotFound.Error()})
+		return
+	}
+
+	current, err := FetchTemplateDocument(ctx.Request.Context(), templateId)
+	if err != nil {
+		helpers.AbortWithApiError(ctx, err)
+		return
+	}
+
+	result, err := ApplyTemplate(ctx.Request.Context(), templateId, rollbackDocument(current, snapshot.Template), true)
+	if err != nil {
+		abortWithApplyError(ctx, err, result)
+		return
+	}
+	ctx.JSON(http.StatusOK, result)
+}
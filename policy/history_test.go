@@ -0,0 +1,155 @@
+package policy
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"api/helpers"
+	"api/store"
+	"api/vault"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRollbackDocument(t *testing.T) {
+	tests := []struct {
+		name     string
+		snapshot string
+		want     string
+	}{
+		{
+			name:     "false values and removed fields are restored",
+			snapshot: `{"name": "webinar", "roles": {"host": {"name": "host", "permissions": {"endRoom": false, "mute": true}}, "guest": {"name": "guest", "permissions": {"endRoom": false}}}, "settings": {"region": "in", "recording": {"enabled": false, "upload": {"type": "s3"}}}}`,
+			want:     `{"name": "webinar", "roles": {"host": {"name": "host", "permissions": {"endRoom": false, "mute": true}}, "guest": {"name": "guest", "permissions": {"endRoom": false}}}, "settings": {"region": "in", "recording": {"enabled": false, "upload": {"type": "s3", "credentials": {"key": "k", "secretKey": "s"}}}}}`,
+		},
+		{
+			name:     "roles added since are deleted",
+			snapshot: `{"name": "old", "roles": {"host": {"name": "host", "priority": 1, "permissions": {"endRoom": true, "mute": true}}}}`,
+			want:     `{"name": "old", "roles": {"host": {"name": "host", "priority": 1, "permissions": {"endRoom": true, "mute": true}}}, "settings": {"region": "in", "recording": {"enabled": true, "upload": {"type": "s3", "credentials": {"key": "k", "secretKey": "s"}}}}}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			current := document(t, liveTemplate)
+			snapshot := document(t, test.snapshot)
+			got := appliedDocument(current, rollbackDocument(current, snapshot), true)
+			if want := document(t, test.want); !reflect.DeepEqual(got, want) {
+				t.Errorf("rolled back to\n%v\nwant\n%v", got, want)
+			}
+			if !reflect.DeepEqual(snapshot, document(t, test.snapshot)) {
+				t.Errorf("the snapshot was changed")
+			}
+		})
+	}
+}
+
+// Snapshots recorded before secrets were stripped from the history
+const historyWithSecrets = `{"snapshots": {"t1": [
+	{"version": 1, "template_id": "t1", "action": "observed",
+	 "template": {"name": "webinar", "settings": {"recording": {"upload": {"type": "s3", "credentials": {"key": "k", "secretKey": "upload-secret"}}}}, "destinations": {"rtmpDestinations": {"yt": {"name": "yt", "rtmpUrls": ["rtmp://a.rtmp.youtube.com/live2/stream-key"]}}}},
+	 "changes": [
+		{"kind": "added", "section": "settings", "path": "settings", "new": {"recording": {"upload": {"type": "s3", "credentials": {"key": "k", "secretKey": "upload-secret"}}}}},
+		{"kind": "added", "section": "destinations", "path": "destinations.rtmpDestinations.yt", "new": {"name": "yt", "rtmpUrls": ["rtmp://a.rtmp.youtube.com/live2/stream-key"]}},
+		{"kind": "changed", "section": "destinations", "path": "destinations.rtmpDestinations.yt.rtmpUrls", "old": [], "new": ["rtmp://a.rtmp.youtube.com/live2/stream-key"]},
+		{"kind": "added", "section": "template", "path": "name", "new": "webinar"}
+	 ]}
+]}}`
+
+func TestLoadHistoryStripsSecrets(t *testing.T) {
+	t.Setenv("DATA_DIR", t.TempDir())
+	file := store.Open("template-history.json")
+	if err := os.WriteFile(file.Path(), []byte(historyWithSecrets), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	h := loadHistory(file, 50)
+	snapshot := h.get("t1", 1)
+	if want := document(t, `{"name": "webinar", "settings": {"recording": {"upload": {"type": "s3"}}}, "destinations": {"rtmpDestinations": {"yt": {"name": "yt"}}}}`); !reflect.DeepEqual(snapshot.Template, want) {
+		t.Errorf("template %v, want %v", snapshot.Template, want)
+	}
+	wantChanges := []Change{
+		{Kind: "added", Section: "settings", Path: "settings", New: map[string]interface{}{"recording": map[string]interface{}{"upload": map[string]interface{}{"type": "s3"}}}},
+		{Kind: "added", Section: "destinations", Path: "destinations.rtmpDestinations.yt", New: map[string]interface{}{"name": "yt"}},
+		{Kind: "added", Section: "template", Path: "name", New: "webinar"},
+	}
+	if !reflect.DeepEqual(snapshot.Changes, wantChanges) {
+		t.Errorf("changes %+v, want %+v", snapshot.Changes, wantChanges)
+	}
+
+	saved, err := os.ReadFile(file.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"upload-secret", "stream-key"} {
+		if strings.Contains(string(saved), secret) {
+			t.Errorf("the saved history still holds %q", secret)
+		}
+	}
+}
+
+// Credentials referenced from the vault reach 100ms, stay out of the history
+// and survive a rollback
+func TestHistoryVaultRoundTrip(t *testing.T) {
+	fake := fakeTemplateEndpoint(t, "t1", liveTemplate)
+	dataDir := t.TempDir()
+	t.Setenv("DATA_DIR", dataDir)
+	t.Setenv("VAULT_MASTER_KEY", base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef")))
+	helpers.RequestBodyRewriter = vault.InjectCredentials
+	t.Cleanup(func() { helpers.RequestBodyRewriter = nil })
+	if _, err := vault.Put("bucket", vault.Credentials{Key: "vault-key", Secret: "vault-secret"}); err != nil {
+		t.Fatal(err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.PATCH("/templates/:templateId/settings", RecordHistory, PatchTemplateSettings)
+	router.PATCH("/templates/:templateId/destinations", RecordHistory, PatchTemplateDestinations)
+	router.POST("/templates/:templateId/history/:version/rollback", RecordHistory, RollbackTemplate)
+	send := func(method, path, body string) {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s %s: status %d: %s", method, path, w.Code, w.Body)
+		}
+	}
+
+	send("PATCH", "/templates/t1/settings", `{"recording": {"upload": {"location": "bucket", "credentials": null, "credentials_ref": "bucket"}}}`)
+	send("PATCH", "/templates/t1/destinations", `{"rtmpDestinations": {"yt": {"name": "yt", "rtmpUrls": ["rtmp://a.rtmp.youtube.com/live2/stream-key"]}}}`)
+	wantCredentials := map[string]interface{}{"key": "vault-key", "secretKey": "vault-secret"}
+	if credentials := TemplateDocument(fake.template).object("settings", "recording", "upload")["credentials"]; !reflect.DeepEqual(credentials, wantCredentials) {
+		t.Fatalf("100ms got credentials %v, want %v", credentials, wantCredentials)
+	}
+
+	send("PATCH", "/templates/t1/settings", `{"region": "us"}`)
+	// Version 1 is the template before the first change and version 3 the one after the second
+	send("POST", "/templates/t1/history/3/rollback", ``)
+	upload := TemplateDocument(fake.template).object("settings", "recording", "upload")
+	if !reflect.DeepEqual(upload["credentials"], wantCredentials) || upload["location"] != "bucket" {
+		t.Errorf("upload after rollback %v, want the vault credentials", upload)
+	}
+	if _, ok := TemplateDocument(fake.template).object("destinations", "rtmpDestinations", "yt")["rtmpUrls"]; !ok {
+		t.Errorf("the stream key was lost in the rollback")
+	}
+	if region := TemplateDocument(fake.template).object("settings")["region"]; region != "in" {
+		t.Errorf("region %v after rollback, want in", region)
+	}
+
+	saved, err := os.ReadFile(filepath.Join(dataDir, "template-history.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"vault-secret", "stream-key"} {
+		if strings.Contains(string(saved), secret) {
+			t.Errorf("the history holds %s", secret)
+		}
+	}
+}
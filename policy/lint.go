@@ -0,0 +1,389 @@
+package policy
+
+import (
+	"api/helpers"
+	"api/hmserrors"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// How templates are linted when they are created or updated, from TEMPLATE_LINT_MODE
+const (
+	LintModeOff = "off"
+	// Issues are reported in Warning headers and the template is sent to 100ms anyway
+	LintModeWarn = "warn"
+	// Templates with error issues are rejected with 422
+	LintModeBlock = "block"
+)
+
+type LintIssue struct {
+	Rule     string `json:"rule"`
+	Severity string `json:"severity"`
+	Path     string `json:"path"`
+	Message  string `json:"message"`
+}
+
+type LintRule struct {
+	Name        string `json:"name"`
+	Severity    string `json:"severity"`
+	Description string `json:"description"`
+	check       func(template *HMSTemplate) []LintIssue
+}
+
+type LintResult struct {
+	Issues []LintIssue `json:"issues"`
+}
+
+// Upper bound of video bits per pixel per frame. 1080p at 30fps is
+// streamed at around 0.1, so 0.5 is far more than any encoder needs.
+const maxBitsPerPixel = 0.5
+
+var LintRules = []LintRule{
+	{
+		Name:        "dangling-role-reference",
+		Severity:    SeverityError,
+		Description: "subscribeToRoles and transcriptions name roles that exist in the template",
+		check:       checkRoleReferences,
+	},
+	{
+		Name:        "no-end-room",
+		Severity:    SeverityWarning,
+		Description: "At least one role has the endRoom permission",
+		check:       checkEndRoom,
+	},
+	{
+		Name:        "screen-without-params",
+		Severity:    SeverityWarning,
+		Description: "Roles allowed to publish screen have screen publish params",
+		check:       checkScreenParams,
+	},
+	{
+		Name:        "video-bitrate-bounds",
+		Severity:    SeverityWarning,
+		Description: "Video and screen bitrates are sensible for their resolution and frame rate",
+		check:       checkVideoBitrate,
+	},
+	{
+		Name:        "simulcast-scale",
+		Severity:    SeverityError,
+		Description: "Simulcast layers scale the resolution down by at least 1, with unique rids",
+		check:       checkSimulcastLayers,
+	},
+	{
+		Name:        "hls-without-destinations",
+		Severity:    SeverityWarning,
+		Description: "Roles with the hlsStreaming permission have an HLS destination to stream to",
+		check:       checkHlsDestinations,
+	},
+	{
+		Name:        "browser-recording-role",
+		Severity:    SeverityError,
+		Description: "Browser recordings name a role of the template for the recorder to join as",
+		check:       checkBrowserRecordingRole,
+	},
+}
+
+func lintMode() string {
+	mode, _ := helpers.GetEnvironmentVariable("TEMPLATE_LINT_MODE")
+	switch mode {
+	case LintModeOff, LintModeBlock:
+		return mode
+	default:
+		return LintModeWarn
+	}
+}
+
+// Rules listed in TEMPLATE_LINT_DISABLE, separated by commas, are skipped
+func disabledLintRules() map[string]bool {
+	disabled := map[string]bool{}
+	for _, name := range helpers.GetEnvironmentList("TEMPLATE_LINT_DISABLE") {
+		disabled[name] = true
+	}
+	return disabled
+}
+
+// Run every enabled rule over the template. Rules only look at the parts of
+// the template that are set.
+func LintTemplate(template *HMSTemplate) []LintIssue {
+	disabled := disabledLintRules()
+	issues := []LintIssue{}
+	for _, rule := range LintRules {
+		if disabled[rule.Name] {
+			continue
+		}
+		for _, issue := range rule.check(template) {
+			issue.Rule = rule.Name
+			issue.Severity = rule.Severity
+			issues = append(issues, issue)
+		}
+	}
+	return issues
+}
+
+func hasLintErrors(issues []LintIssue) bool {
+	for _, issue := range issues {
+		if issue.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// Lint a template about to be sent to 100ms according to TEMPLATE_LINT_MODE.
+// Issues are added as Warning headers; in block mode templates with errors are
+// rejected and false is returned.
+func lintTemplateRequest(ctx *gin.Context, template *HMSTemplate) ([]LintIssue, bool) {
+	mode := lintMode()
+	if mode == LintModeOff {
+		return nil, true
+	}
+
+	issues := LintTemplate(template)
+	if mode == LintModeBlock && hasLintErrors(issues) {
+		ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{
+			"error":  hmserrors.ErrTemplateLintFailed.Error(),
+			"issues": issues,
+		})
+		return issues, false
+	}
+	for _, issue := range issues {
+		ctx.Writer.Header().Add("Warning", "199 - "+strconv.Quote(issue.Rule+": "+issue.Path+": "+issue.Message))
+	}
+	if len(issues) > 0 {
+		log.Printf("template lint: %d issue(s) in %s %s", len(issues), ctx.Request.Method, ctx.Request.URL.Path)
+	}
+	return issues, true
+}
+
+// Lint an update of a template as the whole template will be once it is made,
+// since rules that compare roles need the parts the update leaves out.
+// change builds that template from the current one.
+func lintTemplateChange(ctx *gin.Context, templateId string, change func(current TemplateDocument) TemplateDocument) bool {
+	if lintMode() == LintModeOff {
+		return true
+	}
+	current, err := FetchTemplateDocument(ctx.Request.Context(), templateId)
+	if err != nil {
+		helpers.AbortWithApiError(ctx, err)
+		return false
+	}
+	template, err := change(current).Template()
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+	_, ok := lintTemplateRequest(ctx, template)
+	return ok
+}
+
+// Lint the template with the part at path replaced by the JSON body sent to 100ms
+func lintSection(ctx *gin.Context, templateId, path string, body []byte) bool {
+	var section interface{}
+	json.Unmarshal(body, &section)
+	return lintTemplateChange(ctx, templateId, func(current TemplateDocument) TemplateDocument {
+		return withSection(current, path, section)
+	})
+}
+
+func rolePath(roleName string, path string) string {
+	return "roles." + roleName + "." + path
+}
+
+func checkRoleReferences(template *HMSTemplate) []LintIssue {
+	if len(template.Roles) == 0 {
+		return nil
+	}
+
+	var issues []LintIssue
+	for _, roleName := range sortedKeys(template.Roles) {
+		role := template.Roles[roleName]
+		if role.SubscribeParams == nil {
+			continue
+		}
+		for i, subscribed := range role.SubscribeParams.SubscribeToRoles {
+			if _, ok := template.Roles[subscribed]; !ok {
+				issues = append(issues, LintIssue{
+					Path:    rolePath(roleName, fmt.Sprintf("subscribeParams.subscribeToRoles[%d]", i)),
+					Message: fmt.Sprintf("role %q does not exist", subscribed),
+				})
+			}
+		}
+	}
+
+	if template.Destinations != nil {
+		for _, name := range sortedKeys(template.Destinations.Transcriptions) {
+			transcription := template.Destinations.Transcriptions[name]
+			if _, ok := template.Roles[transcription.Role]; !ok {
+				issues = append(issues, LintIssue{
+					Path:    "destinations.transcriptions." + name + ".role",
+					Message: fmt.Sprintf("role %q does not exist", transcription.Role),
+				})
+			}
+		}
+	}
+	return issues
+}
+
+func checkEndRoom(template *HMSTemplate) []LintIssue {
+	if len(template.Roles) == 0 {
+		return nil
+	}
+	for _, role := range template.Roles {
+		if role.Permissions != nil && role.Permissions.EndRoom {
+			return nil
+		}
+	}
+	return []LintIssue{{Path: "roles", Message: "no role can end the room"}}
+}
+
+func checkScreenParams(template *HMSTemplate) []LintIssue {
+	var issues []LintIssue
+	for _, roleName := range sortedKeys(template.Roles) {
+		publish := template.Roles[roleName].PublishParams
+		if publish == nil || publish.Screen != nil {
+			continue
+		}
+		for _, allowed := range publish.Allowed {
+			if allowed == "screen" {
+				issues = append(issues, LintIssue{
+					Path:    rolePath(roleName, "publishParams.screen"),
+					Message: "screen share is allowed but has no screen params",
+				})
+			}
+		}
+	}
+	return issues
+}
+
+func checkVideoBitrate(template *HMSTemplate) []LintIssue {
+	var issues []LintIssue
+	check := func(path string, video *HMSVideo) {
+		if video == nil || video.Bitrate == 0 || video.Width == 0 || video.Height == 0 {
+			return
+		}
+		framerate := float64(video.Framerate)
+		if framerate == 0 {
+			framerate = 30
+		}
+		// Bitrates are in kbps
+		maxBitrate := float64(video.Width) * float64(video.Height) * framerate * maxBitsPerPixel / 1000
+		if float64(video.Bitrate) > maxBitrate {
+			issues = append(issues, LintIssue{
+				Path:    path + ".bitRate",
+				Message: fmt.Sprintf("%d kbps is more than %.0f kbps, the most %dx%d at %.0ffps needs", video.Bitrate, maxBitrate, video.Width, video.Height, framerate),
+			})
+		}
+	}
+
+	for _, roleName := range sortedKeys(template.Roles) {
+		if publish := template.Roles[roleName].PublishParams; publish != nil {
+			check(rolePath(roleName, "publishParams.video"), publish.Video)
+			check(rolePath(roleName, "publishParams.screen"), publish.Screen)
+		}
+	}
+	return issues
+}
+
+func checkSimulcastLayers(template *HMSTemplate) []LintIssue {
+	var issues []LintIssue
+	for _, roleName := range sortedKeys(template.Roles) {
+		publish := template.Roles[roleName].PublishParams
+		if publish == nil {
+			continue
+		}
+		for _, source := range sortedKeys(publish.Simulcast) {
+			simulcast := publish.Simulcast[source]
+			if simulcast == nil || simulcast.Layers == nil {
+				continue
+			}
+			rids := map[string]bool{}
+			for i, layer := range *simulcast.Layers {
+				path := rolePath(roleName, fmt.Sprintf("publishParams.simulcast.%s.layers[%d]", source, i))
+				if layer.ScaleResolutionDownBy < 1 {
+					issues = append(issues, LintIssue{
+						Path:    path + ".scaleResolutionDownBy",
+						Message: fmt.Sprintf("%g would scale the resolution up, use 1 or more", layer.ScaleResolutionDownBy),
+					})
+				}
+				if rids[layer.Rid] {
+					issues = append(issues, LintIssue{Path: path + ".rid", Message: fmt.Sprintf("rid %q is used by another layer", layer.Rid)})
+				}
+				rids[layer.Rid] = true
+			}
+		}
+	}
+	return issues
+}
+
+func checkHlsDestinations(template *HMSTemplate) []LintIssue {
+	if template.Destinations != nil && len(template.Destinations.HlsDestinations) > 0 {
+		return nil
+	}
+	var issues []LintIssue
+	for _, roleName := range sortedKeys(template.Roles) {
+		if permissions := template.Roles[roleName].Permissions; permissions != nil && permissions.HlsStreaming {
+			issues = append(issues, LintIssue{
+				Path:    rolePath(roleName, "permissions.hlsStreaming"),
+				Message: "HLS streaming is allowed but the template has no HLS destinations",
+			})
+		}
+	}
+	return issues
+}
+
+func checkBrowserRecordingRole(template *HMSTemplate) []LintIssue {
+	if template.Destinations == nil || len(template.Roles) == 0 {
+		return nil
+	}
+	var issues []LintIssue
+	for _, name := range sortedKeys(template.Destinations.BrowserRecordings) {
+		recording := template.Destinations.BrowserRecordings[name]
+		path := "destinations.browserRecordings." + name + ".role"
+		switch _, ok := template.Roles[recording.Role]; {
+		case recording.Role == "":
+			issues = append(issues, LintIssue{Path: path, Message: "no role is set for the recorder"})
+		case !ok:
+			issues = append(issues, LintIssue{Path: path, Message: fmt.Sprintf("role %q does not exist", recording.Role)})
+		}
+	}
+	return issues
+}
+
+// Lint a YAML or JSON template without sending it to 100ms
+func LintTemplateFile(ctx *gin.Context) {
+	var rb HMSTemplate
+	if !helpers.BindYAMLOrJSON(ctx, &rb) {
+		return
+	}
+	ctx.JSON(http.StatusOK, LintResult{Issues: LintTemplate(&rb)})
+}
+
+// Lint a template as it currently is in 100ms
+func LintExistingTemplate(ctx *gin.Context) {
+	templateId, ok := ctx.Params.Get("templateId")
+	if !ok {
+		ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": hmserrors.ErrMissingTemplateId})
+		return
+	}
+	template, err := FetchTemplate(ctx.Request.Context(), templateId)
+	if err != nil {
+		helpers.AbortWithApiError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, LintResult{Issues: LintTemplate(template)})
+}
+
+// List the rules templates are linted with
+func ListLintRules(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, gin.H{"data": LintRules, "mode": lintMode()})
+}
@@ -0,0 +1,135 @@
+package policy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestLintTemplate(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		// rule: path of each issue found
+		want []string
+	}{
+		{
+			name:     "clean",
+			template: `{"roles": {"host": {"name": "host", "permissions": {"endRoom": true}}, "guest": {"name": "guest", "subscribeParams": {"subscribeToRoles": ["host"]}}}}`,
+			want:     []string{},
+		},
+		{
+			name:     "dangling role reference",
+			template: `{"roles": {"host": {"name": "host", "permissions": {"endRoom": true}, "subscribeParams": {"subscribeToRoles": ["host", "ghost"]}}}, "destinations": {"transcriptions": {"t": {"name": "t", "role": "nobody"}}}}`,
+			want:     []string{"dangling-role-reference: roles.host.subscribeParams.subscribeToRoles[1]", "dangling-role-reference: destinations.transcriptions.t.role"},
+		},
+		{
+			name:     "no role can end the room",
+			template: `{"roles": {"guest": {"name": "guest", "permissions": {"mute": true}}}}`,
+			want:     []string{"no-end-room: roles"},
+		},
+		{
+			name:     "screen without params",
+			template: `{"roles": {"host": {"name": "host", "permissions": {"endRoom": true}, "publishParams": {"allowed": ["audio", "screen"]}}}}`,
+			want:     []string{"screen-without-params: roles.host.publishParams.screen"},
+		},
+		{
+			name:     "video bitrate",
+			template: `{"roles": {"host": {"name": "host", "permissions": {"endRoom": true}, "publishParams": {"video": {"bitRate": 5000, "width": 320, "height": 180, "frameRate": 30}, "screen": {"bitRate": 500, "width": 1920, "height": 1080}}}}}`,
+			want:     []string{"video-bitrate-bounds: roles.host.publishParams.video.bitRate"},
+		},
+		{
+			name:     "simulcast layers",
+			template: `{"roles": {"host": {"name": "host", "permissions": {"endRoom": true}, "publishParams": {"simulcast": {"video": {"layers": [{"rid": "f", "scaleResolutionDownBy": 1}, {"rid": "f", "scaleResolutionDownBy": 0.5}]}}}}}}`,
+			want:     []string{"simulcast-scale: roles.host.publishParams.simulcast.video.layers[1].scaleResolutionDownBy", "simulcast-scale: roles.host.publishParams.simulcast.video.layers[1].rid"},
+		},
+		{
+			name:     "hls without destinations",
+			template: `{"roles": {"host": {"name": "host", "permissions": {"endRoom": true, "hlsStreaming": true}}}}`,
+			want:     []string{"hls-without-destinations: roles.host.permissions.hlsStreaming"},
+		},
+		{
+			name:     "browser recording role",
+			template: `{"roles": {"host": {"name": "host", "permissions": {"endRoom": true}}}, "destinations": {"browserRecordings": {"a": {"name": "a", "role": "recorder"}, "b": {"name": "b", "role": ""}, "c": {"name": "c", "role": "host"}}}}`,
+			want:     []string{"browser-recording-role: destinations.browserRecordings.a.role", "browser-recording-role: destinations.browserRecordings.b.role"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var template HMSTemplate
+			if err := json.Unmarshal([]byte(test.template), &template); err != nil {
+				t.Fatal(err)
+			}
+			got := []string{}
+			for _, issue := range LintTemplate(&template) {
+				got = append(got, issue.Rule+": "+issue.Path)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("issues %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestLintTemplateDisabledRules(t *testing.T) {
+	t.Setenv("TEMPLATE_LINT_DISABLE", "no-end-room, hls-without-destinations")
+	template := HMSTemplate{Roles: map[string]*HMSRole{"guest": {Name: "guest", Permissions: &HMSPermissions{HlsStreaming: true}}}}
+	if issues := LintTemplate(&template); len(issues) != 0 {
+		t.Errorf("issues %+v from disabled rules", issues)
+	}
+}
+
+// Updates in block mode are linted as the whole template will be, so that
+// they may name roles the update itself leaves out
+func TestLintTemplateUpdates(t *testing.T) {
+	tests := []struct {
+		name, method, path, body string
+		wantStatus               int
+	}{
+		{"update naming an existing role", "POST", "/templates/t1", `{"roles": {"viewer": {"name": "viewer", "subscribeParams": {"subscribeToRoles": ["host"]}}}}`, http.StatusOK},
+		{"update naming a missing role", "POST", "/templates/t1", `{"roles": {"viewer": {"name": "viewer", "subscribeParams": {"subscribeToRoles": ["ghost"]}}}}`, http.StatusUnprocessableEntity},
+		{"update of the destinations only", "POST", "/templates/t1", `{"destinations": {"browserRecordings": {"r": {"name": "r", "role": "guest"}}}}`, http.StatusOK},
+		{"role naming an existing role", "POST", "/templates/t1/roles/viewer", `{"name": "viewer", "subscribeParams": {"subscribeToRoles": ["guest"]}}`, http.StatusOK},
+		{"role naming a missing role", "POST", "/templates/t1/roles/viewer", `{"name": "viewer", "subscribeParams": {"subscribeToRoles": ["ghost"]}}`, http.StatusUnprocessableEntity},
+		{"patched role naming an existing role", "PATCH", "/templates/t1/roles/guest", `{"subscribeParams": {"subscribeToRoles": ["host"]}}`, http.StatusOK},
+		{"patched role naming a missing role", "PATCH", "/templates/t1/roles/guest", `{"subscribeParams": {"subscribeToRoles": ["ghost"]}}`, http.StatusUnprocessableEntity},
+		{"patched destinations naming an existing role", "PATCH", "/templates/t1/destinations", `{"browserRecordings": {"r": {"name": "r", "role": "host"}}}`, http.StatusOK},
+		{"patched destinations naming a missing role", "PATCH", "/templates/t1/destinations", `{"browserRecordings": {"r": {"name": "r", "role": "ghost"}}}`, http.StatusUnprocessableEntity},
+		{"destinations naming an existing role", "POST", "/templates/t1/destinations", `{"browserRecordings": {"r": {"name": "r", "role": "host"}}}`, http.StatusOK},
+		{"destinations naming a missing role", "POST", "/templates/t1/destinations", `{"browserRecordings": {"r": {"name": "r", "role": "ghost"}}}`, http.StatusUnprocessableEntity},
+		{"destinations transcribing a missing role", "POST", "/templates/t1/destinations", `{"transcriptions": {"t": {"name": "t", "role": "ghost"}}}`, http.StatusUnprocessableEntity},
+		{"preset role naming an existing role", "POST", "/templates/t1/roles/viewer/preset", `{"preset": "speaker", "overrides": {"subscribeParams": {"subscribeToRoles": ["host"]}}}`, http.StatusOK},
+		{"preset role naming a missing role", "POST", "/templates/t1/roles/viewer/preset", `{"preset": "speaker", "overrides": {"subscribeParams": {"subscribeToRoles": ["ghost"]}}}`, http.StatusUnprocessableEntity},
+		{"settings", "POST", "/templates/t1/settings", `{"region": "in"}`, http.StatusOK},
+		{"settings that are not JSON", "POST", "/templates/t1/settings", `{"region": `, http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fakeTemplateEndpoint(t, "t1", liveTemplate)
+			t.Setenv("TEMPLATE_LINT_MODE", LintModeBlock)
+
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.POST("/templates/:templateId", UpdateTemplate)
+			router.POST("/templates/:templateId/roles/:roleName", ModifyTemplateRole)
+			router.PATCH("/templates/:templateId/roles/:roleName", PatchTemplateRole)
+			router.POST("/templates/:templateId/roles/:roleName/preset", AddTemplateRoleFromPreset)
+			router.POST("/templates/:templateId/settings", UpdateTemplateSettings)
+			router.POST("/templates/:templateId/destinations", UpdateTemplateDestinations)
+			router.PATCH("/templates/:templateId/destinations", PatchTemplateDestinations)
+
+			req := httptest.NewRequest(test.method, test.path, strings.NewReader(test.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != test.wantStatus {
+				t.Errorf("status %d, want %d: %s", w.Code, test.wantStatus, w.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package policy
+
+import (
+	"api/helpers"
+	"api/hmserrors"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Content type of JSON merge patches (RFC 7386). Plain application/json is accepted too.
+const MIMEMergePatch = "application/merge-patch+json"
+
+// Read a merge patch request body, which has to be a JSON object
+func bindMergePatch(ctx *gin.Context) (map[string]interface{}, bool) {
+	if contentType := ctx.ContentType(); contentType != "" && contentType != MIMEMergePatch && contentType != gin.MIMEJSON {
+		ctx.AbortWithStatusJSON(http.StatusUnsupportedMediaType, gin.H{"error": hmserrors.ErrInvalidMergePatchType.Error()})
+		return nil, false
+	}
+	body, err := io.ReadAll(ctx.Request.Body)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	var patch map[string]interface{}
+	if err := json.Unmarshal(body, &patch); err != nil || patch == nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": hmserrors.ErrInvalidMergePatch.Error()})
+		return nil, false
+	}
+	return patch, true
+}
+
+// Apply a merge patch to the part of a template at path, e.g. roles/host, and
+// send the result back to 100ms once the template it makes is linted.
+// The merged JSON is sent as it is rather than through v, which would drop false
+// and zero values because of omitempty; v only checks it against the validation rules.
+func patchDocument(ctx *gin.Context, templateId, path string, patch map[string]interface{}, v interface{}) {
+	url := policyBaseUrl() + "/" + templateId + "/" + path
+	patchBody, _ := json.Marshal(patch)
+
+	var current json.RawMessage
+	if err := helpers.CallApi(ctx.Request.Context(), "GET", url, nil, &current); err != nil {
+		helpers.AbortWithApiError(ctx, err)
+		return
+	}
+
+	merged, err := helpers.MergePatch(current, patchBody)
+	if err == nil {
+		if err = json.Unmarshal(merged, v); err == nil {
+			err = helpers.Validate(v)
+		}
+	}
+	if err != nil {
+		helpers.AbortWithFieldErrors(ctx, helpers.ValidationErrors(err))
+		return
+	}
+
+	var section interface{}
+	json.Unmarshal(merged, &section)
+	if !lintTemplateChange(ctx, templateId, func(current TemplateDocument) TemplateDocument {
+		return withSection(current, path, section)
+	}) {
+		return
+	}
+	helpers.MakeApiRequest(ctx, url, "POST", bytes.NewBuffer(merged))
+}
+
+// The template with the part at path, e.g. roles/host or settings, replaced by section
+func withSection(current TemplateDocument, path string, section interface{}) TemplateDocument {
+	replaced := TemplateDocument{}
+	for key, value := range current {
+		replaced[key] = value
+	}
+	if roleName, ok := strings.CutPrefix(path, "roles/"); ok {
+		roles := map[string]interface{}{}
+		for name, role := range current.object("roles") {
+			roles[name] = role
+		}
+		roles[roleName] = section
+		replaced["roles"] = roles
+	} else {
+		replaced[path] = section
+	}
+	return replaced
+}
+
+// Update the fields of a role named in a JSON merge patch, e.g. {"permissions": {"endRoom": false}}
+func PatchTemplateRole(ctx *gin.Context) {
+	templateId, ok := ctx.Params.Get("templateId")
+	roleName, ok1 := ctx.Params.Get("roleName")
+	if !ok || !ok1 {
+		ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": hmserrors.ErrMissingTemplateIdAndRoleName})
+		return
+	}
+
+	patch, ok := bindMergePatch(ctx)
+	if !ok {
+		return
+	}
+	// The role keeps the name in the path
+	patch["name"] = roleName
+	patchDocument(ctx, templateId, "roles/"+roleName, patch, &HMSRole{})
+}
+
+// Update the fields of the template settings named in a JSON merge patch
+func PatchTemplateSettings(ctx *gin.Context) {
+	templateId, ok := ctx.Params.Get("templateId")
+	if !ok {
+		ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": hmserrors.ErrMissingTemplateId})
+		return
+	}
+
+	patch, ok := bindMergePatch(ctx)
+	if !ok {
+		return
+	}
+	patchDocument(ctx, templateId, "settings", patch, &HMSSetting{})
+}
+
+// Update the fields of the template destinations named in a JSON merge patch.
+// A destination is removed by setting it to null.
+func PatchTemplateDestinations(ctx *gin.Context) {
+	templateId, ok := ctx.Params.Get("templateId")
+	if !ok {
+		ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": hmserrors.ErrMissingTemplateId})
+		return
+	}
+
+	patch, ok := bindMergePatch(ctx)
+	if !ok {
+		return
+	}
+	patchDocument(ctx, templateId, "destinations", patch, &HMSDestination{})
+}
@@ -0,0 +1,66 @@
+package policy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestPatchTemplateRole(t *testing.T) {
+	tests := []struct {
+		name, contentType, body string
+		wantStatus              int
+		// The role sent to 100ms, when it is
+		wantSent string
+	}{
+		{
+			name: "false values are sent", contentType: MIMEMergePatch,
+			body:       `{"permissions": {"endRoom": false}, "priority": null}`,
+			wantStatus: http.StatusOK,
+			wantSent:   `{"name": "host", "permissions": {"endRoom": false, "mute": true}}`,
+		},
+		{
+			name: "the role keeps the name in the path", contentType: gin.MIMEJSON,
+			body:       `{"name": "other", "maxPeerCount": 5}`,
+			wantStatus: http.StatusOK,
+			wantSent:   `{"name": "host", "priority": 1, "maxPeerCount": 5, "permissions": {"endRoom": true, "mute": true}}`,
+		},
+		{name: "other content types", contentType: "text/plain", body: `{}`, wantStatus: http.StatusUnsupportedMediaType},
+		{name: "not an object", contentType: MIMEMergePatch, body: `[1]`, wantStatus: http.StatusBadRequest},
+		{name: "invalid result", contentType: MIMEMergePatch, body: `{"maxPeerCount": -1}`, wantStatus: http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake := fakeTemplateEndpoint(t, "t1", liveTemplate)
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.PATCH("/templates/:templateId/roles/:roleName", PatchTemplateRole)
+
+			req := httptest.NewRequest("PATCH", "/templates/t1/roles/host", strings.NewReader(test.body))
+			req.Header.Set("Content-Type", test.contentType)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != test.wantStatus {
+				t.Fatalf("status %d, want %d: %s", w.Code, test.wantStatus, w.Body)
+			}
+
+			sent, ok := fake.posted["POST roles/host"]
+			if test.wantSent == "" {
+				if ok {
+					t.Errorf("role sent: %v", sent)
+				}
+				return
+			}
+			var want interface{}
+			json.Unmarshal([]byte(test.wantSent), &want)
+			if !reflect.DeepEqual(sent, want) {
+				t.Errorf("role sent %v, want %v", sent, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,248 @@
+package policy
+
+import (
+	"api/helpers"
+	"api/hmserrors"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	ChangeAdded   = "added"
+	ChangeRemoved = "removed"
+	ChangeChanged = "changed"
+)
+
+// A single difference between two templates, e.g. the path
+// "roles.host.permissions.endRoom" changing from false to true
+type Change struct {
+	Kind string `json:"kind"`
+	// One of template, roles, permissions, publishParams, subscribeParams, settings or destinations
+	Section string      `json:"section"`
+	Path    string      `json:"path"`
+	Old     interface{} `json:"old,omitempty"`
+	New     interface{} `json:"new,omitempty"`
+}
+
+type Plan struct {
+	TemplateId string `json:"template_id"`
+	// Confirms the plan when passed to apply, as long as the template has not changed since
+	PlanId  string   `json:"plan_id"`
+	Changes []Change `json:"changes"`
+	// The template once the plan is applied
+	applied TemplateDocument
+}
+
+type PlanTemplateQueryParam struct {
+	Prune  bool   `form:"prune"`
+	Format string `form:"format" binding:"omitempty,oneof=json text"`
+}
+
+// Merge a part of a template file into the current one as a JSON merge patch
+func mergeSection(current, patch interface{}) interface{} {
+	currentData, _ := json.Marshal(current)
+	patchData, _ := json.Marshal(patch)
+	merged, err := helpers.MergePatch(currentData, patchData)
+	if err != nil {
+		return patch
+	}
+	var value interface{}
+	json.Unmarshal(merged, &value)
+	return value
+}
+
+// The template as it will be once the file is applied: the name is replaced, and
+// each role and the settings and destinations the file has are merged into the
+// current ones. A field is only changed when the file sets it, to false as well,
+// and is removed when the file sets it to null.
+func appliedDocument(current, file TemplateDocument, prune bool) TemplateDocument {
+	applied := TemplateDocument{}
+	for key, value := range current {
+		applied[key] = value
+	}
+	if name := file.name(); name != "" {
+		applied["name"] = name
+	}
+
+	if fileRoles := file.object("roles"); fileRoles != nil || prune {
+		currentRoles := current.object("roles")
+		roles := map[string]interface{}{}
+		if !prune {
+			for roleName, role := range currentRoles {
+				roles[roleName] = role
+			}
+		}
+		for roleName, role := range fileRoles {
+			roles[roleName] = mergeSection(currentRoles[roleName], role)
+		}
+		applied["roles"] = roles
+	}
+
+	for _, section := range []string{"settings", "destinations"} {
+		if patch, ok := file[section]; ok {
+			applied[section] = mergeSection(current[section], patch)
+		}
+	}
+	return applied
+}
+
+func changeSection(path string) string {
+	parts := strings.Split(path, ".")
+	switch parts[0] {
+	case "roles":
+		if len(parts) > 2 {
+			switch parts[2] {
+			case "permissions", "publishParams", "subscribeParams":
+				return parts[2]
+			}
+		}
+		return "roles"
+	case "settings", "destinations":
+		return parts[0]
+	default:
+		return "template"
+	}
+}
+
+func diffValues(path string, old, new interface{}, changes *[]Change) {
+	oldObject, oldIsObject := old.(map[string]interface{})
+	newObject, newIsObject := new.(map[string]interface{})
+	if !oldIsObject || !newIsObject {
+		if !reflect.DeepEqual(old, new) {
+			*changes = append(*changes, Change{Kind: ChangeChanged, Section: changeSection(path), Path: path, Old: old, New: new})
+		}
+		return
+	}
+
+	keys := map[string]bool{}
+	for key := range oldObject {
+		keys[key] = true
+	}
+	for key := range newObject {
+		keys[key] = true
+	}
+	sorted := make([]string, 0, len(keys))
+	for key := range keys {
+		sorted = append(sorted, key)
+	}
+	sort.Strings(sorted)
+
+	for _, key := range sorted {
+		keyPath := key
+		if path != "" {
+			keyPath = path + "." + key
+		}
+		oldValue, inOld := oldObject[key]
+		newValue, inNew := newObject[key]
+		switch {
+		case !inOld:
+			*changes = append(*changes, Change{Kind: ChangeAdded, Section: changeSection(keyPath), Path: keyPath, New: newValue})
+		case !inNew:
+			*changes = append(*changes, Change{Kind: ChangeRemoved, Section: changeSection(keyPath), Path: keyPath, Old: oldValue})
+		default:
+			diffValues(keyPath, oldValue, newValue, changes)
+		}
+	}
+}
+
+// Every field that differs between two template documents, ordered by path
+func diffDocuments(old, new TemplateDocument) []Change {
+	changes := []Change{}
+	diffValues("", map[string]interface{}(old), map[string]interface{}(new), &changes)
+	return changes
+}
+
+func planId(current, file TemplateDocument, prune bool) string {
+	data, _ := json.Marshal([]interface{}{current, file, prune})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// Compare a template file with the current state of the template it would update.
+// The changes are exactly those ApplyTemplate makes.
+func PlanTemplate(ctx context.Context, templateId string, file TemplateDocument, prune bool) (*Plan, error) {
+	current, err := FetchTemplateDocument(ctx, templateId)
+	if err != nil {
+		return nil, err
+	}
+	applied := appliedDocument(current, file, prune)
+	return &Plan{
+		TemplateId: templateId,
+		PlanId:     planId(current, file, prune),
+		Changes:    diffDocuments(current, applied),
+		applied:    applied,
+	}, nil
+}
+
+func formatValue(value interface{}) string {
+	data, _ := json.Marshal(value)
+	return string(data)
+}
+
+// Human readable form of the plan, one line per change
+func (plan *Plan) String() string {
+	counts := map[string]int{}
+	for _, change := range plan.Changes {
+		counts[change.Kind]++
+	}
+
+	var text strings.Builder
+	if len(plan.Changes) == 0 {
+		fmt.Fprintf(&text, "No changes to template %s\n", plan.TemplateId)
+		return text.String()
+	}
+	fmt.Fprintf(&text, "Plan %s for template %s: %d to add, %d to change, %d to remove\n\n",
+		plan.PlanId, plan.TemplateId, counts[ChangeAdded], counts[ChangeChanged], counts[ChangeRemoved])
+	for _, change := range plan.Changes {
+		switch change.Kind {
+		case ChangeAdded:
+			fmt.Fprintf(&text, "  + %s = %s\n", change.Path, formatValue(change.New))
+		case ChangeRemoved:
+			fmt.Fprintf(&text, "  - %s = %s\n", change.Path, formatValue(change.Old))
+		default:
+			fmt.Fprintf(&text, "  ~ %s: %s -> %s\n", change.Path, formatValue(change.Old), formatValue(change.New))
+		}
+	}
+	return text.String()
+}
+
+// Show the changes applying a template file would make, without making them
+func PlanTemplateFile(ctx *gin.Context) {
+	templateId, ok := ctx.Params.Get("templateId")
+	if !ok {
+		ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": hmserrors.ErrMissingTemplateId})
+		return
+	}
+
+	var param PlanTemplateQueryParam
+	if err := ctx.ShouldBindQuery(&param); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rb, ok := bindTemplateFile(ctx)
+	if !ok {
+		return
+	}
+
+	plan, err := PlanTemplate(ctx.Request.Context(), templateId, rb, param.Prune)
+	if err != nil {
+		helpers.AbortWithApiError(ctx, err)
+		return
+	}
+
+	if param.Format == "text" {
+		ctx.String(http.StatusOK, plan.String())
+		return
+	}
+	ctx.JSON(http.StatusOK, plan)
+}
@@ -0,0 +1,240 @@
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func document(t *testing.T, data string) TemplateDocument {
+	t.Helper()
+	document, err := NewTemplateDocument([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return document
+}
+
+// A 100ms templates endpoint holding a single template. Its name is set, and
+// roles, settings and destinations replaced, by the bodies posted to them, which are kept.
+type fakeTemplates struct {
+	mu       sync.Mutex
+	template map[string]interface{}
+	posted   map[string]interface{}
+}
+
+func fakeTemplateEndpoint(t *testing.T, templateId, template string) *fakeTemplates {
+	t.Helper()
+	fake := &fakeTemplates{posted: map[string]interface{}{}}
+	json.Unmarshal([]byte(template), &fake.template)
+
+	prefix := "/templates/" + templateId
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fake.mu.Lock()
+		defer fake.mu.Unlock()
+		if !strings.HasPrefix(r.URL.Path, prefix) {
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, `{"message":"template not found"}`)
+			return
+		}
+		section := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, prefix), "/")
+
+		if r.Method == "GET" {
+			var value interface{} = fake.template
+			if roleName, ok := strings.CutPrefix(section, "roles/"); ok {
+				value = fake.template["roles"].(map[string]interface{})[roleName]
+			} else if section != "" {
+				value = fake.template[section]
+			}
+			json.NewEncoder(w).Encode(value)
+			return
+		}
+
+		var body interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		switch {
+		case section == "":
+			fake.template["name"] = body.(map[string]interface{})["name"]
+		case strings.HasPrefix(section, "roles/"):
+			roles, _ := fake.template["roles"].(map[string]interface{})
+			if r.Method == "DELETE" {
+				delete(roles, strings.TrimPrefix(section, "roles/"))
+			} else {
+				roles[strings.TrimPrefix(section, "roles/")] = body
+			}
+		default:
+			fake.template[section] = body
+		}
+		fake.posted[r.Method+" "+section] = body
+		io.WriteString(w, `{}`)
+	}))
+	t.Cleanup(server.Close)
+	t.Setenv("BASE_URL", server.URL+"/")
+	t.Setenv("APP_ACCESS_KEY", "access")
+	t.Setenv("APP_SECRET", "secret")
+	return fake
+}
+
+const liveTemplate = `{
+	"id": "t1",
+	"name": "webinar",
+	"roles": {
+		"host": {"name": "host", "priority": 1, "permissions": {"endRoom": true, "mute": true}},
+		"guest": {"name": "guest", "permissions": {"endRoom": false}}
+	},
+	"settings": {"region": "in", "recording": {"enabled": true, "upload": {"type": "s3", "credentials": {"key": "k", "secretKey": "s"}}}}
+}`
+
+func TestAppliedDocument(t *testing.T) {
+	tests := []struct {
+		name  string
+		file  string
+		prune bool
+		want  string
+	}{
+		{
+			name: "fields the file leaves out are kept",
+			file: `{"roles": {"host": {"priority": 2}}}`,
+			want: `{"name": "webinar", "roles": {"host": {"name": "host", "priority": 2, "permissions": {"endRoom": true, "mute": true}}, "guest": {"name": "guest", "permissions": {"endRoom": false}}}, "settings": {"region": "in", "recording": {"enabled": true, "upload": {"type": "s3", "credentials": {"key": "k", "secretKey": "s"}}}}}`,
+		},
+		{
+			name: "false values are applied",
+			file: `{"roles": {"host": {"permissions": {"endRoom": false}}}, "settings": {"recording": {"enabled": false}}}`,
+			want: `{"name": "webinar", "roles": {"host": {"name": "host", "priority": 1, "permissions": {"endRoom": false, "mute": true}}, "guest": {"name": "guest", "permissions": {"endRoom": false}}}, "settings": {"region": "in", "recording": {"enabled": false, "upload": {"type": "s3", "credentials": {"key": "k", "secretKey": "s"}}}}}`,
+		},
+		{
+			name: "null removes a field",
+			file: `{"name": "webinar-2", "settings": {"region": null}}`,
+			want: `{"name": "webinar-2", "roles": {"host": {"name": "host", "priority": 1, "permissions": {"endRoom": true, "mute": true}}, "guest": {"name": "guest", "permissions": {"endRoom": false}}}, "settings": {"recording": {"enabled": true, "upload": {"type": "s3", "credentials": {"key": "k", "secretKey": "s"}}}}}`,
+		},
+		{
+			name:  "prune drops roles missing from the file",
+			file:  `{"roles": {"viewer": {"name": "viewer"}}}`,
+			prune: true,
+			want:  `{"name": "webinar", "roles": {"viewer": {"name": "viewer"}}, "settings": {"region": "in", "recording": {"enabled": true, "upload": {"type": "s3", "credentials": {"key": "k", "secretKey": "s"}}}}}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			current := document(t, liveTemplate)
+			got := appliedDocument(current, document(t, test.file), test.prune)
+			if want := document(t, test.want); !reflect.DeepEqual(got, want) {
+				t.Errorf("applied\n%v\nwant\n%v", got, want)
+			}
+			if !reflect.DeepEqual(current, document(t, liveTemplate)) {
+				t.Errorf("the current template was changed")
+			}
+		})
+	}
+}
+
+func TestDiffDocuments(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new string
+		want     []Change
+	}{
+		{"equal", `{"name": "a"}`, `{"name": "a"}`, []Change{}},
+		{
+			"true to false",
+			`{"roles": {"host": {"permissions": {"endRoom": true}}}}`,
+			`{"roles": {"host": {"permissions": {"endRoom": false}}}}`,
+			[]Change{{Kind: ChangeChanged, Section: "permissions", Path: "roles.host.permissions.endRoom", Old: true, New: false}},
+		},
+		{
+			"added and removed, ordered by path",
+			`{"name": "a", "settings": {"region": "in"}}`,
+			`{"roles": {"guest": {"name": "guest"}}, "settings": {"region": "in"}}`,
+			[]Change{
+				{Kind: ChangeRemoved, Section: "template", Path: "name", Old: "a"},
+				{Kind: ChangeAdded, Section: "roles", Path: "roles", New: map[string]interface{}{"guest": map[string]interface{}{"name": "guest"}}},
+			},
+		},
+		{
+			"sections",
+			`{"roles": {"host": {"priority": 1, "publishParams": {"allowed": ["audio"]}}}, "destinations": {"hlsDestinations": {}}}`,
+			`{"roles": {"host": {"priority": 2, "publishParams": {"allowed": ["audio", "video"]}}}, "destinations": {}}`,
+			[]Change{
+				{Kind: ChangeRemoved, Section: "destinations", Path: "destinations.hlsDestinations", Old: map[string]interface{}{}},
+				{Kind: ChangeChanged, Section: "roles", Path: "roles.host.priority", Old: 1.0, New: 2.0},
+				{Kind: ChangeChanged, Section: "publishParams", Path: "roles.host.publishParams.allowed", Old: []interface{}{"audio"}, New: []interface{}{"audio", "video"}},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := diffDocuments(document(t, test.old), document(t, test.new))
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("changes\n%+v\nwant\n%+v", got, test.want)
+			}
+		})
+	}
+}
+
+// Apply makes exactly the changes of the plan, false values included
+func TestApplyTemplateMatchesPlan(t *testing.T) {
+	tests := []struct {
+		name  string
+		file  string
+		prune bool
+		// A request apply makes, and its body
+		request, body string
+	}{
+		{
+			"permission switched off", `{"roles": {"host": {"name": "host", "permissions": {"endRoom": false}}}}`, false,
+			"POST roles/host", `{"name": "host", "priority": 1, "permissions": {"endRoom": false, "mute": true}}`,
+		},
+		{
+			"settings and name", `{"name": "webinar-2", "settings": {"recording": {"enabled": false}, "region": null}}`, false,
+			"POST settings", `{"recording": {"enabled": false, "upload": {"type": "s3", "credentials": {"key": "k", "secretKey": "s"}}}}`,
+		},
+		{
+			"prune", `{"roles": {"guest": {"name": "guest", "priority": 3}}}`, true,
+			"DELETE roles/host", `null`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake := fakeTemplateEndpoint(t, "t1", liveTemplate)
+			ctx := context.Background()
+			file := document(t, test.file)
+
+			plan, err := PlanTemplate(ctx, "t1", file, test.prune)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(plan.Changes) == 0 {
+				t.Fatal("the plan has no changes")
+			}
+			if _, err := ApplyTemplate(ctx, "t1", file, test.prune); err != nil {
+				t.Fatal(err)
+			}
+
+			after, err := FetchTemplateDocument(ctx, "t1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(after, plan.applied) {
+				t.Errorf("template after apply\n%v\nplanned\n%v", after, plan.applied)
+			}
+			replanned, err := PlanTemplate(ctx, "t1", file, test.prune)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(replanned.Changes) != 0 {
+				t.Errorf("changes left after apply: %+v", replanned.Changes)
+			}
+			var body interface{}
+			json.Unmarshal([]byte(test.body), &body)
+			if sent, ok := fake.posted[test.request]; !ok || !reflect.DeepEqual(sent, body) {
+				t.Errorf("%s sent %v, want %v", test.request, sent, body)
+			}
+		})
+	}
+}
@@ -13,7 +13,9 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-var policyBaseUrl = helpers.GetEndpointUrl("templates")
+func policyBaseUrl() string {
+	return helpers.GetEndpointUrl("templates")
+}
 
 type HMSAudio struct {
 	Bitrate uint16 `json:"bitRate,omitempty"`
@@ -38,25 +40,25 @@ type HMSSimulcastLayer struct {
 }
 
 type HMSSimulcast struct {
-	Layers *[]HMSSimulcastLayer `json:"layers,omitempty"`
+	Layers *[]HMSSimulcastLayer `json:"layers,omitempty" binding:"omitempty,dive"`
 }
 
 type HMSPublishParams struct {
-	Allowed   []string                 `json:"allowed,omitempty"`
+	Allowed   []string                 `json:"allowed,omitempty" binding:"omitempty,dive,oneof=audio video screen"`
 	Audio     *HMSAudio                `json:"audio,omitempty"`
 	Video     *HMSVideo                `json:"video,omitempty"`
 	Screen    *HMSScreen               `json:"screen,omitempty"`
-	Simulcast map[string]*HMSSimulcast `json:"simulcast,omitempty"`
+	Simulcast map[string]*HMSSimulcast `json:"simulcast,omitempty" binding:"omitempty,dive,keys,oneof=video screen,endkeys,required"`
 }
 
 type HMSSubscribeDegradation struct {
-	PacketLossThreshold       uint8 `json:"packetLossThreshold,omitempty"`
+	PacketLossThreshold       uint8 `json:"packetLossThreshold,omitempty" binding:"lte=100"`
 	DegradeGracePeriodSeconds uint8 `json:"degradeGracePeriodSeconds,omitempty"`
 	RecoverGracePeriodSeconds uint8 `json:"recoverGracePeriodSeconds,omitempty"`
 }
 
 type HMSSubscribeParams struct {
-	MaxSubsBitRate       int                      `json:"maxSubsBitRate,omitempty"`
+	MaxSubsBitRate       int                      `json:"maxSubsBitRate,omitempty" binding:"gte=0"`
 	SubscribeToRoles     []string                 `json:"subscribeToRoles,omitempty"`
 	SubscribeDegradation *HMSSubscribeDegradation `json:"subscribeDegradation,omitempty"`
 }
@@ -76,12 +78,12 @@ type HMSPermissions struct {
 }
 
 type HMSRole struct {
-	Name            string              `json:"name,omitempty"`
+	Name            string              `json:"name,omitempty" binding:"required"`
 	PublishParams   *HMSPublishParams   `json:"publishParams,omitempty"`
 	SubscribeParams *HMSSubscribeParams `json:"subscribeParams,omitempty"`
 	Permissions     *HMSPermissions     `json:"permissions,omitempty"`
 	Priority        uint8               `json:"priority,omitempty"`
-	MaxPeerCount    int                 `json:"maxPeerCount,omitempty"`
+	MaxPeerCount    int                 `json:"maxPeerCount,omitempty" binding:"gte=0"`
 }
 
 type UploadOptions struct {
@@ -99,6 +101,8 @@ type HMSUpload struct {
 	Prefix      string             `json:"prefix"`
 	Options     *UploadOptions     `json:"options,omitempty"`
 	Credentials *UploadCredentials `json:"credentials,omitempty"`
+	// Name of credentials in the vault, filled in when the template is sent to 100ms
+	CredentialsRef string `json:"credentials_ref,omitempty"`
 }
 
 type HMSRecording struct {
@@ -195,7 +199,7 @@ type HMSDestination struct {
 
 type HMSTemplate struct {
 	Name         string              `json:"name,omitempty"`
-	Roles        map[string]*HMSRole `json:"roles,omitempty"`
+	Roles        map[string]*HMSRole `json:"roles,omitempty" binding:"omitempty,dive,keys,required,endkeys,required"`
 	Settings     *HMSSetting         `json:"settings,omitempty"`
 	Destinations *HMSDestination     `json:"destinations,omitempty"`
 }
@@ -205,11 +209,21 @@ type HMSTemplateQueryParam struct {
 	Start string `form:"start,omitempty"`
 }
 
-// Get the post request body
-func getTemplateRequestBody(ctx *gin.Context) *bytes.Buffer {
+// Get the post request body. Updates of the template with templateId are
+// linted merged into the current template.
+func getTemplateRequestBody(ctx *gin.Context, templateId string) (*bytes.Buffer, bool) {
 	var rb HMSTemplate
-	if err := ctx.ShouldBindJSON(&rb); err != nil {
-		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !helpers.BindJSON(ctx, &rb) {
+		return nil, false
+	}
+	if templateId == "" {
+		if _, ok := lintTemplateRequest(ctx, &rb); !ok {
+			return nil, false
+		}
+	} else if !lintTemplateChange(ctx, templateId, func(current TemplateDocument) TemplateDocument {
+		return appliedDocument(current, documentOf(&rb), false)
+	}) {
+		return nil, false
 	}
 
 	postBody, _ := json.Marshal(HMSTemplate{
@@ -220,13 +234,16 @@ func getTemplateRequestBody(ctx *gin.Context) *bytes.Buffer {
 	})
 
 	payload := bytes.NewBuffer(postBody)
-	return payload
+	return payload, true
 }
 
 // Create a template
 func CreateTemplate(ctx *gin.Context) {
-	payload := getTemplateRequestBody(ctx)
-	helpers.MakeApiRequest(ctx, policyBaseUrl, "POST", payload)
+	payload, ok := getTemplateRequestBody(ctx, "")
+	if !ok {
+		return
+	}
+	helpers.MakeApiRequest(ctx, policyBaseUrl(), "POST", payload)
 }
 
 // Update a template using the template ID
@@ -236,8 +253,11 @@ func UpdateTemplate(ctx *gin.Context) {
 		ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": hmserrors.ErrMissingTemplateId})
 	}
 
-	payload := getTemplateRequestBody(ctx)
-	helpers.MakeApiRequest(ctx, policyBaseUrl+"/"+templateId, "POST", payload)
+	payload, ok := getTemplateRequestBody(ctx, templateId)
+	if !ok {
+		return
+	}
+	helpers.MakeApiRequest(ctx, policyBaseUrl()+"/"+templateId, "POST", payload)
 }
 
 // Get a list of all rooms
@@ -251,7 +271,7 @@ func ListTemplates(ctx *gin.Context) {
 			qs.Add("limit", strconv.Itoa(int(param.Limit)))
 		}
 	}
-	helpers.MakeApiRequest(ctx, policyBaseUrl+"?"+qs.Encode(), "GET", nil)
+	helpers.MakeApiRequest(ctx, policyBaseUrl()+"?"+qs.Encode(), "GET", nil)
 }
 
 // Get a template using the template ID
@@ -260,7 +280,7 @@ func GetTemplate(ctx *gin.Context) {
 	if !ok {
 		ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": hmserrors.ErrMissingTemplateId})
 	}
-	helpers.MakeApiRequest(ctx, policyBaseUrl+"/"+templateId, "GET", nil)
+	helpers.MakeApiRequest(ctx, policyBaseUrl()+"/"+templateId, "GET", nil)
 }
 
 // Modify a role in a template
@@ -272,8 +292,13 @@ func ModifyTemplateRole(ctx *gin.Context) {
 	}
 
 	var rb HMSRole
-	if err := ctx.ShouldBindJSON(&rb); err != nil {
-		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !helpers.BindJSON(ctx, &rb) {
+		return
+	}
+	if !lintTemplateChange(ctx, templateId, func(current TemplateDocument) TemplateDocument {
+		return appliedDocument(current, documentOf(&HMSTemplate{Roles: map[string]*HMSRole{roleName: &rb}}), false)
+	}) {
+		return
 	}
 
 	postBody, _ := json.Marshal(HMSRole{
@@ -286,7 +311,7 @@ func ModifyTemplateRole(ctx *gin.Context) {
 	})
 
 	payload := bytes.NewBuffer(postBody)
-	helpers.MakeApiRequest(ctx, policyBaseUrl+"/"+templateId+"/roles/"+roleName, "POST", payload)
+	helpers.MakeApiRequest(ctx, policyBaseUrl()+"/"+templateId+"/roles/"+roleName, "POST", payload)
 }
 
 // Retrieve a specific role
@@ -296,7 +321,7 @@ func GetTemplateRole(ctx *gin.Context) {
 	if !ok || !ok1 {
 		ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": hmserrors.ErrMissingTemplateIdAndRoleName})
 	}
-	helpers.MakeApiRequest(ctx, policyBaseUrl+"/"+templateId+"/roles/"+roleName, "GET", nil)
+	helpers.MakeApiRequest(ctx, policyBaseUrl()+"/"+templateId+"/roles/"+roleName, "GET", nil)
 }
 
 // Delete a specific role
@@ -306,7 +331,7 @@ func DeleteTemplateRole(ctx *gin.Context) {
 	if !ok || !ok1 {
 		ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": hmserrors.ErrMissingTemplateIdAndRoleName})
 	}
-	helpers.MakeApiRequest(ctx, policyBaseUrl+"/"+templateId+"/roles/"+roleName, "DELETE", nil)
+	helpers.MakeApiRequest(ctx, policyBaseUrl()+"/"+templateId+"/roles/"+roleName, "DELETE", nil)
 }
 
 // Retrieve template settings
@@ -315,7 +340,7 @@ func GetTemplateSettings(ctx *gin.Context) {
 	if !ok {
 		ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": hmserrors.ErrMissingTemplateId})
 	}
-	helpers.MakeApiRequest(ctx, policyBaseUrl+"/"+templateId+"/settings", "GET", nil)
+	helpers.MakeApiRequest(ctx, policyBaseUrl()+"/"+templateId+"/settings", "GET", nil)
 }
 
 // Update template settings
@@ -326,16 +351,19 @@ func UpdateTemplateSettings(ctx *gin.Context) {
 	}
 
 	var rb HMSSetting
-	if err := ctx.ShouldBindJSON(&rb); err != nil {
-		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !helpers.BindJSON(ctx, &rb) {
+		return
 	}
 	postBody, _ := json.Marshal(HMSSetting{
 		Region:    rb.Region,
 		Recording: rb.Recording,
 		RoomState: rb.RoomState,
 	})
+	if !lintSection(ctx, templateId, "settings", postBody) {
+		return
+	}
 	payload := bytes.NewBuffer(postBody)
-	helpers.MakeApiRequest(ctx, policyBaseUrl+"/"+templateId+"/settings", "POST", payload)
+	helpers.MakeApiRequest(ctx, policyBaseUrl()+"/"+templateId+"/settings", "POST", payload)
 }
 
 // Retrieve template destinations
@@ -344,7 +372,7 @@ func GetTemplateDestinations(ctx *gin.Context) {
 	if !ok {
 		ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": hmserrors.ErrMissingTemplateId})
 	}
-	helpers.MakeApiRequest(ctx, policyBaseUrl+"/"+templateId+"/destinations", "GET", nil)
+	helpers.MakeApiRequest(ctx, policyBaseUrl()+"/"+templateId+"/destinations", "GET", nil)
 }
 
 // Update template destinations
@@ -355,8 +383,8 @@ func UpdateTemplateDestinations(ctx *gin.Context) {
 	}
 
 	var rb HMSDestination
-	if err := ctx.ShouldBindJSON(&rb); err != nil {
-		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !helpers.BindJSON(ctx, &rb) {
+		return
 	}
 	postBody, _ := json.Marshal(HMSDestination{
 		BrowserRecordings: rb.BrowserRecordings,
@@ -364,6 +392,9 @@ func UpdateTemplateDestinations(ctx *gin.Context) {
 		HlsDestinations:   rb.HlsDestinations,
 		Transcriptions:    rb.Transcriptions,
 	})
+	if !lintSection(ctx, templateId, "destinations", postBody) {
+		return
+	}
 	payload := bytes.NewBuffer(postBody)
-	helpers.MakeApiRequest(ctx, policyBaseUrl+"/"+templateId+"/destinations", "POST", payload)
+	helpers.MakeApiRequest(ctx, policyBaseUrl()+"/"+templateId+"/destinations", "POST", payload)
 }
@@ -0,0 +1,322 @@
+package policy
+
+import (
+	"api/helpers"
+	"api/hmserrors"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// A named starting point for a role
+type RolePreset struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Role        *HMSRole `json:"role"`
+	// Without a subscribeToRoles override, the role subscribes to the roles of
+	// the template that publish
+	SubscribesToPublishers bool `json:"subscribes_to_publishers"`
+}
+
+// A role made from a preset. Overrides are a JSON merge patch of the preset's
+// role: objects are merged, null removes a field and other values replace it.
+type RoleFromPreset struct {
+	Preset    string                 `json:"preset" binding:"required"`
+	Overrides map[string]interface{} `json:"overrides,omitempty"`
+}
+
+type TemplateFromPresetsBody struct {
+	Name         string                     `json:"name" binding:"required"`
+	Roles        map[string]*RoleFromPreset `json:"roles" binding:"required,min=1,dive,keys,required,endkeys,required"`
+	Settings     *HMSSetting                `json:"settings,omitempty"`
+	Destinations *HMSDestination            `json:"destinations,omitempty"`
+}
+
+func publishParams(allowed ...string) *HMSPublishParams {
+	return &HMSPublishParams{
+		Allowed: allowed,
+		Audio:   &HMSAudio{Bitrate: 32, Codec: "opus"},
+		Video:   &HMSVideo{Bitrate: 700, Codec: "vp8", Framerate: 30, Width: 1280, Height: 720},
+		Screen:  &HMSScreen{Bitrate: 1000, Codec: "vp8", Framerate: 10, Width: 1920, Height: 1080},
+		Simulcast: map[string]*HMSSimulcast{
+			"video": {Layers: &[]HMSSimulcastLayer{
+				{Rid: "f", ScaleResolutionDownBy: 1, MaxBitrate: 700, MaxFramerate: 30},
+				{Rid: "h", ScaleResolutionDownBy: 2, MaxBitrate: 250, MaxFramerate: 30},
+				{Rid: "q", ScaleResolutionDownBy: 4, MaxBitrate: 100, MaxFramerate: 15},
+			}},
+		},
+	}
+}
+
+func subscribeParams() *HMSSubscribeParams {
+	return &HMSSubscribeParams{
+		MaxSubsBitRate: 3200,
+		SubscribeDegradation: &HMSSubscribeDegradation{
+			PacketLossThreshold:       25,
+			DegradeGracePeriodSeconds: 1,
+			RecoverGracePeriodSeconds: 4,
+		},
+	}
+}
+
+// Built on every call, so that callers can change the roles they get
+func rolePresets() []*RolePreset {
+	return []*RolePreset{
+		{
+			Name:        "host",
+			Description: "Runs the room: publishes audio, video and screen and has every permission",
+			Role: &HMSRole{
+				PublishParams:   publishParams("audio", "video", "screen"),
+				SubscribeParams: subscribeParams(),
+				Permissions: &HMSPermissions{
+					EndRoom: true, RemoveOthers: true, Mute: true, Unmute: true, ChangeRole: true, SendRoomState: true,
+					PollRead: true, PollWrite: true, BrowserRecording: true, RtmpStreaming: true, HlsStreaming: true,
+				},
+				Priority: 1,
+			},
+			SubscribesToPublishers: true,
+		},
+		{
+			Name:        "co-host",
+			Description: "Helps the host run the room, without ending it or starting recordings and streams",
+			Role: &HMSRole{
+				PublishParams:   publishParams("audio", "video", "screen"),
+				SubscribeParams: subscribeParams(),
+				Permissions: &HMSPermissions{
+					RemoveOthers: true, Mute: true, Unmute: true, ChangeRole: true, SendRoomState: true, PollRead: true, PollWrite: true,
+				},
+				Priority: 2,
+			},
+			SubscribesToPublishers: true,
+		},
+		{
+			Name:        "speaker",
+			Description: "Publishes audio, video and screen and takes part in polls",
+			Role: &HMSRole{
+				PublishParams:   publishParams("audio", "video", "screen"),
+				SubscribeParams: subscribeParams(),
+				Permissions:     &HMSPermissions{PollRead: true},
+				Priority:        3,
+			},
+			SubscribesToPublishers: true,
+		},
+		{
+			Name:        "viewer-realtime",
+			Description: "Watches the publishers over WebRTC with low latency, without publishing",
+			Role: &HMSRole{
+				SubscribeParams: subscribeParams(),
+				Permissions:     &HMSPermissions{PollRead: true},
+			},
+			SubscribesToPublishers: true,
+		},
+		{
+			Name:        "hls-viewer",
+			Description: "Watches the HLS stream of the room, for large audiences",
+			Role: &HMSRole{
+				Permissions: &HMSPermissions{PollRead: true},
+			},
+		},
+		{
+			Name:        "recorder-bot",
+			Description: "Joins browser recordings and RTMP streams to capture the publishers",
+			Role: &HMSRole{
+				SubscribeParams: &HMSSubscribeParams{MaxSubsBitRate: 5200},
+			},
+			SubscribesToPublishers: true,
+		},
+		{
+			Name:        "moderator",
+			Description: "Keeps order without being on stage: mutes, removes and changes the role of peers",
+			Role: &HMSRole{
+				SubscribeParams: subscribeParams(),
+				Permissions: &HMSPermissions{
+					RemoveOthers: true, Mute: true, ChangeRole: true, PollRead: true, PollWrite: true,
+				},
+			},
+			SubscribesToPublishers: true,
+		},
+	}
+}
+
+func getRolePreset(name string) (*RolePreset, bool) {
+	for _, preset := range rolePresets() {
+		if preset.Name == name {
+			return preset, true
+		}
+	}
+	return nil, false
+}
+
+func rolePresetNames() []string {
+	var names []string
+	for _, preset := range rolePresets() {
+		names = append(names, preset.Name)
+	}
+	return names
+}
+
+// Make a role named roleName from a preset and its overrides. The subscribeToRoles
+// of presets watching the publishers are filled in later, once all roles are known.
+func PresetRole(roleName string, spec *RoleFromPreset) (*HMSRole, *RolePreset, error) {
+	preset, ok := getRolePreset(spec.Preset)
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: %q", hmserrors.ErrUnknownRolePreset, spec.Preset)
+	}
+
+	role := preset.Role
+	if len(spec.Overrides) > 0 {
+		document, _ := json.Marshal(preset.Role)
+		patch, err := json.Marshal(spec.Overrides)
+		if err != nil {
+			return nil, nil, err
+		}
+		merged, err := helpers.MergePatch(document, patch)
+		if err != nil {
+			return nil, nil, err
+		}
+		role = &HMSRole{}
+		if err := json.Unmarshal(merged, role); err != nil {
+			return nil, nil, fmt.Errorf("overrides of role %s: %w", roleName, err)
+		}
+	}
+	role.Name = roleName
+	if err := helpers.Validate(role); err != nil {
+		return nil, nil, err
+	}
+	return role, preset, nil
+}
+
+// Subscribe the roles of presets watching the publishers to every role that
+// publishes, unless their subscribeToRoles is set already
+func subscribeToPublishers(roles map[string]*HMSRole, subscribers []string) {
+	var publishers []string
+	for _, roleName := range sortedKeys(roles) {
+		if publish := roles[roleName].PublishParams; publish != nil && len(publish.Allowed) > 0 {
+			publishers = append(publishers, roleName)
+		}
+	}
+	for _, roleName := range subscribers {
+		role := roles[roleName]
+		if role.SubscribeParams == nil {
+			role.SubscribeParams = &HMSSubscribeParams{}
+		}
+		if len(role.SubscribeParams.SubscribeToRoles) == 0 {
+			role.SubscribeParams.SubscribeToRoles = append([]string{}, publishers...)
+		}
+	}
+}
+
+// HMSPermissions with the permissions that are not granted sent as false
+type explicitPermissions struct {
+	EndRoom          bool `json:"endRoom"`
+	RemoveOthers     bool `json:"removeOthers"`
+	Mute             bool `json:"mute"`
+	Unmute           bool `json:"unmute"`
+	ChangeRole       bool `json:"changeRole"`
+	SendRoomState    bool `json:"sendRoomState"`
+	PollRead         bool `json:"pollRead"`
+	PollWrite        bool `json:"pollWrite"`
+	BrowserRecording bool `json:"browserRecording"`
+	RtmpStreaming    bool `json:"rtmpStreaming"`
+	HlsStreaming     bool `json:"hlsStreaming"`
+}
+
+// The JSON of a preset role with every permission spelled out, so that
+// a role it replaces does not keep permissions the preset leaves off
+func presetRoleBody(role *HMSRole) map[string]interface{} {
+	data, _ := json.Marshal(role)
+	var body map[string]interface{}
+	json.Unmarshal(data, &body)
+	var permissions HMSPermissions
+	if role.Permissions != nil {
+		permissions = *role.Permissions
+	}
+	body["permissions"] = explicitPermissions(permissions)
+	return body
+}
+
+func abortWithPresetError(ctx *gin.Context, err error) {
+	if errors.Is(err, hmserrors.ErrUnknownRolePreset) {
+		ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error(), "presets": rolePresetNames()})
+		return
+	}
+	// The role the overrides make is invalid
+	helpers.AbortWithFieldErrors(ctx, helpers.ValidationErrors(err))
+}
+
+// List the role presets templates can be built from
+func ListRolePresets(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, gin.H{"data": rolePresets()})
+}
+
+// Create a template whose roles are made from presets
+func CreateTemplateFromPresets(ctx *gin.Context) {
+	var rb TemplateFromPresetsBody
+	if !helpers.BindJSON(ctx, &rb) {
+		return
+	}
+
+	template := &HMSTemplate{Name: rb.Name, Roles: map[string]*HMSRole{}, Settings: rb.Settings, Destinations: rb.Destinations}
+	var subscribers []string
+	for _, roleName := range sortedKeys(rb.Roles) {
+		role, preset, err := PresetRole(roleName, rb.Roles[roleName])
+		if err != nil {
+			abortWithPresetError(ctx, err)
+			return
+		}
+		template.Roles[roleName] = role
+		if preset.SubscribesToPublishers {
+			subscribers = append(subscribers, roleName)
+		}
+	}
+	subscribeToPublishers(template.Roles, subscribers)
+
+	if _, ok := lintTemplateRequest(ctx, template); !ok {
+		return
+	}
+	postBody, _ := json.Marshal(template)
+	helpers.MakeApiRequest(ctx, policyBaseUrl(), "POST", bytes.NewBuffer(postBody))
+}
+
+// Add a role made from a preset to a template, or replace the role with that name
+func AddTemplateRoleFromPreset(ctx *gin.Context) {
+	templateId, ok := ctx.Params.Get("templateId")
+	roleName, ok1 := ctx.Params.Get("roleName")
+	if !ok || !ok1 {
+		ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": hmserrors.ErrMissingTemplateIdAndRoleName})
+		return
+	}
+
+	var rb RoleFromPreset
+	if !helpers.BindJSON(ctx, &rb) {
+		return
+	}
+	role, preset, err := PresetRole(roleName, &rb)
+	if err != nil {
+		abortWithPresetError(ctx, err)
+		return
+	}
+
+	if preset.SubscribesToPublishers {
+		template, err := FetchTemplate(ctx.Request.Context(), templateId)
+		if err != nil {
+			helpers.AbortWithApiError(ctx, err)
+			return
+		}
+		if template.Roles == nil {
+			template.Roles = map[string]*HMSRole{}
+		}
+		template.Roles[roleName] = role
+		subscribeToPublishers(template.Roles, []string{roleName})
+	}
+
+	postBody, _ := json.Marshal(presetRoleBody(role))
+	if !lintSection(ctx, templateId, "roles/"+roleName, postBody) {
+		return
+	}
+	helpers.MakeApiRequest(ctx, policyBaseUrl()+"/"+templateId+"/roles/"+roleName, "POST", bytes.NewBuffer(postBody))
+}
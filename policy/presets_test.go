@@ -0,0 +1,33 @@
+package policy
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestPresetRoleBody(t *testing.T) {
+	role, _, err := PresetRole("lead", &RoleFromPreset{Preset: "host", Overrides: map[string]interface{}{
+		"permissions": map[string]interface{}{"endRoom": false},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := json.Marshal(presetRoleBody(role))
+	var body struct {
+		Name        string           `json:"name"`
+		Permissions map[string]*bool `json:"permissions"`
+	}
+	json.Unmarshal(data, &body)
+
+	if body.Name != "lead" {
+		t.Errorf("name %q", body.Name)
+	}
+	for _, permission := range []string{"endRoom", "removeOthers", "mute", "unmute", "changeRole", "sendRoomState", "pollRead", "pollWrite", "browserRecording", "rtmpStreaming", "hlsStreaming"} {
+		if body.Permissions[permission] == nil {
+			t.Errorf("permission %s is not sent", permission)
+		}
+	}
+	if endRoom := body.Permissions["endRoom"]; endRoom == nil || *endRoom {
+		t.Errorf("endRoom is not sent as false: %s", data)
+	}
+}
@@ -0,0 +1,347 @@
+package policy
+
+import (
+	"api/helpers"
+	"api/hmserrors"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Header listing the secrets left out of an exported template
+const HeaderStrippedSecrets = "X-Stripped-Secrets"
+
+type TemplateFileQueryParam struct {
+	Format string `form:"format" binding:"omitempty,oneof=yaml json"`
+}
+
+type ApplyTemplateQueryParam struct {
+	// Delete roles of the template that are missing from the file
+	Prune bool `form:"prune"`
+	// Updates need the plan_id of a reviewed plan, or auto_approve
+	Plan        string `form:"plan"`
+	AutoApprove bool   `form:"auto_approve"`
+}
+
+// Outcome of applying a template file
+type ApplyResult struct {
+	TemplateId string   `json:"template_id"`
+	Created    bool     `json:"created"`
+	Applied    []string `json:"applied"`
+	Deleted    []string `json:"deleted,omitempty"`
+	// Lint issues of the template, when linting is in warn mode
+	Warnings []LintIssue `json:"warnings,omitempty"`
+}
+
+// Parts of a template that a template file describes
+var templateFileKeys = []string{"name", "roles", "settings", "destinations"}
+
+// A template as the JSON values 100ms sends and receives. Templates are planned,
+// applied and exported as documents rather than as an HMSTemplate, whose
+// omitempty fields would drop every false and zero value set in them.
+type TemplateDocument map[string]interface{}
+
+// Keep the parts of a template's JSON that a template file describes
+func NewTemplateDocument(data []byte) (TemplateDocument, error) {
+	var values map[string]interface{}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, err
+	}
+	document := TemplateDocument{}
+	for _, key := range templateFileKeys {
+		if value, ok := values[key]; ok && value != nil {
+			document[key] = value
+		}
+	}
+	return document, nil
+}
+
+// The document of a template built in code. Fields left at their zero value
+// are missing from it, and so are left as they are when it is applied.
+func documentOf(template *HMSTemplate) TemplateDocument {
+	data, _ := json.Marshal(template)
+	document, _ := NewTemplateDocument(data)
+	return document
+}
+
+// Decode the document, e.g. to validate or lint it
+func (document TemplateDocument) Template() (*HMSTemplate, error) {
+	data, err := json.Marshal(document)
+	if err != nil {
+		return nil, err
+	}
+	var template HMSTemplate
+	if err := json.Unmarshal(data, &template); err != nil {
+		return nil, err
+	}
+	return &template, nil
+}
+
+// The object at a path of keys, or nil when there is none
+func (document TemplateDocument) object(keys ...string) map[string]interface{} {
+	object := map[string]interface{}(document)
+	for _, key := range keys {
+		next, ok := object[key].(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		object = next
+	}
+	return object
+}
+
+func (document TemplateDocument) name() string {
+	name, _ := document["name"].(string)
+	return name
+}
+
+// Get a template as it is described in a template file. Fields set by 100ms,
+// such as the id and timestamps, are left out.
+func FetchTemplate(ctx context.Context, templateId string) (*HMSTemplate, error) {
+	var template HMSTemplate
+	if err := helpers.CallApi(ctx, "GET", policyBaseUrl()+"/"+templateId, nil, &template); err != nil {
+		return nil, err
+	}
+	return &template, nil
+}
+
+// Get a template as a document, leaving out the fields set by 100ms
+func FetchTemplateDocument(ctx context.Context, templateId string) (TemplateDocument, error) {
+	var data json.RawMessage
+	if err := helpers.CallApi(ctx, "GET", policyBaseUrl()+"/"+templateId, nil, &data); err != nil {
+		return nil, err
+	}
+	return NewTemplateDocument(data)
+}
+
+func MarshalTemplateYAML(document TemplateDocument) ([]byte, error) {
+	data, err := json.Marshal(document)
+	if err != nil {
+		return nil, err
+	}
+	return helpers.JSONToYAML(data)
+}
+
+func sortedKeys[V any](values map[string]V) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Create a template from a document, or when templateId is set, update the name,
+// the roles, the settings and the destinations it names one by one. Each of them
+// is merged into the current one as a JSON merge patch, the way appliedDocument
+// plans it, and sent whole, so that false values in the document are sent too.
+// On failure the result lists what was applied before the error.
+func ApplyTemplate(ctx context.Context, templateId string, document TemplateDocument, prune bool) (*ApplyResult, error) {
+	result := &ApplyResult{TemplateId: templateId, Applied: []string{}}
+
+	if templateId == "" {
+		var created struct {
+			Id string `json:"id"`
+		}
+		if err := helpers.CallApi(ctx, "POST", policyBaseUrl(), document, &created); err != nil {
+			return result, err
+		}
+		result.TemplateId = created.Id
+		result.Created = true
+		result.Applied = append(result.Applied, "template")
+		return result, nil
+	}
+
+	current, err := FetchTemplateDocument(ctx, templateId)
+	if err != nil {
+		return result, err
+	}
+	applied := appliedDocument(current, document, prune)
+
+	if name := document.name(); name != "" {
+		if err := helpers.CallApi(ctx, "POST", policyBaseUrl()+"/"+templateId, map[string]string{"name": name}, nil); err != nil {
+			return result, err
+		}
+		result.Applied = append(result.Applied, "template")
+	}
+
+	roles := document.object("roles")
+	for _, roleName := range sortedKeys(roles) {
+		if err := helpers.CallApi(ctx, "POST", policyBaseUrl()+"/"+templateId+"/roles/"+roleName, applied.object("roles")[roleName], nil); err != nil {
+			return result, err
+		}
+		result.Applied = append(result.Applied, "roles/"+roleName)
+	}
+
+	for _, section := range []string{"settings", "destinations"} {
+		if _, ok := document[section]; !ok {
+			continue
+		}
+		if err := helpers.CallApi(ctx, "POST", policyBaseUrl()+"/"+templateId+"/"+section, applied[section], nil); err != nil {
+			return result, err
+		}
+		result.Applied = append(result.Applied, section)
+	}
+
+	if prune {
+		for _, roleName := range sortedKeys(current.object("roles")) {
+			if _, ok := roles[roleName]; ok {
+				continue
+			}
+			if err := helpers.CallApi(ctx, "DELETE", policyBaseUrl()+"/"+templateId+"/roles/"+roleName, nil, nil); err != nil {
+				return result, err
+			}
+			result.Deleted = append(result.Deleted, "roles/"+roleName)
+		}
+	}
+	return result, nil
+}
+
+// Bind a YAML or JSON template file. It is validated as an HMSTemplate but
+// kept as a document, so that the false values it sets are applied.
+func bindTemplateFile(ctx *gin.Context) (TemplateDocument, bool) {
+	data, err := io.ReadAll(ctx.Request.Body)
+	if err == nil && helpers.IsYAMLRequest(ctx) {
+		data, err = helpers.YAMLToJSON(data)
+	}
+	if err != nil {
+		helpers.AbortWithFieldErrors(ctx, []helpers.FieldError{{Message: err.Error()}})
+		return nil, false
+	}
+
+	ctx.Request.Body = io.NopCloser(bytes.NewReader(data))
+	var rb HMSTemplate
+	if !helpers.BindJSON(ctx, &rb) {
+		return nil, false
+	}
+	document, err := NewTemplateDocument(data)
+	if err != nil {
+		helpers.AbortWithFieldErrors(ctx, []helpers.FieldError{{Message: err.Error()}})
+		return nil, false
+	}
+	return document, true
+}
+
+// Respond with the error of a failed apply, along with what was applied before it
+func abortWithApplyError(ctx *gin.Context, err error, result *ApplyResult) {
+	var apiError *helpers.ApiError
+	if errors.As(err, &apiError) {
+		ctx.AbortWithStatusJSON(apiError.StatusCode, gin.H{
+			"error":    err.Error(),
+			"template": result,
+		})
+		return
+	}
+	helpers.AbortWithApiError(ctx, err)
+}
+
+// Export a template as a YAML file, or JSON with format=json. Upload credentials
+// and RTMP stream keys are left out, and their paths listed in X-Stripped-Secrets.
+func ExportTemplateFile(ctx *gin.Context) {
+	templateId, ok := ctx.Params.Get("templateId")
+	if !ok {
+		ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": hmserrors.ErrMissingTemplateId})
+		return
+	}
+
+	var param TemplateFileQueryParam
+	if err := ctx.ShouldBindQuery(&param); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	template, err := FetchTemplateDocument(ctx.Request.Context(), templateId)
+	if err != nil {
+		helpers.AbortWithApiError(ctx, err)
+		return
+	}
+	// Credentials are left in the workspace; applying the file keeps the ones the template has
+	if stripped := template.StripSecrets(); len(stripped) > 0 {
+		ctx.Header(HeaderStrippedSecrets, strings.Join(stripped, ", "))
+	}
+
+	if param.Format == "json" {
+		ctx.Header("Content-Disposition", "attachment; filename="+strconv.Quote(templateId+".json"))
+		ctx.JSON(http.StatusOK, template)
+		return
+	}
+
+	data, err := MarshalTemplateYAML(template)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.Header("Content-Disposition", "attachment; filename="+strconv.Quote(templateId+".yaml"))
+	ctx.Data(http.StatusOK, "application/yaml", data)
+}
+
+// Apply a YAML or JSON template file, creating a template or updating the one in the path
+func ApplyTemplateFile(ctx *gin.Context) {
+	templateId := ctx.Param("templateId")
+
+	var param ApplyTemplateQueryParam
+	if err := ctx.ShouldBindQuery(&param); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rb, ok := bindTemplateFile(ctx)
+	if !ok {
+		return
+	}
+
+	// Updates overwrite the live template, so they are only made once the plan is confirmed.
+	// They are linted as the template will be once applied.
+	applied := rb
+	var plan *Plan
+	if templateId != "" {
+		var err error
+		if plan, err = PlanTemplate(ctx.Request.Context(), templateId, rb, param.Prune); err != nil {
+			helpers.AbortWithApiError(ctx, err)
+			return
+		}
+		applied = plan.applied
+	}
+
+	template, err := applied.Template()
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	warnings, ok := lintTemplateRequest(ctx, template)
+	if !ok {
+		return
+	}
+
+	if plan != nil && !param.AutoApprove {
+		if param.Plan == "" {
+			ctx.AbortWithStatusJSON(http.StatusPreconditionRequired, gin.H{"error": hmserrors.ErrTemplatePlanRequired.Error(), "plan": plan})
+			return
+		}
+		if param.Plan != plan.PlanId {
+			ctx.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": hmserrors.ErrTemplatePlanStale.Error(), "plan": plan})
+			return
+		}
+	}
+
+	result, err := ApplyTemplate(ctx.Request.Context(), templateId, rb, param.Prune)
+	if err != nil {
+		abortWithApplyError(ctx, err, result)
+		return
+	}
+
+	result.Warnings = warnings
+	status := http.StatusOK
+	if result.Created {
+		status = http.StatusCreated
+	}
+	ctx.JSON(status, result)
+}
@@ -20,7 +20,7 @@ type PollOption struct {
 
 type PollAnswer struct {
 	Hidden  bool          `json:"hidden,omitempty"`
-	Options *[]PollOption `json:"options,omitempty"`
+	Options *[]PollOption `json:"options,omitempty" binding:"omitempty,dive"`
 	Text    string        `json:"text,omitempty"`
 	Case    bool          `json:"case,omitempty"`
 	Trim    string        `json:"trim,omitempty"`
@@ -29,26 +29,26 @@ type PollAnswer struct {
 type PollQuestion struct {
 	Index        int           `json:"index,omitempty"`
 	Text         string        `json:"text,omitempty"`
-	Format       string        `json:"format,omitempty"`
+	Format       string        `json:"format,omitempty" binding:"omitempty,oneof=single-choice multiple-choice short-answer long-answer"`
 	Attachment   []string      `json:"attachment,omitempty"`
 	Skippable    bool          `json:"skippable,omitempty"`
-	Duration     int           `json:"duration,omitempty"`
+	Duration     int           `json:"duration,omitempty" binding:"gte=0"`
 	Once         bool          `json:"once,omitempty"`
 	Weight       int           `json:"weight,omitempty"`
 	AnswerMinLen bool          `json:"answer_min_len,omitempty"`
 	AnswerMaxLen bool          `json:"answer_max_len,omitempty"`
 	Answer       *PollAnswer   `json:"answer,omitempty"`
-	Options      *[]PollOption `json:"options,omitempty"`
+	Options      *[]PollOption `json:"options,omitempty" binding:"omitempty,dive"`
 }
 
 type HMSPoll struct {
 	Title     string          `json:"title,omitempty"`
-	Duration  int             `json:"duration,omitempty"`
+	Duration  int             `json:"duration,omitempty" binding:"gte=0"`
 	Anonymous bool            `json:"anonymous,omitempty"`
 	Mode      string          `json:"mode,omitempty"`
-	Type      string          `json:"type,omitempty"`
+	Type      string          `json:"type,omitempty" binding:"omitempty,oneof=poll quiz"`
 	Start     string          `json:"start,omitempty"`
-	Questions *[]PollQuestion `json:"questions,omitempty"`
+	Questions *[]PollQuestion `json:"questions,omitempty" binding:"omitempty,dive"`
 }
 
 type PollQueryParam struct {
@@ -58,12 +58,17 @@ type PollQueryParam struct {
 	Question int32  `form:"question,omitempty"`
 }
 
-var pollBaseUrl = helpers.GetEndpointUrl("polls")
+func pollBaseUrl() string {
+	return helpers.GetEndpointUrl("polls")
+}
 
 // Create a poll
 func CreatePoll(ctx *gin.Context) {
 
 	var rb HMSPoll
+	if !helpers.BindJSON(ctx, &rb) {
+		return
+	}
 	postBody, _ := json.Marshal(HMSPoll{
 		Title:     rb.Title,
 		Duration:  rb.Duration,
@@ -74,7 +79,7 @@ func CreatePoll(ctx *gin.Context) {
 		Questions: rb.Questions,
 	})
 	payload := bytes.NewBuffer(postBody)
-	helpers.MakeApiRequest(ctx, pollBaseUrl, "POST", payload)
+	helpers.MakeApiRequest(ctx, pollBaseUrl(), "POST", payload)
 }
 
 // Get a Poll
@@ -83,7 +88,7 @@ func GetPoll(ctx *gin.Context) {
 	if !ok {
 		ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": hmserrors.ErrMissingPollId})
 	}
-	helpers.MakeApiRequest(ctx, pollBaseUrl+"/"+pollId, "GET", nil)
+	helpers.MakeApiRequest(ctx, pollBaseUrl()+"/"+pollId, "GET", nil)
 }
 
 // Update a poll
@@ -94,6 +99,9 @@ func UpdatePoll(ctx *gin.Context) {
 	}
 
 	var rb HMSPoll
+	if !helpers.BindJSON(ctx, &rb) {
+		return
+	}
 	postBody, _ := json.Marshal(HMSPoll{
 		Title:     rb.Title,
 		Duration:  rb.Duration,
@@ -105,7 +113,7 @@ func UpdatePoll(ctx *gin.Context) {
 	})
 	payload := bytes.NewBuffer(postBody)
 
-	helpers.MakeApiRequest(ctx, pollBaseUrl+"/"+pollId, "POST", payload)
+	helpers.MakeApiRequest(ctx, pollBaseUrl()+"/"+pollId, "POST", payload)
 }
 
 // Update a poll question
@@ -117,6 +125,9 @@ func UpdatePollQuestion(ctx *gin.Context) {
 	}
 
 	var rb PollQuestion
+	if !helpers.BindJSON(ctx, &rb) {
+		return
+	}
 	postBody, _ := json.Marshal(PollQuestion{
 		Index:        rb.Index,
 		Text:         rb.Text,
@@ -133,7 +144,7 @@ func UpdatePollQuestion(ctx *gin.Context) {
 	})
 
 	payload := bytes.NewBuffer(postBody)
-	helpers.MakeApiRequest(ctx, pollBaseUrl+"/"+pollId+"/questions/"+questionId, "POST", payload)
+	helpers.MakeApiRequest(ctx, pollBaseUrl()+"/"+pollId+"/questions/"+questionId, "POST", payload)
 }
 
 // Delete a poll question
@@ -143,7 +154,7 @@ func DeletePollQuestion(ctx *gin.Context) {
 	if !ok || !ok1 {
 		ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": hmserrors.ErrMissingPollIdAndQuestionId})
 	}
-	helpers.MakeApiRequest(ctx, pollBaseUrl+"/"+pollId+"/questions/"+questionId, "DELETE", nil)
+	helpers.MakeApiRequest(ctx, pollBaseUrl()+"/"+pollId+"/questions/"+questionId, "DELETE", nil)
 }
 
 // Update a poll option
@@ -156,13 +167,16 @@ func UpdatePollOption(ctx *gin.Context) {
 	}
 
 	var rb PollOption
+	if !helpers.BindJSON(ctx, &rb) {
+		return
+	}
 	postBody, _ := json.Marshal(PollOption{
 		Index:  rb.Index,
 		Text:   rb.Text,
 		Weight: rb.Weight,
 	})
 	payload := bytes.NewBuffer(postBody)
-	helpers.MakeApiRequest(ctx, pollBaseUrl+"/"+pollId+"/questions/"+questionId+"/options/"+optionId, "POST", payload)
+	helpers.MakeApiRequest(ctx, pollBaseUrl()+"/"+pollId+"/questions/"+questionId+"/options/"+optionId, "POST", payload)
 }
 
 // Delete a poll option
@@ -173,7 +187,7 @@ func DeletePollOption(ctx *gin.Context) {
 	if !ok || !ok1 || !ok2 {
 		ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": hmserrors.ErrMissingPollIdAndQuestionIdAndOptionId})
 	}
-	helpers.MakeApiRequest(ctx, pollBaseUrl+"/"+pollId+"/questions/"+questionId+"/options/"+optionId, "DELETE", nil)
+	helpers.MakeApiRequest(ctx, pollBaseUrl()+"/"+pollId+"/questions/"+questionId+"/options/"+optionId, "DELETE", nil)
 }
 
 // Get a poll session
@@ -192,7 +206,7 @@ func GetPollSessions(ctx *gin.Context) {
 
 	}
 
-	helpers.MakeApiRequest(ctx, pollBaseUrl+"/"+pollId+"/sessions/"+sessionId+"?"+qs.Encode(), "GET", nil)
+	helpers.MakeApiRequest(ctx, pollBaseUrl()+"/"+pollId+"/sessions/"+sessionId+"?"+qs.Encode(), "GET", nil)
 }
 
 // Get a poll result
@@ -203,7 +217,7 @@ func GetPollResult(ctx *gin.Context) {
 	if !ok || !ok1 || !ok2 {
 		ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": hmserrors.ErrMissingPollIdAndSessionIdAndResultID})
 	}
-	helpers.MakeApiRequest(ctx, pollBaseUrl+"/"+pollId+"/sessions/"+sessionId+"/results/"+resultId, "GET", nil)
+	helpers.MakeApiRequest(ctx, pollBaseUrl()+"/"+pollId+"/sessions/"+sessionId+"/results/"+resultId, "GET", nil)
 }
 
 // List  poll results
@@ -222,7 +236,7 @@ func ListPollResults(ctx *gin.Context) {
 
 	}
 
-	helpers.MakeApiRequest(ctx, pollBaseUrl+"/"+pollId+"/sessions/"+sessionId+"/results"+"?"+qs.Encode(), "GET", nil)
+	helpers.MakeApiRequest(ctx, pollBaseUrl()+"/"+pollId+"/sessions/"+sessionId+"/results"+"?"+qs.Encode(), "GET", nil)
 }
 
 // List  poll responses
@@ -245,7 +259,7 @@ func ListPollResponses(ctx *gin.Context) {
 
 	}
 
-	helpers.MakeApiRequest(ctx, pollBaseUrl+"/"+pollId+"/sessions/"+sessionId+"/responses"+"?"+qs.Encode(), "GET", nil)
+	helpers.MakeApiRequest(ctx, pollBaseUrl()+"/"+pollId+"/sessions/"+sessionId+"/responses"+"?"+qs.Encode(), "GET", nil)
 }
 
 // Get a poll response
@@ -256,5 +270,5 @@ func GetPollResponse(ctx *gin.Context) {
 	if !ok || !ok1 || !ok2 {
 		ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": hmserrors.ErrMissingPollIdAndSessionIdAndResultID})
 	}
-	helpers.MakeApiRequest(ctx, pollBaseUrl+"/"+pollId+"/sessions/"+sessionId+"/responses/"+responseId, "GET", nil)
+	helpers.MakeApiRequest(ctx, pollBaseUrl()+"/"+pollId+"/sessions/"+sessionId+"/responses/"+responseId, "GET", nil)
 }
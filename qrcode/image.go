@@ -0,0 +1,47 @@
+package qrcode
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"strings"
+)
+
+// Light modules around the symbol, as readers expect
+const quietZone = 4
+
+// Draw the code as a PNG of about size pixels square, each module at least one pixel
+func (c *Code) PNG(w io.Writer, size int) error {
+	modules := c.Size + 2*quietZone
+	scale := max(1, size/modules)
+	pixels := modules * scale
+
+	img := image.NewPaletted(image.Rect(0, 0, pixels, pixels), color.Palette{color.White, color.Black})
+	for y := 0; y < pixels; y++ {
+		for x := 0; x < pixels; x++ {
+			if c.Dark(x/scale-quietZone, y/scale-quietZone) {
+				img.SetColorIndex(x, y, 1)
+			}
+		}
+	}
+	return png.Encode(w, img)
+}
+
+// Draw the code as an SVG image of size pixels square, one unit per module
+func (c *Code) SVG(w io.Writer, size int) error {
+	modules := c.Size + 2*quietZone
+	var path strings.Builder
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if c.Dark(x, y) {
+				fmt.Fprintf(&path, "M%d,%dh1v1h-1z", x+quietZone, y+quietZone)
+			}
+		}
+	}
+	_, err := fmt.Fprintf(w, `<svg xmlns="http://www.w3.org/2000/svg" version="1.1" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`+
+		`<rect width="100%%" height="100%%" fill="#ffffff"/><path d="%s" fill="#000000"/></svg>`+"\n",
+		size, size, modules, modules, path.String())
+	return err
+}
@@ -0,0 +1,397 @@
+package qrcode
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Format information of level M by mask, from the table of ISO/IEC 18004
+var formatBitsM = [8]int{
+	0b101010000010010,
+	0b101000100100101,
+	0b101111001111100,
+	0b101101101001011,
+	0b100010111111001,
+	0b100000011001110,
+	0b100111110010111,
+	0b100101010100000,
+}
+
+// Version information, from the table of ISO/IEC 18004
+var versionBits = map[int]int{7: 0x07C94, 8: 0x085BC, 9: 0x09A99, 10: 0x0A4D3, 40: 0x28C69}
+
+// Alignment pattern centres and level M blocks, from the tables of ISO/IEC 18004
+var versionLayouts = map[int]struct {
+	alignment []int
+	// Data codewords of each block, and error correction codewords per block
+	blocks []int
+	ecc    int
+}{
+	1:  {nil, []int{16}, 10},
+	2:  {[]int{6, 18}, []int{28}, 16},
+	7:  {[]int{6, 22, 38}, []int{31, 31, 31, 31}, 18},
+	10: {[]int{6, 28, 50}, []int{43, 43, 43, 43, 44}, 26},
+	40: {[]int{6, 30, 58, 86, 114, 142, 170}, append(repeat(47, 18), repeat(48, 31)...), 28},
+}
+
+func repeat(n, count int) []int {
+	list := make([]int, count)
+	for i := range list {
+		list[i] = n
+	}
+	return list
+}
+
+func TestFormatBits(t *testing.T) {
+	for mask, want := range formatBitsM {
+		c := newCode(1)
+		c.drawFormatBits(mask)
+		if first, second := readFormatBits(c); first != want || second != want {
+			t.Errorf("mask %d: format bits %015b and %015b, want %015b", mask, first, second, want)
+		}
+	}
+}
+
+func TestVersionBits(t *testing.T) {
+	for version, want := range versionBits {
+		c := newCode(version)
+		c.drawVersion()
+		var first, second int
+		for i := 0; i < 18; i++ {
+			a, b := c.Size-11+i%3, i/3
+			if c.modules[b][a] {
+				first |= 1 << i
+			}
+			if c.modules[a][b] {
+				second |= 1 << i
+			}
+		}
+		if first != want || second != want {
+			t.Errorf("version %d: version bits %#x and %#x, want %#x", version, first, second, want)
+		}
+	}
+}
+
+// The 1-M symbol of "HELLO WORLD" in alphanumeric mode, a worked example of the standard
+func TestReedSolomon(t *testing.T) {
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	want := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+	if got := reedSolomonRemainder(data, reedSolomonDivisor(10)); !bytes.Equal(got, want) {
+		t.Errorf("error correction %v, want %v", got, want)
+	}
+}
+
+func TestEncodeVersions(t *testing.T) {
+	tests := []struct {
+		length, version int
+	}{
+		{0, 1},
+		{14, 1},
+		{15, 2},
+		{26, 2},
+		{122, 7},
+		{213, 10},
+		{2331, 40},
+	}
+	for _, test := range tests {
+		data := bytes.Repeat([]byte("https://ex.am/ple?"), test.length/18+1)[:test.length]
+		c, err := Encode(data)
+		if err != nil {
+			t.Fatalf("length %d: %v", test.length, err)
+		}
+		if c.Version != test.version || c.Size != test.version*4+17 {
+			t.Errorf("length %d: version %d of size %d, want version %d", test.length, c.Version, c.Size, test.version)
+		}
+	}
+	if _, err := Encode(make([]byte, 2332)); err != ErrTooLong {
+		t.Errorf("error %v for 2332 bytes, want %v", err, ErrTooLong)
+	}
+}
+
+// Symbols decode back to their data, read as a reader would with the
+// layouts of the standard rather than those of the encoder
+func TestEncodeDecodes(t *testing.T) {
+	link := strings.Repeat("https://example.com/join?code=xyz-abcd-efg&role=guest&", 50)
+	for _, data := range []string{
+		"",
+		"hello",
+		"https://acme.app/m/abc-def",
+		link[:110],
+		strings.Repeat("\x00\xff QR ", 34),
+		link[:2300],
+	} {
+		c, err := Encode([]byte(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := decode(t, c); got != data {
+			t.Errorf("version %d decodes to %q, want %q", c.Version, got, data)
+		}
+	}
+}
+
+// Pinned once it decoded as above, so that symbols do not change unnoticed,
+// e.g. by another choice of mask
+func TestEncodeGolden(t *testing.T) {
+	want := []string{
+		"#######..##...#######",
+		"#.....#.##....#.....#",
+		"#.###.#..#.##.#.###.#",
+		"#.###.#...##..#.###.#",
+		"#.###.#.##..#.#.###.#",
+		"#.....#.....#.#.....#",
+		"#######.#.#.#.#######",
+		"..........###........",
+		"#.#.#.#..#.#....#..#.",
+		"..#.##....#...#....##",
+		".#.#..#.###.#...#####",
+		"##..#.........#....#.",
+		".##.#.##..#.#.#.#....",
+		"........####.#.#..###",
+		"#######...##.###..###",
+		"#.....#...####.##....",
+		"#.###.#.#.##.###...##",
+		"#.###.#..#....##..##.",
+		"#.###.#.###.#...#.#.#",
+		"#.....#..#....#.#..#.",
+		"#######.###.#.##...##",
+	}
+	c, err := Encode([]byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := render(c); !reflect.DeepEqual(got, want) {
+		t.Errorf("symbol of \"hello\"\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func render(c *Code) []string {
+	rows := make([]string, c.Size)
+	for y := range rows {
+		var row strings.Builder
+		for x := 0; x < c.Size; x++ {
+			if c.Dark(x, y) {
+				row.WriteByte('#')
+			} else {
+				row.WriteByte('.')
+			}
+		}
+		rows[y] = row.String()
+	}
+	return rows
+}
+
+// Both copies of the format information
+func readFormatBits(c *Code) (int, int) {
+	var first, second int
+	set := func(bits *int, i, x, y int) {
+		if c.modules[y][x] {
+			*bits |= 1 << i
+		}
+	}
+	for i := 0; i <= 5; i++ {
+		set(&first, i, 8, i)
+	}
+	set(&first, 6, 8, 7)
+	set(&first, 7, 8, 8)
+	set(&first, 8, 7, 8)
+	for i := 9; i < 15; i++ {
+		set(&first, i, 14-i, 8)
+	}
+	for i := 0; i < 8; i++ {
+		set(&second, i, c.Size-1-i, 8)
+	}
+	for i := 8; i < 15; i++ {
+		set(&second, i, 8, c.Size-15+i)
+	}
+	return first, second
+}
+
+// Whether a module belongs to the finder, timing, alignment, format or version patterns
+func isFunctionModule(version, size, x, y int) bool {
+	inFinder := func(fx, fy int) bool { return x >= fx && x < fx+9 && y >= fy && y < fy+9 }
+	if inFinder(0, 0) || inFinder(size-8, 0) || inFinder(0, size-8) || x == 6 || y == 6 {
+		return true
+	}
+	alignment := versionLayouts[version].alignment
+	for i, ax := range alignment {
+		for j, ay := range alignment {
+			corner := i == 0 && j == 0 || i == 0 && j == len(alignment)-1 || i == len(alignment)-1 && j == 0
+			if !corner && x >= ax-2 && x <= ax+2 && y >= ay-2 && y <= ay+2 {
+				return true
+			}
+		}
+	}
+	return version >= 7 && (x < 6 && y >= size-11 && y < size-8 || y < 6 && x >= size-11 && x < size-8)
+}
+
+func masked(mask, x, y int) bool {
+	i, j := y, x
+	switch mask {
+	case 0:
+		return (i+j)%2 == 0
+	case 1:
+		return i%2 == 0
+	case 2:
+		return j%3 == 0
+	case 3:
+		return (i+j)%3 == 0
+	case 4:
+		return (i/2+j/3)%2 == 0
+	case 5:
+		return i*j%2+i*j%3 == 0
+	case 6:
+		return (i*j%2+i*j%3)%2 == 0
+	default:
+		return ((i+j)%2+i*j%3)%2 == 0
+	}
+}
+
+// Multiplication in GF(2^8) by log tables, apart from the encoder's
+var gfExp, gfLog = func() ([512]int, [256]int) {
+	var exp [512]int
+	var log [256]int
+	x := 1
+	for i := 0; i < 255; i++ {
+		exp[i], exp[i+255] = x, x
+		log[x] = i
+		if x <<= 1; x >= 256 {
+			x ^= 0x11D
+		}
+	}
+	return exp, log
+}()
+
+func gfMul(a, b int) int {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[gfLog[a]+gfLog[b]]
+}
+
+// Read the data of a symbol, checking its format information and error correction
+func decode(t *testing.T, c *Code) string {
+	t.Helper()
+	layout, ok := versionLayouts[c.Version]
+	if !ok {
+		t.Fatalf("no layout for version %d", c.Version)
+	}
+	first, second := readFormatBits(c)
+	mask := -1
+	for m, bits := range formatBitsM {
+		if first == bits {
+			mask = m
+		}
+	}
+	if mask < 0 || second != first {
+		t.Fatalf("version %d: format bits %015b and %015b are not those of level M", c.Version, first, second)
+	}
+	if !c.Dark(8, c.Size-8) {
+		t.Errorf("version %d: the dark module is light", c.Version)
+	}
+
+	// Two module wide columns from the right, upwards and downwards in turn
+	var bits []bool
+	upwards := true
+	for right := c.Size - 1; right > 0; right -= 2 {
+		if right == 6 {
+			right--
+		}
+		for n := 0; n < c.Size; n++ {
+			y := n
+			if upwards {
+				y = c.Size - 1 - n
+			}
+			for x := right; x > right-2; x-- {
+				if !isFunctionModule(c.Version, c.Size, x, y) {
+					bits = append(bits, c.Dark(x, y) != masked(mask, x, y))
+				}
+			}
+		}
+		upwards = !upwards
+	}
+	codewords := make([]int, len(bits)/8)
+	for i := range codewords {
+		for _, bit := range bits[i*8 : i*8+8] {
+			codewords[i] <<= 1
+			if bit {
+				codewords[i] |= 1
+			}
+		}
+	}
+
+	// Data codewords are interleaved across the blocks, then the error correction ones
+	blocks := make([][]int, len(layout.blocks))
+	k := 0
+	for i := 0; i < layout.blocks[len(layout.blocks)-1]; i++ {
+		for b, length := range layout.blocks {
+			if i < length {
+				blocks[b] = append(blocks[b], codewords[k])
+				k++
+			}
+		}
+	}
+	var data []int
+	for b := range blocks {
+		data = append(data, blocks[b]...)
+	}
+	for i := 0; i < layout.ecc; i++ {
+		for b := range blocks {
+			blocks[b] = append(blocks[b], codewords[k])
+			k++
+		}
+	}
+	for b, block := range blocks {
+		// Every codeword of a block is a multiple of the generator, so it is zero at its roots
+		for root := 0; root < layout.ecc; root++ {
+			syndrome := 0
+			for _, codeword := range block {
+				syndrome = gfMul(syndrome, gfExp[root]) ^ codeword
+			}
+			if syndrome != 0 {
+				t.Fatalf("version %d: block %d is not a Reed-Solomon codeword", c.Version, b)
+			}
+		}
+	}
+
+	var stream []bool
+	for _, codeword := range data {
+		for i := 7; i >= 0; i-- {
+			stream = append(stream, codeword>>i&1 != 0)
+		}
+	}
+	read := func(n int) int {
+		value := 0
+		for _, bit := range stream[:n] {
+			value <<= 1
+			if bit {
+				value |= 1
+			}
+		}
+		stream = stream[n:]
+		return value
+	}
+	if mode := read(4); mode != 0x4 {
+		t.Fatalf("version %d: mode %04b, want byte mode", c.Version, mode)
+	}
+	countBits := 8
+	if c.Version >= 10 {
+		countBits = 16
+	}
+	var text []byte
+	for n := read(countBits); n > 0; n-- {
+		text = append(text, byte(read(8)))
+	}
+	if terminator := read(min(4, len(stream))); terminator != 0 {
+		t.Errorf("version %d: terminator %b", c.Version, terminator)
+	}
+	read(len(stream) % 8)
+	for pad := 0xEC; len(stream) > 0; pad ^= 0xEC ^ 0x11 {
+		if got := read(8); got != pad {
+			t.Fatalf("version %d: pad byte %#x, want %#x", c.Version, got, pad)
+		}
+	}
+	return string(text)
+}
@@ -0,0 +1,186 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"api/hmserrors"
+
+	"github.com/gin-gonic/gin"
+)
+
+// A token bucket refilled at Rate tokens per second, holding at most Burst tokens
+type Bucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func NewBucket(rate float64, burst int) *Bucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &Bucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+func (b *Bucket) refill(now time.Time) {
+	elapsed := now.Sub(b.last).Seconds()
+	b.last = now
+	b.tokens = math.Min(b.burst, b.tokens+elapsed*b.rate)
+}
+
+// Take a token if one is available right now
+func (b *Bucket) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill(time.Now())
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// Time until the next token is available
+func (b *Bucket) RetryAfter() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill(time.Now())
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+// Reserve the next token and tell how long until it is available, giving up
+// straight away when that is after the context deadline
+func (b *Bucket) Reserve(ctx context.Context) (time.Duration, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	b.refill(now)
+	b.tokens--
+
+	var delay time.Duration
+	if b.tokens < 0 {
+		delay = time.Duration(-b.tokens / b.rate * float64(time.Second))
+	}
+	if deadline, ok := ctx.Deadline(); ok && now.Add(delay).After(deadline) {
+		b.tokens++
+		return 0, hmserrors.ErrRateLimitWaitExceeded
+	}
+	return delay, nil
+}
+
+// Hand back a reserved token that was not used
+func (b *Bucket) Release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = math.Min(b.burst, b.tokens+1)
+}
+
+// Queue for a token, giving up straight away when it would not be
+// available before the context deadline
+func (b *Bucket) Wait(ctx context.Context) error {
+	delay, err := b.Reserve(ctx)
+	if err != nil || delay == 0 {
+		return err
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		b.Release()
+		return ctx.Err()
+	}
+}
+
+// A set of buckets sharing the same rate, keyed by caller
+type Limiter struct {
+	mu      sync.Mutex
+	rate    float64
+	burst   int
+	buckets map[string]*Bucket
+	swept   time.Time
+}
+
+func NewLimiter(rate float64, burst int) *Limiter {
+	return &Limiter{
+		rate:    rate,
+		burst:   burst,
+		buckets: map[string]*Bucket{},
+		swept:   time.Now(),
+	}
+}
+
+func (l *Limiter) bucket(key string) *Bucket {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Forget callers whose buckets have been full for a while
+	if now := time.Now(); now.Sub(l.swept) > time.Minute {
+		for k, b := range l.buckets {
+			b.mu.Lock()
+			b.refill(now)
+			full := b.tokens >= b.burst
+			b.mu.Unlock()
+			if full {
+				delete(l.buckets, k)
+			}
+		}
+		l.swept = now
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = NewBucket(l.rate, l.burst)
+		l.buckets[key] = b
+	}
+	return b
+}
+
+// Rate limit a route per caller IP. A rate of zero disables the limit.
+func PerCaller(rate float64, burst int) gin.HandlerFunc {
+	if rate <= 0 {
+		return func(ctx *gin.Context) {
+			ctx.Next()
+		}
+	}
+
+	limiter := NewLimiter(rate, burst)
+	return func(ctx *gin.Context) {
+		b := limiter.bucket(ctx.ClientIP())
+		if !b.Allow() {
+			retryAfter := int(math.Ceil(b.RetryAfter().Seconds()))
+			ctx.Header("Retry-After", strconv.Itoa(retryAfter))
+			ctx.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": hmserrors.ErrRateLimited.Error()})
+			return
+		}
+		ctx.Next()
+	}
+}
+
+// Take a token from the bucket of a key, or tell how long until one is available
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	b := l.bucket(key)
+	if b.Allow() {
+		return true, 0
+	}
+	return false, b.RetryAfter()
+}
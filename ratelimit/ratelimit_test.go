@@ -0,0 +1,135 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"api/hmserrors"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestBucketAllow(t *testing.T) {
+	tests := []struct {
+		name    string
+		rate    float64
+		burst   int
+		takes   int
+		allowed int
+	}{
+		{"burst is available at once", 1, 3, 5, 3},
+		{"burst below one holds a single token", 1, 0, 3, 1},
+		{"slow rate does not refill in time", 0.001, 2, 4, 2},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b := NewBucket(test.rate, test.burst)
+			allowed := 0
+			for i := 0; i < test.takes; i++ {
+				if b.Allow() {
+					allowed++
+				}
+			}
+			if allowed != test.allowed {
+				t.Errorf("allowed %d of %d, want %d", allowed, test.takes, test.allowed)
+			}
+		})
+	}
+}
+
+func TestBucketRefill(t *testing.T) {
+	b := NewBucket(10, 1)
+	b.Allow()
+	if b.Allow() {
+		t.Fatal("second token allowed before the refill")
+	}
+	if retryAfter := b.RetryAfter(); retryAfter <= 0 || retryAfter > 100*time.Millisecond {
+		t.Errorf("retry after %s, want up to 100ms", retryAfter)
+	}
+	b.last = b.last.Add(-100 * time.Millisecond)
+	if !b.Allow() {
+		t.Error("token not refilled after 100ms at 10/s")
+	}
+}
+
+func TestBucketReserve(t *testing.T) {
+	b := NewBucket(1, 1)
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	if delay, err := b.Reserve(ctx); err != nil || delay != 0 {
+		t.Fatalf("first reservation: %s, %v", delay, err)
+	}
+	// The next token comes after a second, past the deadline
+	if _, err := b.Reserve(ctx); !errors.Is(err, hmserrors.ErrRateLimitWaitExceeded) {
+		t.Fatalf("reservation past the deadline: %v", err)
+	}
+	// A refused reservation takes nothing, a released one is given back
+	b.Release()
+	if !b.Allow() {
+		t.Error("released token not available")
+	}
+	b.Release()
+	b.Release()
+	if b.tokens > b.burst {
+		t.Errorf("released past the burst: %v tokens", b.tokens)
+	}
+}
+
+func TestBucketWaitCancelled(t *testing.T) {
+	b := NewBucket(1, 1)
+	b.Allow()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := b.Wait(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("wait: %v", err)
+	}
+	if b.tokens < -0.01 {
+		t.Errorf("cancelled wait kept its token: %v tokens", b.tokens)
+	}
+}
+
+func TestLimiterKeys(t *testing.T) {
+	l := NewLimiter(0.001, 1)
+	if ok, _ := l.Allow("a"); !ok {
+		t.Fatal("first request of a refused")
+	}
+	ok, retryAfter := l.Allow("a")
+	if ok || retryAfter <= 0 {
+		t.Errorf("second request of a: %v, retry after %s", ok, retryAfter)
+	}
+	if ok, _ := l.Allow("b"); !ok {
+		t.Error("b limited by the bucket of a")
+	}
+}
+
+func TestPerCaller(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/", PerCaller(0.001, 2), func(ctx *gin.Context) {
+		ctx.Status(http.StatusOK)
+	})
+
+	request := func(ip string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = ip + ":1234"
+		router.ServeHTTP(w, req)
+		return w
+	}
+	for i, want := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		if w := request("10.0.0.1"); w.Code != want {
+			t.Errorf("request %d: %d, want %d", i, w.Code, want)
+		}
+	}
+	if w := request("10.0.0.1"); w.Header().Get("Retry-After") == "" {
+		t.Error("no Retry-After on a limited request")
+	}
+	if w := request("10.0.0.2"); w.Code != http.StatusOK {
+		t.Errorf("other caller: %d", w.Code)
+	}
+}
@@ -11,7 +11,9 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-var recordingBaseUrl = helpers.GetEndpointUrl("recordings")
+func recordingBaseUrl() string {
+	return helpers.GetEndpointUrl("recordings")
+}
 
 type RecordingResolution struct {
 	Height uint32 `json:"height,omitempty"`
@@ -65,7 +67,7 @@ func StartRecording(ctx *gin.Context) {
 		Transcription: rb.Transcription,
 	})
 	payload := bytes.NewBuffer(postBody)
-	helpers.MakeApiRequest(ctx, recordingBaseUrl+"/room/"+roomId+"/start", "POST", payload)
+	helpers.MakeApiRequest(ctx, recordingBaseUrl()+"/room/"+roomId+"/start", "POST", payload)
 }
 
 // Stop all recordings in the given room
@@ -74,7 +76,7 @@ func StopRecordings(ctx *gin.Context) {
 	if !ok {
 		ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": hmserrors.ErrMissingRoomId})
 	}
-	helpers.MakeApiRequest(ctx, recordingBaseUrl+"/room/"+roomId+"/stop", "POST", nil)
+	helpers.MakeApiRequest(ctx, recordingBaseUrl()+"/room/"+roomId+"/stop", "POST", nil)
 }
 
 // Stop a recording given the recording ID
@@ -83,7 +85,7 @@ func StopRecording(ctx *gin.Context) {
 	if !ok {
 		ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": hmserrors.ErrMissingRecordingId})
 	}
-	helpers.MakeApiRequest(ctx, recordingBaseUrl+"/"+recordingId+"/stop", "POST", nil)
+	helpers.MakeApiRequest(ctx, recordingBaseUrl()+"/"+recordingId+"/stop", "POST", nil)
 }
 
 // Get a recording by its ID
@@ -92,12 +94,12 @@ func GetRecording(ctx *gin.Context) {
 	if !ok {
 		ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": hmserrors.ErrMissingRecordingId})
 	}
-	helpers.MakeApiRequest(ctx, recordingBaseUrl+"/"+recordingId, "GET", nil)
+	helpers.MakeApiRequest(ctx, recordingBaseUrl()+"/"+recordingId, "GET", nil)
 }
 
 // List all recordings in the room.
 func ListRecordings(ctx *gin.Context) {
-	helpers.MakeApiRequest(ctx, recordingBaseUrl, "GET", nil)
+	helpers.MakeApiRequest(ctx, recordingBaseUrl(), "GET", nil)
 }
 
 // Get the configuration of a recording
@@ -106,5 +108,5 @@ func GetRecordingConfig(ctx *gin.Context) {
 	if !ok {
 		ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": hmserrors.ErrMissingRecordingId})
 	}
-	helpers.MakeApiRequest(ctx, recordingBaseUrl+"/"+recordingId+"/config", "GET", nil)
+	helpers.MakeApiRequest(ctx, recordingBaseUrl()+"/"+recordingId+"/config", "GET", nil)
 }
@@ -10,7 +10,9 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-var recordingAssetsBaseUrl = helpers.GetEndpointUrl("recording-assets")
+func recordingAssetsBaseUrl() string {
+	return helpers.GetEndpointUrl("recording-assets")
+}
 
 type HMSRecordingAssetsQueryParam struct {
 	RoomId    string `form:"room_id,omitempty"`
@@ -20,13 +22,17 @@ type HMSRecordingAssetsQueryParam struct {
 	Limit     int32  `form:"limit,omitempty"`
 }
 
+type HMSPresignedUrlQueryParam struct {
+	PresignDuration int32 `form:"presign_duration,omitempty"`
+}
+
 // Get asset id
 func GetRecordingAsset(ctx *gin.Context) {
 	assetId, ok := ctx.Params.Get("assetId")
 	if !ok {
 		ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": hmserrors.ErrMissingAssetId})
 	}
-	helpers.MakeApiRequest(ctx, recordingAssetsBaseUrl+"/"+assetId, "GET", nil)
+	helpers.MakeApiRequest(ctx, recordingAssetsBaseUrl()+"/"+assetId, "GET", nil)
 }
 
 // List all recording assets
@@ -44,7 +50,7 @@ func ListRecordingAssets(ctx *gin.Context) {
 		qs.Add("limit", strconv.Itoa(int(param.Limit)))
 	}
 
-	helpers.MakeApiRequest(ctx, recordingAssetsBaseUrl+"?"+qs.Encode(), "GET", nil)
+	helpers.MakeApiRequest(ctx, recordingAssetsBaseUrl()+"?"+qs.Encode(), "GET", nil)
 
 }
 
@@ -55,9 +61,31 @@ func GetPresignedUrl(ctx *gin.Context) {
 		ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": hmserrors.ErrMissingAssetId})
 	}
 
-	presignDuration := ctx.Query("presign_duration")
+	var param HMSPresignedUrlQueryParam
 	qs := url.Values{}
-	qs.Add("presign_duration", presignDuration)
+	if ctx.BindQuery(&param) == nil && param.PresignDuration > 0 {
+		qs.Add("presign_duration", strconv.Itoa(int(param.PresignDuration)))
+	}
+
+	helpers.MakeApiRequest(ctx, recordingAssetsBaseUrl()+"/"+assetId+"/presigned-url?"+qs.Encode(), "GET", nil)
+}
+
+// Export all recording assets as NDJSON or CSV
+// Applicable filters: room_id string, session_id string, status string, after string, before string, format string, columns string
+func ExportRecordingAssets(ctx *gin.Context) {
+	var param HMSRecordingAssetsQueryParam
+
+	qs := url.Values{}
+	if ctx.BindQuery(&param) == nil {
+		qs.Add("room_id", param.RoomId)
+		qs.Add("session_id", param.SessionId)
+		qs.Add("status", param.Status)
+	}
 
-	helpers.MakeApiRequest(ctx, recordingAssetsBaseUrl+"/"+assetId+"/presigned-url?"+qs.Encode(), "GET", nil)
+	helpers.ExportApiPages(ctx, recordingAssetsBaseUrl(), qs, helpers.ExportOptions{
+		ItemsKey:  "data",
+		CursorKey: "last",
+		TimeField: "created_at",
+		Columns:   []string{"id", "room_id", "session_id", "job_id", "type", "path", "status", "size", "duration", "created_at"},
+	})
 }
@@ -0,0 +1,404 @@
+package room
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"api/helpers"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	BulkRoomCreated  = "created"
+	BulkRoomExisting = "existing"
+	BulkRoomFailed   = "failed"
+
+	defaultBulkConcurrency = 5
+	maxBulkConcurrency     = 20
+)
+
+// A room to provision, identified by its name so that a batch can be run again
+type BulkRoom struct {
+	HMSRoom
+	// Roles to create room codes for, every role of the template when empty
+	Roles []string `json:"roles,omitempty"`
+}
+
+type BulkRoomsBody struct {
+	Rooms []BulkRoom `json:"rooms" binding:"required"`
+}
+
+type BulkRoomsQueryParam struct {
+	// Rooms created at the same time
+	Concurrency int    `form:"concurrency" binding:"omitempty,gte=1,lte=20"`
+	Format      string `form:"format" binding:"omitempty,oneof=json csv"`
+}
+
+type RoomCode struct {
+	Code    string `json:"code"`
+	Role    string `json:"role"`
+	Enabled bool   `json:"enabled"`
+}
+
+type BulkRoomResult struct {
+	Name      string     `json:"name"`
+	RoomId    string     `json:"room_id,omitempty"`
+	Status    string     `json:"status"`
+	RoomCodes []RoomCode `json:"room_codes,omitempty"`
+	Error     string     `json:"error,omitempty"`
+}
+
+// Outcome of a batch, with the rooms in the order they were given
+type BulkManifest struct {
+	Created  int              `json:"created"`
+	Existing int              `json:"existing"`
+	Failed   int              `json:"failed"`
+	Rooms    []BulkRoomResult `json:"rooms"`
+}
+
+// Columns of a CSV batch. Only name is required; roles and key:value tags are separated by ";".
+var bulkCSVColumns = []string{
+	"name", "description", "template_id", "region", "large_room", "size", "max_duration_seconds",
+	"recording_enabled", "upload_type", "upload_location", "upload_prefix", "upload_region", "upload_key", "upload_secret", "credentials_ref", "roles", "tags",
+}
+
+// Read rooms from a CSV file with a header row naming the columns it has
+func ParseBulkRoomsCSV(r io.Reader) ([]BulkRoom, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	// Rows may leave out empty columns at the end
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading the header row: %w", err)
+	}
+
+	columns := map[string]int{}
+	for i, column := range header {
+		columns[strings.ToLower(strings.TrimSpace(column))] = i
+	}
+	if _, ok := columns["name"]; !ok {
+		return nil, errors.New("the header row has no name column")
+	}
+	known := map[string]bool{}
+	for _, column := range bulkCSVColumns {
+		known[column] = true
+	}
+	for column := range columns {
+		if !known[column] {
+			return nil, fmt.Errorf("unknown column %q, use %s", column, strings.Join(bulkCSVColumns, ", "))
+		}
+	}
+
+	var rooms []BulkRoom
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return rooms, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		value := func(column string) string {
+			if i, ok := columns[column]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		flag := func(column string) (bool, error) {
+			if value(column) == "" {
+				return false, nil
+			}
+			enabled, err := strconv.ParseBool(value(column))
+			if err != nil {
+				return false, fmt.Errorf("line %d: %s must be true or false", line, column)
+			}
+			return enabled, nil
+		}
+
+		room := BulkRoom{HMSRoom: HMSRoom{
+			Name:               value("name"),
+			Description:        value("description"),
+			TemplateId:         value("template_id"),
+			Region:             value("region"),
+			MaxDurationSeconds: value("max_duration_seconds"),
+		}}
+		if room.LargeRoom, err = flag("large_room"); err != nil {
+			return nil, err
+		}
+		if size := value("size"); size != "" {
+			if room.Size, err = strconv.Atoi(size); err != nil {
+				return nil, fmt.Errorf("line %d: size must be a number", line)
+			}
+		}
+		recording, err := flag("recording_enabled")
+		if err != nil {
+			return nil, err
+		}
+		if recording || value("upload_location") != "" {
+			room.RecordingInfo = &RecordingInfo{Enabled: recording}
+			if value("upload_location") != "" {
+				room.RecordingInfo.UploadInfo = &UploadInfo{
+					Type:     value("upload_type"),
+					Location: value("upload_location"),
+					Prefix:   value("upload_prefix"),
+				}
+				if region := value("upload_region"); region != "" {
+					room.RecordingInfo.UploadInfo.Options = &UploadOptions{Region: region}
+				}
+				if value("upload_key") != "" || value("upload_secret") != "" {
+					room.RecordingInfo.UploadInfo.Credentials = &UploadCredentials{Key: value("upload_key"), Secret: value("upload_secret")}
+				}
+				room.RecordingInfo.UploadInfo.CredentialsRef = value("credentials_ref")
+			}
+		}
+		for _, role := range strings.Split(value("roles"), ";") {
+			if role = strings.TrimSpace(role); role != "" {
+				room.Roles = append(room.Roles, role)
+			}
+		}
+		for _, tag := range strings.Split(value("tags"), ";") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				key, tagValue, _ := strings.Cut(tag, ":")
+				if room.Tags == nil {
+					room.Tags = map[string]string{}
+				}
+				room.Tags[key] = tagValue
+			}
+		}
+		rooms = append(rooms, room)
+	}
+}
+
+// Check every room of a batch, beyond the validation rules of HMSRoom
+func CheckBulkRooms(rooms []BulkRoom) []helpers.FieldError {
+	var fieldErrors []helpers.FieldError
+	names := map[string]int{}
+	for i, room := range rooms {
+		field := fmt.Sprintf("rooms[%d]", i)
+		if room.Name == "" {
+			fieldErrors = append(fieldErrors, helpers.FieldError{Field: field + ".name", Message: "is required"})
+		} else if first, ok := names[room.Name]; ok {
+			fieldErrors = append(fieldErrors, helpers.FieldError{Field: field + ".name", Message: fmt.Sprintf("is also the name of rooms[%d]", first)})
+		} else {
+			names[room.Name] = i
+		}
+		if err := helpers.Validate(&room.HMSRoom); err != nil {
+			for _, fieldError := range helpers.ValidationErrors(err) {
+				fieldError.Field = field + "." + fieldError.Field
+				fieldErrors = append(fieldErrors, fieldError)
+			}
+		}
+	}
+	return fieldErrors
+}
+
+// Id of the room with exactly the given name, or "" when there is none
+func findRoomByName(ctx context.Context, name string) (string, error) {
+	var page struct {
+		Data []struct {
+			Id   string `json:"id"`
+			Name string `json:"name"`
+		} `json:"data"`
+	}
+	if err := helpers.CallApi(ctx, "GET", roomBaseUrl()+"?"+url.Values{"name": {name}}.Encode(), nil, &page); err != nil {
+		return "", err
+	}
+	for _, room := range page.Data {
+		if room.Name == name {
+			return room.Id, nil
+		}
+	}
+	return "", nil
+}
+
+// Make sure the room has a code for every given role, or any code when no
+// roles are given, reusing the codes it already has
+func EnsureRoomCodes(ctx context.Context, roomId string, roles []string) ([]RoomCode, error) {
+	roomCodesUrl := helpers.GetEndpointUrl("room-codes/room/" + roomId)
+	var existing struct {
+		Data []RoomCode `json:"data"`
+	}
+	if err := helpers.CallApi(ctx, "GET", roomCodesUrl, nil, &existing); err != nil {
+		var apiError *helpers.ApiError
+		if !errors.As(err, &apiError) || apiError.StatusCode != http.StatusNotFound {
+			return nil, err
+		}
+	}
+
+	if len(roles) == 0 {
+		if len(existing.Data) > 0 {
+			return existing.Data, nil
+		}
+		var created struct {
+			Data []RoomCode `json:"data"`
+		}
+		err := helpers.CallApi(ctx, "POST", roomCodesUrl, nil, &created)
+		return created.Data, err
+	}
+
+	byRole := map[string]RoomCode{}
+	for _, code := range existing.Data {
+		if code.Enabled {
+			byRole[code.Role] = code
+		}
+	}
+	codes := []RoomCode{}
+	for _, role := range roles {
+		code, ok := byRole[role]
+		if !ok {
+			if err := helpers.CallApi(ctx, "POST", roomCodesUrl+"/role/"+url.PathEscape(role), nil, &code); err != nil {
+				return codes, fmt.Errorf("room code of role %s: %w", role, err)
+			}
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+func provisionRoom(ctx context.Context, room BulkRoom) BulkRoomResult {
+	result := BulkRoomResult{Name: room.Name, Status: BulkRoomExisting}
+	fail := func(err error) BulkRoomResult {
+		result.Status = BulkRoomFailed
+		result.Error = err.Error()
+		return result
+	}
+
+	roomId, err := findRoomByName(ctx, room.Name)
+	if err != nil {
+		return fail(err)
+	}
+	if roomId == "" {
+		var created struct {
+			Id string `json:"id"`
+		}
+		if err := helpers.CallApi(ctx, "POST", roomBaseUrl(), room.HMSRoom.upstream(), &created); err != nil {
+			return fail(err)
+		}
+		roomId = created.Id
+		result.Status = BulkRoomCreated
+	}
+	result.RoomId = roomId
+
+	codes, err := EnsureRoomCodes(ctx, roomId, room.Roles)
+	result.RoomCodes = codes
+	if err != nil {
+		return fail(err)
+	}
+	return result
+}
+
+// Create the rooms of a batch that do not exist yet, by name, along with their
+// room codes, working on up to concurrency rooms at a time. Rooms that exist
+// are left as they are, so a batch that partly failed can be run again.
+// Tags are not sent to 100ms and are left for the caller to keep.
+func ProvisionRooms(ctx context.Context, rooms []BulkRoom, concurrency int) *BulkManifest {
+	if concurrency < 1 {
+		concurrency = defaultBulkConcurrency
+	}
+	if concurrency > maxBulkConcurrency {
+		concurrency = maxBulkConcurrency
+	}
+
+	results := make([]BulkRoomResult, len(rooms))
+	slots := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, room := range rooms {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(i int, room BulkRoom) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			results[i] = provisionRoom(ctx, room)
+		}(i, room)
+	}
+	wg.Wait()
+
+	manifest := &BulkManifest{Rooms: results}
+	for _, result := range results {
+		switch result.Status {
+		case BulkRoomCreated:
+			manifest.Created++
+		case BulkRoomExisting:
+			manifest.Existing++
+		default:
+			manifest.Failed++
+		}
+	}
+	return manifest
+}
+
+// Write the manifest as CSV, one row per room with its codes as role:code pairs
+func (manifest *BulkManifest) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"name", "room_id", "status", "room_codes", "error"})
+	for _, result := range manifest.Rooms {
+		codes := make([]string, 0, len(result.RoomCodes))
+		for _, code := range result.RoomCodes {
+			codes = append(codes, code.Role+":"+code.Code)
+		}
+		writer.Write([]string{result.Name, result.RoomId, result.Status, strings.Join(codes, ";"), result.Error})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// Create rooms with their room codes from a JSON list or a CSV file, skipping
+// rooms that already exist by name
+func CreateRooms(ctx *gin.Context) {
+	var param BulkRoomsQueryParam
+	if err := ctx.ShouldBindQuery(&param); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var rooms []BulkRoom
+	if ctx.ContentType() == "text/csv" {
+		var err error
+		if rooms, err = ParseBulkRoomsCSV(ctx.Request.Body); err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	} else {
+		var rb BulkRoomsBody
+		if !helpers.BindJSON(ctx, &rb) {
+			return
+		}
+		rooms = rb.Rooms
+	}
+	if len(rooms) == 0 {
+		helpers.AbortWithFieldErrors(ctx, []helpers.FieldError{{Field: "rooms", Message: "must contain at least 1 item(s)"}})
+		return
+	}
+	if fieldErrors := CheckBulkRooms(rooms); len(fieldErrors) > 0 {
+		helpers.AbortWithFieldErrors(ctx, fieldErrors)
+		return
+	}
+
+	manifest := ProvisionRooms(ctx.Request.Context(), rooms, param.Concurrency)
+	for i, result := range manifest.Rooms {
+		if result.RoomId != "" && rooms[i].Tags != nil {
+			roomTags().set(result.RoomId, rooms[i].Tags)
+		}
+	}
+	status := http.StatusOK
+	if manifest.Failed > 0 {
+		status = http.StatusMultiStatus
+	}
+	if param.Format == "csv" {
+		ctx.Status(status)
+		ctx.Header("Content-Type", "text/csv")
+		manifest.WriteCSV(ctx.Writer)
+		return
+	}
+	ctx.JSON(status, manifest)
+}
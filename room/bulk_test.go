@@ -0,0 +1,297 @@
+package room
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"api/helpers"
+	"api/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// A 100ms rooms and room codes endpoint. Rooms are listed by name as a
+// substring, like 100ms does, and new rooms get codes for host and guest.
+type fakeRooms struct {
+	mu      sync.Mutex
+	rooms   []map[string]interface{}
+	codes   map[string][]RoomCode
+	created int
+}
+
+func fakeRoomsEndpoint(t *testing.T) *fakeRooms {
+	t.Helper()
+	fake := &fakeRooms{codes: map[string][]RoomCode{}}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fake.mu.Lock()
+		defer fake.mu.Unlock()
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/rooms":
+			data := []map[string]interface{}{}
+			for _, room := range fake.rooms {
+				if strings.Contains(room["name"].(string), r.URL.Query().Get("name")) {
+					data = append(data, room)
+				}
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": data, "last": ""})
+		case r.Method == "POST" && r.URL.Path == "/rooms":
+			fake.add(body)
+			fake.created++
+			json.NewEncoder(w).Encode(fake.rooms[len(fake.rooms)-1])
+		case parts[0] == "rooms" && len(parts) == 2:
+			room := fake.room(parts[1])
+			if room == nil {
+				w.WriteHeader(http.StatusNotFound)
+				io.WriteString(w, `{"message":"room not found"}`)
+				return
+			}
+			for key, value := range body {
+				room[key] = value
+			}
+			json.NewEncoder(w).Encode(room)
+		case parts[0] == "room-codes" && len(parts) >= 3:
+			roomId := parts[2]
+			switch {
+			case r.Method == "GET" && len(fake.codes[roomId]) == 0:
+				w.WriteHeader(http.StatusNotFound)
+				io.WriteString(w, `{"message":"no room codes"}`)
+			case r.Method == "GET":
+				json.NewEncoder(w).Encode(map[string]interface{}{"data": fake.codes[roomId]})
+			case len(parts) == 5:
+				json.NewEncoder(w).Encode(fake.code(roomId, parts[4]))
+			default:
+				json.NewEncoder(w).Encode(map[string]interface{}{"data": []RoomCode{fake.code(roomId, "host"), fake.code(roomId, "guest")}})
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, `{"message":"not found"}`)
+		}
+	}))
+	t.Cleanup(server.Close)
+	t.Setenv("BASE_URL", server.URL+"/")
+	t.Setenv("APP_ACCESS_KEY", "access")
+	t.Setenv("APP_SECRET", "secret")
+	return fake
+}
+
+// Add a room as 100ms creates it, holding the lock
+func (fake *fakeRooms) add(fields map[string]interface{}) map[string]interface{} {
+	room := map[string]interface{}{
+		"id":         fmt.Sprintf("r%02d", len(fake.rooms)+1),
+		"enabled":    true,
+		"created_at": time.Date(2024, 1, 1, 0, len(fake.rooms), 0, 0, time.UTC).Format(time.RFC3339),
+	}
+	for key, value := range fields {
+		room[key] = value
+	}
+	fake.rooms = append(fake.rooms, room)
+	return room
+}
+
+func (fake *fakeRooms) room(roomId string) map[string]interface{} {
+	for _, room := range fake.rooms {
+		if room["id"] == roomId {
+			return room
+		}
+	}
+	return nil
+}
+
+func (fake *fakeRooms) code(roomId, role string) RoomCode {
+	code := RoomCode{Code: roomId + "-" + role, Role: role, Enabled: true}
+	fake.codes[roomId] = append(fake.codes[roomId], code)
+	return code
+}
+
+// Tags kept in a fresh file in DATA_DIR for this test
+func useRoomTags(t *testing.T) {
+	t.Helper()
+	t.Setenv("DATA_DIR", t.TempDir())
+	s := roomTags()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.document = store.Open("room_tags.json")
+	s.Rooms = map[string]*RoomTags{}
+}
+
+func TestParseBulkRoomsCSV(t *testing.T) {
+	tests := []struct {
+		name string
+		csv  string
+		want []BulkRoom
+		err  string
+	}{
+		{
+			name: "only names",
+			csv:  "name\ncs101\n cs102 \n",
+			want: []BulkRoom{{HMSRoom: HMSRoom{Name: "cs101"}}, {HMSRoom: HMSRoom{Name: "cs102"}}},
+		},
+		{
+			name: "every column",
+			csv: "Name,description,template_id,region,large_room,size,max_duration_seconds,recording_enabled,upload_type,upload_location,upload_prefix,upload_region,credentials_ref,roles,tags\n" +
+				"cs101,Lecture,t1,eu,true,50,3600,true,s3,bucket,rec/,eu-west-1,archive,host; guest,course:cs101;term:fall;pinned\n",
+			want: []BulkRoom{{
+				HMSRoom: HMSRoom{
+					Name: "cs101", Description: "Lecture", TemplateId: "t1", Region: "eu", LargeRoom: true, Size: 50, MaxDurationSeconds: "3600",
+					RecordingInfo: &RecordingInfo{Enabled: true, UploadInfo: &UploadInfo{
+						Type: "s3", Location: "bucket", Prefix: "rec/", Options: &UploadOptions{Region: "eu-west-1"}, CredentialsRef: "archive",
+					}},
+					Tags: map[string]string{"course": "cs101", "term": "fall", "pinned": ""},
+				},
+				Roles: []string{"host", "guest"},
+			}},
+		},
+		{
+			name: "upload credentials",
+			csv:  "name,upload_type,upload_location,upload_key,upload_secret\ncs101,s3,bucket,AKIA,shh\n",
+			want: []BulkRoom{{HMSRoom: HMSRoom{Name: "cs101", RecordingInfo: &RecordingInfo{UploadInfo: &UploadInfo{
+				Type: "s3", Location: "bucket", Credentials: &UploadCredentials{Key: "AKIA", Secret: "shh"},
+			}}}}},
+		},
+		{
+			name: "short rows",
+			csv:  "name,description,roles\ncs101\n",
+			want: []BulkRoom{{HMSRoom: HMSRoom{Name: "cs101"}}},
+		},
+		{name: "no header", csv: "", err: "reading the header row: EOF"},
+		{name: "no name column", csv: "description\nLecture\n", err: "the header row has no name column"},
+		{name: "unknown column", csv: "name,colour\ncs101,red\n", err: `unknown column "colour"`},
+		{name: "invalid flag", csv: "name,large_room\ncs101,yes please\n", err: "line 2: large_room must be true or false"},
+		{name: "invalid size", csv: "name,size\ncs101,ten\ncs102,x\n", err: "line 2: size must be a number"},
+		{name: "invalid flag on a later line", csv: "name,recording_enabled\ncs101,true\ncs102,maybe\n", err: "line 3: recording_enabled must be true or false"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rooms, err := ParseBulkRoomsCSV(strings.NewReader(test.csv))
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("error %v, want %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(rooms, test.want) {
+				got, _ := json.Marshal(rooms)
+				want, _ := json.Marshal(test.want)
+				t.Errorf("rooms\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+}
+
+func TestCheckBulkRooms(t *testing.T) {
+	tests := []struct {
+		name  string
+		rooms []BulkRoom
+		want  []helpers.FieldError
+	}{
+		{"valid", []BulkRoom{{HMSRoom: HMSRoom{Name: "cs101"}}, {HMSRoom: HMSRoom{Name: "cs102", Region: "eu"}}}, nil},
+		{"missing name", []BulkRoom{{HMSRoom: HMSRoom{Name: "cs101"}}, {}}, []helpers.FieldError{
+			{Field: "rooms[1].name", Message: "is required"},
+		}},
+		{"duplicate name", []BulkRoom{{HMSRoom: HMSRoom{Name: "cs101"}}, {HMSRoom: HMSRoom{Name: "cs102"}}, {HMSRoom: HMSRoom{Name: "cs101"}}}, []helpers.FieldError{
+			{Field: "rooms[2].name", Message: "is also the name of rooms[0]"},
+		}},
+		{"invalid fields", []BulkRoom{{HMSRoom: HMSRoom{Name: "cs101", Region: "mars", Size: -1}}}, []helpers.FieldError{
+			{Field: "rooms[0].region", Message: "must be one of: in, us, eu, auto"},
+			{Field: "rooms[0].size", Message: "must be greater than or equal to 0"},
+		}},
+		{"invalid tag key", []BulkRoom{{HMSRoom: HMSRoom{Name: "cs101", Tags: map[string]string{"a:b": "c"}}}}, []helpers.FieldError{
+			{Field: "rooms[0].tags[a:b]", Message: "must not contain any of: :"},
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := CheckBulkRooms(test.rooms); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("errors %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestProvisionRoomsAgain(t *testing.T) {
+	fake := fakeRoomsEndpoint(t)
+	// Found by a search for "cs101", but not the same room
+	fake.add(map[string]interface{}{"name": "cs101-archive"})
+	existing := fake.add(map[string]interface{}{"name": "cs102"})
+	fake.code(existing["id"].(string), "guest")
+
+	rooms := []BulkRoom{
+		{HMSRoom: HMSRoom{Name: "cs101", TemplateId: "t1"}, Roles: []string{"host", "guest"}},
+		{HMSRoom: HMSRoom{Name: "cs102"}, Roles: []string{"guest"}},
+		{HMSRoom: HMSRoom{Name: "cs103"}},
+	}
+	first := ProvisionRooms(context.Background(), rooms, 2)
+	if first.Created != 2 || first.Existing != 1 || first.Failed != 0 {
+		t.Fatalf("first run %+v, want 2 created and 1 existing", first)
+	}
+	if first.Rooms[1].RoomId != existing["id"] || !reflect.DeepEqual(first.Rooms[1].RoomCodes, []RoomCode{{Code: "r02-guest", Role: "guest", Enabled: true}}) {
+		t.Errorf("existing room %+v, want r02 with its guest code", first.Rooms[1])
+	}
+	if got := first.Rooms[0].RoomCodes; len(got) != 2 || got[0].Role != "host" || got[1].Role != "guest" {
+		t.Errorf("room codes %+v, want host and guest", got)
+	}
+
+	second := ProvisionRooms(context.Background(), rooms, 2)
+	if second.Created != 0 || second.Existing != 3 || second.Failed != 0 {
+		t.Errorf("second run %+v, want 3 existing", second)
+	}
+	if fake.created != 2 || len(fake.rooms) != 4 {
+		t.Errorf("%d rooms created, %d in all, want 2 and 4", fake.created, len(fake.rooms))
+	}
+	for i := range rooms {
+		if a, b := first.Rooms[i], second.Rooms[i]; a.RoomId != b.RoomId || !reflect.DeepEqual(a.RoomCodes, b.RoomCodes) {
+			t.Errorf("room %d: second run %+v, first %+v", i, b, a)
+		}
+	}
+	for roomId, codes := range fake.codes {
+		if roomId != "r02" && len(codes) != 2 {
+			t.Errorf("room %s has %d codes, want 2", roomId, len(codes))
+		}
+	}
+}
+
+func TestCreateRoomsCSV(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	useRoomTags(t)
+	fakeRoomsEndpoint(t)
+	router := gin.New()
+	router.POST("/rooms/bulk", CreateRooms)
+
+	csv := "name,roles,tags\ncs101,host,course:cs101\ncs102,,course:cs102\n"
+	req := httptest.NewRequest("POST", "/rooms/bulk?format=csv&concurrency=1", strings.NewReader(csv))
+	req.Header.Set("Content-Type", "text/csv")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	want := "name,room_id,status,room_codes,error\ncs101,r01,created,host:r01-host,\ncs102,r02,created,host:r02-host;guest:r02-guest,\n"
+	if w.Code != http.StatusOK || w.Body.String() != want {
+		t.Errorf("status %d, manifest\n%s\nwant\n%s", w.Code, w.Body, want)
+	}
+	if tags := Tags("r02"); !reflect.DeepEqual(tags, map[string]string{"course": "cs102"}) {
+		t.Errorf("tags %v, want course:cs102", tags)
+	}
+
+	req = httptest.NewRequest("POST", "/rooms/bulk", strings.NewReader(`{"rooms": [{"name": "cs101"}, {"name": "cs101"}]}`))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "is also the name of rooms[0]") {
+		t.Errorf("duplicate names: status %d %s", w.Code, w.Body)
+	}
+}
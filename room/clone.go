@@ -0,0 +1,136 @@
+package room
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"api/helpers"
+	"api/hmserrors"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Fields of the new room that differ from the source room. Fields left out
+// are copied, so they are pointers that can also set false, zero or empty values.
+type CloneRoomBody struct {
+	Name          string         `json:"name,omitempty"`
+	Description   *string        `json:"description,omitempty"`
+	TemplateId    *string        `json:"template_id,omitempty"`
+	RecordingInfo *RecordingInfo `json:"recording_info,omitempty"`
+	Region        *string        `json:"region,omitempty" binding:"omitempty,oneof=in us eu auto"`
+	LargeRoom     *bool          `json:"large_room,omitempty"`
+	Size          *int           `json:"size,omitempty" binding:"omitempty,gte=0"`
+	// A number, or a string holding one
+	MaxDurationSeconds *json.Number      `json:"max_duration_seconds,omitempty"`
+	Polls              *[]string         `json:"polls,omitempty"`
+	Tags               map[string]string `json:"tags,omitempty" binding:"omitempty,max=50,dive,keys,min=1,max=64,excludesall=:,endkeys,max=256"`
+	// Create a room code for every role the source room has an enabled code for
+	RoomCodes bool `json:"room_codes,omitempty"`
+}
+
+type ClonedRoom struct {
+	Room      map[string]interface{} `json:"room"`
+	RoomCodes []RoomCode             `json:"room_codes,omitempty"`
+	// Set when the room was created but its room codes were not
+	Error string `json:"error,omitempty"`
+}
+
+// Fields of a room from the 100ms API that are copied to its clones
+var clonedFields = []string{"description", "template_id", "recording_info", "region", "large_room", "size", "max_duration_seconds", "polls"}
+
+// The settings of the source room, as 100ms returns them, with the fields set
+// in the body on top. The name is not copied, since room names are unique.
+func cloneSettings(source map[string]json.RawMessage, rb CloneRoomBody) map[string]json.RawMessage {
+	room := map[string]json.RawMessage{}
+	for _, field := range clonedFields {
+		if value, ok := source[field]; ok && string(value) != "null" {
+			room[field] = value
+		}
+	}
+	// Pointers that are set are marshalled even when they point to zero values
+	body, _ := json.Marshal(rb)
+	var overrides map[string]json.RawMessage
+	json.Unmarshal(body, &overrides)
+	delete(overrides, "tags")
+	delete(overrides, "room_codes")
+	for field, value := range overrides {
+		room[field] = value
+	}
+	return room
+}
+
+// Roles with an enabled room code in a room
+func roomCodeRoles(ctx context.Context, roomId string) ([]string, error) {
+	var codes struct {
+		Data []RoomCode `json:"data"`
+	}
+	if err := helpers.CallApi(ctx, "GET", helpers.GetEndpointUrl("room-codes/room/"+roomId), nil, &codes); err != nil {
+		return nil, err
+	}
+	roles := []string{}
+	seen := map[string]bool{}
+	for _, code := range codes.Data {
+		if code.Enabled && !seen[code.Role] {
+			seen[code.Role] = true
+			roles = append(roles, code.Role)
+		}
+	}
+	return roles, nil
+}
+
+// Create a room with the template, region, recording and other settings of
+// another, and optionally room codes for the same roles
+func CloneRoom(ctx *gin.Context) {
+	roomId, ok := ctx.Params.Get("roomId")
+	if !ok {
+		ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": hmserrors.ErrMissingRoomId})
+		return
+	}
+	var rb CloneRoomBody
+	if ctx.Request.ContentLength != 0 && !helpers.BindJSON(ctx, &rb) {
+		return
+	}
+	requestCtx := ctx.Request.Context()
+
+	var source map[string]json.RawMessage
+	if err := helpers.CallApi(requestCtx, "GET", roomBaseUrl()+"/"+roomId, nil, &source); err != nil {
+		helpers.AbortWithApiError(ctx, err)
+		return
+	}
+	var roles []string
+	if rb.RoomCodes {
+		var err error
+		if roles, err = roomCodeRoles(requestCtx, roomId); err != nil {
+			helpers.AbortWithApiError(ctx, err)
+			return
+		}
+	}
+
+	var cloned ClonedRoom
+	if err := helpers.CallApi(requestCtx, "POST", roomBaseUrl(), cloneSettings(source, rb), &cloned.Room); err != nil {
+		helpers.AbortWithApiError(ctx, err)
+		return
+	}
+	newRoomId, _ := cloned.Room["id"].(string)
+
+	tags := rb.Tags
+	if tags == nil {
+		tags = roomTags().get(roomId)
+	}
+	if len(tags) > 0 && newRoomId != "" {
+		roomTags().set(newRoomId, tags)
+		cloned.Room["tags"] = tags
+	}
+
+	if len(roles) > 0 {
+		codes, err := EnsureRoomCodes(requestCtx, newRoomId, roles)
+		cloned.RoomCodes = codes
+		if err != nil {
+			cloned.Error = err.Error()
+			ctx.JSON(http.StatusMultiStatus, cloned)
+			return
+		}
+	}
+	ctx.JSON(http.StatusCreated, cloned)
+}
@@ -0,0 +1,52 @@
+package room
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestCloneSettings(t *testing.T) {
+	// As 100ms returns a room, with max_duration_seconds as a number
+	source := `{"id": "r1", "name": "cs101", "enabled": true, "description": "lecture", "template_id": "t1", "region": "in", "large_room": true, "size": 50, "max_duration_seconds": 3600, "polls": ["p1"], "created_at": "2024-01-01T00:00:00Z"}`
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{
+			name: "settings are copied",
+			body: `{"name": "cs101-spring"}`,
+			want: `{"name": "cs101-spring", "description": "lecture", "template_id": "t1", "region": "in", "large_room": true, "size": 50, "max_duration_seconds": 3600, "polls": ["p1"]}`,
+		},
+		{
+			name: "false, zero and empty values are set",
+			body: `{"name": "cs101-spring", "large_room": false, "size": 0, "description": "", "polls": []}`,
+			want: `{"name": "cs101-spring", "description": "", "template_id": "t1", "region": "in", "large_room": false, "size": 0, "max_duration_seconds": 3600, "polls": []}`,
+		},
+		{
+			name: "max duration as a string",
+			body: `{"name": "cs101-spring", "max_duration_seconds": "7200", "room_codes": true, "tags": {"course": "cs101"}}`,
+			want: `{"name": "cs101-spring", "description": "lecture", "template_id": "t1", "region": "in", "large_room": true, "size": 50, "max_duration_seconds": 7200, "polls": ["p1"]}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var room map[string]json.RawMessage
+			var rb CloneRoomBody
+			if err := json.Unmarshal([]byte(source), &room); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal([]byte(test.body), &rb); err != nil {
+				t.Fatal(err)
+			}
+			data, _ := json.Marshal(cloneSettings(room, rb))
+			var got, want interface{}
+			json.Unmarshal(data, &got)
+			json.Unmarshal([]byte(test.want), &want)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("settings %s, want %s", data, test.want)
+			}
+		})
+	}
+}
@@ -21,11 +21,13 @@ type RecordingInfo struct {
 }
 
 type UploadInfo struct {
-	Type        string             `json:"type"`
-	Location    string             `json:"location"`
+	Type        string             `json:"type" binding:"required"`
+	Location    string             `json:"location" binding:"required"`
 	Prefix      string             `json:"prefix,omitempty"`
 	Options     *UploadOptions     `json:"options,omitempty"`
 	Credentials *UploadCredentials `json:"credentials,omitempty"`
+	// Name of credentials in the vault, filled in when the room is sent to 100ms
+	CredentialsRef string `json:"credentials_ref,omitempty"`
 }
 
 type UploadOptions struct {
@@ -33,8 +35,8 @@ type UploadOptions struct {
 }
 
 type UploadCredentials struct {
-	Key    string `json:"key"`
-	Secret string `json:"secret"`
+	Key    string `json:"key" binding:"required"`
+	Secret string `json:"secret" binding:"required"`
 }
 
 type HMSRoom struct {
@@ -42,30 +44,32 @@ type HMSRoom struct {
 	Description        string         `json:"description,omitempty"`
 	TemplateId         string         `json:"template_id,omitempty"`
 	RecordingInfo      *RecordingInfo `json:"recording_info,omitempty"`
-	Region             string         `json:"region,omitempty"`
+	Region             string         `json:"region,omitempty" binding:"omitempty,oneof=in us eu auto"`
 	LargeRoom          bool           `json:"large_room,omitempty"`
-	Size               int            `json:"size,omitempty"`
+	Size               int            `json:"size,omitempty" binding:"gte=0"`
 	MaxDurationSeconds string         `json:"max_duration_seconds,omitempty"`
 	Polls              []string       `json:"polls,omitempty"`
+	// Kept by this service and never sent to 100ms, e.g. {"course": "cs101"}
+	Tags map[string]string `json:"tags,omitempty" binding:"omitempty,max=50,dive,keys,min=1,max=64,excludesall=:,endkeys,max=256"`
 }
 type HMSRoomQueryParam struct {
 	Name    string `form:"name,omitempty"`
 	Enabled *bool  `form:"enabled,omitempty"`
 	Before  string `form:"before,omitempty"`
 	After   string `form:"after,omitempty"`
+	// Tags as key:value, or key for any value, resolved locally
+	Tag   []string `form:"tag,omitempty"`
+	Limit uint8    `form:"limit,omitempty"`
+	Start string   `form:"start,omitempty"`
 }
 
-var roomBaseUrl = helpers.GetEndpointUrl("rooms")
-
-// Get the post request body
-func getRequestBody(ctx *gin.Context) *bytes.Buffer {
-	var rb HMSRoom
-
-	if err := ctx.ShouldBindJSON(&rb); err != nil {
-		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-	}
+func roomBaseUrl() string {
+	return helpers.GetEndpointUrl("rooms")
+}
 
-	postBody, _ := json.Marshal(HMSRoom{
+// The fields of the room that are sent to 100ms
+func (rb HMSRoom) upstream() HMSRoom {
+	return HMSRoom{
 		Name:               rb.Name,
 		Description:        rb.Description,
 		TemplateId:         rb.TemplateId,
@@ -75,9 +79,20 @@ func getRequestBody(ctx *gin.Context) *bytes.Buffer {
 		Size:               rb.Size,
 		MaxDurationSeconds: rb.MaxDurationSeconds,
 		Polls:              rb.Polls,
-	})
+	}
+}
+
+// Get the post request body, and the tags to keep locally
+func getRequestBody(ctx *gin.Context) (*bytes.Buffer, map[string]string, bool) {
+	var rb HMSRoom
+
+	if !helpers.BindJSON(ctx, &rb) {
+		return nil, nil, false
+	}
+
+	postBody, _ := json.Marshal(rb.upstream())
 	payload := bytes.NewBuffer(postBody)
-	return payload
+	return payload, rb.Tags, true
 }
 
 // Get details of a given room
@@ -88,30 +103,42 @@ func GetRoom(ctx *gin.Context) {
 		ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": hmserrors.ErrMissingRoomId})
 	}
 
-	helpers.MakeApiRequest(ctx, roomBaseUrl+"/"+roomId, "GET", nil)
+	forwardRoom(ctx, roomBaseUrl()+"/"+roomId, "GET", nil, nil)
 
 }
 
 // Get a list of all rooms
-// Applicable filters: name string, enabled *bool, after string, before string
+// Applicable filters: name string, enabled *bool, after string, before string, tag []string,
+// start string, limit int
 func ListRooms(ctx *gin.Context) {
 	var param HMSRoomQueryParam
 	qs := url.Values{}
 	if ctx.BindQuery(&param) == nil {
+		if len(param.Tag) > 0 {
+			listTaggedRooms(ctx, &param)
+			return
+		}
 		qs.Add("name", param.Name)
 		if param.Enabled != nil {
 			qs.Add("enabled", strconv.FormatBool(*param.Enabled))
 		}
 		qs.Add("before", param.Before)
 		qs.Add("after", param.After)
+		qs.Add("start", param.Start)
+		if param.Limit >= 10 {
+			qs.Add("limit", strconv.Itoa(int(param.Limit)))
+		}
 	}
-	helpers.MakeApiRequest(ctx, roomBaseUrl+"?"+qs.Encode(), "GET", nil)
+	forwardRoomList(ctx, roomBaseUrl()+"?"+qs.Encode())
 }
 
 // Create a   room with a given room name
 func CreateRoom(ctx *gin.Context) {
-	payload := getRequestBody(ctx)
-	helpers.MakeApiRequest(ctx, roomBaseUrl, "POST", payload)
+	payload, tags, ok := getRequestBody(ctx)
+	if !ok {
+		return
+	}
+	forwardRoom(ctx, roomBaseUrl(), "POST", payload, tags)
 }
 
 // Update a Room
@@ -121,8 +148,11 @@ func UpdateRoom(ctx *gin.Context) {
 		ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": hmserrors.ErrMissingRoomId})
 	}
 
-	payload := getRequestBody(ctx)
-	helpers.MakeApiRequest(ctx, roomBaseUrl+"/"+roomId, "POST", payload)
+	payload, tags, ok := getRequestBody(ctx)
+	if !ok {
+		return
+	}
+	forwardRoom(ctx, roomBaseUrl()+"/"+roomId, "POST", payload, tags)
 }
 
 // Enable a room
@@ -133,7 +163,7 @@ func EnableRoom(ctx *gin.Context) {
 	}
 	postBody, _ := json.Marshal(map[string]bool{"enabled": true})
 	payload := bytes.NewBuffer(postBody)
-	helpers.MakeApiRequest(ctx, roomBaseUrl+"/"+roomId, "POST", payload)
+	helpers.MakeApiRequest(ctx, roomBaseUrl()+"/"+roomId, "POST", payload)
 }
 
 // Disable a room
@@ -144,5 +174,5 @@ func DisableRoom(ctx *gin.Context) {
 	}
 	postBody, _ := json.Marshal(map[string]bool{"enabled": false})
 	payload := bytes.NewBuffer(postBody)
-	helpers.MakeApiRequest(ctx, roomBaseUrl+"/"+roomId, "POST", payload)
+	helpers.MakeApiRequest(ctx, roomBaseUrl()+"/"+roomId, "POST", payload)
 }
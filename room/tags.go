@@ -0,0 +1,297 @@
+package room
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"api/helpers"
+	"api/hmserrors"
+	"api/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Tags of a room, which 100ms does not store
+type RoomTags struct {
+	Tags      map[string]string `json:"tags"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+type tagStore struct {
+	mu       sync.Mutex
+	document *store.Document
+	Rooms    map[string]*RoomTags `json:"rooms"`
+}
+
+// Loaded on first use from ROOM_TAGS_FILE in DATA_DIR
+var roomTags = sync.OnceValue(func() *tagStore {
+	name, ok := helpers.GetEnvironmentVariable("ROOM_TAGS_FILE")
+	if !ok || name == "" {
+		name = "room_tags.json"
+	}
+	s := &tagStore{document: store.Open(name), Rooms: map[string]*RoomTags{}}
+	if err := s.document.Load(s); err != nil {
+		log.Printf("room tags: %s: %v", s.document.Path(), err)
+	}
+	if s.Rooms == nil {
+		s.Rooms = map[string]*RoomTags{}
+	}
+	return s
+})
+
+func (s *tagStore) get(roomId string) map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if room, ok := s.Rooms[roomId]; ok {
+		return room.Tags
+	}
+	return nil
+}
+
+// Replace the tags of a room, forgetting the room when there are none
+func (s *tagStore) set(roomId string, tags map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(tags) == 0 {
+		delete(s.Rooms, roomId)
+	} else {
+		s.Rooms[roomId] = &RoomTags{Tags: tags, UpdatedAt: time.Now().UTC()}
+	}
+	if err := s.document.Save(s); err != nil {
+		log.Printf("room tags: %s: %v", s.document.Path(), err)
+	}
+}
+
+// Tags of a room kept by this service, nil when it has none
+func Tags(roomId string) map[string]string {
+	return roomTags().get(roomId)
+}
+
+// A tag a room must have, with any value when Value is empty
+type tagFilter struct {
+	Key, Value string
+}
+
+// Parse tag filters of the form "key:value", or "key" for any value
+func parseTagFilters(values []string) ([]tagFilter, error) {
+	filters := make([]tagFilter, 0, len(values))
+	for _, value := range values {
+		key, tagValue, _ := strings.Cut(value, ":")
+		if key == "" {
+			return nil, hmserrors.ErrInvalidTagFilter
+		}
+		filters = append(filters, tagFilter{Key: key, Value: tagValue})
+	}
+	return filters, nil
+}
+
+// Ids of the rooms with all of the given tags, in order
+func (s *tagStore) match(filters []tagFilter) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	roomIds := []string{}
+	for roomId, room := range s.Rooms {
+		matches := true
+		for _, filter := range filters {
+			value, ok := room.Tags[filter.Key]
+			if !ok || filter.Value != "" && value != filter.Value {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			roomIds = append(roomIds, roomId)
+		}
+	}
+	sort.Strings(roomIds)
+	return roomIds
+}
+
+// Add the tags of a room to its JSON from the 100ms API
+func withTags(room map[string]json.RawMessage) map[string]json.RawMessage {
+	var roomId string
+	json.Unmarshal(room["id"], &roomId)
+	if tags := roomTags().get(roomId); tags != nil {
+		room["tags"], _ = json.Marshal(tags)
+	}
+	return room
+}
+
+// Send a request to the 100ms API, aborting with its error when it fails
+func readApiResponse(ctx *gin.Context, url, method string, payload *bytes.Buffer) ([]byte, int, bool) {
+	var requestBody io.Reader
+	if payload != nil {
+		requestBody = payload
+	}
+	res, err := helpers.DoApiRequest(ctx.Request.Context(), method, url, requestBody)
+	if err != nil {
+		helpers.AbortWithApiError(ctx, err)
+		return nil, 0, false
+	}
+	defer res.Body.Close()
+
+	resp, err := io.ReadAll(res.Body)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, 0, false
+	}
+	return resp, res.StatusCode, true
+}
+
+// Forward a request about a single room and respond with the room and its
+// tags. Tags that are not nil replace those of the room once 100ms accepts
+// the request.
+func forwardRoom(ctx *gin.Context, url, method string, payload *bytes.Buffer, tags map[string]string) {
+	resp, status, ok := readApiResponse(ctx, url, method, payload)
+	if !ok {
+		return
+	}
+	var room map[string]json.RawMessage
+	if status < 200 || status > 299 || json.Unmarshal(resp, &room) != nil {
+		ctx.Data(status, gin.MIMEJSON, resp)
+		return
+	}
+
+	if tags != nil {
+		var roomId string
+		if json.Unmarshal(room["id"], &roomId) == nil && roomId != "" {
+			roomTags().set(roomId, tags)
+		}
+	}
+	ctx.JSON(status, withTags(room))
+}
+
+// Forward a request for a list of rooms and respond with the tags of each room
+func forwardRoomList(ctx *gin.Context, url string) {
+	resp, status, ok := readApiResponse(ctx, url, "GET", nil)
+	if !ok {
+		return
+	}
+	var list map[string]json.RawMessage
+	var rooms []map[string]json.RawMessage
+	if status < 200 || status > 299 || json.Unmarshal(resp, &list) != nil || json.Unmarshal(list["data"], &rooms) != nil {
+		ctx.Data(status, gin.MIMEJSON, resp)
+		return
+	}
+
+	for _, room := range rooms {
+		withTags(room)
+	}
+	list["data"], _ = json.Marshal(rooms)
+	ctx.JSON(status, list)
+}
+
+// Whether a room from the 100ms API matches the filters of a room list
+func (param *HMSRoomQueryParam) matches(room map[string]interface{}) bool {
+	if param.Name != "" && room["name"] != param.Name {
+		return false
+	}
+	if param.Enabled != nil && room["enabled"] != *param.Enabled {
+		return false
+	}
+	createdAtValue, _ := room["created_at"].(string)
+	createdAt, _ := time.Parse(time.RFC3339, createdAtValue)
+	if before, err := time.Parse(time.RFC3339, param.Before); err == nil && !createdAt.Before(before) {
+		return false
+	}
+	if after, err := time.Parse(time.RFC3339, param.After); err == nil && !createdAt.After(after) {
+		return false
+	}
+	return true
+}
+
+const (
+	// Rooms of a page of tagged rooms, unless the limit is set
+	defaultTaggedRoomLimit = 10
+	maxTaggedRoomLimit     = 100
+	// Tagged rooms fetched from 100ms at the same time
+	taggedRoomConcurrency = 5
+)
+
+// Ids of the rooms after start, the id of the last room of the page before
+func roomIdsAfter(roomIds []string, start string) []string {
+	if start == "" {
+		return roomIds
+	}
+	return roomIds[sort.Search(len(roomIds), func(i int) bool { return roomIds[i] > start }):]
+}
+
+// Fetch rooms from 100ms, up to taggedRoomConcurrency at a time. Rooms that no
+// longer exist are nil.
+func fetchRooms(ctx context.Context, roomIds []string) ([]map[string]interface{}, error) {
+	rooms := make([]map[string]interface{}, len(roomIds))
+	errs := make([]error, len(roomIds))
+	slots := make(chan struct{}, taggedRoomConcurrency)
+	var wg sync.WaitGroup
+	for i, roomId := range roomIds {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(i int, roomId string) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			err := helpers.CallApi(ctx, "GET", roomBaseUrl()+"/"+roomId, nil, &rooms[i])
+			var apiError *helpers.ApiError
+			if errors.As(err, &apiError) && apiError.StatusCode == http.StatusNotFound {
+				rooms[i], err = nil, nil
+			}
+			errs[i] = err
+		}(i, roomId)
+	}
+	wg.Wait()
+	return rooms, errors.Join(errs...)
+}
+
+// List the rooms with the given tags, a page at a time. The rooms are looked
+// up locally in order of id and fetched from 100ms, so that the other filters
+// can be applied. start is the last room id of the page before, as returned
+// in last, which is empty on the last page.
+func listTaggedRooms(ctx *gin.Context, param *HMSRoomQueryParam) {
+	filters, err := parseTagFilters(param.Tag)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	limit := int(param.Limit)
+	if limit == 0 {
+		limit = defaultTaggedRoomLimit
+	}
+	if limit > maxTaggedRoomLimit {
+		limit = maxTaggedRoomLimit
+	}
+
+	// Rooms are fetched a page of ids at a time until the page is full, since
+	// some may not match the other filters
+	roomIds := roomIdsAfter(roomTags().match(filters), param.Start)
+	rooms := []map[string]interface{}{}
+	last := ""
+	for len(roomIds) > 0 && len(rooms) < limit {
+		batch := roomIds[:min(limit-len(rooms), len(roomIds))]
+		fetched, err := fetchRooms(ctx.Request.Context(), batch)
+		if err != nil {
+			helpers.AbortWithApiError(ctx, err)
+			return
+		}
+		for i, room := range fetched {
+			if room != nil && param.matches(room) {
+				room["tags"] = roomTags().get(batch[i])
+				rooms = append(rooms, room)
+			}
+		}
+		roomIds = roomIds[len(batch):]
+		last = batch[len(batch)-1]
+	}
+	if len(roomIds) == 0 {
+		last = ""
+	}
+	ctx.JSON(http.StatusOK, gin.H{"limit": limit, "data": rooms, "last": last})
+}
@@ -0,0 +1,184 @@
+package room
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"api/hmserrors"
+
+	"github.com/gin-gonic/gin"
+)
+
+func roomsRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/rooms", ListRooms)
+	router.POST("/rooms", CreateRoom)
+	router.GET("/rooms/:roomId", GetRoom)
+	router.POST("/rooms/:roomId", UpdateRoom)
+	return router
+}
+
+func serve(router *gin.Engine, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestParseTagFilters(t *testing.T) {
+	tests := []struct {
+		values []string
+		want   []tagFilter
+		err    error
+	}{
+		{[]string{"course"}, []tagFilter{{Key: "course"}}, nil},
+		{[]string{"course:cs101", "term"}, []tagFilter{{Key: "course", Value: "cs101"}, {Key: "term"}}, nil},
+		{[]string{"url:https://example.com"}, []tagFilter{{Key: "url", Value: "https://example.com"}}, nil},
+		{[]string{"course:"}, []tagFilter{{Key: "course"}}, nil},
+		{[]string{":cs101"}, nil, hmserrors.ErrInvalidTagFilter},
+		{[]string{""}, nil, hmserrors.ErrInvalidTagFilter},
+	}
+	for _, test := range tests {
+		got, err := parseTagFilters(test.values)
+		if err != test.err || !reflect.DeepEqual(got, test.want) && test.err == nil {
+			t.Errorf("parseTagFilters(%q) = %+v, %v, want %+v, %v", test.values, got, err, test.want, test.err)
+		}
+	}
+}
+
+func TestRoomTags(t *testing.T) {
+	fake := fakeRoomsEndpoint(t)
+	useRoomTags(t)
+	router := roomsRouter()
+
+	responseTags := func(w *httptest.ResponseRecorder) map[string]string {
+		t.Helper()
+		if w.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", w.Code, w.Body)
+		}
+		var room struct {
+			Tags map[string]string `json:"tags"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &room); err != nil {
+			t.Fatal(err)
+		}
+		return room.Tags
+	}
+
+	w := serve(router, "POST", "/rooms", `{"name": "cs101-lecture", "tags": {"course": "cs101", "term": "fall"}}`)
+	want := map[string]string{"course": "cs101", "term": "fall"}
+	if got := responseTags(w); !reflect.DeepEqual(got, want) {
+		t.Errorf("created room with tags %v, want %v", got, want)
+	}
+	if !reflect.DeepEqual(Tags("r01"), want) {
+		t.Errorf("stored tags %v, want %v", Tags("r01"), want)
+	}
+	if _, sent := fake.room("r01")["tags"]; sent {
+		t.Error("tags were sent to 100ms")
+	}
+	if got := responseTags(serve(router, "GET", "/rooms/r01", "")); !reflect.DeepEqual(got, want) {
+		t.Errorf("got room with tags %v, want %v", got, want)
+	}
+
+	tests := []struct {
+		name, body string
+		want       map[string]string
+	}{
+		{"update without tags keeps them", `{"description": "Lectures"}`, want},
+		{"update with tags replaces them", `{"tags": {"course": "cs102"}}`, map[string]string{"course": "cs102"}},
+		{"update with no tags clears them", `{"tags": {}}`, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := responseTags(serve(router, "POST", "/rooms/r01", test.body)); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("updated room with tags %v, want %v", got, test.want)
+			}
+			if !reflect.DeepEqual(Tags("r01"), test.want) {
+				t.Errorf("stored tags %v, want %v", Tags("r01"), test.want)
+			}
+		})
+	}
+
+	// Tags are kept only once 100ms accepts the request
+	if w := serve(router, "POST", "/rooms/r99", `{"tags": {"course": "cs101"}}`); w.Code != http.StatusNotFound || Tags("r99") != nil {
+		t.Errorf("status %d with tags %v for a missing room", w.Code, Tags("r99"))
+	}
+	if w := serve(router, "POST", "/rooms", `{"name": "r", "tags": {"a:b": "c"}}`); w.Code != http.StatusBadRequest {
+		t.Errorf("status %d for a tag key with a colon, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestListTaggedRooms(t *testing.T) {
+	fake := fakeRoomsEndpoint(t)
+	useRoomTags(t)
+	// r04 is disabled
+	tags := []map[string]string{
+		{"course": "cs101", "term": "fall"},
+		{"course": "cs101", "term": "spring"},
+		{"course": "cs102", "term": "fall"},
+		{"course": "cs101"},
+		nil,
+		{"course": "cs101", "term": "fall"},
+	}
+	for i, roomTagsOf := range tags {
+		room := fake.add(map[string]interface{}{"name": "room"})
+		if i == 3 {
+			room["enabled"] = false
+		}
+		roomTags().set(room["id"].(string), roomTagsOf)
+	}
+	// Tagged, but deleted in 100ms since
+	roomTags().set("r07", map[string]string{"course": "cs101"})
+	router := roomsRouter()
+
+	tests := []struct {
+		name, query string
+		want        []string
+		last        string
+	}{
+		{"any value", "tag=term", []string{"r01", "r02", "r03", "r06"}, ""},
+		{"value", "tag=course:cs101", []string{"r01", "r02", "r04", "r06"}, ""},
+		{"all tags", "tag=course:cs101&tag=term:fall", []string{"r01", "r06"}, ""},
+		{"no match", "tag=course:cs999", []string{}, ""},
+		{"first page", "tag=course:cs101&limit=2", []string{"r01", "r02"}, "r02"},
+		{"second page", "tag=course:cs101&limit=2&start=r02", []string{"r04", "r06"}, "r06"},
+		{"last page", "tag=course:cs101&limit=2&start=r06", []string{}, ""},
+		{"other filters", "tag=course:cs101&enabled=true&limit=2&start=r02", []string{"r06"}, ""},
+		{"created after", "tag=course&after=2024-01-01T00:01:30Z", []string{"r03", "r04", "r06"}, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := serve(router, "GET", "/rooms?"+test.query, "")
+			if w.Code != http.StatusOK {
+				t.Fatalf("status %d: %s", w.Code, w.Body)
+			}
+			var page struct {
+				Data []map[string]interface{} `json:"data"`
+				Last string                   `json:"last"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+				t.Fatal(err)
+			}
+			got := []string{}
+			for _, room := range page.Data {
+				got = append(got, room["id"].(string))
+				if room["tags"] == nil {
+					t.Errorf("room %s listed without tags", room["id"])
+				}
+			}
+			if !reflect.DeepEqual(got, test.want) || page.Last != test.last {
+				t.Errorf("listed %v with last %q, want %v with %q", got, page.Last, test.want, test.last)
+			}
+		})
+	}
+
+	if w := serve(router, "GET", "/rooms?tag=:cs101", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("status %d for a filter without a key, want %d", w.Code, http.StatusBadRequest)
+	}
+}
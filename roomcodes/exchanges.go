@@ -0,0 +1,211 @@
+package roomcodes
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"api/helpers"
+	"api/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	ExchangeIssued      = "issued"
+	ExchangeRefused     = "refused"
+	ExchangeRateLimited = "rate_limited"
+	ExchangeUnverified  = "unverified"
+	ExchangeFailed      = "failed"
+
+	defaultExchangesKept = 1000
+	defaultExchangeLimit = 100
+)
+
+// An attempt to exchange a room code for an auth token
+type CodeExchange struct {
+	At        time.Time `json:"at"`
+	Code      string    `json:"code"`
+	RoomId    string    `json:"room_id,omitempty"`
+	Role      string    `json:"role,omitempty"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	Outcome   string    `json:"outcome"`
+	Status    int       `json:"status"`
+	Error     string    `json:"error,omitempty"`
+}
+
+type CodeExchangeQueryParam struct {
+	Code    string `form:"code"`
+	IP      string `form:"ip"`
+	Outcome string `form:"outcome" binding:"omitempty,oneof=issued refused unverified failed"`
+	Limit   int    `form:"limit" binding:"omitempty,gte=1,lte=1000"`
+}
+
+// Rate limited attempts of a caller IP on a code, counted instead of logged
+// one by one so that a flood of attempts does not flush the log
+type RateLimitedExchanges struct {
+	IP       string    `json:"ip"`
+	Code     string    `json:"code"`
+	Attempts int       `json:"attempts"`
+	FirstAt  time.Time `json:"first_at"`
+	LastAt   time.Time `json:"last_at"`
+}
+
+type RateLimitedExchangesQueryParam struct {
+	Code  string `form:"code"`
+	IP    string `form:"ip"`
+	Limit int    `form:"limit" binding:"omitempty,gte=1,lte=1000"`
+}
+
+type exchangeStore struct {
+	mu  sync.Mutex
+	log *store.Log
+	// Since the start of the service, for at most kept callers and codes
+	rateLimited map[[2]string]*RateLimitedExchanges
+	kept        int
+}
+
+// Appended to CODE_EXCHANGES_FILE in DATA_DIR, which is rotated every CODE_EXCHANGES_KEPT attempts
+var exchanges = sync.OnceValue(func() *exchangeStore {
+	name, ok := helpers.GetEnvironmentVariable("CODE_EXCHANGES_FILE")
+	if !ok || name == "" {
+		name = "code_exchanges.jsonl"
+	}
+	kept := max(helpers.GetEnvironmentInt("CODE_EXCHANGES_KEPT", defaultExchangesKept), 1)
+	return &exchangeStore{log: store.OpenLog(name, kept), rateLimited: map[[2]string]*RateLimitedExchanges{}, kept: kept}
+})
+
+func (s *exchangeStore) record(exchange CodeExchange) {
+	if exchange.Outcome == ExchangeRateLimited {
+		s.countRateLimited(exchange)
+		return
+	}
+	if err := s.log.Append(exchange); err != nil {
+		log.Printf("code exchanges: %s: %v", s.log.Path(), err)
+	}
+}
+
+func (s *exchangeStore) countRateLimited(exchange CodeExchange) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := [2]string{exchange.IP, exchange.Code}
+	if summary, ok := s.rateLimited[key]; ok {
+		summary.Attempts++
+		summary.LastAt = exchange.At
+		return
+	}
+	if len(s.rateLimited) > 0 && len(s.rateLimited) >= s.kept {
+		// Forget the caller and code that were limited the longest time ago
+		var oldest *RateLimitedExchanges
+		for _, summary := range s.rateLimited {
+			if oldest == nil || summary.LastAt.Before(oldest.LastAt) {
+				oldest = summary
+			}
+		}
+		delete(s.rateLimited, [2]string{oldest.IP, oldest.Code})
+	}
+	s.rateLimited[key] = &RateLimitedExchanges{IP: exchange.IP, Code: exchange.Code, Attempts: 1, FirstAt: exchange.At, LastAt: exchange.At}
+}
+
+func (s *exchangeStore) list(param CodeExchangeQueryParam) ([]CodeExchange, error) {
+	records, err := s.log.Records()
+	if err != nil {
+		return nil, err
+	}
+	limit := param.Limit
+	if limit == 0 {
+		limit = defaultExchangeLimit
+	}
+	list := []CodeExchange{}
+	for i := len(records) - 1; i >= 0 && len(list) < limit; i-- {
+		var exchange CodeExchange
+		if json.Unmarshal(records[i], &exchange) != nil {
+			continue
+		}
+		if param.Code != "" && exchange.Code != param.Code ||
+			param.IP != "" && exchange.IP != param.IP ||
+			param.Outcome != "" && exchange.Outcome != param.Outcome {
+			continue
+		}
+		list = append(list, exchange)
+	}
+	return list, nil
+}
+
+// Rate limited callers and codes, most recently limited first
+func (s *exchangeStore) listRateLimited(param RateLimitedExchangesQueryParam) []RateLimitedExchanges {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := []RateLimitedExchanges{}
+	for _, summary := range s.rateLimited {
+		if param.Code != "" && summary.Code != param.Code || param.IP != "" && summary.IP != param.IP {
+			continue
+		}
+		list = append(list, *summary)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].LastAt.After(list[j].LastAt) })
+	limit := param.Limit
+	if limit == 0 {
+		limit = defaultExchangeLimit
+	}
+	if len(list) > limit {
+		list = list[:limit]
+	}
+	return list
+}
+
+// Room and role an auth token was issued for, from its unverified claims
+func tokenClaims(response []byte) (roomId, role string) {
+	var body struct {
+		Token string `json:"token"`
+	}
+	if json.Unmarshal(response, &body) != nil {
+		return "", ""
+	}
+	parts := strings.Split(body.Token, ".")
+	if len(parts) != 3 {
+		return "", ""
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", ""
+	}
+	var claims struct {
+		RoomId string `json:"room_id"`
+		Role   string `json:"role"`
+	}
+	json.Unmarshal(payload, &claims)
+	return claims.RoomId, claims.Role
+}
+
+// List the attempts to exchange room codes for auth tokens, newest first
+func ListCodeExchanges(ctx *gin.Context) {
+	var param CodeExchangeQueryParam
+	if err := ctx.ShouldBindQuery(&param); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	list, err := exchanges().list(param)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"data": list})
+}
+
+// List the callers and codes whose attempts to exchange codes were rate limited,
+// most recently limited first
+func ListRateLimitedCodeExchanges(ctx *gin.Context) {
+	var param RateLimitedExchangesQueryParam
+	if err := ctx.ShouldBindQuery(&param); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"data": exchanges().listRateLimited(param)})
+}
@@ -0,0 +1,86 @@
+package roomcodes
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"api/store"
+)
+
+func TestExchangeStore(t *testing.T) {
+	t.Setenv("DATA_DIR", t.TempDir())
+	s := &exchangeStore{log: store.OpenLog("code_exchanges.jsonl", 3), rateLimited: map[[2]string]*RateLimitedExchanges{}, kept: 2}
+	at := time.Date(2024, 9, 2, 10, 0, 0, 0, time.UTC)
+	for i := 0; i < 7; i++ {
+		s.record(CodeExchange{At: at.Add(time.Duration(i) * time.Second), Code: fmt.Sprintf("code-%d", i), IP: "192.0.2.1", Outcome: ExchangeIssued})
+	}
+	list, err := s.list(CodeExchangeQueryParam{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The current file holds the 7th attempt, the rotated one the three before
+	var codes []string
+	for _, exchange := range list {
+		codes = append(codes, exchange.Code)
+	}
+	if fmt.Sprint(codes) != "[code-6 code-5 code-4 code-3]" {
+		t.Errorf("listed %v, want the last four newest first", codes)
+	}
+	if list, _ := s.list(CodeExchangeQueryParam{Code: "code-4", Limit: 1}); len(list) != 1 || list[0].Code != "code-4" {
+		t.Errorf("filtered %+v, want code-4", list)
+	}
+
+	// Rate limited attempts are counted, not logged
+	for i, key := range [][2]string{{"198.51.100.1", "a"}, {"198.51.100.1", "a"}, {"198.51.100.2", "a"}, {"198.51.100.3", "b"}} {
+		s.record(CodeExchange{At: at.Add(time.Duration(i) * time.Minute), IP: key[0], Code: key[1], Outcome: ExchangeRateLimited})
+	}
+	if list, _ := s.list(CodeExchangeQueryParam{}); len(list) != 4 {
+		t.Errorf("rate limited attempts were logged: %+v", list)
+	}
+	limited := s.listRateLimited(RateLimitedExchangesQueryParam{})
+	if len(limited) != 2 || limited[0].IP != "198.51.100.3" || limited[1].IP != "198.51.100.2" {
+		t.Errorf("rate limited %+v, want the two most recent callers", limited)
+	}
+	s.record(CodeExchange{At: at.Add(time.Hour), IP: "198.51.100.2", Code: "a", Outcome: ExchangeRateLimited})
+	if limited := s.listRateLimited(RateLimitedExchangesQueryParam{IP: "198.51.100.2"}); len(limited) != 1 || limited[0].Attempts != 2 || !limited[0].FirstAt.Equal(at.Add(2*time.Minute)) {
+		t.Errorf("rate limited %+v, want two attempts since the third minute", limited)
+	}
+}
+
+func TestExchangeStoreSkipsTornLines(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("DATA_DIR", dir)
+	if err := os.WriteFile(dir+"/code_exchanges.jsonl", []byte(`{"code":"before","outcome":"issued"}`+"\n"+`{"code":"cut`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	s := &exchangeStore{log: store.OpenLog("code_exchanges.jsonl", 10), rateLimited: map[[2]string]*RateLimitedExchanges{}, kept: 10}
+	s.record(CodeExchange{Code: "after", Outcome: ExchangeIssued})
+	list, err := s.list(CodeExchangeQueryParam{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].Code != "after" || list[1].Code != "before" {
+		t.Errorf("listed %+v, want after and before", list)
+	}
+}
+
+func TestExchangesKeptAtLeastOne(t *testing.T) {
+	t.Setenv("DATA_DIR", t.TempDir())
+	t.Setenv("CODE_EXCHANGES_KEPT", "0")
+	s := exchanges()
+	for _, ip := range []string{"198.51.100.1", "198.51.100.2"} {
+		s.record(CodeExchange{At: time.Now(), IP: ip, Code: "a", Outcome: ExchangeRateLimited})
+	}
+	if limited := s.listRateLimited(RateLimitedExchangesQueryParam{}); len(limited) != 1 || limited[0].IP != "198.51.100.2" {
+		t.Errorf("rate limited %+v, want the last caller", limited)
+	}
+
+	// Also when a store is made without going through exchanges
+	s = &exchangeStore{log: s.log, rateLimited: map[[2]string]*RateLimitedExchanges{}}
+	s.record(CodeExchange{At: time.Now(), IP: "198.51.100.3", Code: "a", Outcome: ExchangeRateLimited})
+	if limited := s.listRateLimited(RateLimitedExchangesQueryParam{}); len(limited) != 1 {
+		t.Errorf("rate limited %+v, want one caller", limited)
+	}
+}
@@ -0,0 +1,224 @@
+package roomcodes
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"api/helpers"
+	"api/hmserrors"
+	"api/ratelimit"
+	"api/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// Pre-shared secret of trusted frontends, checked when CODE_EXCHANGE_SECRET is set
+	HeaderExchangeSecret = "X-Exchange-Secret"
+	// CAPTCHA response of the client, checked when CODE_EXCHANGE_CAPTCHA_URL is set
+	HeaderCaptchaToken = "X-Captcha-Token"
+
+	captchaTimeout = 10 * time.Second
+)
+
+// Attempts to exchange a room code for an auth token, limited per caller IP and per code.
+// A rate of zero disables a limit.
+var exchangeLimits = sync.OnceValue(func() [2]*ratelimit.Limiter {
+	limiter := func(rateKey, burstKey string, rate float64, burst int) *ratelimit.Limiter {
+		if rate = helpers.GetEnvironmentFloat(rateKey, rate); rate <= 0 {
+			return nil
+		}
+		return ratelimit.NewLimiter(rate, helpers.GetEnvironmentInt(burstKey, burst))
+	}
+	return [2]*ratelimit.Limiter{
+		limiter("CODE_EXCHANGE_RATE_LIMIT_IP", "CODE_EXCHANGE_RATE_LIMIT_IP_BURST", 0.2, 10),
+		limiter("CODE_EXCHANGE_RATE_LIMIT_CODE", "CODE_EXCHANGE_RATE_LIMIT_CODE_BURST", 1, 20),
+	}
+})
+
+// Codes that are never or exclusively exchanged for auth tokens, as exact codes or path.Match patterns
+type CodeAccessList struct {
+	Allow []string `json:"allow"`
+	Deny  []string `json:"deny"`
+}
+
+type accessListStore struct {
+	mu       sync.Mutex
+	document *store.Document
+	CodeAccessList
+}
+
+// Loaded on first use from CODE_ACCESS_LIST_FILE in DATA_DIR
+var accessList = sync.OnceValue(func() *accessListStore {
+	name, ok := helpers.GetEnvironmentVariable("CODE_ACCESS_LIST_FILE")
+	if !ok || name == "" {
+		name = "code_access_list.json"
+	}
+	s := &accessListStore{document: store.Open(name)}
+	if err := s.document.Load(s); err != nil {
+		log.Printf("code access list: %s: %v", s.document.Path(), err)
+	}
+	return s
+})
+
+func (s *accessListStore) get() CodeAccessList {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := CodeAccessList{Allow: []string{}, Deny: []string{}}
+	list.Allow = append(list.Allow, s.Allow...)
+	list.Deny = append(list.Deny, s.Deny...)
+	return list
+}
+
+func (s *accessListStore) set(list CodeAccessList) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.CodeAccessList = list
+	return s.document.Save(s)
+}
+
+func matchesAny(patterns []string, code string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, code); matched || pattern == code {
+			return true
+		}
+	}
+	return false
+}
+
+// Whether the access list lets the code through: not denied, and allowed when there is an allowlist
+func (l CodeAccessList) permits(code string) bool {
+	if matchesAny(l.Deny, code) {
+		return false
+	}
+	return len(l.Allow) == 0 || matchesAny(l.Allow, code)
+}
+
+// Ask a siteverify endpoint, as offered by reCAPTCHA, hCaptcha and Turnstile,
+// whether the CAPTCHA response of the client is valid
+func verifyCaptcha(ctx context.Context, verifyUrl, response, remoteIp string) error {
+	if response == "" {
+		return hmserrors.ErrCaptchaFailed
+	}
+	secret, _ := helpers.GetEnvironmentVariable("CODE_EXCHANGE_CAPTCHA_SECRET")
+	form := url.Values{"secret": {secret}, "response": {response}, "remoteip": {remoteIp}}
+
+	ctx, cancel := context.WithTimeout(ctx, captchaTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", verifyUrl, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %v", hmserrors.ErrCaptchaFailed, err)
+	}
+	defer res.Body.Close()
+
+	var verdict struct {
+		Success bool `json:"success"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&verdict); err != nil || !verdict.Success {
+		return hmserrors.ErrCaptchaFailed
+	}
+	return nil
+}
+
+// Why an exchange is refused before the code is redeemed
+type exchangeRefusal struct {
+	status     int
+	outcome    string
+	err        error
+	retryAfter time.Duration
+}
+
+// Check the limits, the verification hooks and the access list for an exchange of a code.
+// The limit per caller comes first so that callers cannot hammer the verification hooks,
+// and the limit per code last so that only verified callers use up the attempts on a code.
+func guardExchange(ctx *gin.Context, code string, limits [2]*ratelimit.Limiter) *exchangeRefusal {
+	if limits[0] != nil {
+		if ok, retryAfter := limits[0].Allow(ctx.ClientIP()); !ok {
+			return &exchangeRefusal{http.StatusTooManyRequests, ExchangeRateLimited, hmserrors.ErrRateLimited, retryAfter}
+		}
+	}
+
+	if secret, ok := helpers.GetEnvironmentVariable("CODE_EXCHANGE_SECRET"); ok && secret != "" {
+		sent := ctx.GetHeader(HeaderExchangeSecret)
+		if subtle.ConstantTimeCompare([]byte(sent), []byte(secret)) != 1 {
+			return &exchangeRefusal{http.StatusUnauthorized, ExchangeUnverified, hmserrors.ErrExchangeSecretInvalid, 0}
+		}
+	}
+	if verifyUrl, ok := helpers.GetEnvironmentVariable("CODE_EXCHANGE_CAPTCHA_URL"); ok && verifyUrl != "" {
+		if err := verifyCaptcha(ctx.Request.Context(), verifyUrl, ctx.GetHeader(HeaderCaptchaToken), ctx.ClientIP()); err != nil {
+			return &exchangeRefusal{http.StatusForbidden, ExchangeUnverified, err, 0}
+		}
+	}
+
+	if !accessList().get().permits(code) {
+		return &exchangeRefusal{http.StatusForbidden, ExchangeRefused, hmserrors.ErrRoomCodeDenied, 0}
+	}
+	if limits[1] != nil {
+		if ok, retryAfter := limits[1].Allow(code); !ok {
+			return &exchangeRefusal{http.StatusTooManyRequests, ExchangeRateLimited, hmserrors.ErrRateLimited, retryAfter}
+		}
+	}
+	return nil
+}
+
+func (r *exchangeRefusal) abort(ctx *gin.Context) {
+	if r.retryAfter > 0 {
+		ctx.Header("Retry-After", strconv.Itoa(int(math.Ceil(r.retryAfter.Seconds()))))
+	}
+	ctx.AbortWithStatusJSON(r.status, gin.H{"error": r.err.Error()})
+}
+
+// Get the codes that are denied, or exclusively allowed, to be exchanged for auth tokens
+func GetCodeAccessList(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, accessList().get())
+}
+
+// Replace the allowlist and denylist of codes
+func PutCodeAccessList(ctx *gin.Context) {
+	var rb CodeAccessList
+	if !helpers.BindJSON(ctx, &rb) {
+		return
+	}
+	var fieldErrors []helpers.FieldError
+	check := func(field string, patterns []string) {
+		for i, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil || pattern == "" {
+				fieldErrors = append(fieldErrors, helpers.FieldError{Field: fmt.Sprintf("%s[%d]", field, i), Message: "must be a code or a pattern such as abc-*"})
+			}
+		}
+	}
+	check("allow", rb.Allow)
+	check("deny", rb.Deny)
+	if len(fieldErrors) > 0 {
+		helpers.AbortWithFieldErrors(ctx, fieldErrors)
+		return
+	}
+	if rb.Allow == nil {
+		rb.Allow = []string{}
+	}
+	if rb.Deny == nil {
+		rb.Deny = []string{}
+	}
+
+	if err := accessList().set(rb); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, rb)
+}
@@ -0,0 +1,139 @@
+package roomcodes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"api/ratelimit"
+
+	"github.com/gin-gonic/gin"
+)
+
+// A router that only guards exchanges, trusting no proxies as main does by default,
+// with a siteverify endpoint that accepts the CAPTCHA response "ok"
+func guardedRouter(t *testing.T, limits [2]*ratelimit.Limiter) (*gin.Engine, *atomic.Int32) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	var verified atomic.Int32
+	captcha := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		verified.Add(1)
+		if r.PostFormValue("response") == "ok" {
+			w.Write([]byte(`{"success": true}`))
+			return
+		}
+		w.Write([]byte(`{"success": false}`))
+	}))
+	t.Cleanup(captcha.Close)
+	t.Setenv("CODE_EXCHANGE_SECRET", "s3cret")
+	t.Setenv("CODE_EXCHANGE_CAPTCHA_URL", captcha.URL)
+
+	router := gin.New()
+	if err := router.SetTrustedProxies(nil); err != nil {
+		t.Fatal(err)
+	}
+	router.POST("/room-codes/code/:code", func(ctx *gin.Context) {
+		if refusal := guardExchange(ctx, ctx.Param("code"), limits); refusal != nil {
+			ctx.Header("X-Outcome", refusal.outcome)
+			refusal.abort(ctx)
+			return
+		}
+		ctx.Status(http.StatusOK)
+	})
+	return router, &verified
+}
+
+type exchangeAttempt struct {
+	code, secret, captcha, forwardedFor string
+}
+
+func (a exchangeAttempt) send(router *gin.Engine) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/room-codes/code/"+a.code, nil)
+	req.Header.Set(HeaderExchangeSecret, a.secret)
+	req.Header.Set(HeaderCaptchaToken, a.captcha)
+	if a.forwardedFor != "" {
+		req.Header.Set("X-Forwarded-For", a.forwardedFor)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestGuardExchangeOrder(t *testing.T) {
+	t.Setenv("DATA_DIR", t.TempDir())
+	if err := accessList().set(CodeAccessList{Deny: []string{"leaked-*"}}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { accessList().set(CodeAccessList{}) })
+
+	tests := []struct {
+		name string
+		// Whether the caller or the code already used up its attempts
+		callerLimited, codeLimited bool
+		attempt                    exchangeAttempt
+		status                     int
+		outcome                    string
+		verified                   int32
+	}{
+		{"verified", false, false, exchangeAttempt{"abc-defg-hij", "s3cret", "ok", ""}, http.StatusOK, "", 1},
+		{"caller limit before the secret", true, false, exchangeAttempt{"abc-defg-hij", "", "", ""}, http.StatusTooManyRequests, ExchangeRateLimited, 0},
+		{"secret before the CAPTCHA", false, false, exchangeAttempt{"abc-defg-hij", "guess", "ok", ""}, http.StatusUnauthorized, ExchangeUnverified, 0},
+		{"CAPTCHA before the access list", false, false, exchangeAttempt{"leaked-code", "s3cret", "bot", ""}, http.StatusForbidden, ExchangeUnverified, 1},
+		{"CAPTCHA before the code limit", false, true, exchangeAttempt{"abc-defg-hij", "s3cret", "bot", ""}, http.StatusForbidden, ExchangeUnverified, 1},
+		{"access list before the code limit", false, true, exchangeAttempt{"leaked-code", "s3cret", "ok", ""}, http.StatusForbidden, ExchangeRefused, 1},
+		{"code limit", false, true, exchangeAttempt{"abc-defg-hij", "s3cret", "ok", ""}, http.StatusTooManyRequests, ExchangeRateLimited, 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			limits := [2]*ratelimit.Limiter{ratelimit.NewLimiter(0.001, 1), ratelimit.NewLimiter(0.001, 1)}
+			if test.callerLimited {
+				limits[0].Allow("192.0.2.1")
+			}
+			if test.codeLimited {
+				limits[1].Allow(test.attempt.code)
+			}
+			router, verified := guardedRouter(t, limits)
+			w := test.attempt.send(router)
+			if w.Code != test.status || w.Header().Get("X-Outcome") != test.outcome {
+				t.Errorf("status %d with outcome %q, want %d with %q: %s", w.Code, w.Header().Get("X-Outcome"), test.status, test.outcome, w.Body)
+			}
+			if test.status == http.StatusTooManyRequests && w.Header().Get("Retry-After") == "" {
+				t.Error("no Retry-After")
+			}
+			if got := verified.Load(); got != test.verified {
+				t.Errorf("CAPTCHA verified %d times, want %d", got, test.verified)
+			}
+		})
+	}
+}
+
+// Callers that fail verification cannot use up the attempts on a code and lock out its guests
+func TestGuardExchangeUnverifiedKeepCodeAttempts(t *testing.T) {
+	limits := [2]*ratelimit.Limiter{nil, ratelimit.NewLimiter(0.001, 1)}
+	router, _ := guardedRouter(t, limits)
+	for i := 0; i < 5; i++ {
+		if w := (exchangeAttempt{"abc-defg-hij", "guess", "", ""}).send(router); w.Code != http.StatusUnauthorized {
+			t.Fatalf("unverified attempt: status %d", w.Code)
+		}
+	}
+	verified := exchangeAttempt{"abc-defg-hij", "s3cret", "ok", ""}
+	if w := verified.send(router); w.Code != http.StatusOK {
+		t.Errorf("verified attempt: status %d, want %d", w.Code, http.StatusOK)
+	}
+	if w := verified.send(router); w.Code != http.StatusTooManyRequests {
+		t.Errorf("second verified attempt: status %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+}
+
+// Without trusted proxies, a forged X-Forwarded-For does not give a caller fresh attempts
+func TestGuardExchangeIgnoresForwardedFor(t *testing.T) {
+	limits := [2]*ratelimit.Limiter{ratelimit.NewLimiter(0.001, 1), nil}
+	router, _ := guardedRouter(t, limits)
+	for i, forwardedFor := range []string{"203.0.113.1", "203.0.113.2"} {
+		w := (exchangeAttempt{"abc-defg-hij", "s3cret", "ok", forwardedFor}).send(router)
+		if want := []int{http.StatusOK, http.StatusTooManyRequests}[i]; w.Code != want {
+			t.Errorf("attempt from %s: status %d, want %d", forwardedFor, w.Code, want)
+		}
+	}
+}
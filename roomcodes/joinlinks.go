@@ -0,0 +1,275 @@
+package roomcodes
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"api/helpers"
+	"api/hmserrors"
+	"api/qrcode"
+	"api/room"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	QRFormatPNG = "png"
+	QRFormatSVG = "svg"
+
+	defaultQRSize = 256
+)
+
+type JoinLinksBody struct {
+	// Roles to share the room as, every role with an enabled room code when empty.
+	// Codes are created for the given roles that have none.
+	Roles []string `json:"roles,omitempty"`
+	// Link template with {code}, {role} and {room_id}, instead of JOIN_LINK_TEMPLATE,
+	// on a host in JOIN_LINK_ALLOWED_HOSTS
+	Template string `json:"template,omitempty"`
+	// Also give each link a short link served by this service on SHORT_LINK_BASE_URL
+	Short bool `json:"short,omitempty"`
+	// Embed a QR code of each link as a data URI
+	QR     string `json:"qr,omitempty" binding:"omitempty,oneof=png svg"`
+	QRSize int    `json:"qr_size,omitempty" binding:"omitempty,gte=64,lte=2048"`
+}
+
+type JoinLinkQRQueryParam struct {
+	Format   string `form:"format" binding:"omitempty,oneof=png svg"`
+	Size     int    `form:"size" binding:"omitempty,gte=64,lte=2048"`
+	Template string `form:"template"`
+	// Encode the short link created for the join link rather than the join link
+	Short bool `form:"short"`
+}
+
+type JoinLink struct {
+	Role     string `json:"role"`
+	Code     string `json:"code"`
+	Url      string `json:"url"`
+	ShortUrl string `json:"short_url,omitempty"`
+	QR       string `json:"qr,omitempty"`
+}
+
+type JoinLinks struct {
+	RoomId string     `json:"room_id"`
+	Links  []JoinLink `json:"links"`
+}
+
+// The prebuilt app of the JOIN_LINK_SUBDOMAIN on 100ms
+func subdomainTemplate() string {
+	if subdomain, ok := helpers.GetEnvironmentVariable("JOIN_LINK_SUBDOMAIN"); ok && subdomain != "" {
+		return "https://" + subdomain + ".app.100ms.live/meeting/{code}"
+	}
+	return ""
+}
+
+// A template with every placeholder replaced by the same value
+func fillTemplate(template, value string) string {
+	return strings.NewReplacer("{code}", value, "{role}", value, "{room_id}", value).Replace(template)
+}
+
+// The host of the links of a template, empty when {code}, {role} or
+// {room_id} are part of the host
+func templateHost(template string) string {
+	empty, err := url.Parse(fillTemplate(template, ""))
+	filled, err1 := url.Parse(fillTemplate(template, "x"))
+	if err != nil || err1 != nil || empty.Host != filled.Host {
+		return ""
+	}
+	return empty.Hostname()
+}
+
+// Hosts that the link template of a request may point at: those in
+// JOIN_LINK_ALLOWED_HOSTS and those of the configured templates
+func allowedTemplateHosts() []string {
+	hosts := helpers.GetEnvironmentList("JOIN_LINK_ALLOWED_HOSTS")
+	configured, _ := helpers.GetEnvironmentVariable("JOIN_LINK_TEMPLATE")
+	for _, template := range []string{configured, subdomainTemplate()} {
+		if host := templateHost(template); host != "" {
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
+
+// The join link template of the request, JOIN_LINK_TEMPLATE, or the prebuilt
+// app of the JOIN_LINK_SUBDOMAIN on 100ms. Links may become short links that
+// this service redirects to, so templates of requests must be on an allowed host.
+func joinLinkTemplate(template string) (string, error) {
+	if template != "" {
+		if templateHost(template) == "" || !helpers.HostAllowed(fillTemplate(template, ""), allowedTemplateHosts()) {
+			return "", hmserrors.ErrJoinLinkTemplateNotAllowed
+		}
+	}
+	if template == "" {
+		template, _ = helpers.GetEnvironmentVariable("JOIN_LINK_TEMPLATE")
+	}
+	if template == "" {
+		template = subdomainTemplate()
+	}
+	if template == "" {
+		return "", hmserrors.ErrJoinLinkTemplateMissing
+	}
+	if !strings.Contains(template, "{code}") {
+		return "", hmserrors.ErrInvalidJoinLinkTemplate
+	}
+	return template, nil
+}
+
+func joinLinkUrl(template, roomId string, code room.RoomCode) string {
+	return strings.NewReplacer(
+		"{code}", url.QueryEscape(code.Code),
+		"{role}", url.QueryEscape(code.Role),
+		"{room_id}", url.QueryEscape(roomId),
+	).Replace(template)
+}
+
+// Draw a QR code of a link as a PNG or SVG image
+func drawQR(link, format string, size int) ([]byte, string, error) {
+	code, err := qrcode.Encode([]byte(link))
+	if err != nil {
+		return nil, "", err
+	}
+	if size == 0 {
+		size = defaultQRSize
+	}
+	var image bytes.Buffer
+	if format == QRFormatSVG {
+		err = code.SVG(&image, size)
+		return image.Bytes(), "image/svg+xml", err
+	}
+	err = code.PNG(&image, size)
+	return image.Bytes(), "image/png", err
+}
+
+// The enabled room code of a role, nil when it has none
+func enabledRoomCode(ctx context.Context, roomId, role string) (*room.RoomCode, error) {
+	var codes struct {
+		Data []room.RoomCode `json:"data"`
+	}
+	if err := helpers.CallApi(ctx, "GET", roomCodeBaseUrl()+"/room/"+roomId, nil, &codes); err != nil {
+		return nil, err
+	}
+	for _, code := range codes.Data {
+		if code.Enabled && code.Role == role {
+			return &code, nil
+		}
+	}
+	return nil, nil
+}
+
+// Create ready to share join links for the roles of a room, with their room
+// codes embedded, and optionally short links and QR codes of them
+func CreateJoinLinks(ctx *gin.Context) {
+	roomId, ok := ctx.Params.Get("roomId")
+	if !ok {
+		ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": hmserrors.ErrMissingRoomId})
+		return
+	}
+	var rb JoinLinksBody
+	if ctx.Request.ContentLength != 0 && !helpers.BindJSON(ctx, &rb) {
+		return
+	}
+	template, err := joinLinkTemplate(rb.Template)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+	var shortBaseUrl string
+	if rb.Short {
+		if shortBaseUrl, err = shortLinkBaseUrl(); err != nil {
+			ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	codes, err := room.EnsureRoomCodes(ctx.Request.Context(), roomId, rb.Roles)
+	if err != nil {
+		helpers.AbortWithApiError(ctx, err)
+		return
+	}
+
+	links := JoinLinks{RoomId: roomId, Links: []JoinLink{}}
+	for _, code := range codes {
+		if !code.Enabled {
+			continue
+		}
+		link := JoinLink{Role: code.Role, Code: code.Code, Url: joinLinkUrl(template, roomId, code)}
+		qrLink := link.Url
+		if rb.Short {
+			slug, err := shortLinks().shorten(link.Url, roomId, code.Role)
+			if err != nil {
+				ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			link.ShortUrl = shortBaseUrl + slug
+			qrLink = link.ShortUrl
+		}
+		if rb.QR != "" {
+			image, contentType, err := drawQR(qrLink, rb.QR, rb.QRSize)
+			if err != nil {
+				ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+				return
+			}
+			link.QR = "data:" + contentType + ";base64," + base64.StdEncoding.EncodeToString(image)
+		}
+		links.Links = append(links.Links, link)
+	}
+	ctx.JSON(http.StatusOK, links)
+}
+
+// Get the QR code of the join link of a role as a PNG or SVG image, or of the
+// short link created for it
+func GetJoinLinkQR(ctx *gin.Context) {
+	roomId, ok := ctx.Params.Get("roomId")
+	role, ok1 := ctx.Params.Get("role")
+	if !ok || !ok1 {
+		ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": hmserrors.ErrMissingRoomIdAndRole})
+		return
+	}
+	var param JoinLinkQRQueryParam
+	if err := ctx.ShouldBindQuery(&param); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	template, err := joinLinkTemplate(param.Template)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+
+	code, err := enabledRoomCode(ctx.Request.Context(), roomId, role)
+	if err != nil {
+		helpers.AbortWithApiError(ctx, err)
+		return
+	}
+	if code == nil {
+		ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": hmserrors.ErrRoomCodeNotFound.Error()})
+		return
+	}
+
+	link := joinLinkUrl(template, roomId, *code)
+	if param.Short {
+		// Short links are only created by POST
+		slug, ok := shortLinks().find(link)
+		if !ok {
+			ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": hmserrors.ErrShortLinkNotCreated.Error()})
+			return
+		}
+		base, err := shortLinkBaseUrl()
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return
+		}
+		link = base + slug
+	}
+	image, contentType, err := drawQR(link, param.Format, param.Size)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.Data(http.StatusOK, contentType, image)
+}
@@ -0,0 +1,50 @@
+package roomcodes
+
+import (
+	"testing"
+
+	"api/hmserrors"
+)
+
+func TestJoinLinkTemplate(t *testing.T) {
+	t.Setenv("JOIN_LINK_TEMPLATE", "https://join.example.com/{code}")
+	t.Setenv("JOIN_LINK_SUBDOMAIN", "acme")
+	t.Setenv("JOIN_LINK_ALLOWED_HOSTS", "*.events.example.org, example.net")
+	tests := []struct {
+		template string
+		want     string
+		err      error
+	}{
+		{"", "https://join.example.com/{code}", nil},
+		{"https://join.example.com/guest?code={code}&role={role}", "https://join.example.com/guest?code={code}&role={role}", nil},
+		{"https://acme.app.100ms.live/preview/{code}", "https://acme.app.100ms.live/preview/{code}", nil},
+		{"https://summit.events.example.org/{room_id}/{code}", "https://summit.events.example.org/{room_id}/{code}", nil},
+		{"http://example.net/j?c={code}", "http://example.net/j?c={code}", nil},
+		{"https://example.net/j", "", hmserrors.ErrInvalidJoinLinkTemplate},
+		{"https://evil.test/{code}", "", hmserrors.ErrJoinLinkTemplateNotAllowed},
+		{"https://example.net.evil.test/{code}", "", hmserrors.ErrJoinLinkTemplateNotAllowed},
+		{"https://example.net{role}/{code}", "", hmserrors.ErrJoinLinkTemplateNotAllowed},
+		{"https://{role}/{code}", "", hmserrors.ErrJoinLinkTemplateNotAllowed},
+		{"https://example.net@evil.test/{code}", "", hmserrors.ErrJoinLinkTemplateNotAllowed},
+		{"javascript://example.net/%0A{code}", "", hmserrors.ErrJoinLinkTemplateNotAllowed},
+		{"/relative/{code}", "", hmserrors.ErrJoinLinkTemplateNotAllowed},
+	}
+	for _, test := range tests {
+		got, err := joinLinkTemplate(test.template)
+		if got != test.want || err != test.err {
+			t.Errorf("joinLinkTemplate(%q) = %q, %v, want %q, %v", test.template, got, err, test.want, test.err)
+		}
+	}
+}
+
+func TestJoinLinkTemplateWithoutAllowedHosts(t *testing.T) {
+	t.Setenv("JOIN_LINK_TEMPLATE", "")
+	t.Setenv("JOIN_LINK_SUBDOMAIN", "")
+	t.Setenv("JOIN_LINK_ALLOWED_HOSTS", "")
+	if _, err := joinLinkTemplate("https://example.com/{code}"); err != hmserrors.ErrJoinLinkTemplateNotAllowed {
+		t.Errorf("error %v, want %v", err, hmserrors.ErrJoinLinkTemplateNotAllowed)
+	}
+	if _, err := joinLinkTemplate(""); err != hmserrors.ErrJoinLinkTemplateMissing {
+		t.Errorf("error %v, want %v", err, hmserrors.ErrJoinLinkTemplateMissing)
+	}
+}
@@ -0,0 +1,343 @@
+package roomcodes
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"api/helpers"
+	"api/hmserrors"
+	"api/schedule"
+	"api/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// A recurring window a room code can be redeemed in, e.g. cron
+// "0 9 * * mon-fri" with duration "8h" for office hours
+type CodeWindow struct {
+	Cron     string `json:"cron" binding:"required"`
+	Duration string `json:"duration" binding:"required"`
+}
+
+// Limits on redeeming a room code for an auth token, kept by this service
+type CodePolicy struct {
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// Auth tokens the code can be exchanged for, 1 for a single-use code
+	MaxRedemptions int          `json:"max_redemptions,omitempty" binding:"omitempty,gte=1"`
+	Windows        []CodeWindow `json:"windows,omitempty" binding:"omitempty,max=20,dive"`
+	// IANA time zone the windows are evaluated in, UTC by default
+	Timezone string `json:"timezone,omitempty"`
+}
+
+type RoomCodePolicyBody struct {
+	CodePolicy
+	// Room and role of the code, to purge cached room codes when it is disabled
+	RoomId string `json:"room_id,omitempty"`
+	Role   string `json:"role,omitempty"`
+}
+
+type RoomCodePolicy struct {
+	Code   string `json:"code"`
+	RoomId string `json:"room_id,omitempty"`
+	Role   string `json:"role,omitempty"`
+	CodePolicy
+	Redemptions int       `json:"redemptions"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	// When the code was disabled in 100ms for expiring or being used up
+	DisabledAt *time.Time `json:"disabled_at,omitempty"`
+	LastError  string     `json:"last_error,omitempty"`
+}
+
+type RoomCodePolicyQueryParam struct {
+	RoomId string `form:"room_id"`
+}
+
+// Parse the windows of the policy, reporting each invalid field
+func (p *CodePolicy) check() []helpers.FieldError {
+	var fieldErrors []helpers.FieldError
+	invalid := func(field, message string) {
+		fieldErrors = append(fieldErrors, helpers.FieldError{Field: field, Message: message})
+	}
+
+	location, err := time.LoadLocation(p.Timezone)
+	if err != nil {
+		invalid("timezone", "must be an IANA time zone such as Europe/Berlin")
+	}
+	for i, window := range p.Windows {
+		if duration, err := time.ParseDuration(window.Duration); err != nil || duration <= 0 {
+			invalid(fmt.Sprintf("windows[%d].duration", i), "must be a duration such as 8h")
+		}
+		if location != nil {
+			if _, err := schedule.ParseCron(window.Cron, location); err != nil {
+				invalid(fmt.Sprintf("windows[%d].cron", i), err.Error())
+			}
+		}
+	}
+	return fieldErrors
+}
+
+// Whether now is in one of the windows of the policy, or it has none
+func (p *CodePolicy) inWindow(now time.Time) bool {
+	if len(p.Windows) == 0 {
+		return true
+	}
+	location, _ := time.LoadLocation(p.Timezone)
+	for _, window := range p.Windows {
+		recurrence, err := schedule.ParseCron(window.Cron, location)
+		duration, _ := time.ParseDuration(window.Duration)
+		if err != nil || duration <= 0 {
+			continue
+		}
+		if start, ok := recurrence.Next(now.Add(-duration)); ok && !start.After(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// Why the code cannot be redeemed at the given time, nil when it can
+func (p *RoomCodePolicy) refusal(now time.Time) error {
+	if p.ExpiresAt != nil && !now.Before(*p.ExpiresAt) {
+		return hmserrors.ErrRoomCodeExpired
+	}
+	if p.MaxRedemptions > 0 && p.Redemptions >= p.MaxRedemptions {
+		return hmserrors.ErrRoomCodeUsedUp
+	}
+	if !p.inWindow(now) {
+		return hmserrors.ErrRoomCodeOutsideWindow
+	}
+	return nil
+}
+
+// Whether the code is to be disabled in 100ms, never to be redeemed again
+func (p *RoomCodePolicy) spent(now time.Time) bool {
+	return p.ExpiresAt != nil && !now.Before(*p.ExpiresAt) ||
+		p.MaxRedemptions > 0 && p.Redemptions >= p.MaxRedemptions
+}
+
+type policyStore struct {
+	mu       sync.Mutex
+	document *store.Document
+	Policies map[string]*RoomCodePolicy `json:"policies"`
+}
+
+// Loaded on first use from ROOM_CODE_POLICIES_FILE in DATA_DIR
+var policies = sync.OnceValue(func() *policyStore {
+	name, ok := helpers.GetEnvironmentVariable("ROOM_CODE_POLICIES_FILE")
+	if !ok || name == "" {
+		name = "room_code_policies.json"
+	}
+	s := &policyStore{document: store.Open(name), Policies: map[string]*RoomCodePolicy{}}
+	if err := s.document.Load(s); err != nil {
+		log.Printf("room code policies: %s: %v", s.document.Path(), err)
+	}
+	if s.Policies == nil {
+		s.Policies = map[string]*RoomCodePolicy{}
+	}
+	return s
+})
+
+// Save the policies; the caller holds the lock
+func (s *policyStore) save() {
+	if err := s.document.Save(s); err != nil {
+		log.Printf("room code policies: %s: %v", s.document.Path(), err)
+	}
+}
+
+// Set the policy of a code, keeping the count of its redemptions
+func (s *policyStore) set(code, roomId, role string, policy CodePolicy) RoomCodePolicy {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now().UTC()
+	existing, ok := s.Policies[code]
+	if !ok {
+		existing = &RoomCodePolicy{Code: code, CreatedAt: now}
+		s.Policies[code] = existing
+	}
+	if roomId != "" {
+		existing.RoomId = roomId
+	}
+	if role != "" {
+		existing.Role = role
+	}
+	existing.CodePolicy = policy
+	existing.UpdatedAt = now
+	s.save()
+	return *existing
+}
+
+func (s *policyStore) get(code string) (RoomCodePolicy, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if policy, ok := s.Policies[code]; ok {
+		return *policy, true
+	}
+	return RoomCodePolicy{}, false
+}
+
+func (s *policyStore) delete(code string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.Policies[code]; !ok {
+		return false
+	}
+	delete(s.Policies, code)
+	s.save()
+	return true
+}
+
+// Copies of the policies of the codes of a room, or of every code when roomId is empty
+func (s *policyStore) list(roomId string) []RoomCodePolicy {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := []RoomCodePolicy{}
+	for _, policy := range s.Policies {
+		if roomId == "" || policy.RoomId == roomId {
+			list = append(list, *policy)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.Before(list[j].CreatedAt)
+	})
+	return list
+}
+
+// Count a redemption of the code, unless its policy refuses it. Codes without a policy are not limited.
+func (s *policyStore) redeem(code string, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	policy, ok := s.Policies[code]
+	if !ok {
+		return nil
+	}
+	if err := policy.refusal(now); err != nil {
+		return err
+	}
+	policy.Redemptions++
+	s.save()
+	return nil
+}
+
+// Give back a redemption that did not get an auth token
+func (s *policyStore) release(code string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if policy, ok := s.Policies[code]; ok && policy.Redemptions > 0 {
+		policy.Redemptions--
+		s.save()
+	}
+}
+
+// Copies of the policies of the codes that expired or were used up but are still enabled
+func (s *policyStore) spent(now time.Time) []RoomCodePolicy {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var list []RoomCodePolicy
+	for _, policy := range s.Policies {
+		if policy.DisabledAt == nil && policy.spent(now) {
+			list = append(list, *policy)
+		}
+	}
+	return list
+}
+
+func (s *policyStore) disabled(code string, now time.Time, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	policy, ok := s.Policies[code]
+	if !ok {
+		return
+	}
+	if err != nil {
+		policy.LastError = err.Error()
+	} else {
+		policy.DisabledAt = &now
+		policy.LastError = ""
+	}
+	s.save()
+}
+
+// Disable the codes that expired or were used up
+func (s *policyStore) tick(ctx context.Context, now time.Time, changed func(roomId string)) {
+	for _, policy := range s.spent(now) {
+		body := HMSRoomCodeUpdateRequestBody{Code: policy.Code, Enabled: false}
+		err := helpers.CallApi(ctx, "POST", roomCodeBaseUrl()+"/code", body, nil)
+		if err != nil {
+			log.Printf("room code policies: disabling %s: %v", policy.Code, err)
+		}
+		s.disabled(policy.Code, now.UTC(), err)
+		if err == nil && changed != nil {
+			changed(policy.RoomId)
+		}
+	}
+}
+
+// Disable the room codes whose policies expired or were used up every interval,
+// until the context is done. Changed is called with the room of every code
+// disabled, empty when it is not known.
+func EnforcePolicies(ctx context.Context, interval time.Duration, changed func(roomId string)) {
+	s := policies()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		s.tick(ctx, time.Now(), changed)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// List the policies of the room codes of every room, or of the room in room_id
+func ListRoomCodePolicies(ctx *gin.Context) {
+	var param RoomCodePolicyQueryParam
+	if err := ctx.ShouldBindQuery(&param); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"data": policies().list(param.RoomId)})
+}
+
+// Get the policy of a room code with the redemptions counted so far
+func GetRoomCodePolicy(ctx *gin.Context) {
+	policy, ok := policies().get(ctx.Param("code"))
+	if !ok {
+		ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": hmserrors.ErrRoomCodePolicyNotFound.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, policy)
+}
+
+// Set when and how many times a room code can be exchanged for an auth token
+func PutRoomCodePolicy(ctx *gin.Context) {
+	code, ok := ctx.Params.Get("code")
+	if !ok {
+		ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": hmserrors.ErrMissingAuthCode.Error()})
+		return
+	}
+	var rb RoomCodePolicyBody
+	if !helpers.BindJSON(ctx, &rb) {
+		return
+	}
+	if fieldErrors := rb.check(); len(fieldErrors) > 0 {
+		helpers.AbortWithFieldErrors(ctx, fieldErrors)
+		return
+	}
+	ctx.JSON(http.StatusOK, policies().set(code, rb.RoomId, rb.Role, rb.CodePolicy))
+}
+
+// Remove the policy of a room code, which stays enabled or disabled as it is
+func DeleteRoomCodePolicy(ctx *gin.Context) {
+	if !policies().delete(ctx.Param("code")) {
+		ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": hmserrors.ErrRoomCodePolicyNotFound.Error()})
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
@@ -0,0 +1,142 @@
+package roomcodes
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"api/helpers"
+	"api/hmserrors"
+	"api/store"
+)
+
+func TestCodePolicyInWindow(t *testing.T) {
+	officeHours := []CodeWindow{{Cron: "0 9 * * mon-fri", Duration: "8h"}}
+	tests := []struct {
+		name     string
+		windows  []CodeWindow
+		timezone string
+		now      string
+		want     bool
+	}{
+		{"no windows", nil, "", "2024-09-07T03:00:00Z", true},
+		{"start is in the window", officeHours, "", "2024-09-02T09:00:00Z", true},
+		{"inside", officeHours, "", "2024-09-02T16:59:59Z", true},
+		{"end is not in the window", officeHours, "", "2024-09-02T17:00:00Z", false},
+		{"before the start", officeHours, "", "2024-09-02T08:59:59Z", false},
+		{"weekend", officeHours, "", "2024-09-07T10:00:00Z", false},
+		{"in the time zone", officeHours, "Europe/Berlin", "2024-09-02T07:30:00Z", true},
+		{"outside in the time zone", officeHours, "Europe/Berlin", "2024-09-02T15:30:00Z", false},
+		{"across midnight", []CodeWindow{{Cron: "0 22 * * fri", Duration: "4h"}}, "", "2024-09-07T01:00:00Z", true},
+		{"after a window across midnight", []CodeWindow{{Cron: "0 22 * * fri", Duration: "4h"}}, "", "2024-09-07T02:00:00Z", false},
+		{"second window", []CodeWindow{{Cron: "0 9 * * mon", Duration: "1h"}, {Cron: "0 14 * * mon", Duration: "1h"}}, "", "2024-09-02T14:30:00Z", true},
+		{"between windows", []CodeWindow{{Cron: "0 9 * * mon", Duration: "1h"}, {Cron: "0 14 * * mon", Duration: "1h"}}, "", "2024-09-02T12:00:00Z", false},
+		{"windows longer than their period", []CodeWindow{{Cron: "@hourly", Duration: "90m"}}, "", "2024-09-02T12:45:00Z", true},
+		// 2024-03-10 02:00 does not exist in New York; the window opens at 03:00 EDT
+		{"opening skipped by daylight saving", []CodeWindow{{Cron: "30 2 * * *", Duration: "1h"}}, "America/New_York", "2024-03-10T07:45:00Z", true},
+		{"office hours after daylight saving starts", officeHours, "America/New_York", "2024-03-11T13:00:00Z", true},
+		{"office hours in winter time", officeHours, "America/New_York", "2024-03-08T13:30:00Z", false},
+		{"invalid windows are skipped", []CodeWindow{{Cron: "0 9 * *", Duration: "8h"}, {Cron: "0 9 * * *", Duration: "0s"}}, "", "2024-09-02T10:00:00Z", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			now, err := time.Parse(time.RFC3339, test.now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			policy := CodePolicy{Windows: test.windows, Timezone: test.timezone}
+			if got := policy.inWindow(now); got != test.want {
+				t.Errorf("inWindow(%s) = %v, want %v", test.now, got, test.want)
+			}
+		})
+	}
+}
+
+func TestCodePolicyCheck(t *testing.T) {
+	policy := CodePolicy{
+		Timezone: "Mars/Olympus",
+		Windows:  []CodeWindow{{Cron: "0 9 * * mon-fri", Duration: "8h"}, {Cron: "0 25 * * *", Duration: "-1h"}},
+	}
+	want := []helpers.FieldError{
+		{Field: "timezone", Message: "must be an IANA time zone such as Europe/Berlin"},
+		{Field: "windows[1].duration", Message: "must be a duration such as 8h"},
+	}
+	if got := policy.check(); !reflect.DeepEqual(got, want) {
+		t.Errorf("errors %+v, want %+v", got, want)
+	}
+
+	policy.Timezone = "Europe/Berlin"
+	got := policy.check()
+	if len(got) != 2 || got[1].Field != "windows[1].cron" {
+		t.Errorf("errors %+v, want ones for windows[1].duration and windows[1].cron", got)
+	}
+}
+
+func TestRoomCodePolicyRefusal(t *testing.T) {
+	now := time.Date(2024, 9, 2, 10, 0, 0, 0, time.UTC)
+	past, future := now.Add(-time.Minute), now.Add(time.Minute)
+	closed := []CodeWindow{{Cron: "0 20 * * *", Duration: "1h"}}
+	tests := []struct {
+		name   string
+		policy RoomCodePolicy
+		want   error
+		spent  bool
+	}{
+		{"no limits", RoomCodePolicy{}, nil, false},
+		{"not expired yet", RoomCodePolicy{CodePolicy: CodePolicy{ExpiresAt: &future}}, nil, false},
+		{"expired", RoomCodePolicy{CodePolicy: CodePolicy{ExpiresAt: &past}}, hmserrors.ErrRoomCodeExpired, true},
+		{"expiring now", RoomCodePolicy{CodePolicy: CodePolicy{ExpiresAt: &now}}, hmserrors.ErrRoomCodeExpired, true},
+		{"redemptions left", RoomCodePolicy{CodePolicy: CodePolicy{MaxRedemptions: 2}, Redemptions: 1}, nil, false},
+		{"used up", RoomCodePolicy{CodePolicy: CodePolicy{MaxRedemptions: 1}, Redemptions: 1}, hmserrors.ErrRoomCodeUsedUp, true},
+		// Outside a window the code can still be redeemed later, so it is not disabled
+		{"outside the windows", RoomCodePolicy{CodePolicy: CodePolicy{Windows: closed}}, hmserrors.ErrRoomCodeOutsideWindow, false},
+		{"expiry comes first", RoomCodePolicy{CodePolicy: CodePolicy{ExpiresAt: &past, MaxRedemptions: 1, Windows: closed}, Redemptions: 1}, hmserrors.ErrRoomCodeExpired, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.policy.refusal(now); err != test.want {
+				t.Errorf("refusal %v, want %v", err, test.want)
+			}
+			if spent := test.policy.spent(now); spent != test.spent {
+				t.Errorf("spent %v, want %v", spent, test.spent)
+			}
+		})
+	}
+}
+
+func TestPolicyStoreRedeem(t *testing.T) {
+	t.Setenv("DATA_DIR", t.TempDir())
+	s := &policyStore{document: store.Open("room_code_policies.json"), Policies: map[string]*RoomCodePolicy{}}
+	now := time.Date(2024, 9, 2, 10, 0, 0, 0, time.UTC)
+	s.set("single", "room", "guest", CodePolicy{MaxRedemptions: 1, Windows: []CodeWindow{{Cron: "0 9 * * *", Duration: "2h"}}})
+
+	if err := s.redeem("unlimited", now); err != nil {
+		t.Errorf("a code without a policy was refused: %v", err)
+	}
+	if err := s.redeem("single", now.Add(2*time.Hour)); err != hmserrors.ErrRoomCodeOutsideWindow {
+		t.Errorf("redeemed outside the window: %v", err)
+	}
+	if err := s.redeem("single", now); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.redeem("single", now); err != hmserrors.ErrRoomCodeUsedUp {
+		t.Errorf("redeemed twice: %v", err)
+	}
+	if spent := s.spent(now); len(spent) != 1 || spent[0].Code != "single" {
+		t.Errorf("spent codes %+v, want single", spent)
+	}
+
+	// A redemption that did not get an auth token is given back
+	s.release("single")
+	if err := s.redeem("single", now); err != nil {
+		t.Errorf("not redeemable after a release: %v", err)
+	}
+
+	loaded := &policyStore{document: s.document}
+	if err := loaded.document.Load(loaded); err != nil {
+		t.Fatal(err)
+	}
+	if policy := loaded.Policies["single"]; policy == nil || policy.Redemptions != 1 || policy.RoomId != "room" {
+		t.Errorf("saved policy %+v, want one redemption in room", policy)
+	}
+}
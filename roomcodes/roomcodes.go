@@ -3,8 +3,11 @@ package roomcodes
 import (
 	"api/helpers"
 	"api/hmserrors"
+	"api/room"
 	"bytes"
+	"io"
 	"net/http"
+	"time"
 
 	"encoding/json"
 
@@ -16,8 +19,14 @@ type HMSRoomCodeUpdateRequestBody struct {
 	Enabled bool   `json:"enabled"`
 }
 
-var roomCodeBaseUrl = helpers.GetEndpointUrl("room-codes")
-var authBaseUrl, _ = helpers.GetEnvironmentVariable("AUTH_BASE_URL")
+func roomCodeBaseUrl() string {
+	return helpers.GetEndpointUrl("room-codes")
+}
+
+func authBaseUrl() string {
+	url, _ := helpers.GetEnvironmentVariable("AUTH_BASE_URL")
+	return url
+}
 
 // Get room codes
 func GetRoomCode(ctx *gin.Context) {
@@ -26,7 +35,7 @@ func GetRoomCode(ctx *gin.Context) {
 		ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": hmserrors.ErrMissingRoomId})
 	}
 
-	helpers.MakeApiRequest(ctx, roomCodeBaseUrl+"/room/"+roomId, "GET", nil)
+	helpers.MakeApiRequest(ctx, roomCodeBaseUrl()+"/room/"+roomId, "GET", nil)
 }
 
 // Create room code for all roles
@@ -37,7 +46,11 @@ func CreateRoomCode(ctx *gin.Context) {
 		ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": hmserrors.ErrMissingRoomId})
 	}
 
-	helpers.MakeApiRequest(ctx, roomCodeBaseUrl+"/room/"+roomId, "POST", nil)
+	if ctx.Request.ContentLength != 0 {
+		createRoomCodesWithPolicy(ctx, roomCodeBaseUrl()+"/room/"+roomId, roomId)
+		return
+	}
+	helpers.MakeApiRequest(ctx, roomCodeBaseUrl()+"/room/"+roomId, "POST", nil)
 }
 
 // Create room code for a given role
@@ -47,7 +60,11 @@ func CreateRoomCodeForRole(ctx *gin.Context) {
 	if !ok || !ok1 {
 		ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": hmserrors.ErrMissingRoomIdAndRole})
 	}
-	helpers.MakeApiRequest(ctx, roomCodeBaseUrl+"/room/"+roomId+"/role/"+role, "POST", nil)
+	if ctx.Request.ContentLength != 0 {
+		createRoomCodesWithPolicy(ctx, roomCodeBaseUrl()+"/room/"+roomId+"/role/"+role, roomId)
+		return
+	}
+	helpers.MakeApiRequest(ctx, roomCodeBaseUrl()+"/room/"+roomId+"/role/"+role, "POST", nil)
 }
 
 // Create room code for a given role
@@ -62,18 +79,99 @@ func UpdateRoomCode(ctx *gin.Context) {
 		Enabled: rb.Enabled,
 	})
 	payload := bytes.NewBuffer(postBody)
-	helpers.MakeApiRequest(ctx, roomCodeBaseUrl+"/code", "POST", payload)
+	helpers.MakeApiRequest(ctx, roomCodeBaseUrl()+"/code", "POST", payload)
 }
 
+// Exchange a room code for an auth token, within the attempt limits, verification
+// hooks and access list of exchanges and the policy of the code. Every attempt is recorded.
 func CreateShortCodeAuthToken(ctx *gin.Context) {
 	code, ok := ctx.Params.Get("code")
 	if !ok {
 		ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": hmserrors.ErrMissingAuthCode})
 	}
+	exchange := CodeExchange{At: time.Now().UTC(), Code: code, IP: ctx.ClientIP(), UserAgent: ctx.Request.UserAgent()}
+	if policy, ok := policies().get(code); ok {
+		exchange.RoomId, exchange.Role = policy.RoomId, policy.Role
+	}
+	defer func() {
+		exchange.Status = ctx.Writer.Status()
+		exchanges().record(exchange)
+	}()
+
+	if refusal := guardExchange(ctx, code, exchangeLimits()); refusal != nil {
+		exchange.Outcome, exchange.Error = refusal.outcome, refusal.err.Error()
+		refusal.abort(ctx)
+		return
+	}
+	if err := policies().redeem(code, time.Now()); err != nil {
+		exchange.Outcome, exchange.Error = ExchangeRefused, err.Error()
+		ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
 
 	postBody, _ := json.Marshal(map[string]string{
 		"code": code,
 	})
-	payload := bytes.NewBuffer(postBody)
-	helpers.MakeApiRequest(ctx, authBaseUrl+"token", "POST", payload)
+	res, err := helpers.DoApiRequest(ctx.Request.Context(), "POST", authBaseUrl()+"token", bytes.NewBuffer(postBody))
+	if err != nil {
+		policies().release(code)
+		exchange.Outcome, exchange.Error = ExchangeFailed, err.Error()
+		helpers.AbortWithApiError(ctx, err)
+		return
+	}
+	defer res.Body.Close()
+	resp, err := io.ReadAll(res.Body)
+	if err != nil {
+		policies().release(code)
+		exchange.Outcome, exchange.Error = ExchangeFailed, err.Error()
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		// A code that does not exist or is disabled does not count as a redemption
+		policies().release(code)
+		exchange.Outcome = ExchangeFailed
+	} else {
+		exchange.Outcome = ExchangeIssued
+		if roomId, role := tokenClaims(resp); role != "" {
+			exchange.RoomId, exchange.Role = roomId, role
+		}
+	}
+	ctx.Data(res.StatusCode, gin.MIMEJSON, resp)
+}
+
+// Create room codes and give each the policy in the request body
+func createRoomCodesWithPolicy(ctx *gin.Context, url, roomId string) {
+	var rb CodePolicy
+	if !helpers.BindJSON(ctx, &rb) {
+		return
+	}
+	if fieldErrors := rb.check(); len(fieldErrors) > 0 {
+		helpers.AbortWithFieldErrors(ctx, fieldErrors)
+		return
+	}
+
+	var response json.RawMessage
+	if err := helpers.CallApi(ctx.Request.Context(), "POST", url, nil, &response); err != nil {
+		helpers.AbortWithApiError(ctx, err)
+		return
+	}
+	// Every role gets a list of codes, a single role a code
+	var created struct {
+		room.RoomCode
+		Data []room.RoomCode `json:"data"`
+	}
+	if err := json.Unmarshal(response, &created); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	codes := created.Data
+	if created.Code != "" {
+		codes = append(codes, created.RoomCode)
+	}
+	for _, code := range codes {
+		policies().set(code.Code, roomId, code.Role, rb)
+	}
+	ctx.Data(http.StatusOK, gin.MIMEJSON, response)
 }
@@ -0,0 +1,478 @@
+package roomcodes
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"api/helpers"
+	"api/hmserrors"
+	"api/room"
+	"api/schedule"
+	"api/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	RotationManual    = "manual"
+	RotationScheduled = "scheduled"
+
+	rotatedEvent    = "room_code.rotated"
+	signatureHeader = "X-Hms-Signature"
+	webhookTimeout  = 10 * time.Second
+)
+
+// Outcome of replacing the room code of a role with a fresh one
+type RotatedRoomCode struct {
+	RoomId string `json:"room_id"`
+	Role   string `json:"role"`
+	Code   string `json:"code"`
+	// Previous codes of the role, disabled in 100ms
+	Disabled  []string  `json:"disabled"`
+	Trigger   string    `json:"trigger"`
+	RotatedAt time.Time `json:"rotated_at"`
+	// Set when the new code was created but a previous one could not be disabled
+	Error        string `json:"error,omitempty"`
+	WebhookError string `json:"webhook_error,omitempty"`
+}
+
+type RotateRoomCodeBody struct {
+	// Notified of the new code instead of the webhook of the room's rotation or ROOM_CODE_WEBHOOK_URL
+	WebhookUrl string `json:"webhook_url,omitempty" binding:"omitempty,url"`
+}
+
+// Scheduled rotation of the room codes of a room
+type RoomCodeRotation struct {
+	RoomId string `json:"room_id"`
+	// Roles to rotate, every role with an enabled room code when empty
+	Roles    []string `json:"roles,omitempty"`
+	Cron     string   `json:"cron"`
+	Timezone string   `json:"timezone,omitempty"`
+	// Notified of every new code, ROOM_CODE_WEBHOOK_URL when empty
+	WebhookUrl string     `json:"webhook_url,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastRunAt  *time.Time `json:"last_run_at,omitempty"`
+	LastError  string     `json:"last_error,omitempty"`
+}
+
+type RoomCodeRotationBody struct {
+	Roles []string `json:"roles,omitempty"`
+	// When to rotate, e.g. "@daily" or "0 3 * * *" for nightly
+	Cron       string `json:"cron" binding:"required"`
+	Timezone   string `json:"timezone,omitempty"`
+	WebhookUrl string `json:"webhook_url,omitempty" binding:"omitempty,url"`
+}
+
+// A rotation with when it runs next
+type RoomCodeRotationView struct {
+	RoomCodeRotation
+	NextRunAt *time.Time `json:"next_run_at,omitempty"`
+}
+
+func (r *RoomCodeRotation) nextRun() (time.Time, bool) {
+	location, err := time.LoadLocation(r.Timezone)
+	if err != nil {
+		return time.Time{}, false
+	}
+	recurrence, err := schedule.ParseCron(r.Cron, location)
+	if err != nil {
+		return time.Time{}, false
+	}
+	after := r.CreatedAt
+	if r.LastRunAt != nil {
+		after = *r.LastRunAt
+	}
+	return recurrence.Next(after)
+}
+
+func (r RoomCodeRotation) view() RoomCodeRotationView {
+	view := RoomCodeRotationView{RoomCodeRotation: r}
+	if next, ok := r.nextRun(); ok {
+		view.NextRunAt = &next
+	}
+	return view
+}
+
+type rotationStore struct {
+	mu        sync.Mutex
+	document  *store.Document
+	Rotations map[string]*RoomCodeRotation `json:"rotations"`
+}
+
+// Loaded on first use from ROOM_CODE_ROTATIONS_FILE in DATA_DIR
+var rotations = sync.OnceValue(func() *rotationStore {
+	name, ok := helpers.GetEnvironmentVariable("ROOM_CODE_ROTATIONS_FILE")
+	if !ok || name == "" {
+		name = "room_code_rotations.json"
+	}
+	s := &rotationStore{document: store.Open(name), Rotations: map[string]*RoomCodeRotation{}}
+	if err := s.document.Load(s); err != nil {
+		log.Printf("room code rotations: %s: %v", s.document.Path(), err)
+	}
+	if s.Rotations == nil {
+		s.Rotations = map[string]*RoomCodeRotation{}
+	}
+	return s
+})
+
+// Save the rotations; the caller holds the lock
+func (s *rotationStore) save() {
+	if err := s.document.Save(s); err != nil {
+		log.Printf("room code rotations: %s: %v", s.document.Path(), err)
+	}
+}
+
+func (s *rotationStore) set(rotation *RoomCodeRotation) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Rotations[rotation.RoomId] = rotation
+	s.save()
+}
+
+func (s *rotationStore) get(roomId string) (RoomCodeRotation, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if rotation, ok := s.Rotations[roomId]; ok {
+		return *rotation, true
+	}
+	return RoomCodeRotation{}, false
+}
+
+func (s *rotationStore) delete(roomId string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.Rotations[roomId]; !ok {
+		return false
+	}
+	delete(s.Rotations, roomId)
+	s.save()
+	return true
+}
+
+func (s *rotationStore) list() []RoomCodeRotationView {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := []RoomCodeRotationView{}
+	for _, rotation := range s.Rotations {
+		list = append(list, rotation.view())
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.Before(list[j].CreatedAt)
+	})
+	return list
+}
+
+// Copies of the rotations due at the given time
+func (s *rotationStore) due(now time.Time) []RoomCodeRotation {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var list []RoomCodeRotation
+	for _, rotation := range s.Rotations {
+		if next, ok := rotation.nextRun(); ok && !next.After(now) {
+			list = append(list, *rotation)
+		}
+	}
+	return list
+}
+
+func (s *rotationStore) ran(roomId string, now time.Time, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rotation, ok := s.Rotations[roomId]
+	if !ok {
+		return
+	}
+	rotation.LastRunAt = &now
+	rotation.LastError = ""
+	if err != nil {
+		rotation.LastError = err.Error()
+	}
+	s.save()
+}
+
+// Hosts that the webhooks of requests may point at: those in
+// ROOM_CODE_WEBHOOK_ALLOWED_HOSTS and the host of ROOM_CODE_WEBHOOK_URL
+func allowedWebhookHosts() []string {
+	hosts := helpers.GetEnvironmentList("ROOM_CODE_WEBHOOK_ALLOWED_HOSTS")
+	if configured, _ := helpers.GetEnvironmentVariable("ROOM_CODE_WEBHOOK_URL"); configured != "" {
+		if parsed, err := url.Parse(configured); err == nil && parsed.Hostname() != "" {
+			hosts = append(hosts, parsed.Hostname())
+		}
+	}
+	return hosts
+}
+
+// New codes are posted to webhooks, so those of requests must be on an allowed host
+func webhookAllowed(webhook string) bool {
+	return webhook == "" || helpers.HostAllowed(webhook, allowedWebhookHosts())
+}
+
+var webhookUrlError = helpers.FieldError{Field: "webhook_url", Message: hmserrors.ErrWebhookNotAllowed.Error()}
+
+// The webhook of the request, of the room's rotation, or ROOM_CODE_WEBHOOK_URL.
+// Rotations saved before the allowlist may name a webhook that is no longer allowed.
+func webhookUrl(roomId, requested string) (string, error) {
+	if requested == "" {
+		if rotation, ok := rotations().get(roomId); ok {
+			requested = rotation.WebhookUrl
+		}
+	}
+	if requested != "" {
+		if !webhookAllowed(requested) {
+			return "", hmserrors.ErrWebhookNotAllowed
+		}
+		return requested, nil
+	}
+	webhook, _ := helpers.GetEnvironmentVariable("ROOM_CODE_WEBHOOK_URL")
+	return webhook, nil
+}
+
+// Post a rotation to a webhook, signed with ROOM_CODE_WEBHOOK_SECRET when it is set
+func notify(ctx context.Context, webhook string, rotated RotatedRoomCode) error {
+	body, _ := json.Marshal(struct {
+		Event string `json:"event"`
+		RotatedRoomCode
+	}{rotatedEvent, rotated})
+
+	ctx, cancel := context.WithTimeout(ctx, webhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", webhook, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if secret, ok := helpers.GetEnvironmentVariable("ROOM_CODE_WEBHOOK_SECRET"); ok && secret != "" {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+		req.Header.Set(signatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("webhook answered %s", res.Status)
+	}
+	return nil
+}
+
+// Create a fresh room code for a role and disable the codes it had before. The
+// new code gets the policy of a previous one. Errors after the new code was
+// created are reported in the result.
+func Rotate(ctx context.Context, roomId, role, trigger, webhook string) (RotatedRoomCode, error) {
+	rotated := RotatedRoomCode{RoomId: roomId, Role: role, Disabled: []string{}, Trigger: trigger}
+
+	var codes struct {
+		Data []room.RoomCode `json:"data"`
+	}
+	if err := helpers.CallApi(ctx, "GET", roomCodeBaseUrl()+"/room/"+roomId, nil, &codes); err != nil {
+		return rotated, err
+	}
+	var fresh room.RoomCode
+	if err := helpers.CallApi(ctx, "POST", roomCodeBaseUrl()+"/room/"+roomId+"/role/"+url.PathEscape(role), nil, &fresh); err != nil {
+		return rotated, err
+	}
+	rotated.Code = fresh.Code
+	rotated.RotatedAt = time.Now().UTC()
+
+	var failed []string
+	for _, code := range codes.Data {
+		if !code.Enabled || code.Role != role || code.Code == fresh.Code {
+			continue
+		}
+		if policy, ok := policies().get(code.Code); ok {
+			if _, ok := policies().get(fresh.Code); !ok {
+				policies().set(fresh.Code, roomId, role, policy.CodePolicy)
+			}
+		}
+		body := HMSRoomCodeUpdateRequestBody{Code: code.Code, Enabled: false}
+		if err := helpers.CallApi(ctx, "POST", roomCodeBaseUrl()+"/code", body, nil); err != nil {
+			failed = append(failed, fmt.Sprintf("disabling %s: %v", code.Code, err))
+			continue
+		}
+		rotated.Disabled = append(rotated.Disabled, code.Code)
+	}
+	rotated.Error = strings.Join(failed, "; ")
+
+	webhook, err := webhookUrl(roomId, webhook)
+	if err != nil {
+		rotated.WebhookError = err.Error()
+	} else if webhook != "" {
+		if err := notify(ctx, webhook, rotated); err != nil {
+			rotated.WebhookError = err.Error()
+		}
+	}
+	return rotated, nil
+}
+
+// Rotate the roles of a rotation, every role with an enabled code when it names none
+func (r *RoomCodeRotation) run(ctx context.Context) ([]RotatedRoomCode, error) {
+	roles := r.Roles
+	if len(roles) == 0 {
+		var codes struct {
+			Data []room.RoomCode `json:"data"`
+		}
+		if err := helpers.CallApi(ctx, "GET", roomCodeBaseUrl()+"/room/"+r.RoomId, nil, &codes); err != nil {
+			return nil, err
+		}
+		seen := map[string]bool{}
+		for _, code := range codes.Data {
+			if code.Enabled && !seen[code.Role] {
+				seen[code.Role] = true
+				roles = append(roles, code.Role)
+			}
+		}
+	}
+
+	var results []RotatedRoomCode
+	var failed []string
+	for _, role := range roles {
+		rotated, err := Rotate(ctx, r.RoomId, role, RotationScheduled, r.WebhookUrl)
+		if err == nil && rotated.Error != "" {
+			err = fmt.Errorf("%s", rotated.Error)
+		}
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("role %s: %v", role, err))
+		}
+		if rotated.Code != "" {
+			results = append(results, rotated)
+		}
+	}
+	if len(failed) > 0 {
+		return results, fmt.Errorf("%s", strings.Join(failed, "; "))
+	}
+	return results, nil
+}
+
+// Rotate the room codes of the rooms whose rotation is due, checking every
+// interval until the context is done. Changed is called with the id of every
+// room whose codes were rotated.
+func RotateOnSchedule(ctx context.Context, interval time.Duration, changed func(roomId string)) {
+	s := rotations()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		now := time.Now()
+		for _, rotation := range s.due(now) {
+			results, err := rotation.run(ctx)
+			if err != nil {
+				log.Printf("room code rotations: room %s: %v", rotation.RoomId, err)
+			}
+			s.ran(rotation.RoomId, now.UTC(), err)
+			if len(results) > 0 && changed != nil {
+				changed(rotation.RoomId)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Replace the room code of a role with a fresh one, disabling the previous
+// codes, and notify the webhook of the new code
+func RotateRoomCode(ctx *gin.Context) {
+	roomId, ok := ctx.Params.Get("roomId")
+	role, ok1 := ctx.Params.Get("role")
+	if !ok || !ok1 {
+		ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": hmserrors.ErrMissingRoomIdAndRole})
+		return
+	}
+	var rb RotateRoomCodeBody
+	if ctx.Request.ContentLength != 0 && !helpers.BindJSON(ctx, &rb) {
+		return
+	}
+	if !webhookAllowed(rb.WebhookUrl) {
+		helpers.AbortWithFieldErrors(ctx, []helpers.FieldError{webhookUrlError})
+		return
+	}
+
+	rotated, err := Rotate(ctx.Request.Context(), roomId, role, RotationManual, rb.WebhookUrl)
+	if err != nil {
+		helpers.AbortWithApiError(ctx, err)
+		return
+	}
+	if rotated.Error != "" {
+		ctx.JSON(http.StatusMultiStatus, rotated)
+		return
+	}
+	ctx.JSON(http.StatusOK, rotated)
+}
+
+// List the scheduled rotations of every room
+func ListRoomCodeRotations(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, gin.H{"data": rotations().list()})
+}
+
+// Get the scheduled rotation of the room codes of a room
+func GetRoomCodeRotation(ctx *gin.Context) {
+	rotation, ok := rotations().get(ctx.Param("roomId"))
+	if !ok {
+		ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": hmserrors.ErrRotationNotFound.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, rotation.view())
+}
+
+// Rotate the room codes of a room on a cron schedule, replacing its previous schedule
+func PutRoomCodeRotation(ctx *gin.Context) {
+	roomId, ok := ctx.Params.Get("roomId")
+	if !ok {
+		ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": hmserrors.ErrMissingRoomId})
+		return
+	}
+	var rb RoomCodeRotationBody
+	if !helpers.BindJSON(ctx, &rb) {
+		return
+	}
+	var fieldErrors []helpers.FieldError
+	location, err := time.LoadLocation(rb.Timezone)
+	if err != nil {
+		fieldErrors = append(fieldErrors, helpers.FieldError{Field: "timezone", Message: "must be an IANA time zone such as Europe/Berlin"})
+	} else if _, err := schedule.ParseCron(rb.Cron, location); err != nil {
+		fieldErrors = append(fieldErrors, helpers.FieldError{Field: "cron", Message: err.Error()})
+	}
+	if !webhookAllowed(rb.WebhookUrl) {
+		fieldErrors = append(fieldErrors, webhookUrlError)
+	}
+	if len(fieldErrors) > 0 {
+		helpers.AbortWithFieldErrors(ctx, fieldErrors)
+		return
+	}
+
+	rotation := &RoomCodeRotation{
+		RoomId:     roomId,
+		Roles:      rb.Roles,
+		Cron:       rb.Cron,
+		Timezone:   rb.Timezone,
+		WebhookUrl: rb.WebhookUrl,
+		CreatedAt:  time.Now().UTC(),
+	}
+	rotations().set(rotation)
+	ctx.JSON(http.StatusOK, rotation.view())
+}
+
+// Stop rotating the room codes of a room
+func DeleteRoomCodeRotation(ctx *gin.Context) {
+	if !rotations().delete(ctx.Param("roomId")) {
+		ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": hmserrors.ErrRotationNotFound.Error()})
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
@@ -0,0 +1,61 @@
+package roomcodes
+
+import (
+	"testing"
+
+	"api/hmserrors"
+)
+
+func TestWebhookAllowed(t *testing.T) {
+	t.Setenv("ROOM_CODE_WEBHOOK_URL", "https://hooks.example.com/room-codes")
+	t.Setenv("ROOM_CODE_WEBHOOK_ALLOWED_HOSTS", "*.ops.example.org")
+	tests := []struct {
+		webhook string
+		want    bool
+	}{
+		{"", true},
+		{"https://hooks.example.com/other", true},
+		{"https://chat.ops.example.org/notify", true},
+		{"https://ops.example.org/notify", false},
+		{"https://evil.test/steal", false},
+		{"https://hooks.example.com@evil.test/", false},
+		{"ftp://hooks.example.com/", false},
+	}
+	for _, test := range tests {
+		if got := webhookAllowed(test.webhook); got != test.want {
+			t.Errorf("webhookAllowed(%q) = %v, want %v", test.webhook, got, test.want)
+		}
+	}
+
+	t.Setenv("ROOM_CODE_WEBHOOK_URL", "")
+	t.Setenv("ROOM_CODE_WEBHOOK_ALLOWED_HOSTS", "")
+	if webhookAllowed("https://hooks.example.com/other") {
+		t.Error("a webhook was allowed without any allowed hosts")
+	}
+}
+
+func TestWebhookUrl(t *testing.T) {
+	t.Setenv("DATA_DIR", t.TempDir())
+	t.Setenv("ROOM_CODE_WEBHOOK_URL", "https://hooks.example.com/room-codes")
+	t.Setenv("ROOM_CODE_WEBHOOK_ALLOWED_HOSTS", "")
+	rotations().set(&RoomCodeRotation{RoomId: "rotated", WebhookUrl: "https://hooks.example.com/rotated"})
+	// Saved before webhooks were checked
+	rotations().set(&RoomCodeRotation{RoomId: "legacy", WebhookUrl: "https://evil.test/steal"})
+	tests := []struct {
+		roomId, requested string
+		want              string
+		err               error
+	}{
+		{"other", "", "https://hooks.example.com/room-codes", nil},
+		{"other", "https://hooks.example.com/requested", "https://hooks.example.com/requested", nil},
+		{"other", "https://evil.test/steal", "", hmserrors.ErrWebhookNotAllowed},
+		{"rotated", "", "https://hooks.example.com/rotated", nil},
+		{"legacy", "", "", hmserrors.ErrWebhookNotAllowed},
+	}
+	for _, test := range tests {
+		got, err := webhookUrl(test.roomId, test.requested)
+		if got != test.want || err != test.err {
+			t.Errorf("webhookUrl(%q, %q) = %q, %v, want %q, %v", test.roomId, test.requested, got, err, test.want, test.err)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package roomcodes
+
+import (
+	"crypto/rand"
+	"log"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"api/helpers"
+	"api/hmserrors"
+	"api/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	slugAlphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	slugLength   = 7
+)
+
+// A join link served under a short slug by this service
+type ShortLink struct {
+	Url       string    `json:"url"`
+	RoomId    string    `json:"room_id"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type shortLinkStore struct {
+	mu       sync.Mutex
+	document *store.Document
+	Links    map[string]*ShortLink `json:"links"`
+}
+
+// Loaded on first use from SHORT_LINKS_FILE in DATA_DIR
+var shortLinks = sync.OnceValue(func() *shortLinkStore {
+	name, ok := helpers.GetEnvironmentVariable("SHORT_LINKS_FILE")
+	if !ok || name == "" {
+		name = "short_links.json"
+	}
+	s := &shortLinkStore{document: store.Open(name), Links: map[string]*ShortLink{}}
+	if err := s.document.Load(s); err != nil {
+		log.Printf("short links: %s: %v", s.document.Path(), err)
+	}
+	if s.Links == nil {
+		s.Links = map[string]*ShortLink{}
+	}
+	return s
+})
+
+func newSlug() (string, error) {
+	var slug strings.Builder
+	for i := 0; i < slugLength; i++ {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(slugAlphabet))))
+		if err != nil {
+			return "", err
+		}
+		slug.WriteByte(slugAlphabet[n.Int64()])
+	}
+	return slug.String(), nil
+}
+
+// The slug a join link was given before, if any. Called with the lock held.
+func (s *shortLinkStore) slugOf(link string) (string, bool) {
+	for slug, existing := range s.Links {
+		if existing.Url == link {
+			return slug, true
+		}
+	}
+	return "", false
+}
+
+func (s *shortLinkStore) find(link string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.slugOf(link)
+}
+
+// The slug of a join link, reusing the one it was given before
+func (s *shortLinkStore) shorten(link, roomId, role string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if slug, ok := s.slugOf(link); ok {
+		return slug, nil
+	}
+
+	var slug string
+	for slug == "" || s.Links[slug] != nil {
+		var err error
+		if slug, err = newSlug(); err != nil {
+			return "", err
+		}
+	}
+	s.Links[slug] = &ShortLink{Url: link, RoomId: roomId, Role: role, CreatedAt: time.Now().UTC()}
+	if err := s.document.Save(s); err != nil {
+		delete(s.Links, slug)
+		return "", err
+	}
+	return slug, nil
+}
+
+func (s *shortLinkStore) resolve(slug string) *ShortLink {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.Links[slug]
+}
+
+// Where short links are served, from SHORT_LINK_BASE_URL. It is never taken
+// from the request, whose Host and X-Forwarded-Proto headers callers choose.
+func shortLinkBaseUrl() (string, error) {
+	base, _ := helpers.GetEnvironmentVariable("SHORT_LINK_BASE_URL")
+	if base == "" {
+		return "", hmserrors.ErrShortLinkBaseUrlMissing
+	}
+	return strings.TrimSuffix(base, "/") + "/", nil
+}
+
+// Redirect a short link to the join link it stands for
+func RedirectShortLink(ctx *gin.Context) {
+	link := shortLinks().resolve(ctx.Param("slug"))
+	if link == nil {
+		ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": hmserrors.ErrShortLinkNotFound.Error()})
+		return
+	}
+	ctx.Redirect(http.StatusFound, link.Url)
+}
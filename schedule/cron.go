@@ -0,0 +1,170 @@
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Start times of recurring windows
+type Recurrence interface {
+	// The first start strictly after the given time
+	Next(after time.Time) (time.Time, bool)
+}
+
+// A standard five field cron expression: minute, hour, day of month, month and day of week
+type cronExpression struct {
+	minute, hour, dom, month, dow uint64
+	// Whether the day of month or day of week field is *, in which case a day has
+	// to match both fields rather than either of them
+	domStar, dowStar bool
+	location         *time.Location
+}
+
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var monthNames = map[string]int{
+	"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+	"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+}
+
+var weekdayNames = map[string]int{"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6}
+
+// Parse a cron expression, evaluated in the given location. Fields take
+// numbers, names of months and weekdays, lists, ranges and steps.
+func ParseCron(expression string, location *time.Location) (Recurrence, error) {
+	if macro, ok := cronMacros[strings.TrimSpace(expression)]; ok {
+		expression = macro
+	}
+	fields := strings.Fields(expression)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression %q needs 5 fields, it has %d", expression, len(fields))
+	}
+
+	c := &cronExpression{location: location}
+	var err error
+	if c.minute, err = parseCronField(fields[0], 0, 59, nil); err != nil {
+		return nil, err
+	}
+	if c.hour, err = parseCronField(fields[1], 0, 23, nil); err != nil {
+		return nil, err
+	}
+	if c.dom, err = parseCronField(fields[2], 1, 31, nil); err != nil {
+		return nil, err
+	}
+	if c.month, err = parseCronField(fields[3], 1, 12, monthNames); err != nil {
+		return nil, err
+	}
+	if c.dow, err = parseCronField(fields[4], 0, 7, weekdayNames); err != nil {
+		return nil, err
+	}
+	// Sunday is both 0 and 7
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	c.domStar = fields[2] == "*" || fields[2] == "?"
+	c.dowStar = fields[4] == "*" || fields[4] == "?"
+	return c, nil
+}
+
+func parseCronValue(value string, names map[string]int) (int, error) {
+	if n, ok := names[strings.ToLower(value)]; ok {
+		return n, nil
+	}
+	return strconv.Atoi(value)
+}
+
+// Parse one field into a bit set of the values it matches
+func parseCronField(field string, min, max int, names map[string]int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		valueRange, stepValue, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepValue); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step in cron field %q", field)
+			}
+		}
+
+		low, high := min, max
+		if valueRange != "*" && valueRange != "?" {
+			from, to, isRange := strings.Cut(valueRange, "-")
+			var err error
+			if low, err = parseCronValue(from, names); err != nil {
+				return 0, fmt.Errorf("invalid value in cron field %q", field)
+			}
+			switch {
+			case isRange:
+				if high, err = parseCronValue(to, names); err != nil {
+					return 0, fmt.Errorf("invalid value in cron field %q", field)
+				}
+			case !hasStep:
+				high = low
+			}
+		}
+		if low < min || high > max || low > high {
+			return 0, fmt.Errorf("cron field %q is out of the range %d-%d", field, min, max)
+		}
+		for value := low; value <= high; value += step {
+			bits |= 1 << uint(value)
+		}
+	}
+	return bits, nil
+}
+
+func (c *cronExpression) dayMatches(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domStar || c.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// Times of day are walked in local time. A time skipped when clocks go forward
+// happens just after the gap, and a time repeated when they go back happens once.
+func (c *cronExpression) Next(after time.Time) (time.Time, bool) {
+	after = after.In(c.location)
+	// Expressions such as "0 0 30 2 *" never match
+	limit := after.AddDate(5, 0, 0)
+	for day := time.Date(after.Year(), after.Month(), after.Day(), 0, 0, 0, 0, c.location); day.Before(limit); day = day.AddDate(0, 0, 1) {
+		if c.month&(1<<uint(day.Month())) == 0 || !c.dayMatches(day) {
+			continue
+		}
+		for hour := 0; hour < 24; hour++ {
+			if c.hour&(1<<uint(hour)) == 0 {
+				continue
+			}
+			for minute := 0; minute < 60; minute++ {
+				if c.minute&(1<<uint(minute)) == 0 {
+					continue
+				}
+				if t := wallClock(day, hour, minute); t.After(after) {
+					return t, true
+				}
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// The time of day on the day given, in its location. time.Date puts times
+// skipped when clocks go forward before the gap; they are moved after it.
+func wallClock(day time.Time, hour, minute int) time.Time {
+	t := time.Date(day.Year(), day.Month(), day.Day(), hour, minute, 0, 0, day.Location())
+	want := time.Date(day.Year(), day.Month(), day.Day(), hour, minute, 0, 0, time.UTC)
+	got := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, time.UTC)
+	if skipped := want.Sub(got); skipped > 0 {
+		t = t.Add(skipped)
+	}
+	return t
+}
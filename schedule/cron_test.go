@@ -0,0 +1,100 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func mustLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return location
+}
+
+// Parse a local time such as "2024-03-10 09:00"
+func localTime(t *testing.T, value string, location *time.Location) time.Time {
+	t.Helper()
+	parsed, err := time.ParseInLocation("2006-01-02 15:04", value, location)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed
+}
+
+func TestParseCronNext(t *testing.T) {
+	newYork := mustLocation(t, "America/New_York")
+	santiago := mustLocation(t, "America/Santiago")
+	tests := []struct {
+		name       string
+		expression string
+		location   *time.Location
+		after      string
+		// Successive starts in RFC 3339, none when the expression never matches
+		want []string
+	}{
+		{"@daily", "@daily", time.UTC, "2024-09-01 10:00", []string{"2024-09-02T00:00:00Z", "2024-09-03T00:00:00Z"}},
+		{"@hourly", "@hourly", time.UTC, "2024-09-01 10:00", []string{"2024-09-01T11:00:00Z", "2024-09-01T12:00:00Z"}},
+		{"@weekly", "@weekly", time.UTC, "2024-09-01 10:00", []string{"2024-09-08T00:00:00Z"}},
+		{"@monthly", "@monthly", time.UTC, "2024-09-01 10:00", []string{"2024-10-01T00:00:00Z"}},
+		{"@yearly", "@yearly", time.UTC, "2024-09-01 10:00", []string{"2025-01-01T00:00:00Z"}},
+		{"@annually", "@annually", time.UTC, "2024-09-01 10:00", []string{"2025-01-01T00:00:00Z"}},
+		{"strictly after", "0 10 * * *", time.UTC, "2024-09-01 10:00", []string{"2024-09-02T10:00:00Z"}},
+		// 2024-09-01 is a Sunday; the 13th is a Friday
+		{"day of month or day of week", "0 9 13 * 5", time.UTC, "2024-09-01 00:00", []string{"2024-09-06T09:00:00Z", "2024-09-13T09:00:00Z", "2024-09-20T09:00:00Z", "2024-09-27T09:00:00Z", "2024-10-04T09:00:00Z", "2024-10-11T09:00:00Z", "2024-10-13T09:00:00Z"}},
+		{"day of month only", "0 9 13 * *", time.UTC, "2024-09-01 00:00", []string{"2024-09-13T09:00:00Z", "2024-10-13T09:00:00Z"}},
+		{"day of week only", "0 9 * * fri", time.UTC, "2024-09-01 00:00", []string{"2024-09-06T09:00:00Z", "2024-09-13T09:00:00Z"}},
+		{"day of month with ? day of week", "0 9 13 * ?", time.UTC, "2024-09-01 00:00", []string{"2024-09-13T09:00:00Z"}},
+		{"sunday as 7", "0 0 * * 7", time.UTC, "2024-09-02 00:00", []string{"2024-09-08T00:00:00Z"}},
+		{"ranges, steps and names", "*/20 9-10 * jan-mar mon-fri", time.UTC, "2024-09-01 00:00", []string{"2025-01-01T09:00:00Z", "2025-01-01T09:20:00Z", "2025-01-01T09:40:00Z", "2025-01-01T10:00:00Z"}},
+		{"stepped range", "0 8-18/5 * * *", time.UTC, "2024-09-01 09:00", []string{"2024-09-01T13:00:00Z", "2024-09-01T18:00:00Z", "2024-09-02T08:00:00Z"}},
+		{"february 30th", "0 0 30 2 *", time.UTC, "2024-01-01 00:00", nil},
+		{"daily across the start of daylight saving", "0 9 * * *", newYork, "2024-03-09 09:00", []string{"2024-03-10T09:00:00-04:00"}},
+		{"time skipped by daylight saving", "30 2 * * *", newYork, "2024-03-10 00:00", []string{"2024-03-10T03:30:00-04:00", "2024-03-11T02:30:00-04:00"}},
+		{"midnight skipped by daylight saving", "@daily", santiago, "2024-09-07 00:00", []string{"2024-09-08T01:00:00-03:00", "2024-09-09T00:00:00-03:00"}},
+		{"time repeated by daylight saving", "30 1 * * *", newYork, "2024-11-03 00:00", []string{"2024-11-03T01:30:00-04:00", "2024-11-04T01:30:00-05:00"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recurrence, err := ParseCron(test.expression, test.location)
+			if err != nil {
+				t.Fatal(err)
+			}
+			after := localTime(t, test.after, test.location)
+			for _, want := range test.want {
+				next, ok := recurrence.Next(after)
+				if !ok || next.Format(time.RFC3339) != want {
+					t.Fatalf("Next(%s) = %s, %v, want %s", after.Format(time.RFC3339), next.Format(time.RFC3339), ok, want)
+				}
+				after = next
+			}
+			if test.want == nil {
+				if next, ok := recurrence.Next(after); ok {
+					t.Errorf("Next(%s) = %s, want none", after, next)
+				}
+			}
+		})
+	}
+}
+
+func TestParseCronInvalid(t *testing.T) {
+	for _, expression := range []string{
+		"0 0 * *",
+		"@often",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"* * * foo *",
+	} {
+		if _, err := ParseCron(expression, time.UTC); err == nil {
+			t.Errorf("ParseCron(%q) succeeded", expression)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package schedule
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The part of RFC 5545 recurrence rules that timetables need: FREQ of DAILY,
+// WEEKLY or MONTHLY with INTERVAL, COUNT, UNTIL, BYDAY, BYMONTHDAY, BYHOUR
+// and BYMINUTE. The first occurrence and the default time of day come from
+// the start of the schedule.
+type recurrenceRule struct {
+	freq     string
+	interval int
+	count    int
+	until    time.Time
+	// Weekdays, with the n-th (or n-th last when negative) of the month for MONTHLY; 0 is every
+	byDay      map[time.Weekday][]int
+	byMonthDay []int
+	byHour     []int
+	byMinute   []int
+	start      time.Time
+}
+
+var rruleWeekdays = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+func parseRRuleInts(name, value string, min, max int) ([]int, error) {
+	var values []int
+	for _, part := range strings.Split(value, ",") {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < min || n > max || n == 0 && min < 0 {
+			return nil, fmt.Errorf("invalid %s %q", name, part)
+		}
+		values = append(values, n)
+	}
+	sort.Ints(values)
+	return values, nil
+}
+
+func parseRRuleUntil(value string, location *time.Location) (time.Time, error) {
+	if t, err := time.Parse("20060102T150405Z", value); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("20060102T150405", value, location); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("20060102", value, location); err == nil {
+		// The whole day is included
+		return t.AddDate(0, 0, 1).Add(-time.Second), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid UNTIL %q", value)
+}
+
+// Parse a recurrence rule such as "FREQ=WEEKLY;BYDAY=MO,WE;BYHOUR=9",
+// with or without the "RRULE:" prefix
+func ParseRRule(rule string, start time.Time, location *time.Location) (Recurrence, error) {
+	r := &recurrenceRule{interval: 1, start: start.In(location)}
+	rule = strings.TrimPrefix(strings.TrimSpace(rule), "RRULE:")
+
+	for _, part := range strings.Split(rule, ";") {
+		name, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid rule part %q", part)
+		}
+		var err error
+		switch strings.ToUpper(name) {
+		case "FREQ":
+			r.freq = strings.ToUpper(value)
+		case "INTERVAL":
+			if r.interval, err = strconv.Atoi(value); err != nil || r.interval < 1 {
+				return nil, fmt.Errorf("invalid INTERVAL %q", value)
+			}
+		case "COUNT":
+			if r.count, err = strconv.Atoi(value); err != nil || r.count < 1 {
+				return nil, fmt.Errorf("invalid COUNT %q", value)
+			}
+		case "UNTIL":
+			if r.until, err = parseRRuleUntil(value, location); err != nil {
+				return nil, err
+			}
+		case "BYDAY":
+			r.byDay = map[time.Weekday][]int{}
+			for _, day := range strings.Split(strings.ToUpper(value), ",") {
+				if len(day) < 2 {
+					return nil, fmt.Errorf("invalid BYDAY %q", day)
+				}
+				weekday, ok := rruleWeekdays[day[len(day)-2:]]
+				ordinal := 0
+				if prefix := day[:len(day)-2]; prefix != "" {
+					if ordinal, err = strconv.Atoi(prefix); err != nil || ordinal == 0 || ordinal < -5 || ordinal > 5 {
+						ok = false
+					}
+				}
+				if !ok {
+					return nil, fmt.Errorf("invalid BYDAY %q", day)
+				}
+				r.byDay[weekday] = append(r.byDay[weekday], ordinal)
+			}
+		case "BYMONTHDAY":
+			if r.byMonthDay, err = parseRRuleInts("BYMONTHDAY", value, -31, 31); err != nil {
+				return nil, err
+			}
+		case "BYHOUR":
+			if r.byHour, err = parseRRuleInts("BYHOUR", value, 0, 23); err != nil {
+				return nil, err
+			}
+		case "BYMINUTE":
+			if r.byMinute, err = parseRRuleInts("BYMINUTE", value, 0, 59); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("%s is not supported", name)
+		}
+	}
+
+	switch r.freq {
+	case "DAILY", "WEEKLY", "MONTHLY":
+	case "":
+		return nil, fmt.Errorf("FREQ is required")
+	default:
+		return nil, fmt.Errorf("FREQ=%s is not supported, use DAILY, WEEKLY or MONTHLY", r.freq)
+	}
+	if r.count > 0 && !r.until.IsZero() {
+		return nil, fmt.Errorf("COUNT and UNTIL cannot both be set")
+	}
+	if r.byHour == nil {
+		r.byHour = []int{r.start.Hour()}
+	}
+	if r.byMinute == nil {
+		r.byMinute = []int{r.start.Minute()}
+	}
+	return r, nil
+}
+
+// Days between two dates, ignoring the time of day and daylight saving changes
+func daysBetween(from, to time.Time) int {
+	fromDate := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+	toDate := time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, time.UTC)
+	return int(toDate.Sub(fromDate).Hours() / 24)
+}
+
+func (r *recurrenceRule) weekdayMatches(day time.Time) bool {
+	ordinals, ok := r.byDay[day.Weekday()]
+	if !ok {
+		return false
+	}
+	daysInMonth := time.Date(day.Year(), day.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	for _, ordinal := range ordinals {
+		switch {
+		case ordinal == 0 || r.freq != "MONTHLY":
+			return true
+		case ordinal > 0 && (day.Day()-1)/7+1 == ordinal:
+			return true
+		case ordinal < 0 && (daysInMonth-day.Day())/7+1 == -ordinal:
+			return true
+		}
+	}
+	return false
+}
+
+func (r *recurrenceRule) monthDayMatches(day time.Time) bool {
+	daysInMonth := time.Date(day.Year(), day.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	for _, monthDay := range r.byMonthDay {
+		if monthDay == day.Day() || monthDay < 0 && daysInMonth+monthDay+1 == day.Day() {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *recurrenceRule) dayMatches(day time.Time) bool {
+	switch r.freq {
+	case "DAILY":
+		if daysBetween(r.start, day)%r.interval != 0 {
+			return false
+		}
+	case "WEEKLY":
+		// Weeks start on Monday
+		weekStart := r.start.AddDate(0, 0, -((int(r.start.Weekday()) + 6) % 7))
+		if daysBetween(weekStart, day)/7%r.interval != 0 {
+			return false
+		}
+		if r.byDay == nil {
+			return day.Weekday() == r.start.Weekday()
+		}
+	case "MONTHLY":
+		months := (day.Year()-r.start.Year())*12 + int(day.Month()) - int(r.start.Month())
+		if months%r.interval != 0 {
+			return false
+		}
+		if r.byDay == nil && r.byMonthDay == nil {
+			return day.Day() == r.start.Day()
+		}
+	}
+	if r.byDay != nil && !r.weekdayMatches(day) {
+		return false
+	}
+	if r.byMonthDay != nil && !r.monthDayMatches(day) {
+		return false
+	}
+	return true
+}
+
+// Whether a day matches only depends on its distance from the start, so the
+// walk starts on the day of after. Rules with COUNT are walked from the start
+// instead, to count the occurrences before after; COUNT bounds that walk.
+func (r *recurrenceRule) Next(after time.Time) (time.Time, bool) {
+	location := r.start.Location()
+	from := r.start
+	if r.count == 0 && after.After(from) {
+		from = after.In(location)
+	}
+	// Rules such as BYMONTHDAY=31 every other month may not match for a while
+	limit := after.AddDate(2*r.interval, 0, 0)
+	count := 0
+	for day := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, location); !day.After(limit); day = day.AddDate(0, 0, 1) {
+		if !r.dayMatches(day) {
+			continue
+		}
+		for _, hour := range r.byHour {
+			for _, minute := range r.byMinute {
+				t := wallClock(day, hour, minute)
+				if t.Before(r.start) {
+					continue
+				}
+				if !r.until.IsZero() && t.After(r.until) {
+					return time.Time{}, false
+				}
+				count++
+				if r.count > 0 && count > r.count {
+					return time.Time{}, false
+				}
+				if t.After(after) {
+					return t, true
+				}
+			}
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,78 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRRuleNext(t *testing.T) {
+	newYork := mustLocation(t, "America/New_York")
+	tests := []struct {
+		name     string
+		rule     string
+		start    string
+		location *time.Location
+		after    string
+		// Successive occurrences in RFC 3339, then none
+		want []string
+		more bool
+	}{
+		{"daily at the start time", "FREQ=DAILY", "2024-09-01 09:30", time.UTC, "2024-09-01 00:00", []string{"2024-09-01T09:30:00Z", "2024-09-02T09:30:00Z"}, true},
+		{"every other day", "RRULE:FREQ=DAILY;INTERVAL=2", "2024-09-01 09:00", time.UTC, "2024-09-02 00:00", []string{"2024-09-03T09:00:00Z", "2024-09-05T09:00:00Z"}, true},
+		{"weekdays at two times", "FREQ=WEEKLY;BYDAY=MO,WE;BYHOUR=9,17;BYMINUTE=30", "2024-09-01 00:00", time.UTC, "2024-09-01 00:00", []string{"2024-09-02T09:30:00Z", "2024-09-02T17:30:00Z", "2024-09-04T09:30:00Z"}, true},
+		{"every other week on the start day", "FREQ=WEEKLY;INTERVAL=2", "2024-09-03 10:00", time.UTC, "2024-09-03 10:00", []string{"2024-09-17T10:00:00Z", "2024-10-01T10:00:00Z"}, true},
+		{"last friday of the month", "FREQ=MONTHLY;BYDAY=-1FR;BYHOUR=18", "2024-09-01 00:00", time.UTC, "2024-09-01 00:00", []string{"2024-09-27T18:00:00Z", "2024-10-25T18:00:00Z"}, true},
+		{"second tuesday of the month", "FREQ=MONTHLY;BYDAY=2TU", "2024-09-01 12:00", time.UTC, "2024-09-01 00:00", []string{"2024-09-10T12:00:00Z", "2024-10-08T12:00:00Z"}, true},
+		{"last day of the month", "FREQ=MONTHLY;BYMONTHDAY=-1", "2024-01-31 08:00", time.UTC, "2024-01-31 08:00", []string{"2024-02-29T08:00:00Z", "2024-03-31T08:00:00Z"}, true},
+		{"31st every other month", "FREQ=MONTHLY;INTERVAL=2;BYMONTHDAY=31", "2024-02-01 08:00", time.UTC, "2024-02-01 00:00", []string{"2024-08-31T08:00:00Z", "2024-10-31T08:00:00Z", "2024-12-31T08:00:00Z", "2025-08-31T08:00:00Z"}, true},
+		{"count", "FREQ=DAILY;COUNT=3", "2024-09-01 09:00", time.UTC, "2024-09-01 00:00", []string{"2024-09-01T09:00:00Z", "2024-09-02T09:00:00Z", "2024-09-03T09:00:00Z"}, false},
+		{"count long after the start", "FREQ=WEEKLY;COUNT=2", "2020-01-06 09:00", time.UTC, "2024-09-01 00:00", nil, false},
+		{"count is counted from the start", "FREQ=DAILY;COUNT=5", "2024-09-01 09:00", time.UTC, "2024-09-03 12:00", []string{"2024-09-04T09:00:00Z", "2024-09-05T09:00:00Z"}, false},
+		{"until a date includes the day", "FREQ=DAILY;UNTIL=20240903", "2024-09-01 22:00", time.UTC, "2024-09-01 00:00", []string{"2024-09-01T22:00:00Z", "2024-09-02T22:00:00Z", "2024-09-03T22:00:00Z"}, false},
+		{"until a UTC time", "FREQ=DAILY;UNTIL=20240902T090000Z", "2024-09-01 09:00", time.UTC, "2024-09-01 00:00", []string{"2024-09-01T09:00:00Z", "2024-09-02T09:00:00Z"}, false},
+		{"years after the start", "FREQ=DAILY;BYHOUR=6", "2000-01-01 00:00", time.UTC, "2030-06-15 07:00", []string{"2030-06-16T06:00:00Z"}, true},
+		{"daily across the start of daylight saving", "FREQ=DAILY", "2024-03-08 09:00", newYork, "2024-03-09 09:00", []string{"2024-03-10T09:00:00-04:00", "2024-03-11T09:00:00-04:00"}, true},
+		{"daily across the end of daylight saving", "FREQ=DAILY", "2024-11-01 09:00", newYork, "2024-11-02 09:00", []string{"2024-11-03T09:00:00-05:00"}, true},
+		{"time skipped by daylight saving", "FREQ=DAILY;BYHOUR=2;BYMINUTE=30", "2024-03-08 00:00", newYork, "2024-03-09 03:00", []string{"2024-03-10T03:30:00-04:00", "2024-03-11T02:30:00-04:00"}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recurrence, err := ParseRRule(test.rule, localTime(t, test.start, test.location), test.location)
+			if err != nil {
+				t.Fatal(err)
+			}
+			after := localTime(t, test.after, test.location)
+			for _, want := range test.want {
+				next, ok := recurrence.Next(after)
+				if !ok || next.Format(time.RFC3339) != want {
+					t.Fatalf("Next(%s) = %s, %v, want %s", after.Format(time.RFC3339), next.Format(time.RFC3339), ok, want)
+				}
+				after = next
+			}
+			if _, ok := recurrence.Next(after); ok != test.more {
+				t.Errorf("Next(%s) found an occurrence: %v, want %v", after.Format(time.RFC3339), ok, test.more)
+			}
+		})
+	}
+}
+
+func TestParseRRuleInvalid(t *testing.T) {
+	for _, rule := range []string{
+		"",
+		"INTERVAL=2",
+		"FREQ=YEARLY",
+		"FREQ=DAILY;INTERVAL=0",
+		"FREQ=DAILY;COUNT=2;UNTIL=20240901",
+		"FREQ=DAILY;UNTIL=tomorrow",
+		"FREQ=WEEKLY;BYDAY=XX",
+		"FREQ=MONTHLY;BYDAY=6MO",
+		"FREQ=MONTHLY;BYMONTHDAY=0",
+		"FREQ=DAILY;BYHOUR=24",
+		"FREQ=DAILY;BYSECOND=1",
+		"FREQ",
+	} {
+		if _, err := ParseRRule(rule, time.Date(2024, 9, 1, 0, 0, 0, 0, time.UTC), time.UTC); err == nil {
+			t.Errorf("ParseRRule(%q) succeeded", rule)
+		}
+	}
+}
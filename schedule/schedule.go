@@ -0,0 +1,397 @@
+// Package schedule enables rooms for the windows of their schedules and disables
+// them in between, optionally ending the sessions still running at the end.
+package schedule
+
+import (
+	"api/helpers"
+	"api/hmserrors"
+	"api/store"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	StateEnabled  = "enabled"
+	StateDisabled = "disabled"
+)
+
+// Enable and disable windows of a room: a single one from Start to End, or one
+// of Duration at every occurrence of Cron or RRule
+type Schedule struct {
+	Id     string `json:"id"`
+	RoomId string `json:"room_id"`
+
+	Start *time.Time `json:"start,omitempty"`
+	End   *time.Time `json:"end,omitempty"`
+
+	Cron     string `json:"cron,omitempty"`
+	RRule    string `json:"rrule,omitempty"`
+	Duration string `json:"duration,omitempty"`
+	// IANA time zone recurring windows are evaluated in, UTC by default
+	Timezone string `json:"timezone,omitempty"`
+
+	// How long before a window the room is enabled, e.g. "10m"
+	EnableBefore string `json:"enable_before,omitempty"`
+	// End the active session of the room when a window ends
+	EndSessions bool   `json:"end_sessions"`
+	Lock        bool   `json:"lock"`
+	Reason      string `json:"reason,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+	// Whether the room was last enabled or disabled by the scheduler, and when
+	State     string     `json:"state,omitempty"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+	LastError string     `json:"last_error,omitempty"`
+}
+
+type Window struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// Parse the timing fields of the schedule, reporting each invalid one
+func (s *Schedule) check() []helpers.FieldError {
+	var fieldErrors []helpers.FieldError
+	invalid := func(field, message string) {
+		fieldErrors = append(fieldErrors, helpers.FieldError{Field: field, Message: message})
+	}
+
+	location, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		invalid("timezone", "must be an IANA time zone such as Europe/Berlin")
+	}
+	if s.EnableBefore != "" {
+		if before, err := time.ParseDuration(s.EnableBefore); err != nil || before < 0 {
+			invalid("enable_before", "must be a duration such as 10m")
+		}
+	}
+
+	switch {
+	case s.Cron != "" && s.RRule != "":
+		invalid("rrule", "cannot be set along with cron")
+	case s.Cron == "" && s.RRule == "":
+		if s.Start == nil {
+			invalid("start", "is required without cron or rrule")
+		}
+		if s.End == nil {
+			invalid("end", "is required without cron or rrule")
+		}
+		if s.Start != nil && s.End != nil && !s.End.After(*s.Start) {
+			invalid("end", "must be after start")
+		}
+		if s.Duration != "" {
+			invalid("duration", "is only used with cron or rrule")
+		}
+	default:
+		if duration, err := time.ParseDuration(s.Duration); err != nil || duration <= 0 {
+			invalid("duration", "must be a duration such as 1h30m")
+		}
+		if s.End != nil {
+			invalid("end", "is only used without cron or rrule, use duration or UNTIL")
+		}
+		if s.RRule != "" && s.Start == nil {
+			invalid("start", "is required with rrule, as its first occurrence")
+		}
+		if location != nil {
+			if _, err := s.recurrence(location); err != nil {
+				field := "cron"
+				if s.RRule != "" {
+					field = "rrule"
+				}
+				invalid(field, err.Error())
+			}
+		}
+	}
+	return fieldErrors
+}
+
+func (s *Schedule) recurrence(location *time.Location) (Recurrence, error) {
+	if s.Cron != "" {
+		return ParseCron(s.Cron, location)
+	}
+	return ParseRRule(s.RRule, *s.Start, location)
+}
+
+// The windows that end after the given time, earliest first
+func (s *Schedule) Windows(after time.Time, limit int) []Window {
+	if s.Cron == "" && s.RRule == "" {
+		if s.Start == nil || s.End == nil || !s.End.After(after) {
+			return []Window{}
+		}
+		return []Window{{Start: *s.Start, End: *s.End}}
+	}
+
+	location, _ := time.LoadLocation(s.Timezone)
+	recurrence, err := s.recurrence(location)
+	duration, _ := time.ParseDuration(s.Duration)
+	windows := []Window{}
+	if err != nil || duration <= 0 {
+		return windows
+	}
+	for t := after.Add(-duration); len(windows) < limit; {
+		start, ok := recurrence.Next(t)
+		if !ok {
+			break
+		}
+		windows = append(windows, Window{Start: start, End: start.Add(duration)})
+		t = start
+	}
+	return windows
+}
+
+// Whether the room should be enabled at the given time
+func (s *Schedule) enabledAt(now time.Time) bool {
+	before, _ := time.ParseDuration(s.EnableBefore)
+	windows := s.Windows(now, 1)
+	return len(windows) > 0 && !now.Before(windows[0].Start.Add(-before))
+}
+
+// Whether a room has a schedule with a window that ends after the given time,
+// so that it is expected to be used however long it has been idle
+func Scheduled(roomId string, now time.Time) bool {
+	for _, schedule := range schedules().list(roomId) {
+		if len(schedule.Windows(now, 1)) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+type scheduleStore struct {
+	mu        sync.Mutex
+	document  *store.Document
+	Schedules map[string]*Schedule `json:"schedules"`
+	// Wakes the scheduler up when a schedule is added
+	changed chan struct{}
+}
+
+// Loaded on first use from SCHEDULES_FILE in DATA_DIR
+var schedules = sync.OnceValue(func() *scheduleStore {
+	name, ok := helpers.GetEnvironmentVariable("SCHEDULES_FILE")
+	if !ok || name == "" {
+		name = "schedules.json"
+	}
+	s := &scheduleStore{
+		document:  store.Open(name),
+		Schedules: map[string]*Schedule{},
+		changed:   make(chan struct{}, 1),
+	}
+	if err := s.document.Load(s); err != nil {
+		log.Printf("schedules: %s: %v", s.document.Path(), err)
+	}
+	if s.Schedules == nil {
+		s.Schedules = map[string]*Schedule{}
+	}
+	return s
+})
+
+// Save the schedules; the caller holds the lock
+func (s *scheduleStore) save() {
+	if err := s.document.Save(s); err != nil {
+		log.Printf("schedules: %s: %v", s.document.Path(), err)
+	}
+}
+
+// Copies of the schedules of a room, or of every room when roomId is empty, oldest first
+func (s *scheduleStore) list(roomId string) []Schedule {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := []Schedule{}
+	for _, schedule := range s.Schedules {
+		if roomId == "" || schedule.RoomId == roomId {
+			list = append(list, *schedule)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.Before(list[j].CreatedAt)
+	})
+	return list
+}
+
+func (s *scheduleStore) get(id string) (Schedule, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	schedule, ok := s.Schedules[id]
+	if !ok {
+		return Schedule{}, false
+	}
+	return *schedule, true
+}
+
+func (s *scheduleStore) add(schedule *Schedule) {
+	s.mu.Lock()
+	s.Schedules[schedule.Id] = schedule
+	s.save()
+	s.mu.Unlock()
+
+	select {
+	case s.changed <- struct{}{}:
+	default:
+	}
+}
+
+func (s *scheduleStore) delete(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.Schedules[id]; !ok {
+		return false
+	}
+	delete(s.Schedules, id)
+	s.save()
+	return true
+}
+
+// Record the outcome of enabling or disabling the room of the given schedules
+func (s *scheduleStore) applied(ids []string, state string, now time.Time, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range ids {
+		schedule, ok := s.Schedules[id]
+		if !ok {
+			continue
+		}
+		if err != nil {
+			schedule.LastError = fmt.Sprintf("%s at %s: %v", state, now.Format(time.RFC3339), err)
+			continue
+		}
+		schedule.State = state
+		schedule.UpdatedAt = &now
+		schedule.LastError = ""
+	}
+	s.save()
+}
+
+type ScheduleBody struct {
+	Start        *time.Time `json:"start,omitempty"`
+	End          *time.Time `json:"end,omitempty"`
+	Cron         string     `json:"cron,omitempty"`
+	RRule        string     `json:"rrule,omitempty"`
+	Duration     string     `json:"duration,omitempty"`
+	Timezone     string     `json:"timezone,omitempty"`
+	EnableBefore string     `json:"enable_before,omitempty"`
+	EndSessions  bool       `json:"end_sessions,omitempty"`
+	Lock         bool       `json:"lock,omitempty"`
+	Reason       string     `json:"reason,omitempty"`
+}
+
+type ScheduleQueryParam struct {
+	RoomId string `form:"room_id"`
+}
+
+// A schedule with whether its room should be enabled now and its next windows
+type ScheduleView struct {
+	Schedule
+	Active  bool     `json:"active"`
+	Windows []Window `json:"windows"`
+}
+
+func view(schedule Schedule) ScheduleView {
+	now := time.Now()
+	return ScheduleView{Schedule: schedule, Active: schedule.enabledAt(now), Windows: schedule.Windows(now, 5)}
+}
+
+func views(list []Schedule) []ScheduleView {
+	result := make([]ScheduleView, 0, len(list))
+	for _, schedule := range list {
+		result = append(result, view(schedule))
+	}
+	return result
+}
+
+func roomSchedule(ctx *gin.Context) (Schedule, bool) {
+	roomId, ok := ctx.Params.Get("roomId")
+	scheduleId, ok1 := ctx.Params.Get("scheduleId")
+	if !ok || !ok1 {
+		ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": hmserrors.ErrMissingRoomIdAndScheduleId.Error()})
+		return Schedule{}, false
+	}
+	schedule, ok := schedules().get(scheduleId)
+	if !ok || schedule.RoomId != roomId {
+		ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": hmserrors.ErrScheduleNotFound.Error()})
+		return Schedule{}, false
+	}
+	return schedule, true
+}
+
+// List the schedules of every room, or of the room in room_id
+func ListSchedules(ctx *gin.Context) {
+	var param ScheduleQueryParam
+	if err := ctx.ShouldBindQuery(&param); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"data": views(schedules().list(param.RoomId))})
+}
+
+// List the schedules of a room
+func ListRoomSchedules(ctx *gin.Context) {
+	roomId, ok := ctx.Params.Get("roomId")
+	if !ok {
+		ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": hmserrors.ErrMissingRoomId})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"data": views(schedules().list(roomId))})
+}
+
+// Schedule windows for a room to be enabled in. The room is disabled outside of them.
+func CreateRoomSchedule(ctx *gin.Context) {
+	roomId, ok := ctx.Params.Get("roomId")
+	if !ok {
+		ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": hmserrors.ErrMissingRoomId})
+		return
+	}
+
+	var rb ScheduleBody
+	if !helpers.BindJSON(ctx, &rb) {
+		return
+	}
+	schedule := &Schedule{
+		Id:           uuid.New().String(),
+		RoomId:       roomId,
+		Start:        rb.Start,
+		End:          rb.End,
+		Cron:         rb.Cron,
+		RRule:        rb.RRule,
+		Duration:     rb.Duration,
+		Timezone:     rb.Timezone,
+		EnableBefore: rb.EnableBefore,
+		EndSessions:  rb.EndSessions,
+		Lock:         rb.Lock,
+		Reason:       rb.Reason,
+		CreatedAt:    time.Now().UTC(),
+	}
+	if fieldErrors := schedule.check(); len(fieldErrors) > 0 {
+		helpers.AbortWithFieldErrors(ctx, fieldErrors)
+		return
+	}
+
+	schedules().add(schedule)
+	ctx.JSON(http.StatusCreated, view(*schedule))
+}
+
+// Get a schedule of a room with its next windows
+func GetRoomSchedule(ctx *gin.Context) {
+	schedule, ok := roomSchedule(ctx)
+	if !ok {
+		return
+	}
+	ctx.JSON(http.StatusOK, view(schedule))
+}
+
+// Delete a schedule. The room is left as it is.
+func DeleteRoomSchedule(ctx *gin.Context) {
+	schedule, ok := roomSchedule(ctx)
+	if !ok {
+		return
+	}
+	schedules().delete(schedule.Id)
+	ctx.Status(http.StatusNoContent)
+}
@@ -0,0 +1,97 @@
+package schedule
+
+import (
+	"api/helpers"
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// Enable or disable a room, ending its active session first when asked to
+func setRoomEnabled(ctx context.Context, roomId string, enabled, endSessions, lock bool, reason string) error {
+	if !enabled && endSessions {
+		body := map[string]interface{}{"lock": lock, "reason": reason}
+		err := helpers.CallApi(ctx, "POST", helpers.GetEndpointUrl("active-rooms/"+roomId+"/end-room"), body, nil)
+		// Rooms without an active session are not found
+		var apiError *helpers.ApiError
+		if err != nil && !(errors.As(err, &apiError) && apiError.StatusCode == http.StatusNotFound) {
+			return err
+		}
+	}
+	return helpers.CallApi(ctx, "POST", helpers.GetEndpointUrl("rooms/"+roomId), map[string]bool{"enabled": enabled}, nil)
+}
+
+// Bring every room with a schedule into the state its schedules call for. A room
+// is enabled while any of its windows is open. Rooms are only changed when that
+// state changes, so they can still be enabled or disabled by hand in between.
+func (s *scheduleStore) tick(ctx context.Context, now time.Time, changed func(roomId string)) {
+	rooms := map[string][]Schedule{}
+	for _, schedule := range s.list("") {
+		rooms[schedule.RoomId] = append(rooms[schedule.RoomId], schedule)
+	}
+	roomIds := make([]string, 0, len(rooms))
+	for roomId := range rooms {
+		roomIds = append(roomIds, roomId)
+	}
+	sort.Strings(roomIds)
+
+	for _, roomId := range roomIds {
+		enabled := false
+		for _, schedule := range rooms[roomId] {
+			enabled = enabled || schedule.enabledAt(now)
+		}
+		state := StateDisabled
+		if enabled {
+			state = StateEnabled
+		}
+
+		var ids []string
+		endSessions, lock, reason := false, false, ""
+		for _, schedule := range rooms[roomId] {
+			if schedule.State == state {
+				continue
+			}
+			ids = append(ids, schedule.Id)
+			endSessions = endSessions || schedule.EndSessions
+			lock = lock || schedule.Lock
+			if reason == "" {
+				reason = schedule.Reason
+			}
+		}
+		if len(ids) == 0 {
+			continue
+		}
+
+		err := setRoomEnabled(ctx, roomId, enabled, endSessions, lock, reason)
+		if err != nil {
+			log.Printf("schedules: could not set room %s %s: %v", roomId, state, err)
+		} else {
+			log.Printf("schedules: room %s %s", roomId, state)
+			if changed != nil {
+				changed(roomId)
+			}
+		}
+		s.applied(ids, state, now, err)
+	}
+}
+
+// Check the schedules every interval until the context is done, and right away
+// when one is added. Changed is called with the id of every room the scheduler
+// enables or disables, e.g. to purge cached responses.
+func Run(ctx context.Context, interval time.Duration, changed func(roomId string)) {
+	s := schedules()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		s.tick(ctx, time.Now(), changed)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.changed:
+		}
+	}
+}
@@ -10,7 +10,9 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-var sessionsBaseUrl = helpers.GetEndpointUrl("sessions")
+func sessionsBaseUrl() string {
+	return helpers.GetEndpointUrl("sessions")
+}
 
 type HMSSessionQueryParam struct {
 	RoomId string `form:"room_id,omitempty"`
@@ -26,7 +28,7 @@ func GetSession(ctx *gin.Context) {
 		ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": hmserrors.ErrMissingSessionId})
 	}
 
-	helpers.MakeApiRequest(ctx, sessionsBaseUrl+"/"+sessionId, "GET", nil)
+	helpers.MakeApiRequest(ctx, sessionsBaseUrl()+"/"+sessionId, "GET", nil)
 }
 
 // List all sessions
@@ -44,5 +46,28 @@ func ListSessions(ctx *gin.Context) {
 		qs.Add("after", param.After)
 	}
 
-	helpers.MakeApiRequest(ctx, sessionsBaseUrl+"?"+qs.Encode(), "GET", nil)
+	helpers.MakeApiRequest(ctx, sessionsBaseUrl()+"?"+qs.Encode(), "GET", nil)
+}
+
+// Export all sessions as NDJSON or CSV
+// Applicable filters: room_id string, active *bool, after string, before string, format string, columns string
+func ExportSessions(ctx *gin.Context) {
+	var param HMSSessionQueryParam
+
+	qs := url.Values{}
+	if ctx.BindQuery(&param) == nil {
+		qs.Add("room_id", param.RoomId)
+		if param.Active != nil {
+			qs.Add("active", strconv.FormatBool(*param.Active))
+		}
+		qs.Add("before", param.Before)
+		qs.Add("after", param.After)
+	}
+
+	helpers.ExportApiPages(ctx, sessionsBaseUrl(), qs, helpers.ExportOptions{
+		ItemsKey:  "data",
+		CursorKey: "last",
+		TimeField: "created_at",
+		Columns:   []string{"id", "room_id", "customer_id", "active", "created_at", "updated_at"},
+	})
 }
@@ -0,0 +1,118 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"api/helpers"
+)
+
+// A log of JSON records on disk, one per line, that records are appended to.
+// Once the file holds kept records it is renamed with a ".1" suffix, replacing
+// the previous one, so between kept and twice kept records stay on disk.
+type Log struct {
+	mu   sync.Mutex
+	path string
+	kept int
+	// Records in the file, counted on the first append
+	count   int
+	counted bool
+	// Whether the file ends in a line cut short, e.g. by a crash while appending
+	torn bool
+}
+
+// Open the log with the given file name in DATA_DIR. The file is created on the first append.
+func OpenLog(name string, kept int) *Log {
+	dir, ok := helpers.GetEnvironmentVariable("DATA_DIR")
+	if !ok || dir == "" {
+		dir = "data"
+	}
+	if kept < 1 {
+		kept = 1
+	}
+	return &Log{path: filepath.Join(dir, name), kept: kept}
+}
+
+func (l *Log) Path() string {
+	return l.path
+}
+
+// Append v as a line, rotating the file once it holds kept records
+func (l *Log) Append(v interface{}) error {
+	line, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.counted {
+		data, err := os.ReadFile(l.path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		l.count = bytes.Count(data, []byte("\n"))
+		l.torn = len(data) > 0 && data[len(data)-1] != '\n'
+		l.counted = true
+	}
+	if l.count >= l.kept {
+		if err := os.Rename(l.path, l.path+".1"); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		l.count, l.torn = 0, false
+	}
+
+	if err := os.MkdirAll(filepath.Dir(l.path), 0o700); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(l.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	if l.torn {
+		line = append([]byte("\n"), line...)
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	l.count++
+	l.torn = false
+	return file.Close()
+}
+
+// Read the records of the log, oldest first. Lines cut short are left out.
+func (l *Log) Records() ([]json.RawMessage, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var records []json.RawMessage
+	for _, path := range []string{l.path + ".1", l.path} {
+		file, err := os.Open(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(nil, 1<<20)
+		for scanner.Scan() {
+			if line := scanner.Bytes(); json.Valid(line) {
+				records = append(records, append(json.RawMessage(nil), line...))
+			}
+		}
+		err = scanner.Err()
+		file.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return records, nil
+}
@@ -0,0 +1,77 @@
+// Package store keeps the local state of the service, such as template history,
+// in JSON documents under DATA_DIR (default "data").
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"api/helpers"
+)
+
+// A JSON document on disk, rewritten as a whole on every save
+type Document struct {
+	mu   sync.Mutex
+	path string
+}
+
+// Open the document with the given file name in DATA_DIR. The file is created on the first save.
+func Open(name string) *Document {
+	dir, ok := helpers.GetEnvironmentVariable("DATA_DIR")
+	if !ok || dir == "" {
+		dir = "data"
+	}
+	return &Document{path: filepath.Join(dir, name)}
+}
+
+func (d *Document) Path() string {
+	return d.path
+}
+
+// Decode the document into v, leaving v untouched when it was never saved
+func (d *Document) Load(v interface{}) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	data, err := os.ReadFile(d.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// Replace the document with v. The file is written next to the document and
+// renamed over it, so a crash never leaves a partially written document.
+func (d *Document) Save(v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(d.path), 0o700); err != nil {
+		return err
+	}
+	temp, err := os.CreateTemp(filepath.Dir(d.path), filepath.Base(d.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+
+	if _, err := temp.Write(data); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), d.path)
+}
@@ -8,7 +8,9 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-var streamKeysBaseUrl = helpers.GetEndpointUrl("stream-keys")
+func streamKeysBaseUrl() string {
+	return helpers.GetEndpointUrl("stream-keys")
+}
 
 // Get stream key
 func GetStreamKey(ctx *gin.Context) {
@@ -16,7 +18,7 @@ func GetStreamKey(ctx *gin.Context) {
 	if !ok {
 		ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": hmserrors.ErrMissingRoomId})
 	}
-	helpers.MakeApiRequest(ctx, streamKeysBaseUrl+"/"+roomId, "GET", nil)
+	helpers.MakeApiRequest(ctx, streamKeysBaseUrl()+"/"+roomId, "GET", nil)
 }
 
 // Create stream key
@@ -25,7 +27,7 @@ func CreateStreamKey(ctx *gin.Context) {
 	if !ok {
 		ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": hmserrors.ErrMissingRoomId})
 	}
-	helpers.MakeApiRequest(ctx, streamKeysBaseUrl+"/"+roomId, "POST", nil)
+	helpers.MakeApiRequest(ctx, streamKeysBaseUrl()+"/"+roomId, "POST", nil)
 }
 
 // Disable stream key
@@ -34,5 +36,5 @@ func DisableStreamKey(ctx *gin.Context) {
 	if !ok {
 		ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": hmserrors.ErrMissingRoomId})
 	}
-	helpers.MakeApiRequest(ctx, streamKeysBaseUrl+"/"+roomId+"/disable", "POST", nil)
+	helpers.MakeApiRequest(ctx, streamKeysBaseUrl()+"/"+roomId+"/disable", "POST", nil)
 }
@@ -18,24 +18,18 @@ type RequestBody struct {
 	ExpiresIn int    `json:"expiresIn,omitempty"`
 }
 
-func CreateToken(ctx *gin.Context) {
-
+// Sign an auth token for a client SDK to join a room
+func GenerateAuthToken(rb RequestBody) (string, error) {
 	appAccessKey, ok := helpers.GetEnvironmentVariable("APP_ACCESS_KEY")
 	if !ok {
-		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": hmserrors.ErrMissingAppAccessKey})
+		return "", hmserrors.ErrMissingAppAccessKey
 	}
 	appSecret, ok := helpers.GetEnvironmentVariable("APP_SECRET")
 	if !ok {
-		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": hmserrors.ErrMissingAppSecretKey})
+		return "", hmserrors.ErrMissingAppSecretKey
 	}
 
-	var rb RequestBody
 	var expiresIn uint32
-
-	if err := ctx.ShouldBind(&rb); err != nil {
-		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-	}
-
 	if rb.ExpiresIn == 0 {
 		expiresIn = uint32(24 * 3600)
 	} else {
@@ -59,10 +53,23 @@ func CreateToken(ctx *gin.Context) {
 	})
 
 	// Sign and get the complete encoded token as a string using the secret
-	signedToken, err := token.SignedString(mySigningKey)
+	return token.SignedString(mySigningKey)
+}
+
+func CreateToken(ctx *gin.Context) {
+
+	var rb RequestBody
+
+	if err := ctx.ShouldBind(&rb); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	signedToken, err := GenerateAuthToken(rb)
 
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
 
 	ctx.JSON(http.StatusCreated, gin.H{"token": signedToken})
@@ -0,0 +1,265 @@
+// Package vault keeps cloud storage credentials encrypted at rest, so that
+// request bodies can reference them by name with credentials_ref instead of
+// carrying the secrets. They are filled in only when a request is forwarded to 100ms.
+package vault
+
+import (
+	"api/helpers"
+	"api/hmserrors"
+	"api/store"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Credentials of a cloud storage bucket, as stored in the vault
+type Credentials struct {
+	Key    string `json:"key" binding:"required"`
+	Secret string `json:"secret" binding:"required"`
+}
+
+// What the vault tells about stored credentials, which is never the secrets
+type Entry struct {
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type sealedCredentials struct {
+	Nonce      []byte    `json:"nonce"`
+	Ciphertext []byte    `json:"ciphertext"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+type vaultStore struct {
+	mu       sync.Mutex
+	document *store.Document
+	Secrets  map[string]*sealedCredentials `json:"secrets"`
+}
+
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// Loaded on first use from VAULT_FILE in DATA_DIR
+var vault = sync.OnceValue(func() *vaultStore {
+	name, ok := helpers.GetEnvironmentVariable("VAULT_FILE")
+	if !ok || name == "" {
+		name = "vault.json"
+	}
+	v := &vaultStore{document: store.Open(name), Secrets: map[string]*sealedCredentials{}}
+	if err := v.document.Load(v); err != nil {
+		log.Printf("vault: %s: %v", v.document.Path(), err)
+	}
+	if v.Secrets == nil {
+		v.Secrets = map[string]*sealedCredentials{}
+	}
+	return v
+})
+
+// AES-256-GCM with the base64 encoded 32 byte key in VAULT_MASTER_KEY, read on first use
+var masterKey = sync.OnceValues(loadMasterKey)
+
+func loadMasterKey() (cipher.AEAD, error) {
+	encoded, ok := helpers.GetEnvironmentVariable("VAULT_MASTER_KEY")
+	if !ok || encoded == "" {
+		return nil, hmserrors.ErrVaultMasterKeyMissing
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(key) != 32 {
+		return nil, hmserrors.ErrVaultMasterKeyInvalid
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Encrypt and store credentials under a name, replacing those stored before
+func Put(name string, credentials Credentials) (Entry, error) {
+	aead, err := masterKey()
+	if err != nil {
+		return Entry{}, err
+	}
+	plaintext, _ := json.Marshal(credentials)
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return Entry{}, err
+	}
+	// The name is authenticated, so sealed credentials cannot be moved to another name
+	ciphertext := aead.Seal(nil, nonce, plaintext, []byte(name))
+
+	v := vault()
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	now := time.Now().UTC()
+	sealed := &sealedCredentials{Nonce: nonce, Ciphertext: ciphertext, CreatedAt: now, UpdatedAt: now}
+	if existing, ok := v.Secrets[name]; ok {
+		sealed.CreatedAt = existing.CreatedAt
+	}
+	v.Secrets[name] = sealed
+	if err := v.document.Save(v); err != nil {
+		return Entry{}, err
+	}
+	return Entry{Name: name, CreatedAt: sealed.CreatedAt, UpdatedAt: sealed.UpdatedAt}, nil
+}
+
+// Decrypt the credentials stored under a name
+func Get(name string) (*Credentials, error) {
+	v := vault()
+	v.mu.Lock()
+	sealed, ok := v.Secrets[name]
+	v.mu.Unlock()
+	if !ok {
+		return nil, hmserrors.ErrCredentialsNotFound
+	}
+
+	aead, err := masterKey()
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := aead.Open(nil, sealed.Nonce, sealed.Ciphertext, []byte(name))
+	if err != nil {
+		// Sealed with another master key, or tampered with
+		return nil, hmserrors.ErrCredentialsUnreadable
+	}
+	var credentials Credentials
+	if err := json.Unmarshal(plaintext, &credentials); err != nil {
+		return nil, err
+	}
+	return &credentials, nil
+}
+
+func remove(name string) (bool, error) {
+	v := vault()
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if _, ok := v.Secrets[name]; !ok {
+		return false, nil
+	}
+	delete(v.Secrets, name)
+	return true, v.document.Save(v)
+}
+
+func entries() []Entry {
+	v := vault()
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	list := make([]Entry, 0, len(v.Secrets))
+	for name, sealed := range v.Secrets {
+		list = append(list, Entry{Name: name, CreatedAt: sealed.CreatedAt, UpdatedAt: sealed.UpdatedAt})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+// Name of the secret field of credentials, by the object holding them:
+// the upload of template settings or the upload_info of a room
+func secretField(parent string) string {
+	if parent == "upload" {
+		return "secretKey"
+	}
+	return "secret"
+}
+
+// Replace credentials_ref in the objects of a JSON value with the credentials it names
+func inject(parent string, value interface{}) error {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		if ref, ok := value["credentials_ref"]; ok {
+			if _, ok := value["credentials"]; ok {
+				return hmserrors.ErrCredentialsAndRef
+			}
+			name, _ := ref.(string)
+			credentials, err := Get(name)
+			if err != nil {
+				return err
+			}
+			delete(value, "credentials_ref")
+			value["credentials"] = map[string]string{"key": credentials.Key, secretField(parent): credentials.Secret}
+		}
+		for key, child := range value {
+			if err := inject(key, child); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, child := range value {
+			if err := inject(parent, child); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Fill in the credentials referenced by a request body on its way to 100ms.
+// Set as helpers.RequestBodyRewriter at startup.
+func InjectCredentials(body []byte) ([]byte, error) {
+	if !bytes.Contains(body, []byte(`"credentials_ref"`)) {
+		return body, nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		// Not JSON, so there is nothing to fill in
+		return body, nil
+	}
+	if err := inject("", value); err != nil {
+		return nil, err
+	}
+	return json.Marshal(value)
+}
+
+// List the names of the stored credentials
+func ListCredentials(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, gin.H{"data": entries()})
+}
+
+// Store credentials under a name, to be referenced with credentials_ref
+func PutCredentials(ctx *gin.Context) {
+	name := ctx.Param("name")
+	if !namePattern.MatchString(name) {
+		ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": hmserrors.ErrInvalidCredentialsName.Error()})
+		return
+	}
+	var rb Credentials
+	if !helpers.BindJSON(ctx, &rb) {
+		return
+	}
+
+	entry, err := Put(name, rb)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, entry)
+}
+
+// Delete stored credentials. Requests referencing them fail from then on.
+func DeleteCredentials(ctx *gin.Context) {
+	found, err := remove(ctx.Param("name"))
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !found {
+		ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": hmserrors.ErrCredentialsNotFound.Error()})
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
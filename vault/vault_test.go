@@ -0,0 +1,188 @@
+package vault
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"api/hmserrors"
+	"api/store"
+)
+
+var (
+	testKey  = base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef"))
+	otherKey = base64.StdEncoding.EncodeToString([]byte("fedcba9876543210fedcba9876543210"))
+)
+
+// An empty vault in a temporary DATA_DIR, sealed with the given master key
+func useVault(t *testing.T, key string) {
+	t.Helper()
+	t.Setenv("DATA_DIR", t.TempDir())
+	useMasterKey(t, key)
+	v := vault()
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.document = store.Open("vault.json")
+	v.Secrets = map[string]*sealedCredentials{}
+}
+
+// Read VAULT_MASTER_KEY again, as a restart with another key would
+func useMasterKey(t *testing.T, key string) {
+	t.Helper()
+	t.Setenv("VAULT_MASTER_KEY", key)
+	masterKey = sync.OnceValues(loadMasterKey)
+}
+
+func TestPutGet(t *testing.T) {
+	useVault(t, testKey)
+	first, err := Put("s3-prod", Credentials{Key: "AKIA1", Secret: "first-secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	updated, err := Put("s3-prod", Credentials{Key: "AKIA2", Secret: "second-secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !updated.CreatedAt.Equal(first.CreatedAt) {
+		t.Errorf("created at %v after an update, want %v", updated.CreatedAt, first.CreatedAt)
+	}
+
+	credentials, err := Get("s3-prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *credentials != (Credentials{Key: "AKIA2", Secret: "second-secret"}) {
+		t.Errorf("got %+v, want the updated credentials", credentials)
+	}
+	data, err := os.ReadFile(vault().document.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "AKIA2") || strings.Contains(string(data), "second-secret") {
+		t.Errorf("credentials stored in the clear: %s", data)
+	}
+	if list := entries(); len(list) != 1 || list[0].Name != "s3-prod" {
+		t.Errorf("entries %+v, want s3-prod", list)
+	}
+
+	if _, err := Get("gcs"); !errors.Is(err, hmserrors.ErrCredentialsNotFound) {
+		t.Errorf("got error %v for missing credentials, want %v", err, hmserrors.ErrCredentialsNotFound)
+	}
+}
+
+func TestGetTampered(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(t *testing.T)
+	}{
+		{"other master key", func(t *testing.T) {
+			useMasterKey(t, otherKey)
+		}},
+		{"moved to another name", func(t *testing.T) {
+			v := vault()
+			v.Secrets["s3-prod"] = v.Secrets["s3-staging"]
+		}},
+		{"changed ciphertext", func(t *testing.T) {
+			vault().Secrets["s3-prod"].Ciphertext[0] ^= 1
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useVault(t, testKey)
+			for _, name := range []string{"s3-prod", "s3-staging"} {
+				if _, err := Put(name, Credentials{Key: "AKIA", Secret: name + "-secret"}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			test.tamper(t)
+			if _, err := Get("s3-prod"); !errors.Is(err, hmserrors.ErrCredentialsUnreadable) {
+				t.Errorf("got error %v, want %v", err, hmserrors.ErrCredentialsUnreadable)
+			}
+		})
+	}
+}
+
+func TestMasterKey(t *testing.T) {
+	tests := []struct {
+		name, key string
+		err       error
+	}{
+		{"missing", "", hmserrors.ErrVaultMasterKeyMissing},
+		{"not base64", "not base64!", hmserrors.ErrVaultMasterKeyInvalid},
+		{"too short", base64.StdEncoding.EncodeToString([]byte("0123456789abcdef")), hmserrors.ErrVaultMasterKeyInvalid},
+		{"valid", testKey, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useVault(t, test.key)
+			if _, err := Put("s3-prod", Credentials{Key: "AKIA", Secret: "secret"}); !errors.Is(err, test.err) {
+				t.Errorf("got error %v, want %v", err, test.err)
+			}
+			if test.err != nil && len(entries()) != 0 {
+				t.Errorf("stored credentials without a master key: %+v", entries())
+			}
+		})
+	}
+}
+
+func TestInjectCredentials(t *testing.T) {
+	tests := []struct {
+		name, body, want string
+		err              error
+	}{
+		{
+			"room upload_info",
+			`{"name": "r", "recording_info": {"enabled": true, "upload_info": {"type": "s3", "location": "b", "credentials_ref": "s3-prod"}}}`,
+			`{"name": "r", "recording_info": {"enabled": true, "upload_info": {"type": "s3", "location": "b", "credentials": {"key": "AKIA", "secret": "s3cret"}}}}`,
+			nil,
+		},
+		{
+			"template upload",
+			`{"settings": {"recording": {"upload": {"type": "s3", "location": "b", "credentials_ref": "s3-prod"}}}}`,
+			`{"settings": {"recording": {"upload": {"type": "s3", "location": "b", "credentials": {"key": "AKIA", "secretKey": "s3cret"}}}}}`,
+			nil,
+		},
+		{
+			"rooms in a list",
+			`[{"upload_info": {"credentials_ref": "s3-prod"}}, {"upload_info": {"type": "gs"}}]`,
+			`[{"upload_info": {"credentials": {"key": "AKIA", "secret": "s3cret"}}}, {"upload_info": {"type": "gs"}}]`,
+			nil,
+		},
+		{"no reference", `{"size": 12345678901234567890}`, `{"size": 12345678901234567890}`, nil},
+		{"credentials and a reference", `{"upload_info": {"credentials": {}, "credentials_ref": "s3-prod"}}`, "", hmserrors.ErrCredentialsAndRef},
+		{"missing credentials", `{"upload_info": {"credentials_ref": "gcs"}}`, "", hmserrors.ErrCredentialsNotFound},
+	}
+	useVault(t, testKey)
+	if _, err := Put("s3-prod", Credentials{Key: "AKIA", Secret: "s3cret"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := InjectCredentials([]byte(test.body))
+			if !errors.Is(err, test.err) {
+				t.Fatalf("got error %v, want %v", err, test.err)
+			}
+			if test.err != nil {
+				return
+			}
+			var gotValue, wantValue interface{}
+			decode := func(data []byte, v *interface{}) {
+				decoder := json.NewDecoder(strings.NewReader(string(data)))
+				decoder.UseNumber()
+				if err := decoder.Decode(v); err != nil {
+					t.Fatalf("%s: %v", data, err)
+				}
+			}
+			decode(got, &gotValue)
+			decode([]byte(test.want), &wantValue)
+			if !reflect.DeepEqual(gotValue, wantValue) {
+				t.Errorf("got %s, want %s", got, test.want)
+			}
+		})
+	}
+}